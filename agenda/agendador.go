@@ -0,0 +1,316 @@
+package agenda
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"sped-efinanceira/eventos"
+	"sped-efinanceira/middlewares"
+	"sped-efinanceira/models"
+	"sped-efinanceira/repositories"
+	"sped-efinanceira/semestre"
+)
+
+const intervaloAgenda = time.Minute
+
+// Ordem fixa das etapas: cada uma depende do resultado das anteriores
+var ordemEtapas = []string{
+	models.EtapaImportacao,
+	models.EtapaAbertura,
+	models.EtapaMovimentos,
+	models.EtapaFechamento,
+	models.EtapaValidacao,
+	models.EtapaTransmissao,
+}
+
+// ErroEmExecucao indica que o agendamento já está rodando neste servidor
+var ErroEmExecucao = errors.New("o agendamento já está em execução")
+
+// Agendador roda as etapas do semestre dos agendamentos ativos quando chega
+// o horário previsto pela expressão de cada um
+type Agendador struct {
+	repos           *semestre.Repositorios
+	agendamentoRepo *repositories.AgendamentoRepositorio
+
+	mu          sync.Mutex
+	emAndamento map[primitive.ObjectID]bool
+}
+
+func NovoAgendador(agendamentoRepo *repositories.AgendamentoRepositorio, repos *semestre.Repositorios) *Agendador {
+	return &Agendador{
+		repos:           repos,
+		agendamentoRepo: agendamentoRepo,
+		emAndamento:     make(map[primitive.ObjectID]bool),
+	}
+}
+
+// NormalizarEtapas confere as etapas informadas e as coloca na ordem de
+// execução. Sem etapas, o agendamento roda todas.
+func NormalizarEtapas(etapas []string) ([]string, error) {
+	informadas := make(map[string]bool)
+	for _, etapa := range etapas {
+		informadas[strings.ToLower(strings.TrimSpace(etapa))] = true
+	}
+
+	var normalizadas []string
+	for _, etapa := range ordemEtapas {
+		if len(etapas) == 0 || informadas[etapa] {
+			normalizadas = append(normalizadas, etapa)
+			delete(informadas, etapa)
+		}
+	}
+	for etapa := range informadas {
+		return nil, fmt.Errorf("etapa '%s' inválida; use %s", etapa, strings.Join(ordemEtapas, ", "))
+	}
+
+	return normalizadas, nil
+}
+
+// PeriodoDaExecucao é o período fixo do agendamento ou, sem ele, o último
+// semestre encerrado na data da execução
+func PeriodoDaExecucao(agendamento *models.Agendamento, data time.Time) string {
+	if agendamento.Periodo != "" {
+		return agendamento.Periodo
+	}
+	periodo, _ := eventos.PeriodoAnterior(eventos.PeriodoDe(data))
+	return periodo
+}
+
+// Iniciar verifica os agendamentos vencidos a cada minuto; deve rodar em uma
+// goroutine
+func (a *Agendador) Iniciar() {
+	log.Printf("🗓️ Agenda do semestre verificada a cada %s", intervaloAgenda)
+
+	ticker := time.NewTicker(intervaloAgenda)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		a.Verificar(time.Now())
+	}
+}
+
+// Verificar executa os agendamentos vencidos. O horário é reservado antes
+// da execução para que outra instância do servidor não rode o mesmo
+// agendamento.
+func (a *Agendador) Verificar(agora time.Time) {
+	vencidos, err := a.agendamentoRepo.ListarAgendamentosVencidos(agora)
+	if err != nil {
+		log.Println("Erro ao listar agendamentos vencidos:", err)
+		return
+	}
+
+	for _, agendamento := range vencidos {
+		proxima, err := ProximaExecucao(agendamento.Expressao, agora)
+		if err != nil {
+			log.Printf("Agendamento %s com expressão inválida: %v", agendamento.ID.Hex(), err)
+			continue
+		}
+
+		reservado, err := a.agendamentoRepo.ReservarExecucao(agendamento.ID, *agendamento.ProximaExecucao, proxima)
+		if err != nil || !reservado {
+			continue
+		}
+
+		execucao, err := a.Preparar(agendamento, eventos.UsuarioSistema)
+		if err != nil {
+			log.Printf("Agendamento %s não executado: %v", agendamento.ID.Hex(), err)
+			continue
+		}
+		a.Executar(agendamento, execucao)
+	}
+}
+
+// Preparar registra uma nova execução, com todas as etapas pendentes. Só
+// uma execução de cada agendamento roda por vez.
+func (a *Agendador) Preparar(agendamento *models.Agendamento, usuario string) (*models.ExecucaoAgendamento, error) {
+	a.mu.Lock()
+	if a.emAndamento[agendamento.ID] {
+		a.mu.Unlock()
+		return nil, ErroEmExecucao
+	}
+	a.emAndamento[agendamento.ID] = true
+	a.mu.Unlock()
+
+	execucao := &models.ExecucaoAgendamento{
+		AgendamentoID: agendamento.ID,
+		Declarante:    agendamento.Declarante,
+		Periodo:       PeriodoDaExecucao(agendamento, time.Now()),
+		Usuario:       usuario,
+		Situacao:      models.ExecucaoEmAndamento,
+		IniciadaEm:    time.Now(),
+	}
+	for _, etapa := range agendamento.Etapas {
+		execucao.Etapas = append(execucao.Etapas, models.EtapaExecucao{Etapa: etapa, Situacao: models.ExecucaoPendente})
+	}
+
+	if err := a.agendamentoRepo.CriarExecucao(execucao); err != nil {
+		a.liberar(agendamento.ID)
+		return nil, err
+	}
+
+	return execucao, nil
+}
+
+// Executar roda as etapas em ordem, parando na primeira falha, e avisa os
+// e-mails do agendamento sobre a falha
+func (a *Agendador) Executar(agendamento *models.Agendamento, execucao *models.ExecucaoAgendamento) {
+	defer a.liberar(agendamento.ID)
+
+	execucao.Situacao = models.ExecucaoConcluida
+	for i := range execucao.Etapas {
+		etapa := &execucao.Etapas[i]
+		if execucao.Situacao == models.ExecucaoFalhou {
+			etapa.Situacao = models.ExecucaoIgnorada
+			continue
+		}
+
+		inicio := time.Now()
+		etapa.IniciadaEm = &inicio
+		etapa.Situacao = models.ExecucaoEmAndamento
+		a.agendamentoRepo.AtualizarExecucao(execucao)
+
+		mensagem, err := a.executarEtapa(etapa.Etapa, execucao)
+		fim := time.Now()
+		etapa.ConcluidaEm = &fim
+		etapa.Situacao = models.ExecucaoConcluida
+		etapa.Mensagem = mensagem
+		if err != nil {
+			etapa.Situacao = models.ExecucaoFalhou
+			etapa.Mensagem = err.Error()
+			execucao.Situacao = models.ExecucaoFalhou
+		}
+		a.agendamentoRepo.AtualizarExecucao(execucao)
+	}
+
+	concluida := time.Now()
+	execucao.ConcluidaEm = &concluida
+	if err := a.agendamentoRepo.AtualizarExecucao(execucao); err != nil {
+		log.Println("Erro ao gravar a execução do agendamento:", err)
+	}
+	if err := a.agendamentoRepo.RegistrarUltimaExecucao(agendamento.ID, execucao.IniciadaEm, execucao.Situacao); err != nil {
+		log.Println("Erro ao gravar a execução do agendamento:", err)
+	}
+
+	log.Printf("Agendamento '%s' (%s, %s): %s", agendamento.Nome, execucao.Declarante, execucao.Periodo, execucao.Situacao)
+	if execucao.Situacao == models.ExecucaoFalhou {
+		a.notificarFalha(agendamento, execucao)
+	}
+}
+
+func (a *Agendador) liberar(id primitive.ObjectID) {
+	a.mu.Lock()
+	delete(a.emAndamento, id)
+	a.mu.Unlock()
+}
+
+func (a *Agendador) executarEtapa(etapa string, execucao *models.ExecucaoAgendamento) (string, error) {
+	declarante, periodo := execucao.Declarante, execucao.Periodo
+
+	// Só a verificação das importações pode rodar com o período fechado
+	if etapa != models.EtapaImportacao {
+		if err := eventos.VerificarPeriodoAberto(a.repos.Periodos, declarante, periodo); err != nil {
+			return "", err
+		}
+	}
+
+	switch etapa {
+	case models.EtapaImportacao:
+		concluidas, err := semestre.VerificarImportacoes(a.repos, declarante, periodo)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%d importação(ões) concluída(s)", concluidas), nil
+
+	case models.EtapaAbertura:
+		abertura, nova, err := semestre.GerarAbertura(a.repos, declarante, periodo, eventos.UsuarioSistema)
+		if err != nil {
+			return "", err
+		}
+		return descreverEvento(abertura, nova), nil
+
+	case models.EtapaMovimentos:
+		gerados, err := semestre.GerarMovimentos(a.repos, declarante, periodo, eventos.UsuarioSistema)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%d evento(s) de movimento gerado(s)", len(gerados)), nil
+
+	case models.EtapaFechamento:
+		fechamento, novo, err := semestre.GerarFechamento(a.repos, declarante, periodo, eventos.UsuarioSistema)
+		if err != nil {
+			return "", err
+		}
+		return descreverEvento(fechamento, novo), nil
+
+	case models.EtapaValidacao:
+		lote, resultados, err := semestre.Validar(a.repos, declarante, periodo, eventos.UsuarioSistema)
+		if err != nil {
+			return "", err
+		}
+		comErros := 0
+		for _, resultado := range resultados {
+			if !resultado.Valido {
+				comErros++
+			}
+		}
+		if comErros > 0 {
+			return "", fmt.Errorf("%d de %d evento(s) com erros; consulte as ocorrências de cada evento", comErros, len(lote))
+		}
+		return fmt.Sprintf("%d evento(s) válido(s)", len(lote)), nil
+
+	case models.EtapaTransmissao:
+		comentario := fmt.Sprintf("Solicitado pela execução %s do agendamento", execucao.ID.Hex())
+		pedido, err := semestre.SolicitarTransmissao(a.repos, declarante, periodo, eventos.UsuarioSistema, comentario)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("pedido de aprovação %s com %d evento(s)", pedido.ID.Hex(), len(pedido.EventoIDs)), nil
+	}
+
+	return "", fmt.Errorf("etapa '%s' desconhecida", etapa)
+}
+
+func descreverEvento(evento *models.Evento, novo bool) string {
+	if novo {
+		return fmt.Sprintf("%s %s gerado", evento.Tipo, evento.ID.Hex())
+	}
+	return fmt.Sprintf("%s %s já existente (%s)", evento.Tipo, evento.ID.Hex(), evento.Status)
+}
+
+func (a *Agendador) notificarFalha(agendamento *models.Agendamento, execucao *models.ExecucaoAgendamento) {
+	if len(agendamento.Emails) == 0 {
+		return
+	}
+
+	var corpo strings.Builder
+	fmt.Fprintf(&corpo, "O agendamento '%s' do declarante %s, período %s, parou em %s.\n\n",
+		agendamento.Nome, execucao.Declarante, execucao.Periodo, execucao.ConcluidaEm.Format("02/01/2006 15:04"))
+
+	etapaFalha := ""
+	for _, etapa := range execucao.Etapas {
+		fmt.Fprintf(&corpo, "[%s] %s", strings.ToUpper(etapa.Situacao), etapa.Etapa)
+		if etapa.Mensagem != "" {
+			fmt.Fprintf(&corpo, ": %s", etapa.Mensagem)
+		}
+		corpo.WriteString("\n")
+		if etapa.Situacao == models.ExecucaoFalhou {
+			etapaFalha = etapa.Etapa
+		}
+	}
+	fmt.Fprintf(&corpo, "\nExecução: %s\n", execucao.ID.Hex())
+
+	assunto := fmt.Sprintf("e-Financeira: agendamento '%s' falhou na etapa %s", agendamento.Nome, etapaFalha)
+
+	emailMiddleware := middlewares.NovoEmailMiddleware()
+	for _, email := range agendamento.Emails {
+		if err := emailMiddleware.SendEmail(email, assunto, corpo.String()); err != nil {
+			log.Println("Erro ao enviar o aviso de falha do agendamento:", err)
+		}
+	}
+}
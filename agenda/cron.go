@@ -0,0 +1,158 @@
+package agenda
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Expressao é uma expressão cron de cinco campos: minuto, hora, dia do mês,
+// mês e dia da semana (0 ou 7 é domingo). Cada campo aceita *, valores,
+// listas (1,15), faixas (1-5) e passos (*/15, 8-18/2).
+type Expressao struct {
+	minutos    uint64
+	horas      uint64
+	dias       uint64
+	meses      uint64
+	diasSemana uint64
+
+	// Como no cron, se o dia do mês e o dia da semana forem restritos, basta
+	// um deles coincidir
+	diaLivre    bool
+	semanaLivre bool
+}
+
+type campoCron struct {
+	nome   string
+	minimo int
+	maximo int
+}
+
+var camposCron = []campoCron{
+	{"minuto", 0, 59},
+	{"hora", 0, 23},
+	{"dia do mês", 1, 31},
+	{"mês", 1, 12},
+	{"dia da semana", 0, 7},
+}
+
+// ParseExpressao interpreta a expressão cron
+func ParseExpressao(texto string) (*Expressao, error) {
+	partes := strings.Fields(texto)
+	if len(partes) != len(camposCron) {
+		return nil, fmt.Errorf("a expressão '%s' deve ter cinco campos: minuto, hora, dia do mês, mês e dia da semana", texto)
+	}
+
+	var valores [5]uint64
+	for i, campo := range camposCron {
+		var err error
+		if valores[i], err = parseCampo(partes[i], campo); err != nil {
+			return nil, err
+		}
+	}
+
+	// 7 também é domingo
+	if valores[4]&(1<<7) != 0 {
+		valores[4] = valores[4]&^(1<<7) | 1
+	}
+
+	return &Expressao{
+		minutos:     valores[0],
+		horas:       valores[1],
+		dias:        valores[2],
+		meses:       valores[3],
+		diasSemana:  valores[4],
+		diaLivre:    strings.HasPrefix(partes[2], "*"),
+		semanaLivre: strings.HasPrefix(partes[4], "*"),
+	}, nil
+}
+
+func parseCampo(texto string, campo campoCron) (uint64, error) {
+	var valores uint64
+	for _, item := range strings.Split(texto, ",") {
+		faixa, passo := item, 1
+		if i := strings.Index(item, "/"); i >= 0 {
+			faixa = item[:i]
+			numero, err := strconv.Atoi(item[i+1:])
+			if err != nil || numero <= 0 {
+				return 0, fmt.Errorf("passo inválido em '%s' no campo %s", item, campo.nome)
+			}
+			passo = numero
+		}
+
+		inicio, fim := campo.minimo, campo.maximo
+		if faixa != "*" {
+			limites := strings.SplitN(faixa, "-", 2)
+			var err error
+			if inicio, err = strconv.Atoi(limites[0]); err != nil {
+				return 0, fmt.Errorf("valor inválido em '%s' no campo %s", item, campo.nome)
+			}
+			switch {
+			case len(limites) == 2:
+				if fim, err = strconv.Atoi(limites[1]); err != nil {
+					return 0, fmt.Errorf("valor inválido em '%s' no campo %s", item, campo.nome)
+				}
+			case passo == 1:
+				fim = inicio
+			}
+		}
+
+		if inicio < campo.minimo || fim > campo.maximo || inicio > fim {
+			return 0, fmt.Errorf("'%s' fora do intervalo %d-%d do campo %s", item, campo.minimo, campo.maximo, campo.nome)
+		}
+		for valor := inicio; valor <= fim; valor += passo {
+			valores |= 1 << uint(valor)
+		}
+	}
+
+	return valores, nil
+}
+
+// Proxima devolve o primeiro minuto depois de t que atende à expressão, ou
+// o tempo zero se não houver nenhum nos próximos cinco anos (31 de
+// fevereiro, por exemplo)
+func (e *Expressao) Proxima(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limite := t.AddDate(5, 0, 0)
+
+	for t.Before(limite) {
+		switch {
+		case e.meses&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !e.diaValido(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case e.horas&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case e.minutos&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+func (e *Expressao) diaValido(t time.Time) bool {
+	dia := e.dias&(1<<uint(t.Day())) != 0
+	semana := e.diasSemana&(1<<uint(t.Weekday())) != 0
+	if e.diaLivre || e.semanaLivre {
+		return dia && semana
+	}
+	return dia || semana
+}
+
+// ProximaExecucao valida a expressão e calcula a execução seguinte a t
+func ProximaExecucao(texto string, t time.Time) (time.Time, error) {
+	expressao, err := ParseExpressao(texto)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	proxima := expressao.Proxima(t)
+	if proxima.IsZero() {
+		return time.Time{}, fmt.Errorf("a expressão '%s' nunca é executada", texto)
+	}
+	return proxima, nil
+}
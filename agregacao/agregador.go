@@ -0,0 +1,251 @@
+package agregacao
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"sped-efinanceira/models"
+)
+
+// Transacao é um lançamento individual de uma conta
+type Transacao struct {
+	Documento string
+	NumConta  string
+	Moeda     string
+	Data      time.Time
+	Valor     float64
+	Natureza  string // C (crédito) ou D (débito)
+
+	// Estornos anulam um lançamento anterior da mesma natureza. DataOriginal
+	// indica quando o lançamento estornado ocorreu; sem ela, o estorno é
+	// abatido no próprio mês.
+	Estorno      bool
+	DataOriginal *time.Time
+}
+
+// Chave identifica o balde de uma conta em um mês e moeda
+type Chave struct {
+	Documento string
+	NumConta  string
+	AnoMes    string
+	Moeda     string
+}
+
+// Valores são acumulados em centavos para não perder precisão em arquivos grandes
+type Totais struct {
+	Chave
+	Creditos    int64
+	Debitos     int64
+	Lancamentos int64
+}
+
+type chaveConta struct {
+	Documento string
+	NumConta  string
+	Moeda     string
+}
+
+// ContaAgregada reúne os meses de uma conta no período, com o saldo do
+// último dia de cada mês calculado a partir do saldo inicial
+type ContaAgregada struct {
+	Documento string
+	NumConta  string
+	Moeda     string
+	Meses     []models.MesCaixa
+}
+
+type Agregador struct {
+	inicio       time.Time
+	fim          time.Time
+	totais       map[Chave]*Totais
+	saldoInicial map[chaveConta]int64
+}
+
+// NovoAgregador cria um agregador para os lançamentos entre inicio e fim
+func NovoAgregador(inicio, fim time.Time) *Agregador {
+	return &Agregador{
+		inicio:       inicio,
+		fim:          fim,
+		totais:       make(map[Chave]*Totais),
+		saldoInicial: make(map[chaveConta]int64),
+	}
+}
+
+// Adicionar coloca a transação no balde da conta, mês e moeda.
+//
+// Um estorno reduz o total da mesma natureza no mês do lançamento original.
+// Quando o original é anterior ao período, o valor já foi declarado em outro
+// evento e o estorno entra como movimento de natureza oposta no mês em que
+// ocorreu.
+func (a *Agregador) Adicionar(t Transacao) error {
+	if t.Data.Before(a.inicio) || t.Data.After(a.fim) {
+		return fmt.Errorf("data %s fora do período", t.Data.Format("02/01/2006"))
+	}
+	if t.Natureza != "C" && t.Natureza != "D" {
+		return fmt.Errorf("natureza '%s' inválida, use C ou D", t.Natureza)
+	}
+	if t.Valor < 0 {
+		return fmt.Errorf("valor negativo; use a natureza ou o indicador de estorno")
+	}
+
+	centavos := paraCentavos(t.Valor)
+	data := t.Data
+	natureza := t.Natureza
+
+	if t.Estorno {
+		centavos = -centavos
+		if t.DataOriginal != nil {
+			if t.DataOriginal.Before(a.inicio) {
+				centavos = -centavos
+				natureza = oposta(natureza)
+			} else if !t.DataOriginal.After(t.Data) {
+				data = *t.DataOriginal
+			}
+		}
+	}
+
+	chave := Chave{
+		Documento: t.Documento,
+		NumConta:  t.NumConta,
+		AnoMes:    data.Format("200601"),
+		Moeda:     t.Moeda,
+	}
+
+	totais := a.balde(chave)
+	if natureza == "C" {
+		totais.Creditos += centavos
+	} else {
+		totais.Debitos += centavos
+	}
+	totais.Lancamentos++
+	return nil
+}
+
+// Mesclar soma totais já agregados, por exemplo os acumulados no Mongo
+// pelas importações de arquivos de transações
+func (a *Agregador) Mesclar(movimento models.MovimentoConta) {
+	totais := a.balde(Chave{
+		Documento: movimento.Documento,
+		NumConta:  movimento.NumConta,
+		AnoMes:    movimento.AnoMes,
+		Moeda:     movimento.Moeda,
+	})
+	totais.Creditos += paraCentavos(movimento.TotCreditos)
+	totais.Debitos += paraCentavos(movimento.TotDebitos)
+	totais.Lancamentos += movimento.Lancamentos
+}
+
+// DefinirSaldoInicial informa o saldo da conta no início do período
+func (a *Agregador) DefinirSaldoInicial(documento, numConta, moeda string, saldo float64) {
+	a.saldoInicial[chaveConta{documento, numConta, moeda}] = paraCentavos(saldo)
+}
+
+// Totais devolve os baldes ordenados por conta e mês
+func (a *Agregador) Totais() []Totais {
+	resultado := make([]Totais, 0, len(a.totais))
+	for _, totais := range a.totais {
+		resultado = append(resultado, *totais)
+	}
+
+	sort.Slice(resultado, func(i, j int) bool {
+		return menorChave(resultado[i].Chave, resultado[j].Chave)
+	})
+	return resultado
+}
+
+// Contas monta os totais mensais de cada conta, com o saldo do último dia
+// de cada mês. Contas apenas com saldo inicial também são devolvidas, pois o
+// saldo de fim de semestre precisa ser declarado mesmo sem movimento.
+func (a *Agregador) Contas() []ContaAgregada {
+	porConta := make(map[chaveConta][]Totais)
+	for _, totais := range a.Totais() {
+		conta := chaveConta{totais.Documento, totais.NumConta, totais.Moeda}
+		porConta[conta] = append(porConta[conta], totais)
+	}
+	for conta := range a.saldoInicial {
+		if _, ok := porConta[conta]; !ok {
+			porConta[conta] = nil
+		}
+	}
+
+	mesFinal := a.fim.Format("200601")
+	resultado := make([]ContaAgregada, 0, len(porConta))
+	for conta, meses := range porConta {
+		saldo := a.saldoInicial[conta]
+		agregada := ContaAgregada{
+			Documento: conta.Documento,
+			NumConta:  conta.NumConta,
+			Moeda:     conta.Moeda,
+		}
+
+		for _, mes := range meses {
+			saldo += mes.Creditos - mes.Debitos
+			agregada.Meses = append(agregada.Meses, models.MesCaixa{
+				AnoMes:      mes.AnoMes,
+				TotCreditos: paraReais(mes.Creditos),
+				TotDebitos:  paraReais(mes.Debitos),
+				VlrUltDia:   paraReais(saldo),
+			})
+		}
+
+		// Garante o saldo do último mês do semestre
+		if len(agregada.Meses) == 0 || agregada.Meses[len(agregada.Meses)-1].AnoMes != mesFinal {
+			agregada.Meses = append(agregada.Meses, models.MesCaixa{
+				AnoMes:    mesFinal,
+				VlrUltDia: paraReais(saldo),
+			})
+		}
+
+		resultado = append(resultado, agregada)
+	}
+
+	sort.Slice(resultado, func(i, j int) bool {
+		if resultado[i].Documento != resultado[j].Documento {
+			return resultado[i].Documento < resultado[j].Documento
+		}
+		if resultado[i].NumConta != resultado[j].NumConta {
+			return resultado[i].NumConta < resultado[j].NumConta
+		}
+		return resultado[i].Moeda < resultado[j].Moeda
+	})
+	return resultado
+}
+
+func (a *Agregador) balde(chave Chave) *Totais {
+	totais, ok := a.totais[chave]
+	if !ok {
+		totais = &Totais{Chave: chave}
+		a.totais[chave] = totais
+	}
+	return totais
+}
+
+func menorChave(a, b Chave) bool {
+	if a.Documento != b.Documento {
+		return a.Documento < b.Documento
+	}
+	if a.NumConta != b.NumConta {
+		return a.NumConta < b.NumConta
+	}
+	if a.Moeda != b.Moeda {
+		return a.Moeda < b.Moeda
+	}
+	return a.AnoMes < b.AnoMes
+}
+
+func oposta(natureza string) string {
+	if natureza == "C" {
+		return "D"
+	}
+	return "C"
+}
+
+func paraCentavos(valor float64) int64 {
+	return int64(math.Round(valor * 100))
+}
+
+func paraReais(centavos int64) float64 {
+	return float64(centavos) / 100
+}
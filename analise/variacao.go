@@ -0,0 +1,270 @@
+package analise
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+
+	"sped-efinanceira/layout"
+	"sped-efinanceira/models"
+)
+
+// Situação do titular na comparação entre os períodos
+const (
+	TitularComparado = "comparado"
+	TitularNovo      = "novo"
+	TitularAusente   = "ausente"
+)
+
+// Eventos que não representam o que foi (ou será) declarado
+var statusIgnorados = map[string]bool{
+	models.EventoRejeitado:  true,
+	models.EventoRetificado: true,
+	models.EventoExcluido:   true,
+}
+
+// Criterios definem o que é uma variação relevante: a diferença precisa
+// passar do percentual e do valor mínimo, para que contas pequenas não
+// encham o relatório
+type Criterios struct {
+	Percentual  float64 `json:"percentual"`
+	ValorMinimo float64 `json:"valor_minimo"`
+}
+
+// Totais de um titular no período, em reais
+type TotaisTitular struct {
+	Creditos float64  `json:"creditos"`
+	Debitos  float64  `json:"debitos"`
+	Saldo    float64  `json:"saldo"`
+	Contas   []string `json:"contas"`
+}
+
+// VariacaoTitular compara os totais declarados de um titular nos dois
+// períodos. As variações são percentuais sobre o período anterior e ficam
+// vazias quando não há base de comparação.
+type VariacaoTitular struct {
+	TpNI                string        `json:"tp_ni"`
+	NI                  string        `json:"ni"`
+	Nome                string        `json:"nome"`
+	Situacao            string        `json:"situacao"`
+	Anterior            TotaisTitular `json:"anterior"`
+	Atual               TotaisTitular `json:"atual"`
+	VariacaoCreditos    *float64      `json:"variacao_creditos,omitempty"`
+	VariacaoDebitos     *float64      `json:"variacao_debitos,omitempty"`
+	VariacaoSaldo       *float64      `json:"variacao_saldo,omitempty"`
+	ContasNovas         []string      `json:"contas_novas,omitempty"`
+	ContasDesaparecidas []string      `json:"contas_desaparecidas,omitempty"`
+	Alertas             []string      `json:"alertas,omitempty"`
+}
+
+// CompararPeriodos monta a variação de cada titular entre os eventos de
+// movimento do período anterior e do atual. Titulares com alerta vêm
+// primeiro; dentro de cada grupo, por nome.
+func CompararPeriodos(anteriores, atuais []*models.Evento, criterios Criterios) []*VariacaoTitular {
+	totaisAnteriores, declaradosAnteriores := totaisPorTitular(anteriores)
+	totaisAtuais, declaradosAtuais := totaisPorTitular(atuais)
+
+	var variacoes []*VariacaoTitular
+	for chave, declarado := range declaradosAtuais {
+		variacao := &VariacaoTitular{TpNI: declarado.TpNI, NI: declarado.NI, Nome: declarado.Nome}
+		variacao.Atual = totaisAtuais[chave]
+		if anterior, ok := totaisAnteriores[chave]; ok {
+			variacao.Situacao = TitularComparado
+			variacao.Anterior = anterior
+		} else {
+			variacao.Situacao = TitularNovo
+		}
+		variacoes = append(variacoes, variacao)
+	}
+	for chave, declarado := range declaradosAnteriores {
+		if _, ok := declaradosAtuais[chave]; ok {
+			continue
+		}
+		variacoes = append(variacoes, &VariacaoTitular{
+			TpNI:     declarado.TpNI,
+			NI:       declarado.NI,
+			Nome:     declarado.Nome,
+			Situacao: TitularAusente,
+			Anterior: totaisAnteriores[chave],
+		})
+	}
+
+	for _, variacao := range variacoes {
+		avaliar(variacao, criterios)
+	}
+
+	sort.Slice(variacoes, func(i, j int) bool {
+		if (len(variacoes[i].Alertas) > 0) != (len(variacoes[j].Alertas) > 0) {
+			return len(variacoes[i].Alertas) > 0
+		}
+		if variacoes[i].Nome != variacoes[j].Nome {
+			return variacoes[i].Nome < variacoes[j].Nome
+		}
+		return variacoes[i].NI < variacoes[j].NI
+	})
+
+	return variacoes
+}
+
+// Soma os movimentos por titular. Quando o titular tem mais de um evento no
+// período (uma retificadora ainda não enviada, por exemplo), vale o mais
+// recente.
+func totaisPorTitular(lista []*models.Evento) (map[string]TotaisTitular, map[string]models.Declarado) {
+	recentes := make(map[string]*models.Evento)
+	for _, evento := range lista {
+		if evento.Movimento == nil || statusIgnorados[evento.Status] {
+			continue
+		}
+		chave := chaveTitular(evento.Movimento.Declarado)
+		if atual, ok := recentes[chave]; !ok || evento.CreatedAt.After(atual.CreatedAt) {
+			recentes[chave] = evento
+		}
+	}
+
+	totais := make(map[string]TotaisTitular)
+	declarados := make(map[string]models.Declarado)
+	for chave, evento := range recentes {
+		var total TotaisTitular
+		for _, conta := range evento.Movimento.Contas {
+			total.Contas = append(total.Contas, conta.NumConta)
+
+			var ultimo string
+			var saldo float64
+			for _, mes := range conta.Meses {
+				total.Creditos += mes.TotCreditos
+				total.Debitos += mes.TotDebitos
+				if mes.AnoMes > ultimo {
+					ultimo, saldo = mes.AnoMes, mes.VlrUltDia
+				}
+			}
+			total.Saldo += saldo
+		}
+		total.Creditos = arredondar(total.Creditos)
+		total.Debitos = arredondar(total.Debitos)
+		total.Saldo = arredondar(total.Saldo)
+		sort.Strings(total.Contas)
+
+		totais[chave] = total
+		declarados[chave] = evento.Movimento.Declarado
+	}
+
+	return totais, declarados
+}
+
+func chaveTitular(declarado models.Declarado) string {
+	return declarado.TpNI + ":" + declarado.NI
+}
+
+func avaliar(variacao *VariacaoTitular, criterios Criterios) {
+	switch variacao.Situacao {
+	case TitularNovo:
+		variacao.Alertas = append(variacao.Alertas, "Titular sem movimento declarado no período anterior.")
+		return
+	case TitularAusente:
+		variacao.Alertas = append(variacao.Alertas, "Titular declarado no período anterior sem movimento no atual.")
+		return
+	}
+
+	anteriores := contem(variacao.Anterior.Contas)
+	atuais := contem(variacao.Atual.Contas)
+	for _, conta := range variacao.Atual.Contas {
+		if !anteriores[conta] {
+			variacao.ContasNovas = append(variacao.ContasNovas, conta)
+		}
+	}
+	for _, conta := range variacao.Anterior.Contas {
+		if !atuais[conta] {
+			variacao.ContasDesaparecidas = append(variacao.ContasDesaparecidas, conta)
+		}
+	}
+	if len(variacao.ContasNovas) > 0 {
+		variacao.Alertas = append(variacao.Alertas, fmt.Sprintf("Conta(s) nova(s): %s.", strings.Join(variacao.ContasNovas, ", ")))
+	}
+	if len(variacao.ContasDesaparecidas) > 0 {
+		variacao.Alertas = append(variacao.Alertas, fmt.Sprintf("Conta(s) sem movimento no período atual: %s.", strings.Join(variacao.ContasDesaparecidas, ", ")))
+	}
+
+	variacao.VariacaoCreditos = comparar(&variacao.Alertas, "créditos", variacao.Anterior.Creditos, variacao.Atual.Creditos, criterios)
+	variacao.VariacaoDebitos = comparar(&variacao.Alertas, "débitos", variacao.Anterior.Debitos, variacao.Atual.Debitos, criterios)
+	variacao.VariacaoSaldo = comparar(&variacao.Alertas, "saldo", variacao.Anterior.Saldo, variacao.Atual.Saldo, criterios)
+}
+
+// Calcula a variação percentual e registra o alerta quando a diferença passa
+// dos critérios. Sem valor anterior não há percentual e vale só o mínimo.
+func comparar(alertas *[]string, nome string, anterior, atual float64, criterios Criterios) *float64 {
+	var percentual *float64
+	if anterior != 0 {
+		valor := arredondar((atual - anterior) / math.Abs(anterior) * 100)
+		percentual = &valor
+	}
+
+	diferenca := math.Abs(atual - anterior)
+	if diferenca == 0 || diferenca < criterios.ValorMinimo {
+		return percentual
+	}
+
+	switch {
+	case percentual == nil:
+		*alertas = append(*alertas, fmt.Sprintf("Total de %s passou de zero para %s.", nome, layout.FormatarValor(atual)))
+	case math.Abs(*percentual) >= criterios.Percentual:
+		*alertas = append(*alertas, fmt.Sprintf("Total de %s variou %s%% (%s para %s).",
+			nome, layout.FormatarValor(*percentual), layout.FormatarValor(anterior), layout.FormatarValor(atual)))
+	}
+	return percentual
+}
+
+// EscreverCSV exporta as variações no formato das planilhas do sistema:
+// separador ponto e vírgula e vírgula decimal
+func EscreverCSV(w io.Writer, periodoAnterior, periodoAtual string, variacoes []*VariacaoTitular) error {
+	escritor := csv.NewWriter(w)
+	escritor.Comma = ';'
+
+	cabecalho := []string{
+		"tp_ni", "ni", "nome", "situacao",
+		"creditos_" + periodoAnterior, "creditos_" + periodoAtual, "variacao_creditos_pct",
+		"debitos_" + periodoAnterior, "debitos_" + periodoAtual, "variacao_debitos_pct",
+		"saldo_" + periodoAnterior, "saldo_" + periodoAtual, "variacao_saldo_pct",
+		"contas_novas", "contas_desaparecidas", "alertas",
+	}
+	if err := escritor.Write(cabecalho); err != nil {
+		return err
+	}
+
+	for _, variacao := range variacoes {
+		linha := []string{
+			variacao.TpNI, variacao.NI, variacao.Nome, variacao.Situacao,
+			layout.FormatarValor(variacao.Anterior.Creditos), layout.FormatarValor(variacao.Atual.Creditos), percentualCSV(variacao.VariacaoCreditos),
+			layout.FormatarValor(variacao.Anterior.Debitos), layout.FormatarValor(variacao.Atual.Debitos), percentualCSV(variacao.VariacaoDebitos),
+			layout.FormatarValor(variacao.Anterior.Saldo), layout.FormatarValor(variacao.Atual.Saldo), percentualCSV(variacao.VariacaoSaldo),
+			strings.Join(variacao.ContasNovas, ","), strings.Join(variacao.ContasDesaparecidas, ","), strings.Join(variacao.Alertas, " "),
+		}
+		if err := escritor.Write(linha); err != nil {
+			return err
+		}
+	}
+
+	escritor.Flush()
+	return escritor.Error()
+}
+
+func percentualCSV(percentual *float64) string {
+	if percentual == nil {
+		return ""
+	}
+	return layout.FormatarValor(*percentual)
+}
+
+func contem(lista []string) map[string]bool {
+	conjunto := make(map[string]bool, len(lista))
+	for _, item := range lista {
+		conjunto[item] = true
+	}
+	return conjunto
+}
+
+func arredondar(valor float64) float64 {
+	return math.Round(valor*100) / 100
+}
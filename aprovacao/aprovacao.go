@@ -0,0 +1,177 @@
+package aprovacao
+
+import (
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"sped-efinanceira/cadastro"
+	"sped-efinanceira/eventos"
+	"sped-efinanceira/models"
+	"sped-efinanceira/repositories"
+)
+
+// EventosDaAprovacao carrega os eventos do pedido. Sem IDs, o pedido cobre
+// todos os eventos validados do declarante no período. Todos precisam estar
+// validados e fora de outro pedido pendente.
+func EventosDaAprovacao(eventoRepo *repositories.EventoRepositorio, aprovacaoRepo *repositories.AprovacaoRepositorio, pedido *models.Aprovacao) ([]*models.Evento, error) {
+	var lista []*models.Evento
+	if len(pedido.EventoIDs) == 0 {
+		validados, err := eventoRepo.ListarEventos(pedido.Declarante, pedido.Periodo, "", models.EventoValidado)
+		if err != nil {
+			return nil, err
+		}
+		if len(validados) == 0 {
+			return nil, fmt.Errorf("nenhum evento validado no período %s", pedido.Periodo)
+		}
+		lista = validados
+	} else {
+		for _, id := range pedido.EventoIDs {
+			evento, err := eventoRepo.ListarEventoPorID(id.Hex())
+			if err != nil {
+				return nil, fmt.Errorf("evento %s não encontrado", id.Hex())
+			}
+			if evento.Declarante != pedido.Declarante || evento.Periodo != pedido.Periodo {
+				return nil, fmt.Errorf("evento %s não pertence ao declarante e período informados", id.Hex())
+			}
+			if evento.Status != models.EventoValidado {
+				return nil, fmt.Errorf("evento %s está '%s'; só eventos validados podem ser aprovados", id.Hex(), evento.Status)
+			}
+			lista = append(lista, evento)
+		}
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(lista))
+	for _, evento := range lista {
+		ids = append(ids, evento.ID)
+	}
+	emAprovacao, err := aprovacaoRepo.EventosEmAprovacao(ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		if emAprovacao[id] {
+			return nil, fmt.Errorf("evento %s já está em outro pedido de aprovação pendente", id.Hex())
+		}
+	}
+
+	pedido.EventoIDs = ids
+	return lista, nil
+}
+
+// VerificarAprovador confere se o usuário tem perfil aprovador e não
+// participou da preparação dos eventos: não pode ter pedido a aprovação,
+// criado os eventos nem aparecer no histórico de nenhum deles
+func VerificarAprovador(usuarioRepo *repositories.UsuarioRepositorio, perfilRepo *repositories.PerfilRepositorio, eventoRepo *repositories.EventoRepositorio, usuarioID string, pedido *models.Aprovacao) error {
+	if usuarioID == "" {
+		return fmt.Errorf("usuário não identificado")
+	}
+	if usuarioID == pedido.Solicitante {
+		return fmt.Errorf("quem solicitou a aprovação não pode aprová-la")
+	}
+
+	for _, id := range pedido.EventoIDs {
+		evento, err := eventoRepo.ListarEventoPorID(id.Hex())
+		if err != nil {
+			return fmt.Errorf("evento %s não encontrado", id.Hex())
+		}
+		if participou(evento, usuarioID) {
+			return fmt.Errorf("quem criou ou alterou o evento %s não pode aprová-lo", id.Hex())
+		}
+	}
+
+	usuario, err := usuarioRepo.ListarUsuarioPorID(usuarioID)
+	if err != nil {
+		return fmt.Errorf("usuário não encontrado")
+	}
+	perfil, err := perfilRepo.ListarPerfilPorID(usuario.PerfilID)
+	if err != nil || !perfil.Aprovador {
+		return fmt.Errorf("o perfil do usuário não permite aprovar eventos")
+	}
+
+	return nil
+}
+
+func participou(evento *models.Evento, usuario string) bool {
+	if evento.CriadoPor == usuario {
+		return true
+	}
+	for _, transicao := range evento.Historico {
+		if transicao.Usuario == usuario {
+			return true
+		}
+	}
+	return false
+}
+
+// Decidir aplica a decisão aos eventos do pedido e a registra: aprovados
+// seguem para assinatura e rejeitados voltam a rascunho com o motivo no
+// histórico. Eventos que mudaram desde o pedido impedem a aprovação. Na
+// aprovação, cada evento guarda o hash do conteúdo aprovado, já com os dados
+// do cadastro de titulares e do CRS. Os eventos mudam todos juntos e, se o
+// registro da decisão falhar, voltam a validados, para que o pedido possa
+// ser decidido de novo.
+func Decidir(eventoRepo *repositories.EventoRepositorio, aprovacaoRepo *repositories.AprovacaoRepositorio, titularRepo *repositories.TitularRepositorio, crsRepo *repositories.CRSRepositorio, pedido *models.Aprovacao, decisao models.DecisaoAprovacao, usuario string) error {
+	var lista []*models.Evento
+	for _, id := range pedido.EventoIDs {
+		evento, err := eventoRepo.ListarEventoPorID(id.Hex())
+		if err != nil {
+			return fmt.Errorf("evento %s não encontrado", id.Hex())
+		}
+		if evento.Status != models.EventoValidado {
+			if decisao.Acao == "rejeitar" {
+				continue
+			}
+			return fmt.Errorf("evento %s mudou para '%s' depois do pedido; solicite nova aprovação", id.Hex(), evento.Status)
+		}
+		lista = append(lista, evento)
+	}
+
+	status, motivo := models.EventoAprovado, decisao.Comentario
+	if decisao.Acao == "rejeitar" {
+		status, motivo = models.EventoRascunho, decisao.Motivo
+	}
+
+	if status == models.EventoAprovado {
+		if err := cadastro.ResolverDeclarados(titularRepo, crsRepo, lista...); err != nil {
+			return err
+		}
+		for _, evento := range lista {
+			if err := eventoRepo.RegistrarHashAprovado(evento.ID, eventos.HashConteudo(evento)); err != nil {
+				return err
+			}
+		}
+	}
+	transicoes, err := eventos.AvancarStatusEventos(eventoRepo, lista, status, usuario, motivo)
+	if err != nil {
+		return err
+	}
+
+	decidido := *pedido
+	agora := time.Now()
+	decidido.Aprovador = usuario
+	decidido.DecididaEm = &agora
+	decidido.Situacao = models.AprovacaoAprovada
+	if decisao.Acao == "rejeitar" {
+		decidido.Situacao = models.AprovacaoRejeitada
+		decidido.MotivoRejeicao = decisao.Motivo
+	}
+	if decisao.Comentario != "" {
+		decidido.Comentarios = append(append([]models.ComentarioAprovacao{}, pedido.Comentarios...), models.ComentarioAprovacao{
+			Usuario: usuario,
+			Texto:   decisao.Comentario,
+			Data:    agora,
+		})
+	}
+
+	if err := aprovacaoRepo.RegistrarDecisao(&decidido); err != nil {
+		if errDesfazer := eventos.DesfazerStatusEventos(eventoRepo, lista, transicoes); errDesfazer != nil {
+			return fmt.Errorf("%v; falha ao desfazer o status dos eventos: %v", err, errDesfazer)
+		}
+		return err
+	}
+
+	*pedido = decidido
+	return nil
+}
@@ -0,0 +1,92 @@
+package aprovacao
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"sped-efinanceira/middlewares"
+	"sped-efinanceira/models"
+	"sped-efinanceira/repositories"
+)
+
+// NotificarPedido avisa por e-mail os usuários com perfil aprovador, exceto
+// o solicitante
+func NotificarPedido(usuarioRepo *repositories.UsuarioRepositorio, perfilRepo *repositories.PerfilRepositorio, pedido *models.Aprovacao) {
+	perfis, err := perfilRepo.ListarTodosPerfis()
+	if err != nil {
+		log.Println("Erro ao buscar os aprovadores:", err)
+		return
+	}
+	aprovadores := make(map[string]bool)
+	for _, perfil := range perfis {
+		if perfil.Aprovador {
+			aprovadores[perfil.ID.Hex()] = true
+		}
+	}
+
+	usuarios, err := usuarioRepo.ListarUsuarios()
+	if err != nil {
+		log.Println("Erro ao buscar os aprovadores:", err)
+		return
+	}
+
+	solicitante := nomeUsuario(usuarioRepo, pedido.Solicitante)
+	assunto := fmt.Sprintf("e-Financeira: aprovação pendente de %s (%s)", pedido.Declarante, pedido.Periodo)
+
+	var corpo strings.Builder
+	fmt.Fprintf(&corpo, "%s solicitou a aprovação de %d evento(s) do declarante %s no período %s.\n",
+		solicitante, len(pedido.EventoIDs), pedido.Declarante, pedido.Periodo)
+	if pedido.Comentario != "" {
+		fmt.Fprintf(&corpo, "\nComentário: %s\n", pedido.Comentario)
+	}
+	fmt.Fprintf(&corpo, "\nPedido: %s\n", pedido.ID.Hex())
+
+	enviar(usuarios, func(usuario *models.Usuario) bool {
+		return aprovadores[usuario.PerfilID] && usuario.ID.Hex() != pedido.Solicitante
+	}, assunto, corpo.String())
+}
+
+// NotificarDecisao avisa o solicitante sobre a aprovação ou a rejeição
+func NotificarDecisao(usuarioRepo *repositories.UsuarioRepositorio, pedido *models.Aprovacao) {
+	usuario, err := usuarioRepo.ListarUsuarioPorID(pedido.Solicitante)
+	if err != nil {
+		log.Println("Erro ao buscar o solicitante da aprovação:", err)
+		return
+	}
+
+	assunto := fmt.Sprintf("e-Financeira: pedido %s de %s (%s)", pedido.Situacao, pedido.Declarante, pedido.Periodo)
+
+	var corpo strings.Builder
+	fmt.Fprintf(&corpo, "%s %s o pedido de aprovação de %d evento(s) do declarante %s no período %s.\n",
+		nomeUsuario(usuarioRepo, pedido.Aprovador), pedido.Situacao, len(pedido.EventoIDs), pedido.Declarante, pedido.Periodo)
+	if pedido.MotivoRejeicao != "" {
+		fmt.Fprintf(&corpo, "\nMotivo: %s\n", pedido.MotivoRejeicao)
+	}
+	if n := len(pedido.Comentarios); n > 0 && pedido.Comentarios[n-1].Usuario == pedido.Aprovador {
+		fmt.Fprintf(&corpo, "\nComentário: %s\n", pedido.Comentarios[n-1].Texto)
+	}
+	fmt.Fprintf(&corpo, "\nPedido: %s\n", pedido.ID.Hex())
+
+	enviar([]*models.Usuario{usuario}, func(*models.Usuario) bool { return true }, assunto, corpo.String())
+}
+
+func enviar(usuarios []*models.Usuario, incluir func(*models.Usuario) bool, assunto, corpo string) {
+	emailMiddleware := middlewares.NovoEmailMiddleware()
+	for _, usuario := range usuarios {
+		if usuario.Email == "" || !incluir(usuario) {
+			continue
+		}
+		if err := emailMiddleware.SendEmail(usuario.Email, assunto, corpo); err != nil {
+			log.Println("Erro ao enviar notificação de aprovação:", err)
+		}
+	}
+}
+
+func nomeUsuario(usuarioRepo *repositories.UsuarioRepositorio, id string) string {
+	usuario, err := usuarioRepo.ListarUsuarioPorID(id)
+	if err != nil {
+		return id
+	}
+	return usuario.Nome
+}
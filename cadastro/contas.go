@@ -0,0 +1,72 @@
+package cadastro
+
+import (
+	"fmt"
+	"strings"
+
+	"sped-efinanceira/models"
+	"sped-efinanceira/repositories"
+	"sped-efinanceira/validacao"
+)
+
+// ValidarConta normaliza os documentos e confere as regras que a validação
+// do modelo não cobre: um único titular, participantes sem repetição e
+// encerramento posterior à abertura
+func ValidarConta(conta *models.Conta) error {
+	conta.Declarante = validacao.SomenteDigitos(conta.Declarante)
+	if !validacao.CNPJValido(conta.Declarante) {
+		return fmt.Errorf("o CNPJ do declarante é inválido")
+	}
+
+	conta.Moeda = strings.ToUpper(conta.Moeda)
+	if !validacao.MoedaValida(conta.Moeda) {
+		return fmt.Errorf("moeda '%s' inválida", conta.Moeda)
+	}
+
+	if conta.DtEncerramento != nil && conta.DtEncerramento.Before(conta.DtAbertura) {
+		return fmt.Errorf("a data de encerramento é anterior à abertura")
+	}
+
+	titulares := 0
+	vistos := make(map[string]bool)
+	for i := range conta.Titulares {
+		participante := &conta.Titulares[i]
+		participante.NI = validacao.SomenteDigitos(participante.NI)
+
+		if !validacao.DocumentoValido(participante.NI) {
+			return fmt.Errorf("documento do participante '%s' inválido", participante.NI)
+		}
+		if vistos[participante.NI] {
+			return fmt.Errorf("participante %s informado mais de uma vez", participante.NI)
+		}
+		vistos[participante.NI] = true
+
+		if participante.Papel == models.PapelTitular {
+			titulares++
+		}
+	}
+	if titulares != 1 {
+		return fmt.Errorf("a conta deve ter exatamente um titular; os demais são cotitulares ou procuradores")
+	}
+
+	return nil
+}
+
+// VincularParticipantes associa cada participante da conta ao cadastro de
+// titulares, criando o cadastro quando o documento ainda não existe
+func VincularParticipantes(repo *repositories.TitularRepositorio, conta *models.Conta) error {
+	cache := make(map[string]*models.Titular)
+
+	for i := range conta.Titulares {
+		participante := &conta.Titulares[i]
+		declarado := models.Declarado{NI: participante.NI}
+
+		titular, err := mesclarNoCadastro(repo, cache, conta.Declarante, declarado, "", false)
+		if err != nil {
+			return err
+		}
+		participante.TitularID = titular.ID
+	}
+
+	return nil
+}
@@ -0,0 +1,129 @@
+package cadastro
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"sped-efinanceira/eventos"
+	"sped-efinanceira/models"
+	"sped-efinanceira/repositories"
+	"sped-efinanceira/validacao"
+)
+
+// ValidarResidencias exige país válido e, para cada residência fiscal, o NIF
+// ou o motivo da sua ausência
+func ValidarResidencias(residencias []models.ResidenciaFiscal) error {
+	for i := range residencias {
+		residencia := &residencias[i]
+		residencia.Pais = strings.ToUpper(strings.TrimSpace(residencia.Pais))
+		residencia.NIF = strings.TrimSpace(residencia.NIF)
+
+		if !validacao.PaisValido(residencia.Pais) {
+			return fmt.Errorf("país de residência fiscal '%s' inválido", residencia.Pais)
+		}
+		if residencia.NIF == "" && strings.TrimSpace(residencia.MotivoSemNIF) == "" {
+			return fmt.Errorf("informe o NIF ou o motivo da ausência para a residência em %s", residencia.Pais)
+		}
+	}
+	return nil
+}
+
+// MarcarSituacao define a situação de cada autocertificação na data
+// informada. A lista deve estar da mais recente para a mais antiga: a
+// primeira de cada titular está vigente (ou vencida) e as demais foram
+// substituídas.
+func MarcarSituacao(autoCertificacoes []*models.AutoCertificacao, em time.Time) {
+	vistos := make(map[primitive.ObjectID]bool)
+
+	for _, autoCertificacao := range autoCertificacoes {
+		switch {
+		case vistos[autoCertificacao.TitularID]:
+			autoCertificacao.Situacao = models.AutoCertificacaoSubstituida
+		case autoCertificacao.DtValidade != nil && autoCertificacao.DtValidade.Before(em):
+			autoCertificacao.Situacao = models.AutoCertificacaoVencida
+		default:
+			autoCertificacao.Situacao = models.AutoCertificacaoVigente
+		}
+		vistos[autoCertificacao.TitularID] = true
+	}
+}
+
+// AutoCertificacoesVigentes devolve a autocertificação vigente de cada
+// titular e, para as NFEs passivas, as suas pessoas controladoras
+func AutoCertificacoesVigentes(crsRepo *repositories.CRSRepositorio, ids []primitive.ObjectID) (map[primitive.ObjectID]*models.AutoCertificacao, map[primitive.ObjectID][]*models.PessoaControladora, error) {
+	vigentes := make(map[primitive.ObjectID]*models.AutoCertificacao)
+	controladores := make(map[primitive.ObjectID][]*models.PessoaControladora)
+	if len(ids) == 0 {
+		return vigentes, controladores, nil
+	}
+
+	autoCertificacoes, err := crsRepo.ListarAutoCertificacoes(ids...)
+	if err != nil {
+		return nil, nil, err
+	}
+	MarcarSituacao(autoCertificacoes, time.Now())
+
+	var passivas []primitive.ObjectID
+	for _, autoCertificacao := range autoCertificacoes {
+		if autoCertificacao.Situacao != models.AutoCertificacaoVigente {
+			continue
+		}
+		vigentes[autoCertificacao.TitularID] = autoCertificacao
+		if autoCertificacao.TipoEntidade == models.EntidadeNFEPassiva {
+			passivas = append(passivas, autoCertificacao.TitularID)
+		}
+	}
+
+	if len(passivas) > 0 {
+		pessoas, err := crsRepo.ListarPessoasControladoras(passivas...)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, pessoa := range pessoas {
+			controladores[pessoa.EntidadeID] = append(controladores[pessoa.EntidadeID], pessoa)
+		}
+	}
+
+	return vigentes, controladores, nil
+}
+
+// Preenche as residências fiscais e, para NFEs passivas, as pessoas
+// controladoras a partir da autocertificação vigente de cada declarado
+func completarCRS(crsRepo *repositories.CRSRepositorio, lista []*models.Evento, ids []primitive.ObjectID) error {
+	vigentes, controladores, err := AutoCertificacoesVigentes(crsRepo, ids)
+	if err != nil {
+		return err
+	}
+
+	for _, evento := range lista {
+		if evento.Movimento == nil || evento.Movimento.TitularID == nil || !eventos.Editavel(evento.Status) {
+			continue
+		}
+
+		id := *evento.Movimento.TitularID
+		vigente, ok := vigentes[id]
+		if !ok {
+			continue
+		}
+
+		evento.Movimento.Declarado.Residencias = vigente.Residencias
+		evento.Movimento.Declarado.Controladores = nil
+		for _, pessoa := range controladores[id] {
+			evento.Movimento.Declarado.Controladores = append(evento.Movimento.Declarado.Controladores, models.ControladorDeclarado{
+				TpControle:    pessoa.TpControle,
+				NI:            pessoa.NI,
+				Nome:          pessoa.Nome,
+				Endereco:      pessoa.Endereco,
+				PaisEndereco:  pessoa.PaisEndereco,
+				Nacionalidade: pessoa.Nacionalidade,
+				DtNascimento:  pessoa.DtNascimento,
+				Residencias:   pessoa.Residencias,
+			})
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,310 @@
+package cadastro
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"sped-efinanceira/eventos"
+	"sped-efinanceira/models"
+	"sped-efinanceira/repositories"
+	"sped-efinanceira/validacao"
+)
+
+type campoTitular struct {
+	nome  string
+	valor func(t *models.Titular) *string
+}
+
+// Campos cadastrais sujeitos às regras de mesclagem
+var camposTitular = []campoTitular{
+	{"nome", func(t *models.Titular) *string { return &t.Nome }},
+	{"endereco", func(t *models.Titular) *string { return &t.Endereco }},
+	{"pais_endereco", func(t *models.Titular) *string { return &t.PaisEndereco }},
+	{"nacionalidade", func(t *models.Titular) *string { return &t.Nacionalidade }},
+}
+
+var semAcentos = strings.NewReplacer(
+	"á", "a", "à", "a", "â", "a", "ã", "a", "ä", "a",
+	"é", "e", "è", "e", "ê", "e", "ë", "e",
+	"í", "i", "ì", "i", "î", "i", "ï", "i",
+	"ó", "o", "ò", "o", "ô", "o", "õ", "o", "ö", "o",
+	"ú", "u", "ù", "u", "û", "u", "ü", "u",
+	"ç", "c", "ñ", "n",
+)
+
+// MesclarTitular aplica ao cadastro os dados recebidos de uma origem e
+// devolve as alterações, já acrescentadas ao histórico. Regras:
+//
+//   - valores vazios nunca apagam dados existentes;
+//   - valores que só diferem em maiúsculas, acentos ou espaços não são alteração;
+//   - campos editados manualmente só mudam por nova edição manual;
+//   - dados históricos (de eventos já aceitos) apenas preenchem campos vazios;
+//   - nos demais casos prevalece o dado mais recente.
+//
+// Divergências não aplicadas ficam no histórico uma única vez. A edição
+// manual (OrigemManual) substitui todos os campos e os marca como manuais.
+func MesclarTitular(titular *models.Titular, dados models.Declarado, origem string, historico bool) []models.AlteracaoTitular {
+	recebido := TitularDe(titular.Declarante, dados)
+	manual := origem == eventos.OrigemManual
+	agora := time.Now()
+
+	var alteracoes []models.AlteracaoTitular
+	for _, campo := range camposTitular {
+		atual := campo.valor(titular)
+		novo := *campo.valor(recebido)
+
+		var aplicar bool
+		if manual {
+			if novo == *atual {
+				continue
+			}
+			aplicar = true
+			if !contem(titular.CamposManuais, campo.nome) {
+				titular.CamposManuais = append(titular.CamposManuais, campo.nome)
+			}
+		} else {
+			if novo == "" || Equivalentes(*atual, novo) {
+				continue
+			}
+			aplicar = *atual == "" || (!historico && !contem(titular.CamposManuais, campo.nome))
+			if !aplicar && divergenciaRegistrada(titular.Historico, campo.nome, novo) {
+				continue
+			}
+		}
+
+		alteracoes = append(alteracoes, models.AlteracaoTitular{
+			Campo:         campo.nome,
+			ValorAnterior: *atual,
+			ValorNovo:     novo,
+			Origem:        origem,
+			Aplicada:      aplicar,
+			Data:          agora,
+		})
+		if aplicar {
+			*atual = novo
+		}
+	}
+
+	titular.Historico = append(titular.Historico, alteracoes...)
+	return alteracoes
+}
+
+// VincularTitulares mescla os declarados dos eventos de movimento no cadastro
+// e faz cada evento apontar para o titular. Em rascunhos, o evento passa a
+// guardar apenas o documento; eventos aceitos mantêm os dados enviados.
+func VincularTitulares(repo *repositories.TitularRepositorio, lista []*models.Evento, origem string) error {
+	cache := make(map[string]*models.Titular)
+
+	for _, evento := range lista {
+		if evento.Movimento == nil {
+			continue
+		}
+
+		declarado := evento.Movimento.Declarado
+		declarado.NI = validacao.SomenteDigitos(declarado.NI)
+		if declarado.NI == "" {
+			continue
+		}
+
+		titular, err := mesclarNoCadastro(repo, cache, evento.Declarante, declarado, origem, evento.Status == models.EventoAceito)
+		if err != nil {
+			return err
+		}
+
+		evento.Movimento.TitularID = &titular.ID
+		if eventos.Editavel(evento.Status) {
+			evento.Movimento.Declarado = models.Declarado{TpNI: titular.TpNI, NI: titular.NI}
+		}
+	}
+
+	return nil
+}
+
+// LocalizarTitulares faz os eventos de movimento apontarem para os titulares
+// já cadastrados, sem alterar o cadastro. Declarados ainda sem cadastro
+// mantêm os dados do evento.
+func LocalizarTitulares(repo *repositories.TitularRepositorio, lista []*models.Evento) error {
+	for _, evento := range lista {
+		if evento.Movimento == nil || evento.Movimento.TitularID != nil {
+			continue
+		}
+
+		ni := validacao.SomenteDigitos(evento.Movimento.Declarado.NI)
+		if ni == "" {
+			continue
+		}
+
+		titular, err := repo.BuscarTitular(evento.Declarante, ni)
+		if err != nil {
+			return err
+		}
+		if titular != nil {
+			evento.Movimento.TitularID = &titular.ID
+		}
+	}
+
+	return nil
+}
+
+func mesclarNoCadastro(repo *repositories.TitularRepositorio, cache map[string]*models.Titular, declarante string, declarado models.Declarado, origem string, historico bool) (*models.Titular, error) {
+	chave := declarante + "|" + declarado.NI
+	titular, ok := cache[chave]
+	if !ok {
+		var err error
+		titular, err = repo.BuscarTitular(declarante, declarado.NI)
+		if err != nil {
+			return nil, err
+		}
+
+		if titular == nil {
+			titular = TitularDe(declarante, declarado)
+			if titular.PaisEndereco == "" {
+				titular.PaisEndereco = "BR"
+			}
+
+			err = repo.CriarTitular(titular)
+			if mongo.IsDuplicateKeyError(err) {
+				// Criado por outra importação em paralelo
+				return mesclarNoCadastro(repo, cache, declarante, declarado, origem, historico)
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			cache[chave] = titular
+			return titular, nil
+		}
+		cache[chave] = titular
+	}
+
+	alteracoes := MesclarTitular(titular, declarado, origem, historico)
+	if len(alteracoes) > 0 {
+		if err := repo.EditarTitular(titular, alteracoes); err != nil {
+			return nil, err
+		}
+	}
+
+	return titular, nil
+}
+
+// ResolverDeclarados preenche os dados do declarado dos eventos ainda não
+// assinados a partir do cadastro atual de titulares e da autocertificação
+// vigente (blocos do CRS)
+func ResolverDeclarados(titularRepo *repositories.TitularRepositorio, crsRepo *repositories.CRSRepositorio, lista ...*models.Evento) error {
+	var ids []primitive.ObjectID
+	for _, evento := range lista {
+		if evento.Movimento != nil && evento.Movimento.TitularID != nil && eventos.Editavel(evento.Status) {
+			ids = append(ids, *evento.Movimento.TitularID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	titulares, err := titularRepo.ListarTitularesPorIDs(ids)
+	if err != nil {
+		return err
+	}
+
+	for _, evento := range lista {
+		if evento.Movimento == nil || evento.Movimento.TitularID == nil || !eventos.Editavel(evento.Status) {
+			continue
+		}
+		if titular, ok := titulares[*evento.Movimento.TitularID]; ok {
+			evento.Movimento.Declarado = DeclaradoDe(titular)
+		}
+	}
+
+	return completarCRS(crsRepo, lista, ids)
+}
+
+// AplicarDadosIndicios copia da edição manual os telefones, o país de
+// nascimento e os países das instruções permanentes
+func AplicarDadosIndicios(titular, dados *models.Titular) error {
+	paises := append([]string{dados.PaisNascimento}, dados.InstrucoesPermanentes...)
+	for _, pais := range paises {
+		pais = strings.ToUpper(strings.TrimSpace(pais))
+		if pais != "" && !validacao.PaisValido(pais) {
+			return fmt.Errorf("país '%s' inválido", pais)
+		}
+	}
+
+	titular.Telefones = nil
+	for _, telefone := range dados.Telefones {
+		if telefone = normalizarEspacos(telefone); telefone != "" {
+			titular.Telefones = append(titular.Telefones, telefone)
+		}
+	}
+
+	titular.PaisNascimento = strings.ToUpper(strings.TrimSpace(dados.PaisNascimento))
+
+	titular.InstrucoesPermanentes = nil
+	for _, pais := range dados.InstrucoesPermanentes {
+		if pais = strings.ToUpper(strings.TrimSpace(pais)); pais != "" {
+			titular.InstrucoesPermanentes = append(titular.InstrucoesPermanentes, pais)
+		}
+	}
+
+	return nil
+}
+
+// TitularDe monta um cadastro a partir dos dados de um declarado
+func TitularDe(declarante string, declarado models.Declarado) *models.Titular {
+	ni := validacao.SomenteDigitos(declarado.NI)
+	return &models.Titular{
+		Declarante:    declarante,
+		TpNI:          eventos.TipoNI(ni),
+		NI:            ni,
+		Nome:          normalizarEspacos(declarado.Nome),
+		Endereco:      normalizarEspacos(declarado.Endereco),
+		PaisEndereco:  strings.ToUpper(strings.TrimSpace(declarado.PaisEndereco)),
+		Nacionalidade: strings.ToUpper(strings.TrimSpace(declarado.Nacionalidade)),
+	}
+}
+
+// DeclaradoDe converte o cadastro para o bloco ideDeclarado do evento
+func DeclaradoDe(titular *models.Titular) models.Declarado {
+	return models.Declarado{
+		TpNI:          titular.TpNI,
+		NI:            titular.NI,
+		Nome:          titular.Nome,
+		Endereco:      titular.Endereco,
+		PaisEndereco:  titular.PaisEndereco,
+		Nacionalidade: titular.Nacionalidade,
+	}
+}
+
+// Equivalentes compara textos ignorando maiúsculas, acentos e espaços extras
+func Equivalentes(a, b string) bool {
+	return chaveComparacao(a) == chaveComparacao(b)
+}
+
+func chaveComparacao(valor string) string {
+	return semAcentos.Replace(strings.ToLower(normalizarEspacos(valor)))
+}
+
+func normalizarEspacos(valor string) string {
+	return strings.Join(strings.Fields(valor), " ")
+}
+
+func divergenciaRegistrada(historico []models.AlteracaoTitular, campo, valor string) bool {
+	for i := len(historico) - 1; i >= 0; i-- {
+		if historico[i].Campo == campo {
+			return !historico[i].Aplicada && Equivalentes(historico[i].ValorNovo, valor)
+		}
+	}
+	return false
+}
+
+func contem(lista []string, valor string) bool {
+	for _, item := range lista {
+		if item == valor {
+			return true
+		}
+	}
+	return false
+}
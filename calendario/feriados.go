@@ -0,0 +1,106 @@
+package calendario
+
+import (
+	"sort"
+	"time"
+)
+
+// Feriado nacional, incluindo os dias sem expediente bancário do Carnaval
+type Feriado struct {
+	Data time.Time `json:"data"`
+	Nome string    `json:"nome"`
+}
+
+// Feriados retorna os feriados nacionais do ano em ordem de data. Os
+// móveis (Carnaval, Sexta-feira Santa e Corpus Christi) seguem a Páscoa.
+func Feriados(ano int) []Feriado {
+	data := func(mes time.Month, dia int) time.Time {
+		return time.Date(ano, mes, dia, 0, 0, 0, 0, time.UTC)
+	}
+
+	feriados := []Feriado{
+		{data(time.January, 1), "Confraternização Universal"},
+		{data(time.April, 21), "Tiradentes"},
+		{data(time.May, 1), "Dia do Trabalho"},
+		{data(time.September, 7), "Independência do Brasil"},
+		{data(time.October, 12), "Nossa Senhora Aparecida"},
+		{data(time.November, 2), "Finados"},
+		{data(time.November, 15), "Proclamação da República"},
+		{data(time.December, 25), "Natal"},
+	}
+	if ano >= 2024 {
+		feriados = append(feriados, Feriado{data(time.November, 20), "Dia Nacional de Zumbi e da Consciência Negra"})
+	}
+
+	pascoa := Pascoa(ano)
+	feriados = append(feriados,
+		Feriado{pascoa.AddDate(0, 0, -48), "Carnaval"},
+		Feriado{pascoa.AddDate(0, 0, -47), "Carnaval"},
+		Feriado{pascoa.AddDate(0, 0, -2), "Sexta-feira Santa"},
+		Feriado{pascoa.AddDate(0, 0, 60), "Corpus Christi"},
+	)
+
+	sort.Slice(feriados, func(i, j int) bool { return feriados[i].Data.Before(feriados[j].Data) })
+	return feriados
+}
+
+// Pascoa calcula o domingo de Páscoa pelo algoritmo de Meeus/Jones/Butcher
+func Pascoa(ano int) time.Time {
+	a := ano % 19
+	b := ano / 100
+	c := ano % 100
+	d := b / 4
+	e := b % 4
+	f := (b + 8) / 25
+	g := (b - f + 1) / 3
+	h := (19*a + b - d - g + 15) % 30
+	i := c / 4
+	k := c % 4
+	l := (32 + 2*e + 2*i - h - k) % 7
+	m := (a + 11*h + 22*l) / 451
+	mes := (h + l - 7*m + 114) / 31
+	dia := (h+l-7*m+114)%31 + 1
+	return time.Date(ano, time.Month(mes), dia, 0, 0, 0, 0, time.UTC)
+}
+
+// DiaUtil indica se a data não cai em fim de semana nem em feriado nacional
+func DiaUtil(data time.Time) bool {
+	if data.Weekday() == time.Saturday || data.Weekday() == time.Sunday {
+		return false
+	}
+	for _, feriado := range Feriados(data.Year()) {
+		if mesmoDia(feriado.Data, data) {
+			return false
+		}
+	}
+	return true
+}
+
+// UltimoDiaUtil retorna o último dia útil do mês
+func UltimoDiaUtil(ano int, mes time.Month) time.Time {
+	dia := time.Date(ano, mes+1, 0, 0, 0, 0, 0, time.UTC)
+	for !DiaUtil(dia) {
+		dia = dia.AddDate(0, 0, -1)
+	}
+	return dia
+}
+
+// DiasUteisEntre conta os dias úteis depois de inicio até fim, inclusive
+func DiasUteisEntre(inicio, fim time.Time) int {
+	dias := 0
+	for dia := Data(inicio).AddDate(0, 0, 1); !dia.After(Data(fim)); dia = dia.AddDate(0, 0, 1) {
+		if DiaUtil(dia) {
+			dias++
+		}
+	}
+	return dias
+}
+
+// Data descarta o horário, mantendo o dia do calendário
+func Data(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func mesmoDia(a, b time.Time) bool {
+	return a.Year() == b.Year() && a.Month() == b.Month() && a.Day() == b.Day()
+}
@@ -0,0 +1,154 @@
+package calendario
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"sped-efinanceira/middlewares"
+	"sped-efinanceira/repositories"
+)
+
+// Antecedências padrão, em dias antes do prazo, para os lembretes
+const antecedenciasPadrao = "30,15,7,3,1"
+
+// Antecedência usada para o aviso único de prazo vencido
+const antecedenciaVencido = -1
+
+// Lembretes envia por e-mail os avisos de prazos próximos ou vencidos. Cada
+// aviso (declarante, período e antecedência) é enviado uma única vez.
+type Lembretes struct {
+	eventoRepo    *repositories.EventoRepositorio
+	periodoRepo   *repositories.PeriodoRepositorio
+	lembreteRepo  *repositories.LembreteRepositorio
+	destinatarios []string
+	antecedencias []int
+	intervalo     time.Duration
+}
+
+// NovoLembretes configura os lembretes a partir das variáveis CALENDARIO_*
+func NovoLembretes(eventoRepo *repositories.EventoRepositorio, periodoRepo *repositories.PeriodoRepositorio, lembreteRepo *repositories.LembreteRepositorio) (*Lembretes, error) {
+	lembretes := &Lembretes{
+		eventoRepo:   eventoRepo,
+		periodoRepo:  periodoRepo,
+		lembreteRepo: lembreteRepo,
+		intervalo:    time.Hour,
+	}
+
+	for _, email := range strings.Split(os.Getenv("CALENDARIO_EMAIL"), ",") {
+		if email = strings.TrimSpace(email); email != "" {
+			lembretes.destinatarios = append(lembretes.destinatarios, email)
+		}
+	}
+	if len(lembretes.destinatarios) == 0 {
+		return nil, fmt.Errorf("a variável CALENDARIO_EMAIL deve ser definida")
+	}
+
+	valor := os.Getenv("CALENDARIO_ANTECEDENCIA")
+	if valor == "" {
+		valor = antecedenciasPadrao
+	}
+	for _, parte := range strings.Split(valor, ",") {
+		dias, err := strconv.Atoi(strings.TrimSpace(parte))
+		if err != nil || dias < 0 {
+			return nil, fmt.Errorf("CALENDARIO_ANTECEDENCIA inválido: '%s'", valor)
+		}
+		lembretes.antecedencias = append(lembretes.antecedencias, dias)
+	}
+	sort.Ints(lembretes.antecedencias)
+
+	return lembretes, nil
+}
+
+// Iniciar verifica os prazos agora e depois a cada intervalo; deve rodar
+// em uma goroutine
+func (l *Lembretes) Iniciar() {
+	log.Printf("📅 Lembretes de prazos da e-Financeira com antecedência de %v dias", l.antecedencias)
+
+	l.Verificar(time.Now())
+
+	ticker := time.NewTicker(l.intervalo)
+	defer ticker.Stop()
+
+	for agora := range ticker.C {
+		l.Verificar(agora)
+	}
+}
+
+// Verificar envia os lembretes devidos na data
+func (l *Lembretes) Verificar(hoje time.Time) {
+	prazos, err := Prazos(l.eventoRepo, l.periodoRepo, nil, PeriodosEmAberto(hoje), hoje)
+	if err != nil {
+		log.Println("Erro ao calcular os prazos da e-Financeira:", err)
+		return
+	}
+
+	var avisos []*PrazoDeclarante
+	for _, prazo := range prazos {
+		antecedencia, ok := l.antecedenciaDevida(prazo)
+		if !ok {
+			continue
+		}
+
+		novo, err := l.lembreteRepo.RegistrarLembrete(prazo.Declarante, prazo.Periodo, antecedencia)
+		if err != nil {
+			log.Println("Erro ao registrar lembrete:", err)
+			continue
+		}
+		if novo {
+			avisos = append(avisos, prazo)
+		}
+	}
+
+	if len(avisos) > 0 {
+		l.enviar(avisos)
+	}
+}
+
+// A menor antecedência já alcançada; períodos vencidos recebem um aviso
+// próprio e períodos entregues, nenhum
+func (l *Lembretes) antecedenciaDevida(prazo *PrazoDeclarante) (int, bool) {
+	switch prazo.Situacao {
+	case PrazoEnviado, PrazoEnviadoEmAtraso:
+		return 0, false
+	case PrazoAtrasado:
+		return antecedenciaVencido, true
+	}
+
+	for _, dias := range l.antecedencias {
+		if prazo.DiasRestantes <= dias {
+			return dias, true
+		}
+	}
+	return 0, false
+}
+
+func (l *Lembretes) enviar(avisos []*PrazoDeclarante) {
+	vencidos := 0
+	var corpo strings.Builder
+	fmt.Fprintf(&corpo, "Prazos de entrega da e-Financeira:\n\n")
+	for _, aviso := range avisos {
+		if aviso.Situacao == PrazoAtrasado {
+			vencidos++
+			fmt.Fprintf(&corpo, "[VENCIDO] %s, período %s: prazo era %s\n",
+				aviso.Declarante, aviso.Periodo, aviso.Prazo.Format("02/01/2006"))
+			continue
+		}
+		fmt.Fprintf(&corpo, "[%s] %s, período %s: vence em %s (%d dia(s), %d útil(eis))\n",
+			strings.ToUpper(aviso.Situacao), aviso.Declarante, aviso.Periodo, aviso.Prazo.Format("02/01/2006"),
+			aviso.DiasRestantes, aviso.DiasUteisRestantes)
+	}
+
+	assunto := fmt.Sprintf("e-Financeira: %d prazo(s) próximo(s), %d vencido(s)", len(avisos)-vencidos, vencidos)
+
+	emailMiddleware := middlewares.NovoEmailMiddleware()
+	for _, destinatario := range l.destinatarios {
+		if err := emailMiddleware.SendEmail(destinatario, assunto, corpo.String()); err != nil {
+			log.Println("Erro ao enviar lembrete de prazos:", err)
+		}
+	}
+}
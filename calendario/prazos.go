@@ -0,0 +1,147 @@
+package calendario
+
+import (
+	"fmt"
+	"time"
+
+	"sped-efinanceira/eventos"
+	"sped-efinanceira/models"
+	"sped-efinanceira/repositories"
+)
+
+// Situação da entrega de um período
+const (
+	PrazoPendente        = "pendente"
+	PrazoEmAndamento     = "em_andamento"
+	PrazoEnviado         = "enviado"
+	PrazoEnviadoEmAtraso = "enviado_em_atraso"
+	PrazoAtrasado        = "atrasado"
+)
+
+// PrazoDeclarante mostra, para um declarante e período, o prazo de entrega
+// e em que pé está o envio. A entrega só se completa com o fechamento aceito.
+type PrazoDeclarante struct {
+	Declarante         string         `json:"declarante"`
+	Periodo            string         `json:"periodo"`
+	Prazo              time.Time      `json:"prazo"`
+	Situacao           string         `json:"situacao"`
+	DiasRestantes      int            `json:"dias_restantes"`
+	DiasUteisRestantes int            `json:"dias_uteis_restantes"`
+	FechadoEm          *time.Time     `json:"fechado_em,omitempty"`
+	Eventos            map[string]int `json:"eventos"`
+}
+
+// PrazoEntrega retorna o último dia para entregar o semestre: o último dia
+// útil de agosto para o primeiro semestre e o de fevereiro do ano seguinte
+// para o segundo
+func PrazoEntrega(periodo string) (time.Time, error) {
+	ano, semestre, err := eventos.ParsePeriodo(periodo)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if semestre == 1 {
+		return UltimoDiaUtil(ano, time.August), nil
+	}
+	return UltimoDiaUtil(ano+1, time.February), nil
+}
+
+// PeriodosDoAno retorna os semestres cujo prazo vence no ano
+func PeriodosDoAno(ano int) []string {
+	return []string{fmt.Sprintf("%d-2", ano-1), fmt.Sprintf("%d-1", ano)}
+}
+
+// PeriodosEmAberto retorna os semestres já encerrados que ainda podem ter
+// entrega pendente na data: o último semestre e o anterior a ele
+func PeriodosEmAberto(hoje time.Time) []string {
+	ultimo, _ := eventos.PeriodoAnterior(eventos.PeriodoDe(hoje))
+	penultimo, _ := eventos.PeriodoAnterior(ultimo)
+	return []string{penultimo, ultimo}
+}
+
+// Situacao calcula o prazo do período a partir do registro do período e dos
+// eventos do declarante
+func Situacao(declarante, periodo string, registro *models.PeriodoDeclarante, lista []*models.Evento, hoje time.Time) (*PrazoDeclarante, error) {
+	prazo, err := PrazoEntrega(periodo)
+	if err != nil {
+		return nil, err
+	}
+
+	hoje = Data(hoje)
+	resultado := &PrazoDeclarante{
+		Declarante:    declarante,
+		Periodo:       periodo,
+		Prazo:         prazo,
+		DiasRestantes: int(prazo.Sub(hoje).Hours() / 24),
+		Eventos:       make(map[string]int),
+	}
+	if !hoje.After(prazo) {
+		resultado.DiasUteisRestantes = DiasUteisEntre(hoje, prazo)
+	}
+
+	enviados := 0
+	for _, evento := range lista {
+		resultado.Eventos[evento.Status]++
+		if eventos.Enviado(evento.Status) {
+			enviados++
+		}
+	}
+
+	if registro != nil {
+		for _, situacao := range registro.Historico {
+			if situacao.Situacao == models.PeriodoFechado {
+				data := situacao.Data
+				resultado.FechadoEm = &data
+				break
+			}
+		}
+	}
+
+	switch {
+	case resultado.FechadoEm != nil && Data(*resultado.FechadoEm).After(prazo):
+		resultado.Situacao = PrazoEnviadoEmAtraso
+	case resultado.FechadoEm != nil:
+		resultado.Situacao = PrazoEnviado
+	case hoje.After(prazo):
+		resultado.Situacao = PrazoAtrasado
+	case enviados > 0:
+		resultado.Situacao = PrazoEmAndamento
+	default:
+		resultado.Situacao = PrazoPendente
+	}
+
+	return resultado, nil
+}
+
+// Prazos calcula a situação dos períodos para cada declarante. Sem
+// declarantes informados, considera todos os que têm eventos.
+func Prazos(eventoRepo *repositories.EventoRepositorio, periodoRepo *repositories.PeriodoRepositorio, declarantes, periodos []string, hoje time.Time) ([]*PrazoDeclarante, error) {
+	if len(declarantes) == 0 {
+		var err error
+		declarantes, err = eventoRepo.ListarDeclarantes()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var prazos []*PrazoDeclarante
+	for _, declarante := range declarantes {
+		for _, periodo := range periodos {
+			registro, err := periodoRepo.BuscarPeriodo(declarante, periodo)
+			if err != nil {
+				return nil, err
+			}
+			lista, err := eventoRepo.ListarEventos(declarante, periodo, "", "")
+			if err != nil {
+				return nil, err
+			}
+
+			prazo, err := Situacao(declarante, periodo, registro, lista, hoje)
+			if err != nil {
+				return nil, err
+			}
+			prazos = append(prazos, prazo)
+		}
+	}
+
+	return prazos, nil
+}
@@ -0,0 +1,109 @@
+package cambio
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"sped-efinanceira/models"
+	"sped-efinanceira/repositories"
+)
+
+// MoedaNacional não precisa de conversão
+const MoedaNacional = "BRL"
+
+// Dias que se busca para trás quando o último dia do mês não tem boletim
+// (fins de semana e feriados)
+const diasSemBoletim = 10
+
+// Conversor converte os meses das contas em moeda estrangeira pela taxa de
+// venda PTAX do último dia útil do mês. A mesma taxa vale para os totais de
+// créditos e débitos e para o saldo do último dia, que são apurados por mês.
+type Conversor struct {
+	repo  *repositories.CotacaoRepositorio
+	cache map[string]*models.Cotacao
+}
+
+func NovoConversor(repo *repositories.CotacaoRepositorio) *Conversor {
+	return &Conversor{
+		repo:  repo,
+		cache: make(map[string]*models.Cotacao),
+	}
+}
+
+// ConverterEventos converte as contas dos eventos de movimento
+func (c *Conversor) ConverterEventos(lista []*models.Evento) error {
+	for _, evento := range lista {
+		if evento.Movimento == nil {
+			continue
+		}
+		for i := range evento.Movimento.Contas {
+			if err := c.ConverterConta(&evento.Movimento.Contas[i]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ConverterConta converte para reais os meses ainda não convertidos e
+// registra a cotação usada
+func (c *Conversor) ConverterConta(conta *models.ContaMovimento) error {
+	if conta.Moeda == "" || conta.Moeda == MoedaNacional {
+		return nil
+	}
+
+	for i := range conta.Meses {
+		mes := &conta.Meses[i]
+		if mes.Cotacao != nil {
+			continue
+		}
+
+		referencia, err := time.Parse("200601", mes.AnoMes)
+		if err != nil {
+			return fmt.Errorf("mês '%s' inválido na conta %s", mes.AnoMes, conta.NumConta)
+		}
+		cotacao, err := c.Cotacao(conta.Moeda, referencia.AddDate(0, 1, -1))
+		if err != nil {
+			return fmt.Errorf("conta %s: %v", conta.NumConta, err)
+		}
+
+		mes.Cotacao = &models.CotacaoUtilizada{
+			Moeda:               cotacao.Moeda,
+			Data:                cotacao.Data,
+			Taxa:                cotacao.TaxaVenda,
+			TotCreditosOriginal: mes.TotCreditos,
+			TotDebitosOriginal:  mes.TotDebitos,
+			VlrUltDiaOriginal:   mes.VlrUltDia,
+		}
+		mes.TotCreditos = Converter(mes.TotCreditos, cotacao.TaxaVenda)
+		mes.TotDebitos = Converter(mes.TotDebitos, cotacao.TaxaVenda)
+		mes.VlrUltDia = Converter(mes.VlrUltDia, cotacao.TaxaVenda)
+	}
+
+	return nil
+}
+
+// Cotacao devolve o último boletim da moeda até a data informada
+func (c *Conversor) Cotacao(moeda string, data time.Time) (*models.Cotacao, error) {
+	chave := ChaveCotacao(moeda, data)
+	if cotacao, ok := c.cache[chave]; ok {
+		return cotacao, nil
+	}
+
+	cotacao, err := c.repo.BuscarCotacao(moeda, data.AddDate(0, 0, -diasSemBoletim), data)
+	if err != nil {
+		return nil, err
+	}
+	if cotacao == nil {
+		return nil, fmt.Errorf("sem cotação PTAX de %s até %s; carregue o arquivo do Banco Central", moeda, data.Format("02/01/2006"))
+	}
+
+	c.cache[chave] = cotacao
+	return cotacao, nil
+}
+
+// Converter aplica a taxa e arredonda para centavos
+func Converter(valor, taxa float64) float64 {
+	return math.Round(valor*taxa*100) / 100
+}
@@ -0,0 +1,103 @@
+// Package cambio carrega as cotações PTAX do Banco Central e converte para
+// reais os valores das contas em moeda estrangeira.
+package cambio
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"sped-efinanceira/models"
+	"sped-efinanceira/validacao"
+)
+
+// ResultadoPTAX traz as cotações lidas e as linhas rejeitadas
+type ResultadoPTAX struct {
+	Cotacoes []models.Cotacao
+	Erros    []string
+}
+
+// LerArquivoPTAX interpreta o CSV do boletim de fechamento PTAX, separado por
+// ponto e vírgula e sem cabeçalho:
+//
+//	DDMMAAAA;código;tipo;moeda;compra;venda;paridade compra;paridade venda
+//
+// Um arquivo pode trazer vários dias (série histórica) ou apenas um.
+func LerArquivoPTAX(arquivo io.Reader, nome string) (*ResultadoPTAX, error) {
+	resultado := &ResultadoPTAX{}
+	agora := time.Now()
+
+	leitor := bufio.NewScanner(arquivo)
+	numero := 0
+	for leitor.Scan() {
+		numero++
+		linha := strings.TrimSpace(strings.TrimPrefix(leitor.Text(), "\ufeff"))
+		if linha == "" {
+			continue
+		}
+
+		cotacao, err := lerLinhaPTAX(linha)
+		if err != nil {
+			resultado.Erros = append(resultado.Erros, fmt.Sprintf("linha %d: %v", numero, err))
+			continue
+		}
+		cotacao.Arquivo = nome
+		cotacao.CreatedAt = agora
+		resultado.Cotacoes = append(resultado.Cotacoes, *cotacao)
+	}
+	if err := leitor.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(resultado.Cotacoes) == 0 {
+		return nil, fmt.Errorf("nenhuma cotação válida no arquivo")
+	}
+	return resultado, nil
+}
+
+func lerLinhaPTAX(linha string) (*models.Cotacao, error) {
+	campos := strings.Split(linha, ";")
+	if len(campos) < 8 {
+		return nil, fmt.Errorf("esperados 8 campos, encontrados %d", len(campos))
+	}
+
+	data, err := time.Parse("02012006", strings.TrimSpace(campos[0]))
+	if err != nil {
+		return nil, fmt.Errorf("data '%s' inválida, use DDMMAAAA", campos[0])
+	}
+
+	moeda := strings.ToUpper(strings.TrimSpace(campos[3]))
+	if !validacao.MoedaValida(moeda) {
+		return nil, fmt.Errorf("moeda '%s' inválida", campos[3])
+	}
+
+	var taxas [4]float64
+	for i := range taxas {
+		taxas[i], err = validacao.ParseDecimalBR(campos[4+i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	if taxas[1] <= 0 {
+		return nil, fmt.Errorf("taxa de venda de %s deve ser positiva", moeda)
+	}
+
+	return &models.Cotacao{
+		ID:             ChaveCotacao(moeda, data),
+		Moeda:          moeda,
+		CodigoMoeda:    strings.TrimSpace(campos[1]),
+		Tipo:           strings.TrimSpace(campos[2]),
+		Data:           data,
+		TaxaCompra:     taxas[0],
+		TaxaVenda:      taxas[1],
+		ParidadeCompra: taxas[2],
+		ParidadeVenda:  taxas[3],
+	}, nil
+}
+
+// ChaveCotacao identifica a cotação de uma moeda em um dia
+func ChaveCotacao(moeda string, data time.Time) string {
+	return moeda + "|" + data.Format("2006-01-02")
+}
@@ -0,0 +1,224 @@
+// Package classificacao identifica as contas reportáveis ao FATCA e ao CRS
+// a partir dos indícios encontrados no cadastro de titulares.
+package classificacao
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"sped-efinanceira/models"
+	"sped-efinanceira/validacao"
+)
+
+// Regimes de reporte
+const (
+	RegimeFATCA = "FATCA"
+	RegimeCRS   = "CRS"
+)
+
+// Regras de indícios
+const (
+	RegraEndereco            = "endereco_exterior"
+	RegraTelefone            = "telefone_exterior"
+	RegraResidenciaFiscal    = "residencia_fiscal"
+	RegraNacionalidade       = "nacionalidade_eua"
+	RegraNascimento          = "nascimento_eua"
+	RegraInstrucaoPermanente = "instrucao_permanente"
+	RegraProcurador          = "procurador_exterior"
+	RegraControlador         = "pessoa_controladora"
+)
+
+const (
+	paisBrasil = "BR"
+	paisEUA    = "US"
+)
+
+// Códigos internacionais de telefone dos países mais frequentes; os demais
+// geram indício sem país identificado, para revisão
+var codigosTelefone = map[string]string{
+	"1":   paisEUA,
+	"27":  "ZA",
+	"33":  "FR",
+	"34":  "ES",
+	"39":  "IT",
+	"41":  "CH",
+	"44":  "GB",
+	"49":  "DE",
+	"351": "PT",
+	"52":  "MX",
+	"54":  "AR",
+	"55":  paisBrasil,
+	"56":  "CL",
+	"57":  "CO",
+	"595": "PY",
+	"598": "UY",
+	"81":  "JP",
+	"86":  "CN",
+}
+
+// Participante da conta com os dados usados na busca de indícios
+type Participante struct {
+	Papel            string
+	Titular          *models.Titular
+	AutoCertificacao *models.AutoCertificacao
+	Controladores    []*models.PessoaControladora
+}
+
+// Classificar aplica as regras de indícios aos participantes da conta.
+//
+// Sem autocertificação vigente, todo indício de país estrangeiro torna a
+// conta reportável para aquele país. Com autocertificação, valem as
+// residências fiscais declaradas (e, nas NFEs passivas, as das pessoas
+// controladoras); os indícios de cidadania e nascimento nos EUA continuam
+// valendo para o FATCA. Os demais indícios ficam como evidência para a
+// revisão.
+func Classificar(conta *models.Conta, participantes []Participante) *models.ClassificacaoConta {
+	classificacao := &models.ClassificacaoConta{
+		Declarante: conta.Declarante,
+		ContaID:    conta.ID,
+		NumConta:   conta.NumConta,
+		Evidencias: []models.Indicio{},
+		Situacao:   models.ClassificacaoPendente,
+	}
+
+	jurisdicoes := make(map[string]bool)
+	for _, participante := range participantes {
+		if participante.Titular == nil {
+			continue
+		}
+
+		indicios := Indicios(participante)
+		classificacao.Evidencias = append(classificacao.Evidencias, indicios...)
+
+		for _, indicio := range indicios {
+			if indicio.Pais == "" || indicio.Pais == paisBrasil {
+				continue
+			}
+			switch {
+			case participante.AutoCertificacao == nil:
+				jurisdicoes[indicio.Pais] = true
+			case indicio.Regra == RegraResidenciaFiscal || indicio.Regra == RegraControlador:
+				jurisdicoes[indicio.Pais] = true
+			case indicio.Regra == RegraNacionalidade || indicio.Regra == RegraNascimento:
+				jurisdicoes[indicio.Pais] = true
+			}
+		}
+	}
+
+	classificacao.Jurisdicoes = []string{}
+	for pais := range jurisdicoes {
+		classificacao.Jurisdicoes = append(classificacao.Jurisdicoes, pais)
+	}
+	sort.Strings(classificacao.Jurisdicoes)
+	classificacao.Reportavel = len(classificacao.Jurisdicoes) > 0
+
+	return classificacao
+}
+
+// Indicios devolve as evidências encontradas no cadastro do participante.
+// Do procurador só se considera o endereço.
+func Indicios(participante Participante) []models.Indicio {
+	titular := participante.Titular
+	var indicios []models.Indicio
+
+	adicionar := func(regra, campo, valor, pais, descricao string) {
+		regime := RegimeCRS
+		if pais == paisEUA {
+			regime = RegimeFATCA
+		}
+		indicios = append(indicios, models.Indicio{
+			Regra:     regra,
+			Regime:    regime,
+			NI:        titular.NI,
+			Campo:     campo,
+			Valor:     valor,
+			Pais:      pais,
+			Descricao: descricao,
+		})
+	}
+
+	if participante.Papel == models.PapelProcurador {
+		if estrangeiro(titular.PaisEndereco) {
+			adicionar(RegraProcurador, "pais_endereco", titular.PaisEndereco, titular.PaisEndereco, "Procurador com endereço no exterior")
+		}
+		return indicios
+	}
+
+	if estrangeiro(titular.PaisEndereco) {
+		adicionar(RegraEndereco, "pais_endereco", titular.PaisEndereco, titular.PaisEndereco, "Endereço no exterior")
+	}
+	if titular.Nacionalidade == paisEUA {
+		adicionar(RegraNacionalidade, "nacionalidade", titular.Nacionalidade, paisEUA, "Cidadania norte-americana")
+	}
+	if titular.PaisNascimento == paisEUA {
+		adicionar(RegraNascimento, "pais_nascimento", titular.PaisNascimento, paisEUA, "Nascimento nos EUA")
+	}
+
+	for _, telefone := range titular.Telefones {
+		pais, internacional := PaisTelefone(telefone)
+		if !internacional || pais == paisBrasil {
+			continue
+		}
+		descricao := "Telefone no exterior"
+		if pais == "" {
+			descricao = "Telefone internacional com código de país não identificado"
+		}
+		adicionar(RegraTelefone, "telefones", telefone, pais, descricao)
+	}
+
+	for _, pais := range titular.InstrucoesPermanentes {
+		if estrangeiro(pais) {
+			adicionar(RegraInstrucaoPermanente, "instrucoes_permanentes", pais, pais, "Instrução permanente de transferência para o exterior")
+		}
+	}
+
+	if autoCertificacao := participante.AutoCertificacao; autoCertificacao != nil {
+		for _, residencia := range autoCertificacao.Residencias {
+			if estrangeiro(residencia.Pais) {
+				adicionar(RegraResidenciaFiscal, "residencias", residencia.NIF, residencia.Pais, "Residência fiscal declarada na autocertificação")
+			}
+		}
+	}
+
+	for _, pessoa := range participante.Controladores {
+		for _, residencia := range pessoa.Residencias {
+			if estrangeiro(residencia.Pais) {
+				adicionar(RegraControlador, "controladores", pessoa.Nome, residencia.Pais,
+					fmt.Sprintf("Pessoa controladora (%s) com residência fiscal no exterior", pessoa.TpControle))
+			}
+		}
+	}
+
+	return indicios
+}
+
+// PaisTelefone identifica o país de um telefone no formato internacional
+// (+CC ou 00CC). Números sem prefixo internacional são considerados
+// nacionais.
+func PaisTelefone(telefone string) (string, bool) {
+	telefone = strings.TrimSpace(telefone)
+	internacional := strings.HasPrefix(telefone, "+")
+
+	digitos := validacao.SomenteDigitos(telefone)
+	if !internacional && strings.HasPrefix(digitos, "00") {
+		internacional = true
+		digitos = digitos[2:]
+	}
+	if !internacional {
+		return "", false
+	}
+
+	for tamanho := 3; tamanho >= 1; tamanho-- {
+		if len(digitos) > tamanho {
+			if pais, ok := codigosTelefone[digitos[:tamanho]]; ok {
+				return pais, true
+			}
+		}
+	}
+	return "", true
+}
+
+func estrangeiro(pais string) bool {
+	return pais != "" && pais != paisBrasil
+}
@@ -0,0 +1,110 @@
+package classificacao
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"sped-efinanceira/cadastro"
+	"sped-efinanceira/models"
+	"sped-efinanceira/repositories"
+)
+
+// ClassificarContas recalcula a classificação de todas as contas do
+// declarante. A revisão anterior é mantida enquanto o resultado automático
+// e as evidências não mudarem; caso contrário, a conta volta para revisão.
+func ClassificarContas(repo *repositories.ClassificacaoRepositorio, contaRepo *repositories.ContaRepositorio, titularRepo *repositories.TitularRepositorio, crsRepo *repositories.CRSRepositorio, declarante string) ([]*models.ClassificacaoConta, error) {
+	contas, err := contaRepo.ListarContas(declarante, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []primitive.ObjectID
+	var contaIDs []primitive.ObjectID
+	for _, conta := range contas {
+		contaIDs = append(contaIDs, conta.ID)
+		for _, participante := range conta.Titulares {
+			ids = append(ids, participante.TitularID)
+		}
+	}
+
+	titulares, err := titularRepo.ListarTitularesPorIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+	vigentes, controladores, err := cadastro.AutoCertificacoesVigentes(crsRepo, ids)
+	if err != nil {
+		return nil, err
+	}
+	anteriores, err := repo.ListarClassificacoesPorContas(contaIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	agora := time.Now()
+	classificacoes := []*models.ClassificacaoConta{}
+	for _, conta := range contas {
+		var participantes []Participante
+		for _, participante := range conta.Titulares {
+			participantes = append(participantes, Participante{
+				Papel:            participante.Papel,
+				Titular:          titulares[participante.TitularID],
+				AutoCertificacao: vigentes[participante.TitularID],
+				Controladores:    controladores[participante.TitularID],
+			})
+		}
+
+		classificacao := Classificar(conta, participantes)
+		classificacao.CalculadaEm = agora
+		if anterior, ok := anteriores[conta.ID]; ok {
+			classificacao.ID = anterior.ID
+			classificacao.CreatedAt = anterior.CreatedAt
+			classificacao.Revisoes = anterior.Revisoes
+			if anterior.Situacao != models.ClassificacaoPendente && mesmoResultado(anterior, classificacao) {
+				classificacao.Situacao = anterior.Situacao
+				classificacao.Revisao = anterior.Revisao
+			}
+		}
+
+		if err := repo.SalvarClassificacao(classificacao); err != nil {
+			return nil, err
+		}
+		classificacoes = append(classificacoes, classificacao)
+	}
+
+	return classificacoes, nil
+}
+
+// Resultado devolve a classificação efetiva: a do revisor, quando alterada,
+// ou a automática
+func Resultado(classificacao *models.ClassificacaoConta) (bool, []string) {
+	if classificacao.Situacao == models.ClassificacaoAlterada && classificacao.Revisao != nil {
+		return classificacao.Revisao.Reportavel, classificacao.Revisao.Jurisdicoes
+	}
+	return classificacao.Reportavel, classificacao.Jurisdicoes
+}
+
+func mesmoResultado(a, b *models.ClassificacaoConta) bool {
+	if a.Reportavel != b.Reportavel || !iguais(a.Jurisdicoes, b.Jurisdicoes) || len(a.Evidencias) != len(b.Evidencias) {
+		return false
+	}
+	for i := range a.Evidencias {
+		x, y := a.Evidencias[i], b.Evidencias[i]
+		if x.Regra != y.Regra || x.NI != y.NI || x.Valor != y.Valor || x.Pais != y.Pais {
+			return false
+		}
+	}
+	return true
+}
+
+func iguais(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
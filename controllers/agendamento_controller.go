@@ -0,0 +1,349 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator"
+	"github.com/gorilla/mux"
+
+	"sped-efinanceira/agenda"
+	"sped-efinanceira/common"
+	"sped-efinanceira/eventos"
+	"sped-efinanceira/middlewares"
+	"sped-efinanceira/models"
+	"sped-efinanceira/repositories"
+	"sped-efinanceira/validacao"
+)
+
+type AgendamentoController struct {
+	repo      *repositories.AgendamentoRepositorio
+	agendador *agenda.Agendador
+}
+
+func NovoAgendamentoController(repo *repositories.AgendamentoRepositorio, agendador *agenda.Agendador) *AgendamentoController {
+	return &AgendamentoController{
+		repo:      repo,
+		agendador: agendador,
+	}
+}
+
+// Criar Agendamento das etapas do semestre de um declarante
+func (ac *AgendamentoController) CriarAgendamento(w http.ResponseWriter, r *http.Request) {
+	var agendamento models.Agendamento
+	err := json.NewDecoder(r.Body).Decode(&agendamento)
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Pedido inválido!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	// Validar o modelo
+	err = validarAgendamento(&agendamento)
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Campos inválidos!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	agendamento.CriadoPor = middlewares.UsuarioLogado(r)
+	agendamento.UltimaExecucao = nil
+	agendamento.UltimaSituacao = ""
+
+	err = ac.repo.CriarAgendamento(&agendamento)
+	if err != nil {
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao criar Agendamento!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(agendamento)
+}
+
+// Listar Agendamentos, filtrando por declarante
+func (ac *AgendamentoController) ListarAgendamentos(w http.ResponseWriter, r *http.Request) {
+	agendamentos, err := ac.repo.ListarAgendamentos(validacao.SomenteDigitos(r.URL.Query().Get("declarante")))
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao listar Agendamentos!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	resposta := struct {
+		TotalAgendamentos int                   `json:"total_agendamentos"`
+		Agendamentos      []*models.Agendamento `json:"agendamentos"`
+	}{
+		TotalAgendamentos: len(agendamentos),
+		Agendamentos:      agendamentos,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resposta)
+}
+
+// Listar Agendamento por ID
+func (ac *AgendamentoController) ListarAgendamentoPorID(w http.ResponseWriter, r *http.Request) {
+	agendamento, err := ac.repo.ListarAgendamentoPorID(mux.Vars(r)["id"])
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Agendamento não encontrado!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(agendamento)
+}
+
+// Editar Agendamento; a próxima execução é recalculada pela expressão
+func (ac *AgendamentoController) EditarAgendamento(w http.ResponseWriter, r *http.Request) {
+	agendamento, err := ac.repo.ListarAgendamentoPorID(mux.Vars(r)["id"])
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Agendamento não encontrado!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	var dados models.Agendamento
+	err = json.NewDecoder(r.Body).Decode(&dados)
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Pedido inválido!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	// Validar o modelo
+	err = validarAgendamento(&dados)
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Campos inválidos!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	// Autor e histórico de execuções não mudam na edição
+	dados.ID = agendamento.ID
+	dados.CriadoPor = agendamento.CriadoPor
+	dados.UltimaExecucao = agendamento.UltimaExecucao
+	dados.UltimaSituacao = agendamento.UltimaSituacao
+	dados.CreatedAt = agendamento.CreatedAt
+
+	err = ac.repo.EditarAgendamento(&dados)
+	if err != nil {
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao editar Agendamento!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(dados)
+}
+
+// Deletar Agendamento
+func (ac *AgendamentoController) DeletarAgendamento(w http.ResponseWriter, r *http.Request) {
+	err := ac.repo.DeletarAgendamento(mux.Vars(r)["id"])
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao deletar Agendamento!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Executar o Agendamento agora, fora do horário previsto. As etapas rodam
+// em segundo plano; o andamento fica na execução devolvida.
+func (ac *AgendamentoController) ExecutarAgendamento(w http.ResponseWriter, r *http.Request) {
+	agendamento, err := ac.repo.ListarAgendamentoPorID(mux.Vars(r)["id"])
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Agendamento não encontrado!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	execucao, err := ac.agendador.Preparar(agendamento, middlewares.UsuarioLogado(r))
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao executar Agendamento!",
+			Message: err.Error(),
+		}
+
+		status := http.StatusInternalServerError
+		if err == agenda.ErroEmExecucao {
+			status = http.StatusConflict
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	go ac.agendador.Executar(agendamento, execucao)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(execucao)
+}
+
+// Listar as Execuções do Agendamento, das mais recentes às mais antigas
+func (ac *AgendamentoController) ListarExecucoes(w http.ResponseWriter, r *http.Request) {
+	agendamento, err := ac.repo.ListarAgendamentoPorID(mux.Vars(r)["id"])
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Agendamento não encontrado!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	execucoes, err := ac.repo.ListarExecucoes(agendamento.ID)
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao listar Execuções!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	resposta := struct {
+		TotalExecucoes int                           `json:"total_execucoes"`
+		Execucoes      []*models.ExecucaoAgendamento `json:"execucoes"`
+	}{
+		TotalExecucoes: len(execucoes),
+		Execucoes:      execucoes,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resposta)
+}
+
+// Normaliza o agendamento e calcula a próxima execução, que fica vazia
+// enquanto ele estiver inativo
+func validarAgendamento(agendamento *models.Agendamento) error {
+	agendamento.Declarante = validacao.SomenteDigitos(agendamento.Declarante)
+	agendamento.Expressao = strings.Join(strings.Fields(agendamento.Expressao), " ")
+	for i := range agendamento.Emails {
+		agendamento.Emails[i] = strings.TrimSpace(agendamento.Emails[i])
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(agendamento); err != nil {
+		return err
+	}
+	if !validacao.CNPJValido(agendamento.Declarante) {
+		return fmt.Errorf("O CNPJ do declarante é inválido.")
+	}
+	if agendamento.Periodo != "" {
+		if _, _, err := eventos.LimitesPeriodo(agendamento.Periodo); err != nil {
+			return err
+		}
+	}
+
+	etapas, err := agenda.NormalizarEtapas(agendamento.Etapas)
+	if err != nil {
+		return err
+	}
+	agendamento.Etapas = etapas
+
+	proxima, err := agenda.ProximaExecucao(agendamento.Expressao, time.Now())
+	if err != nil {
+		return err
+	}
+	agendamento.ProximaExecucao = nil
+	if agendamento.Ativo {
+		agendamento.ProximaExecucao = &proxima
+	}
+
+	return nil
+}
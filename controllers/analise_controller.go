@@ -0,0 +1,162 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"sped-efinanceira/analise"
+	"sped-efinanceira/common"
+	"sped-efinanceira/eventos"
+	"sped-efinanceira/layout"
+	"sped-efinanceira/repositories"
+	"sped-efinanceira/validacao"
+)
+
+// Critérios usados quando a consulta não informa outros
+const (
+	percentualVariacaoPadrao  = 50
+	valorMinimoVariacaoPadrao = 0
+)
+
+type AnaliseController struct {
+	eventoRepo *repositories.EventoRepositorio
+}
+
+func NovoAnaliseController(eventoRepo *repositories.EventoRepositorio) *AnaliseController {
+	return &AnaliseController{eventoRepo: eventoRepo}
+}
+
+// Comparar os totais declarados de cada titular entre dois períodos (padrão:
+// o semestre anterior), apontando variações acima dos critérios e contas ou
+// titulares novos e desaparecidos. Com formato=csv, devolve a planilha.
+func (ac *AnaliseController) AnalisarVariacao(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	declarante := validacao.SomenteDigitos(query.Get("declarante"))
+	periodo := query.Get("periodo")
+	anterior := query.Get("anterior")
+
+	criterios := analise.Criterios{
+		Percentual:  percentualVariacaoPadrao,
+		ValorMinimo: valorMinimoVariacaoPadrao,
+	}
+
+	// Validar os parâmetros
+	var err error
+	if !validacao.CNPJValido(declarante) {
+		err = fmt.Errorf("O CNPJ do declarante é inválido.")
+	}
+	if err == nil {
+		_, _, err = eventos.LimitesPeriodo(periodo)
+	}
+	if err == nil {
+		if anterior == "" {
+			anterior, err = eventos.PeriodoAnterior(periodo)
+		} else {
+			_, _, err = eventos.LimitesPeriodo(anterior)
+		}
+	}
+	if err == nil && query.Get("percentual") != "" {
+		criterios.Percentual, err = lerCriterio(query.Get("percentual"))
+	}
+	if err == nil && query.Get("valor_minimo") != "" {
+		criterios.ValorMinimo, err = lerCriterio(query.Get("valor_minimo"))
+	}
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Campos inválidos!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	anteriores, err := ac.eventoRepo.ListarEventos(declarante, anterior, eventos.TipoMovimento, "")
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao listar Eventos!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	atuais, err := ac.eventoRepo.ListarEventos(declarante, periodo, eventos.TipoMovimento, "")
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao listar Eventos!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	variacoes := analise.CompararPeriodos(anteriores, atuais, criterios)
+
+	totalAlertas := 0
+	for _, variacao := range variacoes {
+		if len(variacao.Alertas) > 0 {
+			totalAlertas++
+		}
+	}
+
+	// Só os titulares com alerta, quando pedido
+	if query.Get("somente_alertas") == "true" {
+		variacoes = variacoes[:totalAlertas]
+	}
+
+	if query.Get("formato") == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"variacao_%s_%s_%s.csv\"", declarante, anterior, periodo))
+		if err := analise.EscreverCSV(w, anterior, periodo, variacoes); err != nil {
+			log.Println("Erro ao enviar a análise de variação:", err)
+		}
+		return
+	}
+
+	resposta := struct {
+		Declarante      string                     `json:"declarante"`
+		Periodo         string                     `json:"periodo"`
+		PeriodoAnterior string                     `json:"periodo_anterior"`
+		Criterios       analise.Criterios          `json:"criterios"`
+		TotalTitulares  int                        `json:"total_titulares"`
+		TotalAlertas    int                        `json:"total_alertas"`
+		Titulares       []*analise.VariacaoTitular `json:"titulares"`
+	}{
+		Declarante:      declarante,
+		Periodo:         periodo,
+		PeriodoAnterior: anterior,
+		Criterios:       criterios,
+		TotalTitulares:  len(variacoes),
+		TotalAlertas:    totalAlertas,
+		Titulares:       variacoes,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resposta)
+}
+
+// Critérios aceitam vírgula ou ponto decimal e não podem ser negativos
+func lerCriterio(texto string) (float64, error) {
+	valor, err := layout.LerValor(texto)
+	if err != nil {
+		return 0, err
+	}
+	if valor < 0 {
+		return 0, fmt.Errorf("valor '%s' não pode ser negativo", texto)
+	}
+	return valor, nil
+}
@@ -0,0 +1,321 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-playground/validator"
+	"github.com/gorilla/mux"
+
+	"sped-efinanceira/aprovacao"
+	"sped-efinanceira/common"
+	"sped-efinanceira/middlewares"
+	"sped-efinanceira/models"
+	"sped-efinanceira/repositories"
+	"sped-efinanceira/validacao"
+)
+
+type AprovacaoController struct {
+	repo        *repositories.AprovacaoRepositorio
+	eventoRepo  *repositories.EventoRepositorio
+	usuarioRepo *repositories.UsuarioRepositorio
+	perfilRepo  *repositories.PerfilRepositorio
+	periodoRepo *repositories.PeriodoRepositorio
+	titularRepo *repositories.TitularRepositorio
+	crsRepo     *repositories.CRSRepositorio
+}
+
+func NovoAprovacaoController(repo *repositories.AprovacaoRepositorio, eventoRepo *repositories.EventoRepositorio, usuarioRepo *repositories.UsuarioRepositorio, perfilRepo *repositories.PerfilRepositorio, periodoRepo *repositories.PeriodoRepositorio, titularRepo *repositories.TitularRepositorio, crsRepo *repositories.CRSRepositorio) *AprovacaoController {
+	return &AprovacaoController{
+		repo:        repo,
+		eventoRepo:  eventoRepo,
+		usuarioRepo: usuarioRepo,
+		perfilRepo:  perfilRepo,
+		periodoRepo: periodoRepo,
+		titularRepo: titularRepo,
+		crsRepo:     crsRepo,
+	}
+}
+
+// Solicitar a aprovação de eventos validados ou do lote inteiro do período
+func (ac *AprovacaoController) SolicitarAprovacao(w http.ResponseWriter, r *http.Request) {
+	var pedido models.Aprovacao
+	err := json.NewDecoder(r.Body).Decode(&pedido)
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Pedido inválido!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	pedido.Declarante = validacao.SomenteDigitos(pedido.Declarante)
+	pedido.Solicitante = middlewares.UsuarioLogado(r)
+	pedido.Situacao = models.AprovacaoPendente
+	pedido.Aprovador = ""
+	pedido.MotivoRejeicao = ""
+	pedido.Comentarios = nil
+	pedido.DecididaEm = nil
+
+	// Validar o modelo
+	validate := validator.New()
+	err = validate.Struct(pedido)
+	if err == nil && pedido.Solicitante == "" {
+		err = fmt.Errorf("Usuário não identificado.")
+	}
+	if err == nil {
+		_, err = aprovacao.EventosDaAprovacao(ac.eventoRepo, ac.repo, &pedido)
+	}
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Campos inválidos!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	if periodoBloqueado(w, ac.periodoRepo, pedido.Declarante, pedido.Periodo) {
+		return
+	}
+
+	err = ac.repo.CriarAprovacao(&pedido)
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao solicitar Aprovação!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	go aprovacao.NotificarPedido(ac.usuarioRepo, ac.perfilRepo, &pedido)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(pedido)
+}
+
+// Listar Aprovações, filtrando por declarante e situação
+func (ac *AprovacaoController) ListarAprovacoes(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	aprovacoes, err := ac.repo.ListarAprovacoes(validacao.SomenteDigitos(query.Get("declarante")), query.Get("situacao"))
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao listar Aprovações!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	resposta := struct {
+		TotalAprovacoes int                 `json:"total_aprovacoes"`
+		Aprovacoes      []*models.Aprovacao `json:"aprovacoes"`
+	}{
+		TotalAprovacoes: len(aprovacoes),
+		Aprovacoes:      aprovacoes,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resposta)
+}
+
+// Listar Aprovação por ID
+func (ac *AprovacaoController) ListarAprovacaoPorID(w http.ResponseWriter, r *http.Request) {
+	pedido, err := ac.repo.ListarAprovacaoPorID(mux.Vars(r)["id"])
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Aprovação não encontrada!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pedido)
+}
+
+// Comentar um pedido de Aprovação
+func (ac *AprovacaoController) ComentarAprovacao(w http.ResponseWriter, r *http.Request) {
+	pedido, err := ac.repo.ListarAprovacaoPorID(mux.Vars(r)["id"])
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Aprovação não encontrada!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	var comentario models.ComentarioAprovacao
+	err = json.NewDecoder(r.Body).Decode(&comentario)
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Pedido inválido!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	// Validar o modelo
+	validate := validator.New()
+	if err := validate.Struct(comentario); err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Campos inválidos!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	comentario.Usuario = middlewares.UsuarioLogado(r)
+	comentario.Data = time.Now()
+
+	err = ac.repo.AdicionarComentario(pedido.ID, comentario)
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao comentar Aprovação!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	pedido.Comentarios = append(pedido.Comentarios, comentario)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(pedido)
+}
+
+// Aprovar ou rejeitar um pedido. O aprovador precisa ter perfil aprovador e
+// ser outro usuário que não o solicitante nem quem criou ou alterou os
+// eventos.
+func (ac *AprovacaoController) DecidirAprovacao(w http.ResponseWriter, r *http.Request) {
+	pedido, err := ac.repo.ListarAprovacaoPorID(mux.Vars(r)["id"])
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Aprovação não encontrada!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	var decisao models.DecisaoAprovacao
+	err = json.NewDecoder(r.Body).Decode(&decisao)
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Pedido inválido!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	// Validar o modelo
+	validate := validator.New()
+	err = validate.Struct(decisao)
+	if err == nil && decisao.Acao == "rejeitar" && decisao.Motivo == "" {
+		err = fmt.Errorf("Informe o motivo da rejeição.")
+	}
+	if err == nil && pedido.Situacao != models.AprovacaoPendente {
+		err = fmt.Errorf("A aprovação já foi decidida.")
+	}
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Campos inválidos!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	usuario := middlewares.UsuarioLogado(r)
+	if err := aprovacao.VerificarAprovador(ac.usuarioRepo, ac.perfilRepo, ac.eventoRepo, usuario, pedido); err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Aprovação não permitida!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	if err := aprovacao.Decidir(ac.eventoRepo, ac.repo, ac.titularRepo, ac.crsRepo, pedido, decisao, usuario); err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao registrar a decisão!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	go aprovacao.NotificarDecisao(ac.usuarioRepo, pedido)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pedido)
+}
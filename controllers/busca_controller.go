@@ -0,0 +1,220 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"sped-efinanceira/cadastro"
+	"sped-efinanceira/common"
+	"sped-efinanceira/eventos"
+	"sped-efinanceira/models"
+	"sped-efinanceira/repositories"
+	"sped-efinanceira/validacao"
+)
+
+// Paginação da busca
+const (
+	porPaginaBuscaPadrao = 20
+	porPaginaBuscaMaximo = 100
+)
+
+// Titulares e contas do cadastro considerados na ampliação da busca textual
+const limiteCadastroBusca = 200
+
+type BuscaController struct {
+	eventoRepo  *repositories.EventoRepositorio
+	titularRepo *repositories.TitularRepositorio
+	contaRepo   *repositories.ContaRepositorio
+	crsRepo     *repositories.CRSRepositorio
+}
+
+func NovoBuscaController(eventoRepo *repositories.EventoRepositorio, titularRepo *repositories.TitularRepositorio, contaRepo *repositories.ContaRepositorio, crsRepo *repositories.CRSRepositorio) *BuscaController {
+	return &BuscaController{
+		eventoRepo:  eventoRepo,
+		titularRepo: titularRepo,
+		contaRepo:   contaRepo,
+		crsRepo:     crsRepo,
+	}
+}
+
+// Buscar eventos por texto livre (nome, CPF/CNPJ, conta, recibo ou ID do
+// evento) e por filtros estruturados. O texto também é procurado no cadastro
+// de titulares e contas, e os eventos deles entram no resultado: assim uma
+// conta conjunta aparece mesmo quando foi declarada em nome do outro titular.
+func (bc *BuscaController) BuscarEventos(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filtro := models.FiltroBusca{
+		Declarante: validacao.SomenteDigitos(query.Get("declarante")),
+		Periodo:    query.Get("periodo"),
+		Status:     query.Get("status"),
+		Tipo:       query.Get("tipo"),
+		Recibo:     strings.TrimSpace(query.Get("recibo")),
+		NI:         validacao.SomenteDigitos(query.Get("ni")),
+		Conta:      strings.TrimSpace(query.Get("conta")),
+		Termo:      normalizarTermo(query.Get("q")),
+	}
+
+	// Validar os parâmetros
+	var err error
+	pagina, porPagina := 1, porPaginaBuscaPadrao
+	if filtro.Termo == "" && filtro.Recibo == "" && filtro.NI == "" && filtro.Conta == "" {
+		err = fmt.Errorf("Informe o texto da busca (q) ou um CPF/CNPJ, conta ou recibo.")
+	}
+	if err == nil && filtro.Declarante != "" && !validacao.CNPJValido(filtro.Declarante) {
+		err = fmt.Errorf("O CNPJ do declarante é inválido.")
+	}
+	if err == nil && filtro.Periodo != "" {
+		_, _, err = eventos.LimitesPeriodo(filtro.Periodo)
+	}
+	if err == nil && query.Get("pagina") != "" {
+		pagina, err = strconv.Atoi(query.Get("pagina"))
+		if err == nil && pagina < 1 {
+			err = fmt.Errorf("A página deve ser maior que zero.")
+		}
+	}
+	if err == nil && query.Get("por_pagina") != "" {
+		porPagina, err = strconv.Atoi(query.Get("por_pagina"))
+		if err == nil && (porPagina < 1 || porPagina > porPaginaBuscaMaximo) {
+			err = fmt.Errorf("por_pagina deve estar entre 1 e %d.", porPaginaBuscaMaximo)
+		}
+	}
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Campos inválidos!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	if filtro.Termo != "" {
+		if err := bc.ampliarPeloCadastro(&filtro); err != nil {
+			log.Println(err)
+			RespostaComErro := common.RespostaComErro{
+				Error:   "Falha ao buscar no cadastro!",
+				Message: err.Error(),
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(RespostaComErro)
+			return
+		}
+	}
+
+	encontrados, total, err := bc.eventoRepo.BuscarEventos(filtro, pagina, porPagina)
+	if err == nil {
+		// Rascunhos mostram o declarado como está no cadastro
+		err = cadastro.ResolverDeclarados(bc.titularRepo, bc.crsRepo, encontrados...)
+	}
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao buscar Eventos!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	resultados := make([]models.ResultadoBusca, 0, len(encontrados))
+	for _, evento := range encontrados {
+		resultados = append(resultados, resultadoBusca(evento))
+	}
+
+	resposta := struct {
+		Total      int64                   `json:"total"`
+		Pagina     int                     `json:"pagina"`
+		PorPagina  int                     `json:"por_pagina"`
+		Resultados []models.ResultadoBusca `json:"resultados"`
+	}{
+		Total:      total,
+		Pagina:     pagina,
+		PorPagina:  porPagina,
+		Resultados: resultados,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resposta)
+}
+
+// Acrescenta ao filtro os documentos, contas e titulares do cadastro que
+// casam com o texto da busca
+func (bc *BuscaController) ampliarPeloCadastro(filtro *models.FiltroBusca) error {
+	titulares, err := bc.titularRepo.BuscarTitularesPorTexto(filtro.Declarante, filtro.Termo, limiteCadastroBusca)
+	if err != nil {
+		return err
+	}
+	contas, err := bc.contaRepo.BuscarContasPorTexto(filtro.Declarante, filtro.Termo, limiteCadastroBusca)
+	if err != nil {
+		return err
+	}
+
+	nis := make(map[string]bool)
+	var ids []primitive.ObjectID
+	for _, titular := range titulares {
+		ids = append(ids, titular.ID)
+		if !nis[titular.NI] {
+			nis[titular.NI] = true
+			filtro.NIs = append(filtro.NIs, titular.NI)
+		}
+	}
+	for _, conta := range contas {
+		filtro.Contas = append(filtro.Contas, conta.NumConta)
+	}
+	filtro.TitularIDs = ids
+
+	return nil
+}
+
+func resultadoBusca(evento *models.Evento) models.ResultadoBusca {
+	resultado := models.ResultadoBusca{
+		ID:         evento.ID.Hex(),
+		Tipo:       evento.Tipo,
+		Declarante: evento.Declarante,
+		Periodo:    evento.Periodo,
+		Status:     evento.Status,
+		IDEvento:   evento.IDEvento,
+		Recibo:     evento.Recibo,
+		XML:        "/eventos/" + evento.ID.Hex() + "/xml",
+		CreatedAt:  evento.CreatedAt,
+	}
+	if evento.Movimento != nil {
+		resultado.NI = evento.Movimento.Declarado.NI
+		resultado.Nome = evento.Movimento.Declarado.Nome
+		for _, conta := range evento.Movimento.Contas {
+			resultado.Contas = append(resultado.Contas, conta.NumConta)
+		}
+	}
+	return resultado
+}
+
+// Documentos formatados viram só dígitos, como estão gravados. Aspas e o
+// hífen inicial (negação no $text) são descartados para que o texto seja
+// sempre uma busca simples por palavras.
+func normalizarTermo(termo string) string {
+	termo = strings.TrimSpace(termo)
+	digitos := validacao.SomenteDigitos(termo)
+	if (len(digitos) == 11 || len(digitos) == 14) && strings.Trim(termo, "0123456789.-/ ") == "" {
+		return digitos
+	}
+
+	palavras := strings.Fields(strings.NewReplacer(`"`, " ", `\`, " ").Replace(termo))
+	for i, palavra := range palavras {
+		palavras[i] = strings.TrimLeft(palavra, "-")
+	}
+	return strings.TrimSpace(strings.Join(palavras, " "))
+}
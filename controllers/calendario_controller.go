@@ -0,0 +1,116 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"sped-efinanceira/calendario"
+	"sped-efinanceira/common"
+	"sped-efinanceira/repositories"
+	"sped-efinanceira/validacao"
+)
+
+type CalendarioController struct {
+	eventoRepo  *repositories.EventoRepositorio
+	periodoRepo *repositories.PeriodoRepositorio
+}
+
+func NovoCalendarioController(eventoRepo *repositories.EventoRepositorio, periodoRepo *repositories.PeriodoRepositorio) *CalendarioController {
+	return &CalendarioController{
+		eventoRepo:  eventoRepo,
+		periodoRepo: periodoRepo,
+	}
+}
+
+// Listar os prazos que vencem no ano (padrão: ano atual) e a situação de
+// cada declarante: pendente, em andamento, enviado ou atrasado
+func (cc *CalendarioController) ListarPrazos(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	ano, err := anoInformado(query.Get("ano"))
+	if err != nil {
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Campos inválidos!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	var declarantes []string
+	if declarante := validacao.SomenteDigitos(query.Get("declarante")); declarante != "" {
+		declarantes = append(declarantes, declarante)
+	}
+
+	prazos, err := calendario.Prazos(cc.eventoRepo, cc.periodoRepo, declarantes, calendario.PeriodosDoAno(ano), time.Now())
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao calcular os prazos!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	resposta := struct {
+		Ano         int                           `json:"ano"`
+		TotalPrazos int                           `json:"total_prazos"`
+		Prazos      []*calendario.PrazoDeclarante `json:"prazos"`
+	}{
+		Ano:         ano,
+		TotalPrazos: len(prazos),
+		Prazos:      prazos,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resposta)
+}
+
+// Listar os feriados nacionais considerados no cálculo dos dias úteis
+func (cc *CalendarioController) ListarFeriados(w http.ResponseWriter, r *http.Request) {
+	ano, err := anoInformado(r.URL.Query().Get("ano"))
+	if err != nil {
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Campos inválidos!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	resposta := struct {
+		Ano      int                  `json:"ano"`
+		Feriados []calendario.Feriado `json:"feriados"`
+	}{
+		Ano:      ano,
+		Feriados: calendario.Feriados(ano),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resposta)
+}
+
+func anoInformado(valor string) (int, error) {
+	if valor == "" {
+		return time.Now().Year(), nil
+	}
+	ano, err := strconv.Atoi(valor)
+	if err != nil || ano < 2000 || ano > 2100 {
+		return 0, fmt.Errorf("Ano '%s' inválido.", valor)
+	}
+	return ano, nil
+}
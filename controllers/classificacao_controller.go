@@ -0,0 +1,225 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator"
+	"github.com/gorilla/mux"
+
+	"sped-efinanceira/classificacao"
+	"sped-efinanceira/common"
+	"sped-efinanceira/models"
+	"sped-efinanceira/repositories"
+	"sped-efinanceira/validacao"
+)
+
+type ClassificacaoController struct {
+	repo        *repositories.ClassificacaoRepositorio
+	contaRepo   *repositories.ContaRepositorio
+	titularRepo *repositories.TitularRepositorio
+	crsRepo     *repositories.CRSRepositorio
+}
+
+func NovoClassificacaoController(repo *repositories.ClassificacaoRepositorio, contaRepo *repositories.ContaRepositorio, titularRepo *repositories.TitularRepositorio, crsRepo *repositories.CRSRepositorio) *ClassificacaoController {
+	return &ClassificacaoController{
+		repo:        repo,
+		contaRepo:   contaRepo,
+		titularRepo: titularRepo,
+		crsRepo:     crsRepo,
+	}
+}
+
+// Classificar as contas do declarante pela busca de indícios FATCA/CRS
+func (cc *ClassificacaoController) ClassificarContas(w http.ResponseWriter, r *http.Request) {
+	declarante := validacao.SomenteDigitos(r.URL.Query().Get("declarante"))
+	if !validacao.CNPJValido(declarante) {
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Campos inválidos!",
+			Message: "O CNPJ do declarante é inválido.",
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	classificacoes, err := classificacao.ClassificarContas(cc.repo, cc.contaRepo, cc.titularRepo, cc.crsRepo, declarante)
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao classificar Contas!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	responderClassificacoes(w, classificacoes)
+}
+
+// Listar Classificações, filtrando por declarante e situação
+func (cc *ClassificacaoController) ListarClassificacoes(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	classificacoes, err := cc.repo.ListarClassificacoes(validacao.SomenteDigitos(query.Get("declarante")), query.Get("situacao"))
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao listar Classificações!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	responderClassificacoes(w, classificacoes)
+}
+
+// Listar Classificação por ID, com as evidências e as revisões
+func (cc *ClassificacaoController) ListarClassificacaoPorID(w http.ResponseWriter, r *http.Request) {
+	classificacao, err := cc.repo.ListarClassificacaoPorID(mux.Vars(r)["id"])
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Classificação não encontrada!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(classificacao)
+}
+
+// Revisar Classificação: o revisor confirma o resultado automático ou o
+// substitui, informando a justificativa
+func (cc *ClassificacaoController) RevisarClassificacao(w http.ResponseWriter, r *http.Request) {
+	classificacaoConta, err := cc.repo.ListarClassificacaoPorID(mux.Vars(r)["id"])
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Classificação não encontrada!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	var revisao models.RevisaoClassificacao
+	err = json.NewDecoder(r.Body).Decode(&revisao)
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Pedido inválido!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	// Validar o modelo
+	validate := validator.New()
+	err = validate.Struct(revisao)
+	if err == nil {
+		err = prepararRevisao(classificacaoConta, &revisao)
+	}
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Campos inválidos!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	err = cc.repo.RevisarClassificacao(classificacaoConta, revisao)
+	if err != nil {
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao revisar Classificação!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(classificacaoConta)
+}
+
+// Na confirmação vale o resultado automático; na alteração, o informado,
+// que exige justificativa
+func prepararRevisao(classificacaoConta *models.ClassificacaoConta, revisao *models.RevisaoClassificacao) error {
+	revisao.Data = time.Now()
+
+	if revisao.Acao == "confirmar" {
+		revisao.Reportavel = classificacaoConta.Reportavel
+		revisao.Jurisdicoes = classificacaoConta.Jurisdicoes
+		classificacaoConta.Situacao = models.ClassificacaoConfirmada
+		return nil
+	}
+
+	if strings.TrimSpace(revisao.Justificativa) == "" {
+		return fmt.Errorf("a justificativa é obrigatória para alterar a classificação")
+	}
+
+	jurisdicoes := []string{}
+	for _, pais := range revisao.Jurisdicoes {
+		pais = strings.ToUpper(strings.TrimSpace(pais))
+		if !validacao.PaisValido(pais) || pais == "BR" {
+			return fmt.Errorf("jurisdição '%s' inválida", pais)
+		}
+		jurisdicoes = append(jurisdicoes, pais)
+	}
+	sort.Strings(jurisdicoes)
+
+	if revisao.Reportavel != (len(jurisdicoes) > 0) {
+		return fmt.Errorf("conta reportável exige ao menos uma jurisdição, e conta não reportável nenhuma")
+	}
+
+	revisao.Jurisdicoes = jurisdicoes
+	classificacaoConta.Situacao = models.ClassificacaoAlterada
+	return nil
+}
+
+func responderClassificacoes(w http.ResponseWriter, classificacoes []*models.ClassificacaoConta) {
+	resposta := struct {
+		TotalClassificacoes int                          `json:"total_classificacoes"`
+		Classificacoes      []*models.ClassificacaoConta `json:"classificacoes"`
+	}{
+		TotalClassificacoes: len(classificacoes),
+		Classificacoes:      classificacoes,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resposta)
+}
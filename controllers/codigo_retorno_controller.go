@@ -0,0 +1,39 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"sped-efinanceira/common"
+	"sped-efinanceira/retorno"
+)
+
+type CodigoRetornoController struct{}
+
+func NovoCodigoRetornoController() *CodigoRetornoController {
+	return &CodigoRetornoController{}
+}
+
+// Consultar a explicação de um código de ocorrência da Receita
+func (cc *CodigoRetornoController) BuscarCodigoRetorno(w http.ResponseWriter, r *http.Request) {
+	codigo := mux.Vars(r)["codigo"]
+
+	encontrado, ok := retorno.BuscarCodigo(codigo)
+	if !ok {
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Código de retorno não encontrado!",
+			Message: fmt.Sprintf("O código %s não consta no catálogo.", codigo),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(encontrado)
+}
@@ -0,0 +1,221 @@
+package controllers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/go-playground/validator"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"sped-efinanceira/cadastro"
+	"sped-efinanceira/common"
+	"sped-efinanceira/models"
+	"sped-efinanceira/repositories"
+	"sped-efinanceira/validacao"
+)
+
+type ContaController struct {
+	repo        *repositories.ContaRepositorio
+	titularRepo *repositories.TitularRepositorio
+}
+
+func NovoContaController(repo *repositories.ContaRepositorio, titularRepo *repositories.TitularRepositorio) *ContaController {
+	return &ContaController{
+		repo:        repo,
+		titularRepo: titularRepo,
+	}
+}
+
+// Criar Conta
+func (cc *ContaController) CriarConta(w http.ResponseWriter, r *http.Request) {
+	var conta models.Conta
+	err := json.NewDecoder(r.Body).Decode(&conta)
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Pedido inválido!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	// Validar o modelo
+	validate := validator.New()
+	err = validate.Struct(conta)
+	if err == nil {
+		err = cadastro.ValidarConta(&conta)
+	}
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Campos inválidos!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	err = cadastro.VincularParticipantes(cc.titularRepo, &conta)
+	if err == nil {
+		err = cc.repo.CriarConta(&conta)
+	}
+	if err != nil {
+		status := http.StatusInternalServerError
+		if mongo.IsDuplicateKeyError(err) {
+			status = http.StatusConflict
+		}
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao criar Conta!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(conta)
+}
+
+// Listar Contas, filtrando por declarante e participante
+func (cc *ContaController) ListarContas(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	contas, err := cc.repo.ListarContas(validacao.SomenteDigitos(query.Get("declarante")), validacao.SomenteDigitos(query.Get("ni")))
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao listar Contas!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	resposta := struct {
+		TotalContas int             `json:"total_contas"`
+		Contas      []*models.Conta `json:"contas"`
+	}{
+		TotalContas: len(contas),
+		Contas:      contas,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resposta)
+}
+
+// Listar Conta por ID
+func (cc *ContaController) ListarContaPorID(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	conta, err := cc.repo.ListarContaPorID(id)
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Conta não encontrada!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(conta)
+}
+
+// Editar Conta: tipo, moeda, datas e participantes. Declarante e número
+// identificam a conta e não mudam.
+func (cc *ContaController) EditarConta(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	var conta models.Conta
+	err := json.NewDecoder(r.Body).Decode(&conta)
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Pedido inválido!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	existente, err := cc.repo.ListarContaPorID(id)
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Conta não encontrada!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	conta.ID = existente.ID
+	conta.Declarante = existente.Declarante
+	conta.NumConta = existente.NumConta
+	conta.CreatedAt = existente.CreatedAt
+
+	// Validar o modelo
+	validate := validator.New()
+	err = validate.Struct(conta)
+	if err == nil {
+		err = cadastro.ValidarConta(&conta)
+	}
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Campos inválidos!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	err = cadastro.VincularParticipantes(cc.titularRepo, &conta)
+	if err == nil {
+		err = cc.repo.EditarConta(&conta)
+	}
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao atualizar Conta!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(conta)
+}
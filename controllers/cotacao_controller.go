@@ -0,0 +1,132 @@
+package controllers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"sped-efinanceira/cambio"
+	"sped-efinanceira/common"
+	"sped-efinanceira/models"
+	"sped-efinanceira/repositories"
+)
+
+type CotacaoController struct {
+	repo *repositories.CotacaoRepositorio
+}
+
+func NovoCotacaoController(repo *repositories.CotacaoRepositorio) *CotacaoController {
+	return &CotacaoController{repo: repo}
+}
+
+// Importar arquivo PTAX (CSV do Banco Central) enviado no campo "arquivo"
+func (cc *CotacaoController) ImportarPTAX(w http.ResponseWriter, r *http.Request) {
+	arquivo, cabecalho, err := r.FormFile("arquivo")
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao receber arquivo!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+	defer arquivo.Close()
+
+	resultado, err := cambio.LerArquivoPTAX(arquivo, cabecalho.Filename)
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Arquivo PTAX inválido!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	err = cc.repo.SalvarCotacoes(resultado.Cotacoes)
+	if err != nil {
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao gravar Cotações!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	resposta := struct {
+		CotacoesImportadas int      `json:"cotacoes_importadas"`
+		Erros              []string `json:"erros"`
+	}{
+		CotacoesImportadas: len(resultado.Cotacoes),
+		Erros:              resultado.Erros,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resposta)
+}
+
+// Listar Cotações da moeda entre inicio e fim (AAAA-MM-DD; padrão: últimos
+// 30 dias)
+func (cc *CotacaoController) ListarCotacoes(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	fim := time.Now()
+	inicio := fim.AddDate(0, 0, -30)
+	var err error
+	if valor := query.Get("inicio"); valor != "" {
+		inicio, err = time.Parse("2006-01-02", valor)
+	}
+	if valor := query.Get("fim"); valor != "" && err == nil {
+		fim, err = time.Parse("2006-01-02", valor)
+	}
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Data inválida!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	cotacoes, err := cc.repo.ListarCotacoes(strings.ToUpper(query.Get("moeda")), inicio, fim)
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao listar Cotações!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	resposta := struct {
+		TotalCotacoes int               `json:"total_cotacoes"`
+		Cotacoes      []*models.Cotacao `json:"cotacoes"`
+	}{
+		TotalCotacoes: len(cotacoes),
+		Cotacoes:      cotacoes,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resposta)
+}
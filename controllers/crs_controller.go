@@ -0,0 +1,529 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"sped-efinanceira/cadastro"
+	"sped-efinanceira/common"
+	"sped-efinanceira/models"
+	"sped-efinanceira/repositories"
+	"sped-efinanceira/validacao"
+)
+
+// Tamanho máximo do documento de autocertificação enviado
+const tamanhoMaximoDocumento = 10 << 20
+
+type CRSController struct {
+	repo        *repositories.CRSRepositorio
+	titularRepo *repositories.TitularRepositorio
+}
+
+func NovoCRSController(repo *repositories.CRSRepositorio, titularRepo *repositories.TitularRepositorio) *CRSController {
+	return &CRSController{
+		repo:        repo,
+		titularRepo: titularRepo,
+	}
+}
+
+// Criar Autocertificação do titular. O pedido é multipart, com os dados em
+// JSON no campo "dados" e o documento assinado (opcional) no campo "arquivo".
+func (cc *CRSController) CriarAutoCertificacao(w http.ResponseWriter, r *http.Request) {
+	titular, err := cc.titularRepo.ListarTitularPorID(mux.Vars(r)["id"])
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Titular não encontrado!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	var autoCertificacao models.AutoCertificacao
+	err = r.ParseMultipartForm(tamanhoMaximoDocumento)
+	if err == nil {
+		err = json.Unmarshal([]byte(r.FormValue("dados")), &autoCertificacao)
+	}
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Pedido inválido!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	// Validar o modelo
+	validate := validator.New()
+	err = validate.Struct(autoCertificacao)
+	if err == nil {
+		err = cadastro.ValidarResidencias(autoCertificacao.Residencias)
+	}
+	if err == nil && autoCertificacao.DtValidade != nil && autoCertificacao.DtValidade.Before(autoCertificacao.DtAssinatura) {
+		err = fmt.Errorf("a validade não pode ser anterior à assinatura")
+	}
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Campos inválidos!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	autoCertificacao.Declarante = titular.Declarante
+	autoCertificacao.TitularID = titular.ID
+	autoCertificacao.NI = titular.NI
+
+	autoCertificacao.Arquivo, err = salvarDocumento(r, "arquivo")
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao receber arquivo!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	err = cc.repo.CriarAutoCertificacao(&autoCertificacao)
+	if err != nil {
+		if autoCertificacao.Arquivo != nil {
+			os.Remove(autoCertificacao.Arquivo.Caminho)
+		}
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao criar Autocertificação!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	cadastro.MarcarSituacao([]*models.AutoCertificacao{&autoCertificacao}, time.Now())
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(autoCertificacao)
+}
+
+// Listar Autocertificações do titular com a situação de cada uma
+func (cc *CRSController) ListarAutoCertificacoesTitular(w http.ResponseWriter, r *http.Request) {
+	titularID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Titular não encontrado!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	autoCertificacoes, err := cc.repo.ListarAutoCertificacoes(titularID)
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao listar Autocertificações!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	cadastro.MarcarSituacao(autoCertificacoes, time.Now())
+	responderAutoCertificacoes(w, autoCertificacoes)
+}
+
+// Listar as Autocertificações atuais de cada titular vencidas ou que vencem
+// até a data informada (vencendo_ate, AAAA-MM-DD; padrão: próximos 30 dias)
+func (cc *CRSController) ListarAutoCertificacoesVencendo(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	agora := time.Now()
+	ate := agora.AddDate(0, 0, 30)
+	if valor := query.Get("vencendo_ate"); valor != "" {
+		data, err := time.Parse("2006-01-02", valor)
+		if err != nil {
+			log.Println(err)
+			RespostaComErro := common.RespostaComErro{
+				Error:   "Data inválida!",
+				Message: err.Error(),
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(RespostaComErro)
+			return
+		}
+		ate = data.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+
+	candidatas, err := cc.repo.ListarAutoCertificacoesVencendo(validacao.SomenteDigitos(query.Get("declarante")), ate)
+	if err == nil && len(candidatas) > 0 {
+		// A situação depende das autocertificações mais recentes do titular
+		var ids []primitive.ObjectID
+		for _, autoCertificacao := range candidatas {
+			ids = append(ids, autoCertificacao.TitularID)
+		}
+		candidatas, err = cc.repo.ListarAutoCertificacoes(ids...)
+	}
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao listar Autocertificações!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	cadastro.MarcarSituacao(candidatas, agora)
+
+	autoCertificacoes := []*models.AutoCertificacao{}
+	for _, autoCertificacao := range candidatas {
+		if autoCertificacao.Situacao != models.AutoCertificacaoSubstituida && autoCertificacao.DtValidade != nil && !autoCertificacao.DtValidade.After(ate) {
+			autoCertificacoes = append(autoCertificacoes, autoCertificacao)
+		}
+	}
+
+	responderAutoCertificacoes(w, autoCertificacoes)
+}
+
+// Baixar o documento da Autocertificação
+func (cc *CRSController) BaixarArquivoAutoCertificacao(w http.ResponseWriter, r *http.Request) {
+	autoCertificacao, err := cc.repo.ListarAutoCertificacaoPorID(mux.Vars(r)["id"])
+	if err == nil && autoCertificacao.Arquivo == nil {
+		err = fmt.Errorf("autocertificação sem documento anexado")
+	}
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Documento não encontrado!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	w.Header().Set("Content-Type", autoCertificacao.Arquivo.TipoConteudo)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", autoCertificacao.Arquivo.Nome))
+	http.ServeFile(w, r, autoCertificacao.Arquivo.Caminho)
+}
+
+// Criar Pessoa Controladora da entidade titular
+func (cc *CRSController) CriarPessoaControladora(w http.ResponseWriter, r *http.Request) {
+	entidade, err := cc.titularRepo.ListarTitularPorID(mux.Vars(r)["id"])
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Titular não encontrado!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	var pessoa models.PessoaControladora
+	err = json.NewDecoder(r.Body).Decode(&pessoa)
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Pedido inválido!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	// Validar o modelo
+	err = validarPessoaControladora(&pessoa)
+	if err == nil && len(entidade.NI) != 14 {
+		err = fmt.Errorf("pessoas controladoras só se aplicam a titulares pessoa jurídica")
+	}
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Campos inválidos!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	pessoa.Declarante = entidade.Declarante
+	pessoa.EntidadeID = entidade.ID
+
+	err = cc.repo.CriarPessoaControladora(&pessoa)
+	if err != nil {
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao criar Pessoa Controladora!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(pessoa)
+}
+
+// Listar Pessoas Controladoras da entidade titular
+func (cc *CRSController) ListarPessoasControladoras(w http.ResponseWriter, r *http.Request) {
+	entidadeID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Titular não encontrado!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	pessoas, err := cc.repo.ListarPessoasControladoras(entidadeID)
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao listar Pessoas Controladoras!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	resposta := struct {
+		TotalPessoas int                          `json:"total_pessoas"`
+		Pessoas      []*models.PessoaControladora `json:"pessoas"`
+	}{
+		TotalPessoas: len(pessoas),
+		Pessoas:      pessoas,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resposta)
+}
+
+// Editar Pessoa Controladora
+func (cc *CRSController) EditarPessoaControladora(w http.ResponseWriter, r *http.Request) {
+	pessoa, err := cc.repo.ListarPessoaControladoraPorID(mux.Vars(r)["id"])
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Pessoa Controladora não encontrada!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	var dados models.PessoaControladora
+	err = json.NewDecoder(r.Body).Decode(&dados)
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Pedido inválido!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	// Validar o modelo
+	err = validarPessoaControladora(&dados)
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Campos inválidos!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	// A entidade e o declarante não mudam na edição
+	dados.ID = pessoa.ID
+	dados.Declarante = pessoa.Declarante
+	dados.EntidadeID = pessoa.EntidadeID
+	dados.CreatedAt = pessoa.CreatedAt
+
+	err = cc.repo.EditarPessoaControladora(&dados)
+	if err != nil {
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao editar Pessoa Controladora!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(dados)
+}
+
+// Deletar Pessoa Controladora
+func (cc *CRSController) DeletarPessoaControladora(w http.ResponseWriter, r *http.Request) {
+	err := cc.repo.DeletarPessoaControladora(mux.Vars(r)["id"])
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao deletar Pessoa Controladora!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func validarPessoaControladora(pessoa *models.PessoaControladora) error {
+	pessoa.NI = validacao.SomenteDigitos(pessoa.NI)
+	pessoa.PaisEndereco = strings.ToUpper(strings.TrimSpace(pessoa.PaisEndereco))
+	pessoa.Nacionalidade = strings.ToUpper(strings.TrimSpace(pessoa.Nacionalidade))
+
+	validate := validator.New()
+	if err := validate.Struct(pessoa); err != nil {
+		return err
+	}
+	if pessoa.NI != "" && !validacao.CPFValido(pessoa.NI) {
+		return fmt.Errorf("CPF '%s' inválido", pessoa.NI)
+	}
+	if !validacao.PaisValido(pessoa.PaisEndereco) {
+		return fmt.Errorf("país do endereço '%s' inválido", pessoa.PaisEndereco)
+	}
+	return cadastro.ValidarResidencias(pessoa.Residencias)
+}
+
+func responderAutoCertificacoes(w http.ResponseWriter, autoCertificacoes []*models.AutoCertificacao) {
+	resposta := struct {
+		TotalAutoCertificacoes int                        `json:"total_autocertificacoes"`
+		AutoCertificacoes      []*models.AutoCertificacao `json:"autocertificacoes"`
+	}{
+		TotalAutoCertificacoes: len(autoCertificacoes),
+		AutoCertificacoes:      autoCertificacoes,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resposta)
+}
+
+// Grava o documento enviado em DOCUMENTOS_DIR; retorna nil quando o campo
+// não foi enviado
+func salvarDocumento(r *http.Request, campo string) (*models.ArquivoDocumento, error) {
+	arquivo, cabecalho, err := r.FormFile(campo)
+	if err == http.ErrMissingFile {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer arquivo.Close()
+
+	diretorio := os.Getenv("DOCUMENTOS_DIR")
+	if diretorio == "" {
+		diretorio = "documentos"
+	}
+	if err := os.MkdirAll(diretorio, os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	caminho := filepath.Join(diretorio, primitive.NewObjectID().Hex()+filepath.Ext(cabecalho.Filename))
+	destino, err := os.Create(caminho)
+	if err != nil {
+		return nil, err
+	}
+	defer destino.Close()
+
+	tamanho, err := io.Copy(destino, arquivo)
+	if err != nil {
+		os.Remove(caminho)
+		return nil, err
+	}
+
+	tipoConteudo := cabecalho.Header.Get("Content-Type")
+	if tipoConteudo == "" {
+		tipoConteudo = "application/octet-stream"
+	}
+
+	return &models.ArquivoDocumento{
+		Nome:         filepath.Base(cabecalho.Filename),
+		Caminho:      caminho,
+		TipoConteudo: tipoConteudo,
+		Tamanho:      tamanho,
+	}, nil
+}
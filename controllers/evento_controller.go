@@ -0,0 +1,391 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/go-playground/validator"
+	"github.com/gorilla/mux"
+
+	"sped-efinanceira/cadastro"
+	"sped-efinanceira/common"
+	"sped-efinanceira/eventos"
+	"sped-efinanceira/layout"
+	"sped-efinanceira/middlewares"
+	"sped-efinanceira/models"
+	"sped-efinanceira/repositories"
+	"sped-efinanceira/semestre"
+	"sped-efinanceira/validacao"
+)
+
+type EventoController struct {
+	repo               *repositories.EventoRepositorio
+	importacaoRepo     *repositories.ImportacaoRepositorio
+	movimentoContaRepo *repositories.MovimentoContaRepositorio
+	titularRepo        *repositories.TitularRepositorio
+	contaRepo          *repositories.ContaRepositorio
+	crsRepo            *repositories.CRSRepositorio
+	cotacaoRepo        *repositories.CotacaoRepositorio
+	periodoRepo        *repositories.PeriodoRepositorio
+	sequenciaRepo      *repositories.SequenciaRepositorio
+}
+
+func NovoEventoController(repo *repositories.EventoRepositorio, importacaoRepo *repositories.ImportacaoRepositorio, movimentoContaRepo *repositories.MovimentoContaRepositorio, titularRepo *repositories.TitularRepositorio, contaRepo *repositories.ContaRepositorio, crsRepo *repositories.CRSRepositorio, cotacaoRepo *repositories.CotacaoRepositorio, periodoRepo *repositories.PeriodoRepositorio, sequenciaRepo *repositories.SequenciaRepositorio) *EventoController {
+	return &EventoController{
+		repo:               repo,
+		importacaoRepo:     importacaoRepo,
+		movimentoContaRepo: movimentoContaRepo,
+		titularRepo:        titularRepo,
+		contaRepo:          contaRepo,
+		crsRepo:            crsRepo,
+		cotacaoRepo:        cotacaoRepo,
+		periodoRepo:        periodoRepo,
+		sequenciaRepo:      sequenciaRepo,
+	}
+}
+
+// Listar Eventos, filtrando por declarante, período, tipo e status
+func (ec *EventoController) ListarEventos(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	eventos, err := ec.repo.ListarEventos(query.Get("declarante"), query.Get("periodo"), query.Get("tipo"), query.Get("status"))
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao listar Eventos!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	if err := cadastro.ResolverDeclarados(ec.titularRepo, ec.crsRepo, eventos...); err != nil {
+		log.Println("Erro ao consultar o cadastro de titulares:", err)
+	}
+
+	resposta := struct {
+		TotalEventos int              `json:"total_eventos"`
+		Eventos      []*models.Evento `json:"eventos"`
+	}{
+		TotalEventos: len(eventos),
+		Eventos:      eventos,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resposta)
+}
+
+// Listar Evento por ID
+func (ec *EventoController) ListarEventoPorID(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	evento, err := ec.repo.ListarEventoPorID(id)
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Evento não encontrado!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	if err := cadastro.ResolverDeclarados(ec.titularRepo, ec.crsRepo, evento); err != nil {
+		log.Println("Erro ao consultar o cadastro de titulares:", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(evento)
+}
+
+// Baixar o XML do Evento: o original, quando importado, ou o gerado a partir do modelo
+func (ec *EventoController) BaixarXMLEvento(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	evento, err := ec.repo.ListarEventoPorID(id)
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Evento não encontrado!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	conteudo := []byte(evento.XML)
+	if evento.XML == "" {
+		var versao *layout.Versao
+		versao, err = semestre.VersaoLayout(ec.periodoRepo, evento.Declarante, evento.Periodo)
+		if err == nil {
+			err = cadastro.ResolverDeclarados(ec.titularRepo, ec.crsRepo, evento)
+		}
+		if err == nil {
+			conteudo, err = versao.GerarXML(evento, layout.AmbienteConfigurado())
+		}
+		if err != nil {
+			log.Println(err)
+			RespostaComErro := common.RespostaComErro{
+				Error:   "Falha ao gerar XML!",
+				Message: err.Error(),
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			json.NewEncoder(w).Encode(RespostaComErro)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.xml\"", evento.ID.Hex()))
+	w.Write(conteudo)
+}
+
+// Gerar eventos de movimento (evtMovOpFin) a partir dos totais das
+// importações de transações concluídas. Rascunhos gerados anteriormente para
+// o mesmo período são substituídos.
+func (ec *EventoController) GerarMovimentos(w http.ResponseWriter, r *http.Request) {
+	declarante := validacao.SomenteDigitos(r.URL.Query().Get("declarante"))
+	periodo := r.URL.Query().Get("periodo")
+
+	_, _, err := eventos.LimitesPeriodo(periodo)
+	if err != nil || !validacao.CNPJValido(declarante) {
+		mensagem := "O CNPJ do declarante é inválido."
+		if err != nil {
+			mensagem = err.Error()
+		}
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Campos inválidos!",
+			Message: mensagem,
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	if periodoBloqueado(w, ec.periodoRepo, declarante, periodo) {
+		return
+	}
+
+	repos := &semestre.Repositorios{
+		Eventos:         ec.repo,
+		Importacoes:     ec.importacaoRepo,
+		MovimentosConta: ec.movimentoContaRepo,
+		Titulares:       ec.titularRepo,
+		Contas:          ec.contaRepo,
+		CRS:             ec.crsRepo,
+		Cotacoes:        ec.cotacaoRepo,
+		Sequencias:      ec.sequenciaRepo,
+	}
+
+	gerados, err := semestre.GerarMovimentos(repos, declarante, periodo, middlewares.UsuarioLogado(r))
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao gerar Eventos!",
+			Message: err.Error(),
+		}
+
+		// Falta de cotação é problema dos dados, não do servidor
+		status := http.StatusInternalServerError
+		var conversao *semestre.ErroConversao
+		if errors.As(err, &conversao) {
+			RespostaComErro.Error = "Falha na conversão cambial!"
+			status = http.StatusUnprocessableEntity
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	resposta := struct {
+		TotalEventos int              `json:"total_eventos"`
+		Eventos      []*models.Evento `json:"eventos"`
+	}{
+		TotalEventos: len(gerados),
+		Eventos:      gerados,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resposta)
+}
+
+// Sugerir as exclusões necessárias na retificação do período: movimentos
+// aceitos de declarados que não estão entre os movimentos gerados
+func (ec *EventoController) SugerirExclusoes(w http.ResponseWriter, r *http.Request) {
+	declarante := validacao.SomenteDigitos(r.URL.Query().Get("declarante"))
+	periodo := r.URL.Query().Get("periodo")
+
+	sugestoes, err := semestre.SugerirExclusoes(&semestre.Repositorios{Eventos: ec.repo}, declarante, periodo)
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao sugerir Exclusões!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	resposta := struct {
+		TotalSugestoes int                        `json:"total_sugestoes"`
+		Sugestoes      []eventos.SugestaoExclusao `json:"sugestoes"`
+	}{
+		TotalSugestoes: len(sugestoes),
+		Sugestoes:      sugestoes,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resposta)
+}
+
+// Aceitar as exclusões sugeridas, criando os evtExclusaoeFinanceira em
+// rascunho. Sem recibos no corpo, aceita todas.
+func (ec *EventoController) AceitarExclusoes(w http.ResponseWriter, r *http.Request) {
+	declarante := validacao.SomenteDigitos(r.URL.Query().Get("declarante"))
+	periodo := r.URL.Query().Get("periodo")
+
+	var aceite models.AceiteExclusoes
+	err := json.NewDecoder(r.Body).Decode(&aceite)
+	if err != nil && err != io.EOF {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Pedido inválido!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	if periodoBloqueado(w, ec.periodoRepo, declarante, periodo) {
+		return
+	}
+
+	repos := &semestre.Repositorios{
+		Eventos:    ec.repo,
+		Sequencias: ec.sequenciaRepo,
+	}
+	exclusoes, err := semestre.AceitarExclusoes(repos, declarante, periodo, aceite.Recibos, middlewares.UsuarioLogado(r))
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao criar Exclusões!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	resposta := struct {
+		TotalEventos int              `json:"total_eventos"`
+		Eventos      []*models.Evento `json:"eventos"`
+	}{
+		TotalEventos: len(exclusoes),
+		Eventos:      exclusoes,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resposta)
+}
+
+// Alterar o status do Evento para registrar etapas feitas fora do sistema,
+// como a assinatura e a transmissão, ou devolvê-lo a rascunho
+func (ec *EventoController) AlterarStatusEvento(w http.ResponseWriter, r *http.Request) {
+	evento, err := ec.repo.ListarEventoPorID(mux.Vars(r)["id"])
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Evento não encontrado!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	if periodoBloqueado(w, ec.periodoRepo, evento.Declarante, evento.Periodo) {
+		return
+	}
+
+	var alteracao models.AlteracaoStatus
+	err = json.NewDecoder(r.Body).Decode(&alteracao)
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Pedido inválido!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	// Validar o modelo
+	validate := validator.New()
+	err = validate.Struct(alteracao)
+	if err == nil && !eventos.TransicaoManual(alteracao.Status) {
+		err = fmt.Errorf("O status '%s' não pode ser informado manualmente.", alteracao.Status)
+	}
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Campos inválidos!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	err = eventos.AlterarStatus(ec.repo, evento, alteracao.Status, middlewares.UsuarioLogado(r), alteracao.Motivo)
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Transição de status inválida!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(evento)
+}
@@ -0,0 +1,403 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"sped-efinanceira/cadastro"
+	"sped-efinanceira/cambio"
+	"sped-efinanceira/common"
+	"sped-efinanceira/eventos"
+	"sped-efinanceira/importacao"
+	"sped-efinanceira/middlewares"
+	"sped-efinanceira/models"
+	"sped-efinanceira/repositories"
+	"sped-efinanceira/validacao"
+)
+
+const tipoConteudoXLSX = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+type ImportacaoController struct {
+	eventoRepo     *repositories.EventoRepositorio
+	importacaoRepo *repositories.ImportacaoRepositorio
+	titularRepo    *repositories.TitularRepositorio
+	cotacaoRepo    *repositories.CotacaoRepositorio
+	periodoRepo    *repositories.PeriodoRepositorio
+	sequenciaRepo  *repositories.SequenciaRepositorio
+	processador    *importacao.ProcessadorTransacoes
+}
+
+func NovoImportacaoController(eventoRepo *repositories.EventoRepositorio, importacaoRepo *repositories.ImportacaoRepositorio, titularRepo *repositories.TitularRepositorio, cotacaoRepo *repositories.CotacaoRepositorio, periodoRepo *repositories.PeriodoRepositorio, sequenciaRepo *repositories.SequenciaRepositorio, processador *importacao.ProcessadorTransacoes) *ImportacaoController {
+	return &ImportacaoController{
+		eventoRepo:     eventoRepo,
+		importacaoRepo: importacaoRepo,
+		titularRepo:    titularRepo,
+		cotacaoRepo:    cotacaoRepo,
+		periodoRepo:    periodoRepo,
+		sequenciaRepo:  sequenciaRepo,
+		processador:    processador,
+	}
+}
+
+// Baixar modelo de planilha do tipo de evento
+func (ic *ImportacaoController) BaixarModeloPlanilha(w http.ResponseWriter, r *http.Request) {
+	tipo := mux.Vars(r)["tipo"]
+
+	planilha, err := importacao.GerarModeloPlanilha(tipo)
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Modelo não encontrado!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	w.Header().Set("Content-Type", tipoConteudoXLSX)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"modelo-%s.xlsx\"", tipo))
+	if _, err := planilha.WriteTo(w); err != nil {
+		log.Println("Erro ao enviar modelo de planilha:", err)
+	}
+}
+
+// Importar planilha XLSX, devolvendo o arquivo anotado com os erros
+func (ic *ImportacaoController) ImportarPlanilha(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseMultipartForm(32 << 20)
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Pedido inválido!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	tipo := r.FormValue("tipo")
+	declarante := validacao.SomenteDigitos(r.FormValue("declarante"))
+	periodo := r.FormValue("periodo")
+
+	if !validacao.CNPJValido(declarante) {
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Campos inválidos!",
+			Message: "O CNPJ do declarante é inválido.",
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	if periodoBloqueado(w, ic.periodoRepo, declarante, periodo) {
+		return
+	}
+
+	arquivo, _, err := r.FormFile("arquivo")
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Arquivo não enviado!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+	defer arquivo.Close()
+
+	resultado, err := importacao.ImportarPlanilha(arquivo, tipo, declarante, periodo)
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao importar planilha!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	// Valores em moeda estrangeira são convertidos para reais pela PTAX
+	err = cambio.NovoConversor(ic.cotacaoRepo).ConverterEventos(resultado.Eventos)
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha na conversão cambial!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	// Eventos que substituem outros já aceitos entram como retificadoras
+	aceitos, err := ic.eventoRepo.ListarEventos(declarante, periodo, tipo, models.EventoAceito)
+	if err == nil {
+		eventos.MarcarRetificacoes(resultado.Eventos, aceitos)
+		err = cadastro.VincularTitulares(ic.titularRepo, resultado.Eventos, eventos.OrigemPlanilha)
+	}
+	if err == nil {
+		err = eventos.AtribuirIDs(ic.sequenciaRepo, resultado.Eventos...)
+	}
+	for _, evento := range resultado.Eventos {
+		evento.CriadoPor = middlewares.UsuarioLogado(r)
+	}
+	if err == nil {
+		err = ic.eventoRepo.CriarEventos(resultado.Eventos)
+	}
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao criar Eventos!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	log.Printf("Planilha importada: %d linhas aceitas, %d rejeitadas, %d eventos criados",
+		resultado.LinhasAceitas, resultado.LinhasRejeitadas, len(resultado.Eventos))
+
+	w.Header().Set("Content-Type", tipoConteudoXLSX)
+	w.Header().Set("Content-Disposition", "attachment; filename=\"importacao-anotada.xlsx\"")
+	w.Header().Set("X-Linhas-Aceitas", strconv.Itoa(resultado.LinhasAceitas))
+	w.Header().Set("X-Linhas-Rejeitadas", strconv.Itoa(resultado.LinhasRejeitadas))
+	w.Header().Set("X-Eventos-Criados", strconv.Itoa(len(resultado.Eventos)))
+	w.WriteHeader(http.StatusCreated)
+	if _, err := resultado.Planilha.WriteTo(w); err != nil {
+		log.Println("Erro ao enviar planilha anotada:", err)
+	}
+}
+
+// Importar arquivo de transações. O arquivo é gravado em disco à medida que
+// chega e processado em segundo plano; o progresso é consultado em
+// GET /importacoes/{id}
+func (ic *ImportacaoController) ImportarTransacoes(w http.ResponseWriter, r *http.Request) {
+	declarante := validacao.SomenteDigitos(r.URL.Query().Get("declarante"))
+	periodo := r.URL.Query().Get("periodo")
+
+	if !validacao.CNPJValido(declarante) {
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Campos inválidos!",
+			Message: "O CNPJ do declarante é inválido.",
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	if _, _, err := eventos.ParsePeriodo(periodo); err != nil {
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Campos inválidos!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	// Recusa antes de receber o arquivo, que pode ter vários GB
+	if periodoBloqueado(w, ic.periodoRepo, declarante, periodo) {
+		return
+	}
+
+	nomeArquivo, caminho, tamanho, err := receberArquivo(r, "arquivo")
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao receber arquivo!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	novaImportacao := &models.Importacao{
+		Tipo:        importacao.TipoTransacoes,
+		Declarante:  declarante,
+		Periodo:     periodo,
+		NomeArquivo: nomeArquivo,
+		Caminho:     caminho,
+		Status:      models.ImportacaoPendente,
+		TotalBytes:  tamanho,
+		Erros:       []string{},
+	}
+
+	err = ic.importacaoRepo.CriarImportacao(novaImportacao)
+	if err != nil {
+		log.Println(err)
+		os.Remove(caminho)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao criar Importação!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(novaImportacao)
+
+	ic.processador.Iniciar(novaImportacao)
+}
+
+// Consultar Importação e seu progresso
+func (ic *ImportacaoController) ListarImportacaoPorID(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	registro, err := ic.importacaoRepo.ListarImportacaoPorID(id)
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Importação não encontrada!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	if registro.TotalBytes > 0 {
+		registro.Progresso = float64(registro.BytesProcessados) * 100 / float64(registro.TotalBytes)
+	}
+	if registro.Status == models.ImportacaoConcluida {
+		registro.Progresso = 100
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(registro)
+}
+
+// Importar XMLs históricos (evento avulso, lote ou ZIP com vários arquivos)
+func (ic *ImportacaoController) ImportarXML(w http.ResponseWriter, r *http.Request) {
+	_, caminho, _, err := receberArquivo(r, "arquivo")
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao receber arquivo!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+	defer os.Remove(caminho)
+
+	resultado, err := importacao.ImportarArquivoXML(caminho)
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao importar XML!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	resumo, err := resultado.Gravar(ic.eventoRepo, ic.titularRepo, ic.periodoRepo, middlewares.UsuarioLogado(r))
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao gravar Eventos!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resumo)
+}
+
+// Grava em disco a parte do formulário multipart com o arquivo, sem
+// carregá-lo em memória
+func receberArquivo(r *http.Request, campo string) (string, string, int64, error) {
+	leitor, err := r.MultipartReader()
+	if err != nil {
+		return "", "", 0, err
+	}
+
+	for {
+		parte, err := leitor.NextPart()
+		if err == io.EOF {
+			return "", "", 0, fmt.Errorf("campo '%s' não enviado", campo)
+		}
+		if err != nil {
+			return "", "", 0, err
+		}
+
+		if parte.FormName() != campo {
+			parte.Close()
+			continue
+		}
+		defer parte.Close()
+
+		diretorio := importacao.DiretorioImportacoes()
+		if err := os.MkdirAll(diretorio, os.ModePerm); err != nil {
+			return "", "", 0, err
+		}
+
+		caminho := filepath.Join(diretorio, primitive.NewObjectID().Hex()+filepath.Ext(parte.FileName()))
+		destino, err := os.Create(caminho)
+		if err != nil {
+			return "", "", 0, err
+		}
+		defer destino.Close()
+
+		tamanho, err := io.Copy(destino, parte)
+		if err != nil {
+			os.Remove(caminho)
+			return "", "", 0, err
+		}
+
+		return parte.FileName(), caminho, tamanho, nil
+	}
+}
@@ -0,0 +1,443 @@
+package controllers
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"sped-efinanceira/common"
+	"sped-efinanceira/eventos"
+	"sped-efinanceira/layout"
+	"sped-efinanceira/middlewares"
+	"sped-efinanceira/models"
+	"sped-efinanceira/regras"
+	"sped-efinanceira/repositories"
+	"sped-efinanceira/semestre"
+	"sped-efinanceira/validacao"
+)
+
+// Tempo em que o ZIP de uma simulação fica disponível para download
+const validadeSimulacao = 24 * time.Hour
+
+type LoteController struct {
+	eventoRepo         *repositories.EventoRepositorio
+	titularRepo        *repositories.TitularRepositorio
+	crsRepo            *repositories.CRSRepositorio
+	periodoRepo        *repositories.PeriodoRepositorio
+	sequenciaRepo      *repositories.SequenciaRepositorio
+	importacaoRepo     *repositories.ImportacaoRepositorio
+	movimentoContaRepo *repositories.MovimentoContaRepositorio
+	contaRepo          *repositories.ContaRepositorio
+	cotacaoRepo        *repositories.CotacaoRepositorio
+}
+
+func NovoLoteController(eventoRepo *repositories.EventoRepositorio, titularRepo *repositories.TitularRepositorio, crsRepo *repositories.CRSRepositorio, periodoRepo *repositories.PeriodoRepositorio, sequenciaRepo *repositories.SequenciaRepositorio, importacaoRepo *repositories.ImportacaoRepositorio, movimentoContaRepo *repositories.MovimentoContaRepositorio, contaRepo *repositories.ContaRepositorio, cotacaoRepo *repositories.CotacaoRepositorio) *LoteController {
+	return &LoteController{
+		eventoRepo:         eventoRepo,
+		titularRepo:        titularRepo,
+		crsRepo:            crsRepo,
+		periodoRepo:        periodoRepo,
+		sequenciaRepo:      sequenciaRepo,
+		importacaoRepo:     importacaoRepo,
+		movimentoContaRepo: movimentoContaRepo,
+		contaRepo:          contaRepo,
+		cotacaoRepo:        cotacaoRepo,
+	}
+}
+
+// Validar os rascunhos do período pelas regras de negócio da e-Financeira.
+// As ocorrências ficam gravadas em cada evento e os aprovados passam a
+// validados.
+func (lc *LoteController) ValidarPeriodo(w http.ResponseWriter, r *http.Request) {
+	declarante := validacao.SomenteDigitos(r.URL.Query().Get("declarante"))
+	periodo := r.URL.Query().Get("periodo")
+
+	if periodoBloqueado(w, lc.periodoRepo, declarante, periodo) {
+		return
+	}
+
+	_, resultados, err := lc.validar(declarante, periodo, middlewares.UsuarioLogado(r))
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao validar Eventos!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	responderValidacao(w, http.StatusOK, resultados)
+}
+
+// Gerar os lotes de envio com os eventos pendentes do período. Os eventos só
+// são agrupados se passarem nas regras e estiverem aprovados; caso
+// contrário, devolve as ocorrências ou os eventos sem aprovação. Os eventos
+// incluídos são assinados com o certificado (CERTIFICADO_PFX) e passam a
+// em_lote.
+func (lc *LoteController) GerarLotes(w http.ResponseWriter, r *http.Request) {
+	declarante := validacao.SomenteDigitos(r.URL.Query().Get("declarante"))
+	periodo := r.URL.Query().Get("periodo")
+
+	if periodoBloqueado(w, lc.periodoRepo, declarante, periodo) {
+		return
+	}
+
+	lote, resultados, err := lc.validar(declarante, periodo, middlewares.UsuarioLogado(r))
+	if err == nil && len(lote) == 0 {
+		err = fmt.Errorf("nenhum evento pendente de envio no período %s", periodo)
+	}
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao gerar Lotes!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	if !regras.Validos(resultados) {
+		responderValidacao(w, http.StatusUnprocessableEntity, resultados)
+		return
+	}
+
+	// Só eventos aprovados por um segundo usuário seguem para transmissão
+	var pendentes []string
+	for _, evento := range lote {
+		if evento.Status != models.EventoAprovado {
+			pendentes = append(pendentes, evento.ID.Hex())
+		}
+	}
+	if len(pendentes) > 0 {
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Eventos pendentes de aprovação!",
+			Message: fmt.Sprintf("%d evento(s) ainda não aprovado(s): %s", len(pendentes), strings.Join(pendentes, ", ")),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	// O conteúdo enviado precisa ser o aprovado: eventos que mudaram depois da
+	// aprovação, por exemplo por alteração no cadastro do titular, voltam a
+	// rascunho e precisam passar de novo pela validação e pela aprovação
+	var alterados []*models.Evento
+	for _, evento := range lote {
+		if evento.HashAprovado != eventos.HashConteudo(evento) {
+			alterados = append(alterados, evento)
+		}
+	}
+	if len(alterados) > 0 {
+		ids := make([]string, 0, len(alterados))
+		for _, evento := range alterados {
+			ids = append(ids, evento.ID.Hex())
+		}
+
+		_, err := eventos.AvancarStatusEventos(lc.eventoRepo, alterados, models.EventoRascunho, eventos.UsuarioSistema, "Conteúdo alterado depois da aprovação")
+		if err != nil {
+			log.Println(err)
+		}
+
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Eventos alterados depois da aprovação!",
+			Message: fmt.Sprintf("%d evento(s) mudaram depois de aprovados e voltaram a rascunho: %s", len(ids), strings.Join(ids, ", ")),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	// Os eventos seguem assinados com o certificado do declarante
+	assinador, err := layout.CarregarAssinador()
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Certificado digital indisponível!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	var lotes [][]byte
+	versao, err := semestre.VersaoLayout(lc.periodoRepo, declarante, periodo)
+	if err == nil {
+		lotes, err = montarLotes(versao, lote, assinador)
+	}
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao gerar Lotes!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	// Enquanto editáveis, os eventos leem o declarado e os blocos do CRS do
+	// cadastro; a partir daqui guardam os dados como foram enviados
+	for _, evento := range lote {
+		if evento.Movimento == nil {
+			continue
+		}
+		if err = lc.eventoRepo.GravarMovimento(evento.ID, evento.Movimento); err != nil {
+			break
+		}
+	}
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao gravar os dados dos declarados!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	// Os eventos dos lotes saem do período pendente: passam por assinado a
+	// em_lote e não entram de novo nos próximos lotes
+	_, err = eventos.AvancarStatusEventos(lc.eventoRepo, lote, models.EventoEmLote, middlewares.UsuarioLogado(r), "Assinado com o certificado de "+assinador.Titular()+" e incluído nos lotes de envio")
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao registrar os Eventos nos Lotes!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"lotes_%s_%s.zip\"", declarante, periodo))
+
+	if err := escreverZIP(w, lotes); err != nil {
+		log.Println("Erro ao enviar os lotes:", err)
+	}
+}
+
+// Simular o envio do período sem transmitir nem alterar os eventos: gera em
+// memória a abertura, os movimentos e o fechamento, assina e valida os XML contra os XSD e monta os lotes. O ZIP fica
+// disponível para download por 24 horas.
+func (lc *LoteController) SimularEnvio(w http.ResponseWriter, r *http.Request) {
+	declarante := validacao.SomenteDigitos(r.URL.Query().Get("declarante"))
+	periodo := r.URL.Query().Get("periodo")
+
+	// Sem certificado a simulação segue, apenas sem assinatura
+	assinador, errCertificado := layout.CarregarAssinador()
+
+	repos := &semestre.Repositorios{
+		Eventos:         lc.eventoRepo,
+		Importacoes:     lc.importacaoRepo,
+		MovimentosConta: lc.movimentoContaRepo,
+		Titulares:       lc.titularRepo,
+		Contas:          lc.contaRepo,
+		CRS:             lc.crsRepo,
+		Cotacoes:        lc.cotacaoRepo,
+		Periodos:        lc.periodoRepo,
+	}
+	simulacao, lotes, err := semestre.SimularEnvio(repos, declarante, periodo, assinador)
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao simular o envio!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+	if errCertificado != nil {
+		simulacao.Avisos = append(simulacao.Avisos, "XML não assinado: "+errCertificado.Error())
+	}
+
+	tamanho, err := gravarSimulacao(simulacao.ID, lotes)
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao gravar o ZIP da simulação!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+	simulacao.BytesZIP = tamanho
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(simulacao)
+}
+
+// Baixar o ZIP de uma simulação
+func (lc *LoteController) BaixarSimulacao(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	arquivo, err := os.Open(caminhoSimulacao(id))
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Simulação não encontrada!",
+			Message: "O ZIP da simulação não existe ou já expirou.",
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+	defer arquivo.Close()
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"simulacao_%s.zip\"", id))
+	if _, err := io.Copy(w, arquivo); err != nil {
+		log.Println("Erro ao enviar a simulação:", err)
+	}
+}
+
+// Pasta dos ZIP das simulações, definida em SIMULACOES_DIR
+func pastaSimulacoes() string {
+	if pasta := os.Getenv("SIMULACOES_DIR"); pasta != "" {
+		return pasta
+	}
+	return "simulacoes"
+}
+
+// O nome do arquivo vem da URL; só o nome base é aceito
+func caminhoSimulacao(id string) string {
+	return filepath.Join(pastaSimulacoes(), filepath.Base(id)+".zip")
+}
+
+// Grava o ZIP da simulação e remove os que passaram da validade
+func gravarSimulacao(id string, lotes [][]byte) (int64, error) {
+	pasta := pastaSimulacoes()
+	if err := os.MkdirAll(pasta, 0755); err != nil {
+		return 0, err
+	}
+
+	if antigos, err := os.ReadDir(pasta); err == nil {
+		limite := time.Now().Add(-validadeSimulacao)
+		for _, antigo := range antigos {
+			info, err := antigo.Info()
+			if err == nil && !antigo.IsDir() && info.ModTime().Before(limite) {
+				os.Remove(filepath.Join(pasta, antigo.Name()))
+			}
+		}
+	}
+
+	arquivo, err := os.Create(caminhoSimulacao(id))
+	if err != nil {
+		return 0, err
+	}
+	defer arquivo.Close()
+
+	if err := escreverZIP(arquivo, lotes); err != nil {
+		return 0, err
+	}
+
+	info, err := arquivo.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// Escreve os lotes em um ZIP, um arquivo XML por lote
+func escreverZIP(w io.Writer, lotes [][]byte) error {
+	arquivo := zip.NewWriter(w)
+	for i, conteudo := range lotes {
+		entrada, err := arquivo.Create(semestre.NomeArquivoLote(i))
+		if err != nil {
+			return err
+		}
+		if _, err := entrada.Write(conteudo); err != nil {
+			return err
+		}
+	}
+	return arquivo.Close()
+}
+
+// Valida os eventos pendentes do período com os repositórios do controlador
+func (lc *LoteController) validar(declarante, periodo, usuario string) ([]*models.Evento, []regras.ResultadoEvento, error) {
+	repos := &semestre.Repositorios{
+		Eventos:    lc.eventoRepo,
+		Titulares:  lc.titularRepo,
+		CRS:        lc.crsRepo,
+		Sequencias: lc.sequenciaRepo,
+	}
+	return semestre.Validar(repos, declarante, periodo, usuario)
+}
+
+// Converte os eventos para XML na versão do leiaute, assina e os distribui em
+// lotes. Eventos importados já trazem o XML original, com a assinatura.
+func montarLotes(versao *layout.Versao, lista []*models.Evento, assinador *layout.Assinador) ([][]byte, error) {
+	tpAmb := layout.AmbienteConfigurado()
+
+	var eventosXML []layout.EventoXML
+	for _, evento := range lista {
+		conteudo := []byte(evento.XML)
+		if evento.XML == "" {
+			var err error
+			conteudo, err = versao.GerarXML(evento, tpAmb)
+			if err == nil {
+				conteudo, err = assinador.Assinar(conteudo)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("evento %s: %v", evento.ID.Hex(), err)
+			}
+		}
+		eventosXML = append(eventosXML, layout.EventoXML{ID: evento.IDEvento, XML: conteudo})
+	}
+
+	return versao.MontarLotes(eventosXML)
+}
+
+func responderValidacao(w http.ResponseWriter, status int, resultados []regras.ResultadoEvento) {
+	resposta := struct {
+		Valido       bool                     `json:"valido"`
+		TotalEventos int                      `json:"total_eventos"`
+		Eventos      []regras.ResultadoEvento `json:"eventos"`
+	}{
+		Valido:       regras.Validos(resultados),
+		TotalEventos: len(resultados),
+		Eventos:      resultados,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resposta)
+}
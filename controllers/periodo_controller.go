@@ -0,0 +1,304 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/go-playground/validator"
+	"github.com/gorilla/mux"
+
+	"sped-efinanceira/common"
+	"sped-efinanceira/eventos"
+	"sped-efinanceira/layout"
+	"sped-efinanceira/middlewares"
+	"sped-efinanceira/models"
+	"sped-efinanceira/repositories"
+	"sped-efinanceira/semestre"
+	"sped-efinanceira/validacao"
+)
+
+type PeriodoController struct {
+	repo          *repositories.PeriodoRepositorio
+	eventoRepo    *repositories.EventoRepositorio
+	sequenciaRepo *repositories.SequenciaRepositorio
+}
+
+func NovoPeriodoController(repo *repositories.PeriodoRepositorio, eventoRepo *repositories.EventoRepositorio, sequenciaRepo *repositories.SequenciaRepositorio) *PeriodoController {
+	return &PeriodoController{
+		repo:          repo,
+		eventoRepo:    eventoRepo,
+		sequenciaRepo: sequenciaRepo,
+	}
+}
+
+// Listar Períodos registrados, filtrando por declarante
+func (pc *PeriodoController) ListarPeriodos(w http.ResponseWriter, r *http.Request) {
+	periodos, err := pc.repo.ListarPeriodos(validacao.SomenteDigitos(r.URL.Query().Get("declarante")))
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao listar Períodos!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	resposta := struct {
+		TotalPeriodos int                         `json:"total_periodos"`
+		Periodos      []*models.PeriodoDeclarante `json:"periodos"`
+	}{
+		TotalPeriodos: len(periodos),
+		Periodos:      periodos,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resposta)
+}
+
+// Consultar a situação do período; sem registro, o período está aberto
+func (pc *PeriodoController) BuscarPeriodo(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	declarante := validacao.SomenteDigitos(vars["declarante"])
+
+	registro, err := pc.repo.BuscarPeriodo(declarante, vars["periodo"])
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao consultar Período!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	if registro == nil {
+		registro = &models.PeriodoDeclarante{
+			Declarante: declarante,
+			Periodo:    vars["periodo"],
+			Situacao:   models.PeriodoAberto,
+			Historico:  []models.SituacaoPeriodo{},
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(registro)
+}
+
+// Reabrir um período fechado, registrando quem reabriu e o motivo, e iniciar
+// a retificação: os movimentos e o fechamento aceitos ganham retificadoras em
+// rascunho, devolvidas junto com o período.
+func (pc *PeriodoController) ReabrirPeriodo(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	declarante := validacao.SomenteDigitos(vars["declarante"])
+
+	var reabertura models.ReaberturaPeriodo
+	err := json.NewDecoder(r.Body).Decode(&reabertura)
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Pedido inválido!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	// Validar o modelo
+	validate := validator.New()
+	if err := validate.Struct(reabertura); err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Campos inválidos!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	err = eventos.ReabrirPeriodo(pc.repo, declarante, vars["periodo"], middlewares.UsuarioLogado(r), reabertura.Motivo)
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao reabrir Período!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	log.Printf("Período %s do declarante %s reaberto por %s: %s", vars["periodo"], declarante, middlewares.UsuarioLogado(r), reabertura.Motivo)
+
+	repos := &semestre.Repositorios{
+		Eventos:    pc.eventoRepo,
+		Sequencias: pc.sequenciaRepo,
+	}
+	retificadoras, err := semestre.IniciarRetificacao(repos, declarante, vars["periodo"], middlewares.UsuarioLogado(r))
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Período reaberto, mas houve falha ao criar as retificadoras!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	registro, err := pc.repo.BuscarPeriodo(declarante, vars["periodo"])
+	if err != nil {
+		log.Println(err)
+	}
+
+	resposta := struct {
+		Periodo            *models.PeriodoDeclarante `json:"periodo"`
+		TotalRetificadoras int                       `json:"total_retificadoras"`
+		Retificadoras      []*models.Evento          `json:"retificadoras"`
+	}{
+		Periodo:            registro,
+		TotalRetificadoras: len(retificadoras),
+		Retificadoras:      retificadoras,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resposta)
+}
+
+// Listar as versões do leiaute disponíveis para geração dos eventos
+func (pc *PeriodoController) ListarVersoesLayout(w http.ResponseWriter, r *http.Request) {
+	versoes := layout.Versoes()
+
+	resposta := struct {
+		TotalVersoes int              `json:"total_versoes"`
+		Versoes      []*layout.Versao `json:"versoes"`
+	}{
+		TotalVersoes: len(versoes),
+		Versoes:      versoes,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resposta)
+}
+
+// Definir a versão do leiaute dos eventos do período, por exemplo para
+// retificar um semestre antigo na versão em que foi entregue
+func (pc *PeriodoController) DefinirVersaoLayout(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	declarante := validacao.SomenteDigitos(vars["declarante"])
+	periodo := vars["periodo"]
+
+	var escolha models.EscolhaVersaoLayout
+	err := json.NewDecoder(r.Body).Decode(&escolha)
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Pedido inválido!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	// Validar o modelo
+	validate := validator.New()
+	err = validate.Struct(escolha)
+	if err == nil && !validacao.CNPJValido(declarante) {
+		err = fmt.Errorf("O CNPJ do declarante é inválido.")
+	}
+	if err == nil {
+		_, _, err = eventos.LimitesPeriodo(periodo)
+	}
+	if err == nil {
+		_, err = layout.BuscarVersao(escolha.Versao)
+	}
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Campos inválidos!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	// Em período fechado os eventos já aceitos ficam na versão em que foram
+	// entregues; a troca exige reabertura
+	if periodoBloqueado(w, pc.repo, declarante, periodo) {
+		return
+	}
+
+	err = pc.repo.DefinirVersaoLayout(declarante, periodo, escolha.Versao)
+	if err != nil {
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao definir a versão do leiaute!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	log.Printf("Período %s do declarante %s passa a usar o leiaute %s (%s)", periodo, declarante, escolha.Versao, middlewares.UsuarioLogado(r))
+
+	registro, err := pc.repo.BuscarPeriodo(declarante, periodo)
+	if err != nil {
+		log.Println(err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(registro)
+}
+
+// Responde 423 e devolve true quando o período está fechado para alterações
+func periodoBloqueado(w http.ResponseWriter, periodoRepo *repositories.PeriodoRepositorio, declarante, periodo string) bool {
+	err := eventos.VerificarPeriodoAberto(periodoRepo, declarante, periodo)
+	if err == nil {
+		return false
+	}
+
+	log.Println(err)
+	RespostaComErro := common.RespostaComErro{
+		Error:   "Período fechado!",
+		Message: err.Error(),
+	}
+
+	status := http.StatusLocked
+	var fechado *eventos.ErroPeriodoFechado
+	if !errors.As(err, &fechado) {
+		RespostaComErro.Error = "Falha ao consultar Período!"
+		status = http.StatusInternalServerError
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(RespostaComErro)
+	return true
+}
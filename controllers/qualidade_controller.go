@@ -0,0 +1,213 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"sped-efinanceira/cadastro"
+	"sped-efinanceira/common"
+	"sped-efinanceira/eventos"
+	"sped-efinanceira/middlewares"
+	"sped-efinanceira/qualidade"
+	"sped-efinanceira/repositories"
+	"sped-efinanceira/validacao"
+)
+
+type QualidadeController struct {
+	repo        *repositories.QualidadeRepositorio
+	titularRepo *repositories.TitularRepositorio
+	contaRepo   *repositories.ContaRepositorio
+	crsRepo     *repositories.CRSRepositorio
+	eventoRepo  *repositories.EventoRepositorio
+}
+
+func NovoQualidadeController(repo *repositories.QualidadeRepositorio, titularRepo *repositories.TitularRepositorio, contaRepo *repositories.ContaRepositorio, crsRepo *repositories.CRSRepositorio, eventoRepo *repositories.EventoRepositorio) *QualidadeController {
+	return &QualidadeController{
+		repo:        repo,
+		titularRepo: titularRepo,
+		contaRepo:   contaRepo,
+		crsRepo:     crsRepo,
+		eventoRepo:  eventoRepo,
+	}
+}
+
+// Avaliar a qualidade dos dados do declarante sobre o cadastro e os
+// movimentos em rascunho do período (padrão: o último semestre encerrado) e
+// guardar o relatório na série histórica
+func (qc *QualidadeController) GerarRelatorio(w http.ResponseWriter, r *http.Request) {
+	declarante := validacao.SomenteDigitos(r.URL.Query().Get("declarante"))
+	periodo := r.URL.Query().Get("periodo")
+
+	// Validar os parâmetros
+	var err error
+	if !validacao.CNPJValido(declarante) {
+		err = fmt.Errorf("O CNPJ do declarante é inválido.")
+	}
+	if err == nil {
+		if periodo == "" {
+			periodo, err = eventos.PeriodoAnterior(eventos.PeriodoDe(time.Now()))
+		} else {
+			_, _, err = eventos.LimitesPeriodo(periodo)
+		}
+	}
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Campos inválidos!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	titulares, err := qc.titularRepo.ListarTitulares(declarante, "")
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao listar Titulares!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	contas, err := qc.contaRepo.ListarContas(declarante, "")
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao listar Contas!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	movimentos, err := qc.eventoRepo.ListarEventos(declarante, periodo, eventos.TipoMovimento, "")
+	if err == nil {
+		// Avalia os declarados como serão enviados, com o cadastro atual
+		err = cadastro.ResolverDeclarados(qc.titularRepo, qc.crsRepo, movimentos...)
+	}
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao listar Eventos!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	relatorio := qualidade.Avaliar(titulares, contas, movimentos)
+	relatorio.Declarante = declarante
+	relatorio.Periodo = periodo
+	relatorio.GeradoPor = middlewares.UsuarioLogado(r)
+
+	if err := qc.repo.CriarRelatorio(relatorio); err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao gravar o Relatório de qualidade!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(relatorio)
+}
+
+// Listar a série histórica das pontuações do declarante, do relatório mais
+// recente ao mais antigo, com filtro opcional de período
+func (qc *QualidadeController) ListarTendencia(w http.ResponseWriter, r *http.Request) {
+	declarante := validacao.SomenteDigitos(r.URL.Query().Get("declarante"))
+	periodo := r.URL.Query().Get("periodo")
+
+	// Validar os parâmetros
+	var err error
+	if !validacao.CNPJValido(declarante) {
+		err = fmt.Errorf("O CNPJ do declarante é inválido.")
+	}
+	if err == nil && periodo != "" {
+		_, _, err = eventos.LimitesPeriodo(periodo)
+	}
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Campos inválidos!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	relatorios, err := qc.repo.ListarRelatorios(declarante, periodo)
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao listar Relatórios de qualidade!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	resposta := struct {
+		Declarante      string                     `json:"declarante"`
+		TotalRelatorios int                        `json:"total_relatorios"`
+		Relatorios      []qualidade.PontoTendencia `json:"relatorios"`
+	}{
+		Declarante:      declarante,
+		TotalRelatorios: len(relatorios),
+		Relatorios:      qualidade.Tendencia(relatorios),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resposta)
+}
+
+// Listar Relatório de qualidade por ID, com os exemplos de cada indicador
+func (qc *QualidadeController) ListarRelatorioPorID(w http.ResponseWriter, r *http.Request) {
+	relatorio, err := qc.repo.ListarRelatorioPorID(mux.Vars(r)["id"])
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Relatório de qualidade não encontrado!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(relatorio)
+}
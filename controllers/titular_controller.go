@@ -0,0 +1,160 @@
+package controllers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/go-playground/validator"
+	"github.com/gorilla/mux"
+
+	"sped-efinanceira/cadastro"
+	"sped-efinanceira/common"
+	"sped-efinanceira/eventos"
+	"sped-efinanceira/models"
+	"sped-efinanceira/repositories"
+	"sped-efinanceira/validacao"
+)
+
+type TitularController struct {
+	repo *repositories.TitularRepositorio
+}
+
+func NovoTitularController(repo *repositories.TitularRepositorio) *TitularController {
+	return &TitularController{repo: repo}
+}
+
+// Listar Titulares, filtrando por declarante e documento
+func (tc *TitularController) ListarTitulares(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	titulares, err := tc.repo.ListarTitulares(validacao.SomenteDigitos(query.Get("declarante")), validacao.SomenteDigitos(query.Get("ni")))
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao listar Titulares!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	resposta := struct {
+		TotalTitulares int               `json:"total_titulares"`
+		Titulares      []*models.Titular `json:"titulares"`
+	}{
+		TotalTitulares: len(titulares),
+		Titulares:      titulares,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resposta)
+}
+
+// Listar Titular por ID, com o histórico de alterações
+func (tc *TitularController) ListarTitularPorID(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	titular, err := tc.repo.ListarTitularPorID(id)
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Titular não encontrado!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(titular)
+}
+
+// Editar Titular. A correção vale para todos os eventos ainda não aceitos
+// e os campos editados deixam de ser sobrescritos por importações.
+func (tc *TitularController) EditarTitular(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	var titular models.Titular
+	err := json.NewDecoder(r.Body).Decode(&titular)
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Pedido inválido!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	// Validar o modelo
+	validate := validator.New()
+	if err := validate.Struct(titular); err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Campos inválidos!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	existente, err := tc.repo.ListarTitularPorID(id)
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Titular não encontrado!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	// O documento identifica o titular e não pode ser alterado
+	titular.NI = existente.NI
+	if err := cadastro.AplicarDadosIndicios(existente, &titular); err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Campos inválidos!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+	alteracoes := cadastro.MesclarTitular(existente, cadastro.DeclaradoDe(&titular), eventos.OrigemManual, false)
+
+	err = tc.repo.EditarTitular(existente, alteracoes)
+	if err != nil {
+		log.Println(err)
+		RespostaComErro := common.RespostaComErro{
+			Error:   "Falha ao atualizar Titular!",
+			Message: err.Error(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(RespostaComErro)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(existente)
+}
@@ -0,0 +1,271 @@
+package eventos
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"sped-efinanceira/models"
+	"sped-efinanceira/repositories"
+)
+
+// UsuarioSistema identifica as transições feitas por rotinas automáticas
+const UsuarioSistema = "sistema"
+
+// Transições permitidas a partir de cada status. Só eventos aprovados por um
+// segundo usuário podem ser assinados. Eventos ainda não enviados voltam a
+// rascunho quando alterados ou rejeitados na aprovação; rejeitados pela
+// Receita voltam para correção. Retificados e excluídos são finais.
+var transicoes = map[string][]string{
+	models.EventoRascunho:  {models.EventoValidado},
+	models.EventoValidado:  {models.EventoAprovado, models.EventoRascunho},
+	models.EventoAprovado:  {models.EventoAssinado, models.EventoRascunho},
+	models.EventoAssinado:  {models.EventoEmLote, models.EventoRascunho},
+	models.EventoEmLote:    {models.EventoEnviado, models.EventoAssinado},
+	models.EventoEnviado:   {models.EventoAceito, models.EventoRejeitado},
+	models.EventoAceito:    {models.EventoRetificado, models.EventoExcluido},
+	models.EventoRejeitado: {models.EventoRascunho},
+}
+
+// StatusValido verifica se o status faz parte do ciclo de vida do evento
+func StatusValido(status string) bool {
+	switch status {
+	case models.EventoRetificado, models.EventoExcluido:
+		return true
+	}
+	_, ok := transicoes[status]
+	return ok
+}
+
+// TransicaoPermitida verifica se o evento pode passar diretamente de um
+// status ao outro
+func TransicaoPermitida(de, para string) bool {
+	for _, permitido := range transicoes[de] {
+		if permitido == para {
+			return true
+		}
+	}
+	return false
+}
+
+// Transicionar muda o status do evento, registrando a transição no
+// histórico. Devolve erro se a transição não for permitida.
+func Transicionar(evento *models.Evento, para, usuario, motivo string) (models.TransicaoStatus, error) {
+	if !TransicaoPermitida(evento.Status, para) {
+		return models.TransicaoStatus{}, fmt.Errorf("transição de '%s' para '%s' não permitida", evento.Status, para)
+	}
+
+	transicao := models.TransicaoStatus{
+		De:      evento.Status,
+		Para:    para,
+		Usuario: usuario,
+		Motivo:  motivo,
+		Data:    time.Now(),
+	}
+	evento.Status = para
+	evento.Historico = append(evento.Historico, transicao)
+	return transicao, nil
+}
+
+// AlterarStatus aplica uma transição e a grava no repositório
+func AlterarStatus(repo *repositories.EventoRepositorio, evento *models.Evento, para, usuario, motivo string) error {
+	anterior := *evento
+	transicao, err := Transicionar(evento, para, usuario, motivo)
+	if err != nil {
+		return err
+	}
+
+	if err := repo.AtualizarStatus(evento.ID, []models.TransicaoStatus{transicao}); err != nil {
+		*evento = anterior
+		return err
+	}
+	return nil
+}
+
+// AvancarStatus leva o evento até o status informado passando pelas etapas
+// intermediárias, todas registradas no histórico
+func AvancarStatus(repo *repositories.EventoRepositorio, evento *models.Evento, para, usuario, motivo string) error {
+	caminho, err := Caminho(evento.Status, para)
+	if err != nil {
+		return err
+	}
+
+	anterior := *evento
+	var registradas []models.TransicaoStatus
+	for _, status := range caminho {
+		transicao, err := Transicionar(evento, status, usuario, motivo)
+		if err != nil {
+			*evento = anterior
+			return err
+		}
+		registradas = append(registradas, transicao)
+	}
+
+	if err := repo.AtualizarStatus(evento.ID, registradas); err != nil {
+		*evento = anterior
+		return err
+	}
+	return nil
+}
+
+// AvancarStatusEventos leva todos os eventos, que precisam estar no mesmo
+// status, ao status informado, registrando as etapas intermediárias. Ou todos
+// mudam ou nenhum: se outra operação alterou algum deles, as transições já
+// gravadas são desfeitas. Devolve as transições, para que quem chamou possa
+// desfazê-las se o passo seguinte falhar.
+func AvancarStatusEventos(repo *repositories.EventoRepositorio, lista []*models.Evento, para, usuario, motivo string) ([]models.TransicaoStatus, error) {
+	if len(lista) == 0 {
+		return nil, nil
+	}
+
+	de := lista[0].Status
+	ids := make([]primitive.ObjectID, 0, len(lista))
+	for _, evento := range lista {
+		if evento.Status != de {
+			return nil, fmt.Errorf("evento %s em '%s', diferente dos demais em '%s'", evento.ID.Hex(), evento.Status, de)
+		}
+		ids = append(ids, evento.ID)
+	}
+
+	caminho, err := Caminho(de, para)
+	if err != nil {
+		return nil, err
+	}
+
+	// Mesma data em todas as etapas, para que possam ser desfeitas juntas
+	agora := time.Now().Truncate(time.Millisecond)
+	var transicoes []models.TransicaoStatus
+	for _, status := range caminho {
+		transicoes = append(transicoes, models.TransicaoStatus{De: de, Para: status, Usuario: usuario, Motivo: motivo, Data: agora})
+		de = status
+	}
+
+	alterados, err := repo.AtualizarStatusEventos(ids, transicoes)
+	if err == nil && alterados != int64(len(ids)) {
+		err = fmt.Errorf("%d de %d eventos foram alterados por outra operação", int64(len(ids))-alterados, len(ids))
+	}
+	if err != nil {
+		if errDesfazer := repo.DesfazerStatusEventos(ids, transicoes); errDesfazer != nil {
+			return nil, fmt.Errorf("%v; falha ao desfazer as transições: %v", err, errDesfazer)
+		}
+		return nil, err
+	}
+
+	for _, evento := range lista {
+		evento.Status = para
+		evento.Historico = append(evento.Historico, transicoes...)
+	}
+	return transicoes, nil
+}
+
+// DesfazerStatusEventos desfaz as transições de AvancarStatusEventos
+func DesfazerStatusEventos(repo *repositories.EventoRepositorio, lista []*models.Evento, transicoes []models.TransicaoStatus) error {
+	if len(lista) == 0 || len(transicoes) == 0 {
+		return nil
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(lista))
+	for _, evento := range lista {
+		ids = append(ids, evento.ID)
+	}
+	if err := repo.DesfazerStatusEventos(ids, transicoes); err != nil {
+		return err
+	}
+
+	for _, evento := range lista {
+		evento.Status = transicoes[0].De
+		evento.Historico = evento.Historico[:len(evento.Historico)-len(transicoes)]
+	}
+	return nil
+}
+
+// TransicaoManual indica se o usuário pode informar o status diretamente.
+// Validação, aprovação, aceite, rejeição, retificação e exclusão só resultam
+// das regras de negócio, da aprovação e dos retornos da Receita.
+func TransicaoManual(para string) bool {
+	switch para {
+	case models.EventoRascunho, models.EventoAssinado, models.EventoEmLote, models.EventoEnviado:
+		return true
+	}
+	return false
+}
+
+// Caminho retorna a sequência mais curta de status para levar o evento de
+// um status a outro, sem incluir o de origem. Usado quando um retorno da
+// Receita comprova etapas feitas fora do sistema (assinatura e envio).
+func Caminho(de, para string) ([]string, error) {
+	anterior := map[string]string{de: ""}
+	fila := []string{de}
+	for len(fila) > 0 {
+		atual := fila[0]
+		fila = fila[1:]
+		if atual == para {
+			break
+		}
+		for _, proximo := range transicoes[atual] {
+			if _, visitado := anterior[proximo]; !visitado {
+				anterior[proximo] = atual
+				fila = append(fila, proximo)
+			}
+		}
+	}
+
+	if _, ok := anterior[para]; !ok || de == para {
+		return nil, fmt.Errorf("não há transição de '%s' para '%s'", de, para)
+	}
+
+	var caminho []string
+	for status := para; status != de; status = anterior[status] {
+		caminho = append([]string{status}, caminho...)
+	}
+	return caminho, nil
+}
+
+// Editavel indica se os dados do evento ainda podem mudar: depois de
+// assinado, o evento guarda os dados como foram enviados
+func Editavel(status string) bool {
+	switch status {
+	case models.EventoRascunho, models.EventoValidado, models.EventoAprovado:
+		return true
+	}
+	return false
+}
+
+// HashConteudo resume o que o evento envia à Receita: os blocos de dados, a
+// retificação e o XML importado. Guardado na aprovação, mostra se o conteúdo
+// mudou depois dela, por exemplo por uma alteração no cadastro do titular.
+func HashConteudo(evento *models.Evento) string {
+	conteudo := struct {
+		Tipo             string
+		Declarante       string
+		Periodo          string
+		IndRetificacao   int
+		NrReciboAnterior string
+		XML              string
+		Abertura         *models.AberturaeFinanceira
+		Movimento        *models.MovimentoOpFin
+		Fechamento       *models.FechamentoeFinanceira
+		Exclusao         *models.ExclusaoeFinanceira
+	}{
+		evento.Tipo, evento.Declarante, evento.Periodo, evento.IndRetificacao, evento.NrReciboAnterior, evento.XML,
+		evento.Abertura, evento.Movimento, evento.Fechamento, evento.Exclusao,
+	}
+
+	dados, _ := json.Marshal(conteudo)
+	soma := sha256.Sum256(dados)
+	return hex.EncodeToString(soma[:])
+}
+
+// Enviado indica se o evento já foi aceito ou está a caminho da Receita,
+// valendo para as regras que dependem dos eventos anteriores
+func Enviado(status string) bool {
+	switch status {
+	case models.EventoAssinado, models.EventoEmLote, models.EventoEnviado, models.EventoAceito:
+		return true
+	}
+	return false
+}
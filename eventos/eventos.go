@@ -0,0 +1,116 @@
+package eventos
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tipos de evento da e-Financeira
+const (
+	TipoAbertura   = "evtAberturaeFinanceira"
+	TipoMovimento  = "evtMovOpFin"
+	TipoFechamento = "evtFechamentoeFinanceira"
+	TipoExclusao   = "evtExclusaoeFinanceira"
+)
+
+// Origens dos eventos
+const (
+	OrigemPlanilha   = "planilha"
+	OrigemAgregacao  = "agregacao"
+	OrigemXML        = "xml"
+	OrigemManual     = "manual"
+	OrigemAgenda     = "agenda"
+	OrigemSugestao   = "sugestao"
+	OrigemReabertura = "reabertura"
+)
+
+// TipoValido verifica se o tipo informado é um evento suportado
+func TipoValido(tipo string) bool {
+	switch tipo {
+	case TipoAbertura, TipoMovimento, TipoFechamento, TipoExclusao:
+		return true
+	}
+	return false
+}
+
+// OrdemEnvio define a posição do tipo de evento nos lotes: a abertura vem
+// antes dos movimentos e o fechamento por último
+func OrdemEnvio(tipo string) int {
+	switch tipo {
+	case TipoAbertura:
+		return 0
+	case TipoExclusao:
+		return 1
+	case TipoMovimento:
+		return 2
+	}
+	return 3
+}
+
+// ParsePeriodo interpreta um período semestral no formato AAAA-S (ex.: 2024-1)
+func ParsePeriodo(periodo string) (ano int, semestre int, err error) {
+	partes := strings.Split(periodo, "-")
+	if len(partes) != 2 {
+		return 0, 0, fmt.Errorf("período '%s' inválido, use o formato AAAA-S", periodo)
+	}
+
+	ano, err = strconv.Atoi(partes[0])
+	if err != nil || ano < 2000 {
+		return 0, 0, fmt.Errorf("ano do período '%s' inválido", periodo)
+	}
+
+	semestre, err = strconv.Atoi(partes[1])
+	if err != nil || (semestre != 1 && semestre != 2) {
+		return 0, 0, fmt.Errorf("semestre do período '%s' inválido", periodo)
+	}
+
+	return ano, semestre, nil
+}
+
+// LimitesPeriodo retorna o primeiro e o último dia do semestre
+func LimitesPeriodo(periodo string) (time.Time, time.Time, error) {
+	ano, semestre, err := ParsePeriodo(periodo)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	mesInicio := time.January
+	if semestre == 2 {
+		mesInicio = time.July
+	}
+
+	inicio := time.Date(ano, mesInicio, 1, 0, 0, 0, 0, time.UTC)
+	fim := inicio.AddDate(0, 6, -1)
+	return inicio, fim, nil
+}
+
+// PeriodoDe retorna o período semestral que contém a data
+func PeriodoDe(data time.Time) string {
+	semestre := 1
+	if data.Month() > time.June {
+		semestre = 2
+	}
+	return fmt.Sprintf("%d-%d", data.Year(), semestre)
+}
+
+// PeriodoAnterior retorna o semestre imediatamente anterior
+func PeriodoAnterior(periodo string) (string, error) {
+	ano, semestre, err := ParsePeriodo(periodo)
+	if err != nil {
+		return "", err
+	}
+
+	if semestre == 2 {
+		return fmt.Sprintf("%d-1", ano), nil
+	}
+	return fmt.Sprintf("%d-2", ano-1), nil
+}
+
+// IDEvento monta o identificador do evento no padrão da Receita: "ID", tipo
+// de inscrição (1 = CNPJ), CNPJ do declarante, data e hora da geração
+// (AAAAMMDDHHMMSS) e sequencial de cinco dígitos
+func IDEvento(declarante string, data time.Time, sequencial int) string {
+	return fmt.Sprintf("ID1%s%s%05d", declarante, data.Format("20060102150405"), sequencial)
+}
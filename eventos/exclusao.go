@@ -0,0 +1,77 @@
+package eventos
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"sped-efinanceira/models"
+)
+
+// SugestaoExclusao aponta um movimento aceito cujo declarado não aparece
+// mais nos movimentos gerados para o período. Sem exclusão, o registro
+// continua valendo na Receita.
+type SugestaoExclusao struct {
+	EventoID primitive.ObjectID `json:"evento_id"`
+	IDEvento string             `json:"id_evento,omitempty"`
+	Recibo   string             `json:"recibo"`
+	TpNI     string             `json:"tp_ni"`
+	NI       string             `json:"ni"`
+	Nome     string             `json:"nome,omitempty"`
+	Contas   []string           `json:"contas"`
+}
+
+// SugerirExclusoes compara os movimentos aceitos do período com os gerados
+// (ainda editáveis). O movimento é um evento por declarado e a retificadora
+// substitui o evento inteiro, então contas retiradas de um declarado que
+// continua no período saem pela retificação; só o declarado que sumiu
+// precisa de evtExclusaoeFinanceira. Recibos que já têm exclusão pendente ou
+// enviada ficam de fora.
+func SugerirExclusoes(existentes []*models.Evento) []SugestaoExclusao {
+	gerados := make(map[string]bool)
+	excluidos := make(map[string]bool)
+	for _, evento := range existentes {
+		switch {
+		case evento.Movimento != nil && Editavel(evento.Status):
+			gerados[evento.Movimento.Declarado.NI] = true
+		case evento.Exclusao != nil && (Editavel(evento.Status) || Enviado(evento.Status)):
+			excluidos[evento.Exclusao.NrReciboEvento] = true
+		}
+	}
+
+	var sugestoes []SugestaoExclusao
+	for _, evento := range existentes {
+		if evento.Movimento == nil || evento.Status != models.EventoAceito || evento.Recibo == "" {
+			continue
+		}
+		declarado := evento.Movimento.Declarado
+		if gerados[declarado.NI] || excluidos[evento.Recibo] {
+			continue
+		}
+
+		sugestao := SugestaoExclusao{
+			EventoID: evento.ID,
+			IDEvento: evento.IDEvento,
+			Recibo:   evento.Recibo,
+			TpNI:     declarado.TpNI,
+			NI:       declarado.NI,
+			Nome:     declarado.Nome,
+		}
+		for _, conta := range evento.Movimento.Contas {
+			sugestao.Contas = append(sugestao.Contas, conta.NumConta)
+		}
+		sugestoes = append(sugestoes, sugestao)
+	}
+
+	return sugestoes
+}
+
+// NovaExclusao monta o evtExclusaoeFinanceira em rascunho para o recibo
+func NovaExclusao(declarante, periodo, recibo string) *models.Evento {
+	return &models.Evento{
+		Tipo:       TipoExclusao,
+		Declarante: declarante,
+		Periodo:    periodo,
+		Status:     models.EventoRascunho,
+		Origem:     OrigemSugestao,
+		Exclusao:   &models.ExclusaoeFinanceira{NrReciboEvento: recibo},
+	}
+}
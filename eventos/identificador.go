@@ -0,0 +1,67 @@
+package eventos
+
+import (
+	"time"
+
+	"sped-efinanceira/models"
+)
+
+// Maior sequencial do identificador, que tem cinco dígitos
+const maximoSequencial = 99999
+
+// Sequenciador reserva blocos de um contador e devolve o primeiro número;
+// em produção é o repositories.SequenciaRepositorio
+type Sequenciador interface {
+	Reservar(chave string, quantidade int) (int, error)
+}
+
+// AtribuirIDs dá aos eventos sem identificador um ID no padrão da Receita.
+// O sequencial vem de um contador por declarante e segundo, reservado em
+// bloco no Mongo, então geradores e importações rodando ao mesmo tempo não
+// repetem identificadores. Esgotado o segundo, espera o próximo.
+func AtribuirIDs(repo Sequenciador, lista ...*models.Evento) error {
+	pendentes := make(map[string][]*models.Evento)
+	var declarantes []string
+	for _, evento := range lista {
+		if evento.IDEvento != "" {
+			continue
+		}
+		if _, ok := pendentes[evento.Declarante]; !ok {
+			declarantes = append(declarantes, evento.Declarante)
+		}
+		pendentes[evento.Declarante] = append(pendentes[evento.Declarante], evento)
+	}
+
+	for _, declarante := range declarantes {
+		restantes := pendentes[declarante]
+		for len(restantes) > 0 {
+			bloco := len(restantes)
+			if bloco > maximoSequencial {
+				bloco = maximoSequencial
+			}
+
+			agora := time.Now()
+			primeiro, err := repo.Reservar(declarante+"_"+agora.Format("20060102150405"), bloco)
+			if err != nil {
+				return err
+			}
+
+			// Só usa o que coube no segundo; o resto vai para o próximo
+			disponiveis := maximoSequencial - primeiro + 1
+			if disponiveis <= 0 {
+				time.Sleep(agora.Truncate(time.Second).Add(time.Second).Sub(time.Now()))
+				continue
+			}
+			if disponiveis < bloco {
+				bloco = disponiveis
+			}
+
+			for i, evento := range restantes[:bloco] {
+				evento.IDEvento = IDEvento(declarante, agora, primeiro+i)
+			}
+			restantes = restantes[bloco:]
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,221 @@
+package eventos
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"sped-efinanceira/models"
+	"sped-efinanceira/repositories"
+)
+
+// Contador em memória com o mesmo contrato do SequenciaRepositorio
+type sequenciadorMemoria struct {
+	mu        sync.Mutex
+	contagens map[string]int
+}
+
+func (s *sequenciadorMemoria) Reservar(chave string, quantidade int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.contagens[chave] += quantidade
+	return s.contagens[chave] - quantidade + 1, nil
+}
+
+func novosEventos(declarante string, quantidade int) []*models.Evento {
+	lista := make([]*models.Evento, quantidade)
+	for i := range lista {
+		lista[i] = &models.Evento{Declarante: declarante}
+	}
+	return lista
+}
+
+// Confere que os IDs são únicos e que, em cada segundo, os sequenciais vão
+// de 1 a n sem buracos
+func conferirIDs(t *testing.T, declarante string, lista []*models.Evento) map[string][]int {
+	t.Helper()
+
+	prefixo := "ID1" + declarante
+	vistos := make(map[string]bool)
+	porSegundo := make(map[string][]int)
+	for _, evento := range lista {
+		id := evento.IDEvento
+		if len(id) != len(prefixo)+14+5 || id[:len(prefixo)] != prefixo {
+			t.Fatalf("identificador fora do padrão: %q", id)
+		}
+		if vistos[id] {
+			t.Fatalf("identificador repetido: %s", id)
+		}
+		vistos[id] = true
+
+		segundo := id[len(prefixo) : len(prefixo)+14]
+		sequencial, err := strconv.Atoi(id[len(prefixo)+14:])
+		if err != nil {
+			t.Fatalf("sequencial inválido em %s: %v", id, err)
+		}
+		porSegundo[segundo] = append(porSegundo[segundo], sequencial)
+	}
+
+	for segundo, sequenciais := range porSegundo {
+		sort.Ints(sequenciais)
+		for i, sequencial := range sequenciais {
+			if sequencial != i+1 {
+				t.Fatalf("segundo %s: esperava o sequencial %d, veio %d", segundo, i+1, sequencial)
+			}
+		}
+		if sequenciais[len(sequenciais)-1] > maximoSequencial {
+			t.Fatalf("segundo %s passou do máximo: %d", segundo, sequenciais[len(sequenciais)-1])
+		}
+	}
+
+	return porSegundo
+}
+
+func TestAtribuirIDsConcorrente(t *testing.T) {
+	const declarante = "12345678000195"
+	const rotinas = 50
+	const porRotina = 200
+
+	repo := &sequenciadorMemoria{contagens: make(map[string]int)}
+	lotes := make([][]*models.Evento, rotinas)
+	erros := make(chan error, rotinas)
+
+	var wg sync.WaitGroup
+	for i := range lotes {
+		lotes[i] = novosEventos(declarante, porRotina)
+		wg.Add(1)
+		go func(lista []*models.Evento) {
+			defer wg.Done()
+			erros <- AtribuirIDs(repo, lista...)
+		}(lotes[i])
+	}
+	wg.Wait()
+	close(erros)
+
+	for err := range erros {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var todos []*models.Evento
+	for _, lista := range lotes {
+		todos = append(todos, lista...)
+	}
+	conferirIDs(t, declarante, todos)
+}
+
+// Contra o contador do Mongo (FindOneAndUpdate com upsert): todas as rotinas
+// começam no mesmo segundo e disputam a criação do contador. Só roda com
+// MONGO_TEST_URL definido; usa um banco temporário, apagado no fim.
+func TestAtribuirIDsConcorrenteMongo(t *testing.T) {
+	url := os.Getenv("MONGO_TEST_URL")
+	if url == "" {
+		t.Skip("MONGO_TEST_URL não definido")
+	}
+
+	banco := "sped_efinanceira_teste_" + primitive.NewObjectID().Hex()
+	repo, err := repositories.NovoSequenciaRepositorio(url, banco)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		client, err := mongo.Connect(context.Background(), options.Client().ApplyURI(url))
+		if err != nil {
+			t.Log("Erro ao apagar o banco de teste:", err)
+			return
+		}
+		defer client.Disconnect(context.Background())
+		client.Database(banco).Drop(context.Background())
+	}()
+
+	const declarante = "12345678000195"
+	const rotinas = 32
+	const porRotina = 50
+
+	lotes := make([][]*models.Evento, rotinas)
+	erros := make(chan error, rotinas)
+	largada := make(chan struct{})
+
+	var wg sync.WaitGroup
+	for i := range lotes {
+		lotes[i] = novosEventos(declarante, porRotina)
+		wg.Add(1)
+		go func(lista []*models.Evento) {
+			defer wg.Done()
+			<-largada
+			for _, evento := range lista {
+				if err := AtribuirIDs(repo, evento); err != nil {
+					erros <- err
+					return
+				}
+			}
+		}(lotes[i])
+	}
+	close(largada)
+	wg.Wait()
+	close(erros)
+
+	for err := range erros {
+		t.Fatal(err)
+	}
+
+	var todos []*models.Evento
+	for _, lista := range lotes {
+		todos = append(todos, lista...)
+	}
+	conferirIDs(t, declarante, todos)
+}
+
+func TestAtribuirIDsMantemExistentes(t *testing.T) {
+	repo := &sequenciadorMemoria{contagens: make(map[string]int)}
+	existente := &models.Evento{Declarante: "12345678000195", IDEvento: "ID1123456780001952024010100000000001"}
+	novo := &models.Evento{Declarante: "12345678000195"}
+
+	if err := AtribuirIDs(repo, existente, novo); err != nil {
+		t.Fatal(err)
+	}
+	if existente.IDEvento != "ID1123456780001952024010100000000001" {
+		t.Fatalf("identificador existente alterado: %s", existente.IDEvento)
+	}
+	if novo.IDEvento == "" {
+		t.Fatal("evento sem identificador não recebeu um")
+	}
+}
+
+func TestAtribuirIDsEsgotaSegundo(t *testing.T) {
+	if testing.Short() {
+		t.Skip("espera a virada do segundo")
+	}
+
+	const declarante = "12345678000195"
+	repo := &sequenciadorMemoria{contagens: make(map[string]int)}
+	lista := novosEventos(declarante, maximoSequencial+5)
+
+	if err := AtribuirIDs(repo, lista...); err != nil {
+		t.Fatal(err)
+	}
+
+	porSegundo := conferirIDs(t, declarante, lista)
+	if len(porSegundo) < 2 {
+		t.Fatalf("%d eventos couberam em um segundo: %v", len(lista), resumo(porSegundo))
+	}
+}
+
+func resumo(porSegundo map[string][]int) string {
+	var partes []string
+	for segundo, sequenciais := range porSegundo {
+		partes = append(partes, fmt.Sprintf("%s=%d", segundo, len(sequenciais)))
+	}
+	sort.Strings(partes)
+	return fmt.Sprint(partes)
+}
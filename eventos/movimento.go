@@ -0,0 +1,245 @@
+package eventos
+
+import (
+	"sort"
+	"time"
+
+	"sped-efinanceira/agregacao"
+	"sped-efinanceira/models"
+)
+
+// GerarMovimentos monta um evtMovOpFin em rascunho por declarado a partir
+// das contas agregadas. O evento leva apenas o documento do declarado; os
+// dados cadastrais vêm do cadastro de titulares.
+//
+// Contas presentes em cadastradas (indexado pelo número da conta) trazem o
+// tipo, as datas de abertura e encerramento e os participantes: a conta é
+// declarada no evento de cada titular, cotitular e procurador. Sem cadastro,
+// o único titular é o documento das transações.
+func GerarMovimentos(declarante, periodo string, contas []agregacao.ContaAgregada, cadastradas map[string]*models.Conta) []*models.Evento {
+	inicio, fim, _ := LimitesPeriodo(periodo)
+
+	var resultado []*models.Evento
+	porDocumento := make(map[string]*models.Evento)
+
+	for _, conta := range contas {
+		movimento := models.ContaMovimento{
+			NumConta: conta.NumConta,
+			Moeda:    conta.Moeda,
+			Meses:    conta.Meses,
+		}
+		participantes := []models.TitularConta{{NI: conta.Documento, Papel: models.PapelTitular}}
+
+		if cadastrada, ok := cadastradas[conta.NumConta]; ok {
+			movimento.TpConta = cadastrada.TpConta
+			dtAbertura := cadastrada.DtAbertura
+			MarcarCicloDeVida(&movimento, &dtAbertura, cadastrada.DtEncerramento, inicio, fim)
+			if len(cadastrada.Titulares) > 0 {
+				participantes = cadastrada.Titulares
+			}
+		}
+
+		noTitulares := 0
+		for _, participante := range participantes {
+			if participante.Papel != models.PapelProcurador {
+				noTitulares++
+			}
+		}
+
+		for _, participante := range participantes {
+			evento, ok := porDocumento[participante.NI]
+			if !ok {
+				evento = &models.Evento{
+					Tipo:       TipoMovimento,
+					Declarante: declarante,
+					Periodo:    periodo,
+					Status:     models.EventoRascunho,
+					Origem:     OrigemAgregacao,
+					Movimento: &models.MovimentoOpFin{
+						Declarado: models.Declarado{
+							TpNI: TipoNI(participante.NI),
+							NI:   participante.NI,
+						},
+					},
+				}
+				porDocumento[participante.NI] = evento
+				resultado = append(resultado, evento)
+			}
+
+			contaDoDeclarado := movimento
+			contaDoDeclarado.TpRelacaoDeclarado = TipoRelacao(participante.Papel)
+			contaDoDeclarado.NoTitulares = noTitulares
+			evento.Movimento.Contas = append(evento.Movimento.Contas, contaDoDeclarado)
+		}
+	}
+
+	return resultado
+}
+
+// MarcarCicloDeVida informa na conta as datas de abertura e encerramento que
+// caem dentro do semestre, as únicas declaradas. Na conta encerrada, o mês
+// do encerramento passa a ser o último: os meses seguintes sem movimento
+// (apenas com saldo) são descartados.
+func MarcarCicloDeVida(conta *models.ContaMovimento, dtAbertura, dtEncerramento *time.Time, inicio, fim time.Time) {
+	conta.DtAbertura, conta.DtEncerramento = nil, nil
+	conta.AbertaNoPeriodo, conta.EncerradaNoPeriodo = false, false
+
+	dentro := func(data *time.Time) bool {
+		return data != nil && !data.IsZero() && !data.Before(inicio) && !data.After(fim)
+	}
+
+	if dentro(dtAbertura) {
+		data := *dtAbertura
+		conta.DtAbertura = &data
+		conta.AbertaNoPeriodo = true
+	}
+
+	if dentro(dtEncerramento) {
+		data := *dtEncerramento
+		conta.DtEncerramento = &data
+		conta.EncerradaNoPeriodo = true
+
+		mesEncerramento := data.Format("200601")
+		var meses []models.MesCaixa
+		for _, mes := range conta.Meses {
+			if mes.AnoMes <= mesEncerramento || mes.TotCreditos != 0 || mes.TotDebitos != 0 {
+				meses = append(meses, mes)
+			}
+		}
+
+		temMesEncerramento := false
+		saldo := 0.0
+		for _, mes := range meses {
+			if mes.AnoMes == mesEncerramento {
+				temMesEncerramento = true
+			}
+			if mes.AnoMes < mesEncerramento {
+				saldo = mes.VlrUltDia
+			}
+		}
+		if !temMesEncerramento {
+			meses = append(meses, models.MesCaixa{AnoMes: mesEncerramento, VlrUltDia: saldo})
+			sort.Slice(meses, func(i, j int) bool { return meses[i].AnoMes < meses[j].AnoMes })
+		}
+		conta.Meses = meses
+	}
+}
+
+// TipoRelacao converte o papel do participante no tpRelacaoDeclarado:
+// 1 = titular, 2 = procurador
+func TipoRelacao(papel string) string {
+	if papel == models.PapelProcurador {
+		return "2"
+	}
+	return "1"
+}
+
+// TipoNI indica o tipo do documento do declarado: 1 = CPF, 2 = CNPJ
+func TipoNI(documento string) string {
+	if len(documento) == 14 {
+		return "2"
+	}
+	return "1"
+}
+
+// MovimentosVigentes filtra os movimentos que valem para cada declarado: a
+// retificadora pendente mais recente, quando houver, ou o evento aceito.
+// Eventos rejeitados, retificados ou excluídos e rascunhos que não retificam
+// um aceito ficam de fora.
+func MovimentosVigentes(lista []*models.Evento) []*models.Evento {
+	aceitos := make(map[string]*models.Evento)
+	pendentes := make(map[string]*models.Evento)
+	var documentos []string
+
+	for _, evento := range lista {
+		if evento.Movimento == nil {
+			continue
+		}
+
+		var escolhidos map[string]*models.Evento
+		switch {
+		case evento.Status == models.EventoAceito:
+			escolhidos = aceitos
+		case evento.IndRetificacao == 2 && (Editavel(evento.Status) || Enviado(evento.Status)):
+			escolhidos = pendentes
+		default:
+			continue
+		}
+
+		ni := evento.Movimento.Declarado.NI
+		if aceitos[ni] == nil && pendentes[ni] == nil {
+			documentos = append(documentos, ni)
+		}
+		if atual := escolhidos[ni]; atual == nil || evento.CreatedAt.After(atual.CreatedAt) {
+			escolhidos[ni] = evento
+		}
+	}
+
+	vigentes := make([]*models.Evento, 0, len(documentos))
+	for _, ni := range documentos {
+		if pendente, ok := pendentes[ni]; ok {
+			vigentes = append(vigentes, pendente)
+		} else {
+			vigentes = append(vigentes, aceitos[ni])
+		}
+	}
+	return vigentes
+}
+
+// AplicarSaldosAnteriores usa o saldo do último mês de cada conta dos
+// movimentos do semestre anterior como saldo inicial do agregador. Contas
+// conjuntas aparecem no evento de cada participante, mas o saldo é aplicado
+// uma única vez, no documento do titular principal. Só os movimentos
+// vigentes do semestre anterior são considerados (MovimentosVigentes).
+func AplicarSaldosAnteriores(agregador *agregacao.Agregador, anteriores []*models.Evento, cadastradas map[string]*models.Conta) {
+	aplicadas := make(map[string]bool)
+
+	for _, evento := range MovimentosVigentes(anteriores) {
+		if evento.Movimento == nil {
+			continue
+		}
+
+		for _, conta := range evento.Movimento.Contas {
+			chave := conta.NumConta + "|" + conta.Moeda
+			if aplicadas[chave] {
+				continue
+			}
+
+			var ultimo *models.MesCaixa
+			for i := range conta.Meses {
+				if ultimo == nil || conta.Meses[i].AnoMes > ultimo.AnoMes {
+					ultimo = &conta.Meses[i]
+				}
+			}
+			if ultimo == nil || conta.EncerradaNoPeriodo {
+				continue
+			}
+
+			documento := evento.Movimento.Declarado.NI
+			if cadastrada, ok := cadastradas[conta.NumConta]; ok {
+				documento = TitularPrincipal(cadastrada, documento)
+			} else if conta.TpRelacaoDeclarado == TipoRelacao(models.PapelProcurador) {
+				continue
+			}
+
+			// Em moeda estrangeira o saldo continua na moeda da conta
+			saldo := ultimo.VlrUltDia
+			if ultimo.Cotacao != nil {
+				saldo = ultimo.Cotacao.VlrUltDiaOriginal
+			}
+
+			agregador.DefinirSaldoInicial(documento, conta.NumConta, conta.Moeda, saldo)
+			aplicadas[chave] = true
+		}
+	}
+}
+
+// TitularPrincipal retorna o documento do participante com papel de titular
+func TitularPrincipal(conta *models.Conta, padrao string) string {
+	for _, participante := range conta.Titulares {
+		if participante.Papel == models.PapelTitular {
+			return participante.NI
+		}
+	}
+	return padrao
+}
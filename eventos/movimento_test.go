@@ -0,0 +1,55 @@
+package eventos
+
+import (
+	"testing"
+	"time"
+
+	"sped-efinanceira/models"
+)
+
+func movimentoDe(ni, status string, retificacao int, criado time.Time) *models.Evento {
+	return &models.Evento{
+		Tipo:           TipoMovimento,
+		Status:         status,
+		IndRetificacao: retificacao,
+		CreatedAt:      criado,
+		Movimento:      &models.MovimentoOpFin{Declarado: models.Declarado{NI: ni}},
+	}
+}
+
+func TestMovimentosVigentes(t *testing.T) {
+	inicio := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+	aceito := movimentoDe("11111111111", models.EventoAceito, 0, inicio)
+	retificado := movimentoDe("22222222222", models.EventoRetificado, 0, inicio)
+	retificadora := movimentoDe("22222222222", models.EventoAceito, 2, inicio.Add(time.Hour))
+	aceitoComPendente := movimentoDe("33333333333", models.EventoAceito, 0, inicio)
+	pendenteAntiga := movimentoDe("33333333333", models.EventoValidado, 2, inicio.Add(time.Hour))
+	pendenteNova := movimentoDe("33333333333", models.EventoRascunho, 2, inicio.Add(2*time.Hour))
+
+	casos := []struct {
+		nome     string
+		lista    []*models.Evento
+		esperado []*models.Evento
+	}{
+		{"aceito", []*models.Evento{aceito}, []*models.Evento{aceito}},
+		{"retificado dá lugar à retificadora aceita", []*models.Evento{retificado, retificadora}, []*models.Evento{retificadora}},
+		{"retificadora pendente mais recente", []*models.Evento{aceitoComPendente, pendenteAntiga, pendenteNova}, []*models.Evento{pendenteNova}},
+		{"rejeitado", []*models.Evento{movimentoDe("44444444444", models.EventoRejeitado, 0, inicio)}, nil},
+		{"excluído", []*models.Evento{movimentoDe("44444444444", models.EventoExcluido, 0, inicio)}, nil},
+		{"rascunho sem retificação", []*models.Evento{movimentoDe("44444444444", models.EventoRascunho, 0, inicio)}, nil},
+	}
+
+	for _, caso := range casos {
+		t.Run(caso.nome, func(t *testing.T) {
+			vigentes := MovimentosVigentes(caso.lista)
+			if len(vigentes) != len(caso.esperado) {
+				t.Fatalf("esperava %d eventos, vieram %d", len(caso.esperado), len(vigentes))
+			}
+			for i := range vigentes {
+				if vigentes[i] != caso.esperado[i] {
+					t.Fatalf("evento %d: esperava %+v, veio %+v", i, caso.esperado[i], vigentes[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package eventos
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"sped-efinanceira/models"
+	"sped-efinanceira/repositories"
+)
+
+// ErroPeriodoFechado indica tentativa de alterar eventos de um período cujo
+// fechamento já foi aceito
+type ErroPeriodoFechado struct {
+	Declarante string
+	Periodo    string
+}
+
+func (e *ErroPeriodoFechado) Error() string {
+	return fmt.Sprintf("o período %s do declarante %s está fechado; reabra-o para alterar os eventos", e.Periodo, e.Declarante)
+}
+
+// VerificarPeriodoAberto devolve ErroPeriodoFechado se o período estiver
+// fechado. Períodos sem registro ou reabertos aceitam alterações.
+func VerificarPeriodoAberto(repo *repositories.PeriodoRepositorio, declarante, periodo string) error {
+	registro, err := repo.BuscarPeriodo(declarante, periodo)
+	if err != nil {
+		return err
+	}
+	if registro != nil && registro.Situacao == models.PeriodoFechado {
+		return &ErroPeriodoFechado{Declarante: declarante, Periodo: periodo}
+	}
+	return nil
+}
+
+// FecharPeriodo fecha o período de um evtFechamentoeFinanceira aceito
+func FecharPeriodo(repo *repositories.PeriodoRepositorio, fechamento *models.Evento, usuario string) error {
+	if fechamento.Tipo != TipoFechamento || fechamento.Status != models.EventoAceito || fechamento.Periodo == "" {
+		return nil
+	}
+
+	_, err := repo.FecharPeriodo(fechamento.Declarante, fechamento.Periodo, fechamento.Recibo, models.SituacaoPeriodo{
+		Situacao: models.PeriodoFechado,
+		Usuario:  usuario,
+		Motivo:   fmt.Sprintf("Fechamento aceito (recibo %s)", fechamento.Recibo),
+		Data:     time.Now(),
+	})
+	return err
+}
+
+// ReabrirPeriodo registra a reabertura de um período fechado. A partir
+// dela, os eventos gerados para o período retificam os já aceitos; as
+// retificadoras iniciais são criadas por semestre.IniciarRetificacao.
+func ReabrirPeriodo(repo *repositories.PeriodoRepositorio, declarante, periodo, usuario, motivo string) error {
+	return repo.ReabrirPeriodo(declarante, periodo, models.SituacaoPeriodo{
+		Situacao: models.PeriodoReaberto,
+		Usuario:  usuario,
+		Motivo:   motivo,
+		Data:     time.Now(),
+	})
+}
+
+// NovaRetificacao cria, em rascunho, a retificadora de um evento aceito com
+// os mesmos dados, para ser corrigida e enviada no lugar dele
+func NovaRetificacao(aceito *models.Evento, usuario string) *models.Evento {
+	retificadora := &models.Evento{
+		Tipo:             aceito.Tipo,
+		Declarante:       aceito.Declarante,
+		Periodo:          aceito.Periodo,
+		Status:           models.EventoRascunho,
+		Origem:           OrigemReabertura,
+		CriadoPor:        usuario,
+		IndRetificacao:   2,
+		NrReciboAnterior: aceito.Recibo,
+	}
+	if aceito.Movimento != nil {
+		movimento := *aceito.Movimento
+		retificadora.Movimento = &movimento
+	}
+	if aceito.Fechamento != nil {
+		fechamento := *aceito.Fechamento
+		retificadora.Fechamento = &fechamento
+	}
+	return retificadora
+}
+
+// MarcarRetificacoes transforma em retificadoras os eventos gerados que
+// substituem um evento aceito: o movimento do mesmo declarado ou a abertura
+// e o fechamento do período
+func MarcarRetificacoes(gerados, aceitos []*models.Evento) {
+	for _, evento := range gerados {
+		if evento.IndRetificacao == 2 || evento.Tipo == TipoExclusao {
+			continue
+		}
+		for _, aceito := range aceitos {
+			if aceito.Status != models.EventoAceito || aceito.Tipo != evento.Tipo || aceito.Recibo == "" {
+				continue
+			}
+			if evento.Movimento != nil && (aceito.Movimento == nil || aceito.Movimento.Declarado.NI != evento.Movimento.Declarado.NI) {
+				continue
+			}
+			evento.IndRetificacao = 2
+			evento.NrReciboAnterior = aceito.Recibo
+			break
+		}
+	}
+}
+
+// TotaisFechamento conta, para cada mês de caixa, os declarados com
+// movimento no mês, que é o total de eventos de movimento do mês informado
+// no fechamento. Um declarado conta uma vez mesmo com o evento aceito e a
+// retificadora na lista.
+func TotaisFechamento(movimentos []*models.Evento) []models.FechamentoMes {
+	declarados := make(map[string]map[string]bool)
+	for _, evento := range movimentos {
+		if evento.Movimento == nil {
+			continue
+		}
+		for _, conta := range evento.Movimento.Contas {
+			for _, mes := range conta.Meses {
+				if declarados[mes.AnoMes] == nil {
+					declarados[mes.AnoMes] = make(map[string]bool)
+				}
+				declarados[mes.AnoMes][evento.Movimento.Declarado.NI] = true
+			}
+		}
+	}
+
+	totais := make([]models.FechamentoMes, 0, len(declarados))
+	for anoMes, nis := range declarados {
+		totais = append(totais, models.FechamentoMes{AnoMesCaixa: anoMes, QuantArqTrans: len(nis)})
+	}
+	sort.Slice(totais, func(i, j int) bool { return totais[i].AnoMesCaixa < totais[j].AnoMesCaixa })
+	return totais
+}
@@ -0,0 +1,329 @@
+package importacao
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"sped-efinanceira/eventos"
+	"sped-efinanceira/middlewares"
+	"sped-efinanceira/models"
+	"sped-efinanceira/repositories"
+	"sped-efinanceira/validacao"
+)
+
+const (
+	// Arquivo vazio <nome>.ok criado pelo sistema de origem ao terminar a gravação
+	sufixoSentinela = ".ok"
+
+	intervaloPastaPadrao = time.Minute
+)
+
+// Arquivos de transações: transacoes_<CNPJ>_<AAAA-S>.csv
+var padraoTransacoes = regexp.MustCompile(`(?i)^transacoes_(\d{14})_(\d{4}-[12])\.(csv|txt)$`)
+
+// Extensões usadas durante a gravação; o arquivo só é considerado completo
+// depois de renomeado para o nome final
+var extensoesTemporarias = map[string]bool{
+	".tmp":      true,
+	".part":     true,
+	".partial":  true,
+	".filepart": true,
+}
+
+// MonitorPasta processa os arquivos deixados em uma pasta compartilhada
+// pelos sistemas de origem, arquivando-os em processados ou erros
+type MonitorPasta struct {
+	entrada         string
+	processados     string
+	erros           string
+	intervalo       time.Duration
+	exigirSentinela bool
+	destinatarios   []string
+
+	eventoRepo     *repositories.EventoRepositorio
+	importacaoRepo *repositories.ImportacaoRepositorio
+	titularRepo    *repositories.TitularRepositorio
+	periodoRepo    *repositories.PeriodoRepositorio
+	processador    *ProcessadorTransacoes
+}
+
+type resultadoArquivo struct {
+	nome   string
+	resumo string
+	err    error
+}
+
+// NovoMonitorPasta configura o monitor a partir das variáveis PASTA_*
+func NovoMonitorPasta(eventoRepo *repositories.EventoRepositorio, importacaoRepo *repositories.ImportacaoRepositorio, titularRepo *repositories.TitularRepositorio, periodoRepo *repositories.PeriodoRepositorio, processador *ProcessadorTransacoes) (*MonitorPasta, error) {
+	entrada := os.Getenv("PASTA_ENTRADA")
+	if entrada == "" {
+		return nil, fmt.Errorf("a variável PASTA_ENTRADA deve ser definida")
+	}
+
+	monitor := &MonitorPasta{
+		entrada:         entrada,
+		processados:     valorOuPadrao(os.Getenv("PASTA_PROCESSADOS"), filepath.Join(entrada, "processados")),
+		erros:           valorOuPadrao(os.Getenv("PASTA_ERROS"), filepath.Join(entrada, "erros")),
+		intervalo:       intervaloPastaPadrao,
+		exigirSentinela: os.Getenv("PASTA_EXIGIR_SENTINELA") == "true",
+		eventoRepo:      eventoRepo,
+		importacaoRepo:  importacaoRepo,
+		titularRepo:     titularRepo,
+		periodoRepo:     periodoRepo,
+		processador:     processador,
+	}
+
+	if valor := os.Getenv("PASTA_INTERVALO"); valor != "" {
+		segundos, err := strconv.Atoi(valor)
+		if err != nil || segundos <= 0 {
+			return nil, fmt.Errorf("PASTA_INTERVALO inválido: '%s'", valor)
+		}
+		monitor.intervalo = time.Duration(segundos) * time.Second
+	}
+
+	for _, email := range strings.Split(os.Getenv("PASTA_EMAIL"), ",") {
+		if email = strings.TrimSpace(email); email != "" {
+			monitor.destinatarios = append(monitor.destinatarios, email)
+		}
+	}
+
+	for _, diretorio := range []string{monitor.entrada, monitor.processados, monitor.erros, DiretorioImportacoes()} {
+		if err := os.MkdirAll(diretorio, os.ModePerm); err != nil {
+			return nil, err
+		}
+	}
+
+	return monitor, nil
+}
+
+// Iniciar verifica a pasta a cada intervalo; deve rodar em uma goroutine
+func (m *MonitorPasta) Iniciar() {
+	log.Printf("📂 Monitorando a pasta %s a cada %s", m.entrada, m.intervalo)
+
+	ticker := time.NewTicker(m.intervalo)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		m.Verificar()
+	}
+}
+
+// Verificar importa os arquivos completos da pasta, um de cada vez, e envia
+// o resumo por e-mail
+func (m *MonitorPasta) Verificar() {
+	nomes, err := m.arquivosProntos()
+	if err != nil {
+		log.Println("Erro ao listar a pasta de entrada:", err)
+		return
+	}
+
+	var resultados []resultadoArquivo
+	for _, nome := range nomes {
+		resultado := m.processarArquivo(nome)
+		if resultado.err != nil {
+			log.Printf("Arquivo %s da pasta de entrada com erro: %v", nome, resultado.err)
+		} else {
+			log.Printf("Arquivo %s da pasta de entrada importado: %s", nome, resultado.resumo)
+		}
+		resultados = append(resultados, resultado)
+	}
+
+	if len(resultados) > 0 {
+		m.enviarResumo(resultados)
+	}
+}
+
+// Arquivos completos: renomeados para o nome final ou, quando exigido,
+// acompanhados do arquivo sentinela
+func (m *MonitorPasta) arquivosProntos() ([]string, error) {
+	entradas, err := os.ReadDir(m.entrada)
+	if err != nil {
+		return nil, err
+	}
+
+	existentes := make(map[string]bool)
+	for _, entrada := range entradas {
+		existentes[entrada.Name()] = true
+	}
+
+	var prontos []string
+	for _, entrada := range entradas {
+		nome := entrada.Name()
+		extensao := strings.ToLower(filepath.Ext(nome))
+
+		if entrada.IsDir() || strings.HasPrefix(nome, ".") || extensao == sufixoSentinela || extensoesTemporarias[extensao] {
+			continue
+		}
+		if m.exigirSentinela && !existentes[nome+sufixoSentinela] {
+			continue
+		}
+		prontos = append(prontos, nome)
+	}
+
+	return prontos, nil
+}
+
+// O arquivo sai da pasta de entrada antes de ser importado, para não ser
+// lido de novo caso o servidor reinicie no meio do processamento
+func (m *MonitorPasta) processarArquivo(nome string) resultadoArquivo {
+	resultado := resultadoArquivo{nome: nome}
+	origem := filepath.Join(m.entrada, nome)
+
+	caminho := filepath.Join(DiretorioImportacoes(), primitive.NewObjectID().Hex()+filepath.Ext(nome))
+	if err := moverArquivo(origem, caminho); err != nil {
+		resultado.err = err
+		return resultado
+	}
+	os.Remove(origem + sufixoSentinela)
+
+	extensao := strings.ToLower(filepath.Ext(nome))
+	switch {
+	case padraoTransacoes.MatchString(nome):
+		resultado.resumo, resultado.err = m.importarTransacoes(nome, caminho)
+	case extensao == ".xml" || extensao == ".zip":
+		resultado.resumo, resultado.err = m.importarXML(caminho)
+	default:
+		resultado.err = fmt.Errorf("nome fora dos padrões reconhecidos (transacoes_<CNPJ>_<AAAA-S>.csv, *.xml ou *.zip)")
+	}
+
+	destino := m.processados
+	if resultado.err != nil {
+		destino = m.erros
+	}
+	arquivado := filepath.Join(destino, time.Now().Format("20060102150405")+"_"+nome)
+	if err := moverArquivo(caminho, arquivado); err != nil {
+		log.Println("Erro ao arquivar arquivo da pasta de entrada:", err)
+	}
+
+	return resultado
+}
+
+func (m *MonitorPasta) importarTransacoes(nome, caminho string) (string, error) {
+	partes := padraoTransacoes.FindStringSubmatch(nome)
+	declarante, periodo := partes[1], partes[2]
+	if !validacao.CNPJValido(declarante) {
+		return "", fmt.Errorf("CNPJ do declarante %s inválido", declarante)
+	}
+	if err := eventos.VerificarPeriodoAberto(m.periodoRepo, declarante, periodo); err != nil {
+		return "", err
+	}
+
+	info, err := os.Stat(caminho)
+	if err != nil {
+		return "", err
+	}
+
+	novaImportacao := &models.Importacao{
+		Tipo:        TipoTransacoes,
+		Declarante:  declarante,
+		Periodo:     periodo,
+		NomeArquivo: nome,
+		Caminho:     caminho,
+		Status:      models.ImportacaoPendente,
+		TotalBytes:  info.Size(),
+		Erros:       []string{},
+	}
+
+	if err := m.importacaoRepo.CriarImportacao(novaImportacao); err != nil {
+		return "", err
+	}
+
+	if err := m.processador.Processar(novaImportacao); err != nil {
+		return "", fmt.Errorf("importação %s: %v", novaImportacao.ID.Hex(), err)
+	}
+
+	return fmt.Sprintf("importação %s com %d linhas, %d rejeitadas",
+		novaImportacao.ID.Hex(), novaImportacao.LinhasProcessadas, novaImportacao.LinhasRejeitadas), nil
+}
+
+func (m *MonitorPasta) importarXML(caminho string) (string, error) {
+	resultado, err := ImportarArquivoXML(caminho)
+	if err != nil {
+		return "", err
+	}
+
+	resumo, err := resultado.Gravar(m.eventoRepo, m.titularRepo, m.periodoRepo, eventos.UsuarioSistema)
+	if err != nil {
+		return "", err
+	}
+
+	texto := fmt.Sprintf("%d eventos importados, %d ignorados, %d recibos associados, %d ocorrências lidas",
+		resumo.EventosImportados, resumo.EventosIgnorados, resumo.RecibosAssociados, resumo.OcorrenciasLidas)
+	for _, erro := range resumo.Erros {
+		texto += "\n    " + erro
+	}
+	return texto, nil
+}
+
+func (m *MonitorPasta) enviarResumo(resultados []resultadoArquivo) {
+	if len(m.destinatarios) == 0 {
+		return
+	}
+
+	falhas := 0
+	var corpo strings.Builder
+	fmt.Fprintf(&corpo, "Arquivos processados da pasta %s em %s:\n\n", m.entrada, time.Now().Format("02/01/2006 15:04"))
+	for _, resultado := range resultados {
+		if resultado.err != nil {
+			falhas++
+			fmt.Fprintf(&corpo, "[ERRO] %s: %v\n", resultado.nome, resultado.err)
+		} else {
+			fmt.Fprintf(&corpo, "[OK] %s: %s\n", resultado.nome, resultado.resumo)
+		}
+	}
+
+	assunto := fmt.Sprintf("e-Financeira: %d arquivo(s) processado(s), %d com erro", len(resultados), falhas)
+
+	emailMiddleware := middlewares.NovoEmailMiddleware()
+	for _, destinatario := range m.destinatarios {
+		if err := emailMiddleware.SendEmail(destinatario, assunto, corpo.String()); err != nil {
+			log.Println("Erro ao enviar o resumo da pasta de entrada:", err)
+		}
+	}
+}
+
+// DiretorioImportacoes é onde ficam os arquivos aguardando processamento
+func DiretorioImportacoes() string {
+	return valorOuPadrao(os.Getenv("IMPORTACOES_DIR"), "importacoes")
+}
+
+// Renomeia o arquivo; se a pasta compartilhada estiver em outro sistema de
+// arquivos, copia e remove o original
+func moverArquivo(origem, destino string) error {
+	if err := os.Rename(origem, destino); err == nil {
+		return nil
+	}
+
+	entrada, err := os.Open(origem)
+	if err != nil {
+		return err
+	}
+	defer entrada.Close()
+
+	saida, err := os.Create(destino)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(saida, entrada); err != nil {
+		saida.Close()
+		os.Remove(destino)
+		return err
+	}
+	if err := saida.Close(); err != nil {
+		os.Remove(destino)
+		return err
+	}
+
+	entrada.Close()
+	return os.Remove(origem)
+}
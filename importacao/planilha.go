@@ -0,0 +1,514 @@
+package importacao
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+
+	"sped-efinanceira/eventos"
+	"sped-efinanceira/models"
+	"sped-efinanceira/validacao"
+)
+
+const abaDados = "Dados"
+
+type tipoColuna int
+
+const (
+	colunaTexto tipoColuna = iota
+	colunaDocumento
+	colunaCPF
+	colunaData
+	colunaMesAno
+	colunaDecimal
+	colunaMoeda
+	colunaPais
+)
+
+type Coluna struct {
+	Titulo      string
+	Campo       string
+	Tipo        tipoColuna
+	Obrigatoria bool
+	Exemplo     string
+}
+
+// Colunas do modelo de planilha de cada tipo de evento
+var modelosPlanilha = map[string][]Coluna{
+	eventos.TipoAbertura: {
+		{Titulo: "Data Início", Campo: "dt_inicio", Tipo: colunaData, Obrigatoria: true, Exemplo: "01/01/2024"},
+		{Titulo: "Data Fim", Campo: "dt_fim", Tipo: colunaData, Obrigatoria: true, Exemplo: "30/06/2024"},
+		{Titulo: "CPF Responsável RMF", Campo: "rmf_cpf", Tipo: colunaCPF, Obrigatoria: true, Exemplo: "529.982.247-25"},
+		{Titulo: "Nome Responsável RMF", Campo: "rmf_nome", Tipo: colunaTexto, Obrigatoria: true, Exemplo: "Maria da Silva"},
+		{Titulo: "Setor Responsável RMF", Campo: "rmf_setor", Tipo: colunaTexto, Exemplo: "Compliance"},
+		{Titulo: "Telefone Responsável RMF", Campo: "rmf_telefone", Tipo: colunaTexto, Exemplo: "4733334444"},
+		{Titulo: "CPF Responsável e-Financeira", Campo: "efin_cpf", Tipo: colunaCPF, Obrigatoria: true, Exemplo: "529.982.247-25"},
+		{Titulo: "Nome Responsável e-Financeira", Campo: "efin_nome", Tipo: colunaTexto, Obrigatoria: true, Exemplo: "Maria da Silva"},
+		{Titulo: "E-mail Responsável e-Financeira", Campo: "efin_email", Tipo: colunaTexto, Exemplo: "maria@empresa.com.br"},
+		{Titulo: "CPF Representante Legal", Campo: "legal_cpf", Tipo: colunaCPF, Obrigatoria: true, Exemplo: "529.982.247-25"},
+		{Titulo: "Nome Representante Legal", Campo: "legal_nome", Tipo: colunaTexto, Obrigatoria: true, Exemplo: "João Souza"},
+	},
+	eventos.TipoMovimento: {
+		{Titulo: "CPF/CNPJ Titular", Campo: "ni", Tipo: colunaDocumento, Obrigatoria: true, Exemplo: "529.982.247-25"},
+		{Titulo: "Nome Titular", Campo: "nome", Tipo: colunaTexto, Obrigatoria: true, Exemplo: "Maria da Silva"},
+		{Titulo: "Endereço", Campo: "endereco", Tipo: colunaTexto, Exemplo: "Rua XV de Novembro, 100, Blumenau/SC"},
+		{Titulo: "País Endereço", Campo: "pais_endereco", Tipo: colunaPais, Exemplo: "BR"},
+		{Titulo: "Número Conta", Campo: "num_conta", Tipo: colunaTexto, Obrigatoria: true, Exemplo: "12345-6"},
+		{Titulo: "Tipo Conta", Campo: "tp_conta", Tipo: colunaTexto, Obrigatoria: true, Exemplo: "1"},
+		{Titulo: "Moeda", Campo: "moeda", Tipo: colunaMoeda, Exemplo: "BRL"},
+		{Titulo: "Data Abertura Conta", Campo: "dt_abertura", Tipo: colunaData, Exemplo: "15/03/2019"},
+		{Titulo: "Data Encerramento Conta", Campo: "dt_encerramento", Tipo: colunaData, Exemplo: ""},
+		{Titulo: "Mês Caixa", Campo: "ano_mes", Tipo: colunaMesAno, Obrigatoria: true, Exemplo: "01/2024"},
+		{Titulo: "Total Créditos", Campo: "tot_creditos", Tipo: colunaDecimal, Obrigatoria: true, Exemplo: "12.345,67"},
+		{Titulo: "Total Débitos", Campo: "tot_debitos", Tipo: colunaDecimal, Obrigatoria: true, Exemplo: "10.000,00"},
+		{Titulo: "Saldo Último Dia", Campo: "vlr_ult_dia", Tipo: colunaDecimal, Obrigatoria: true, Exemplo: "2.345,67"},
+	},
+	eventos.TipoFechamento: {
+		{Titulo: "Data Início", Campo: "dt_inicio", Tipo: colunaData, Obrigatoria: true, Exemplo: "01/01/2024"},
+		{Titulo: "Data Fim", Campo: "dt_fim", Tipo: colunaData, Obrigatoria: true, Exemplo: "30/06/2024"},
+		{Titulo: "Situação Especial", Campo: "sit_especial", Tipo: colunaTexto, Obrigatoria: true, Exemplo: "0"},
+	},
+}
+
+type ResultadoPlanilha struct {
+	LinhasAceitas    int
+	LinhasRejeitadas int
+	Eventos          []*models.Evento
+	Planilha         *excelize.File
+}
+
+// linha já convertida de uma planilha, indexada pelo campo da coluna
+type linhaPlanilha map[string]interface{}
+
+// ModeloPlanilha retorna as colunas do modelo de um tipo de evento
+func ModeloPlanilha(tipo string) ([]Coluna, bool) {
+	colunas, ok := modelosPlanilha[tipo]
+	return colunas, ok
+}
+
+// GerarModeloPlanilha monta o arquivo XLSX vazio para o tipo de evento
+func GerarModeloPlanilha(tipo string) (*excelize.File, error) {
+	colunas, ok := ModeloPlanilha(tipo)
+	if !ok {
+		return nil, fmt.Errorf("tipo de evento '%s' não possui modelo de planilha", tipo)
+	}
+
+	f := excelize.NewFile()
+	if err := f.SetSheetName("Sheet1", abaDados); err != nil {
+		return nil, err
+	}
+
+	estiloCabecalho, err := f.NewStyle(&excelize.Style{
+		Font: &excelize.Font{Bold: true},
+		Fill: excelize.Fill{Type: "pattern", Color: []string{"#D9E1F2"}, Pattern: 1},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Células como texto evitam que o Excel converta datas e valores
+	estiloTexto, err := f.NewStyle(&excelize.Style{NumFmt: 49})
+	if err != nil {
+		return nil, err
+	}
+
+	for i, coluna := range colunas {
+		nomeColuna, _ := excelize.ColumnNumberToName(i + 1)
+
+		titulo := coluna.Titulo
+		if coluna.Obrigatoria {
+			titulo += " *"
+		}
+		f.SetCellValue(abaDados, nomeColuna+"1", titulo)
+		if coluna.Exemplo != "" {
+			f.AddComment(abaDados, excelize.Comment{Author: "e-Financeira", Cell: nomeColuna + "1", Text: "Exemplo: " + coluna.Exemplo})
+		}
+		f.SetColStyle(abaDados, nomeColuna, estiloTexto)
+		f.SetColWidth(abaDados, nomeColuna, nomeColuna, float64(len(titulo)+6))
+	}
+
+	ultimaColuna, _ := excelize.ColumnNumberToName(len(colunas))
+	f.SetCellStyle(abaDados, "A1", ultimaColuna+"1", estiloCabecalho)
+	f.SetPanes(abaDados, &excelize.Panes{Freeze: true, YSplit: 1, TopLeftCell: "A2", ActivePane: "bottomLeft"})
+
+	return f, nil
+}
+
+// ImportarPlanilha valida cada célula da planilha, anota os erros no próprio
+// arquivo e monta os eventos em rascunho a partir das linhas aceitas
+func ImportarPlanilha(r io.Reader, tipo, declarante, periodo string) (*ResultadoPlanilha, error) {
+	colunas, ok := ModeloPlanilha(tipo)
+	if !ok {
+		return nil, fmt.Errorf("tipo de evento '%s' não possui modelo de planilha", tipo)
+	}
+
+	inicio, fim, err := eventos.LimitesPeriodo(periodo)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := excelize.OpenReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("arquivo XLSX inválido: %v", err)
+	}
+
+	aba := f.GetSheetName(0)
+	linhas, err := f.GetRows(aba, excelize.Options{RawCellValue: true})
+	if err != nil {
+		return nil, err
+	}
+	if len(linhas) == 0 {
+		return nil, fmt.Errorf("a planilha está vazia")
+	}
+
+	indices, err := indicesColunas(linhas[0], colunas)
+	if err != nil {
+		return nil, err
+	}
+
+	estiloErro, err := f.NewStyle(&excelize.Style{
+		Fill: excelize.Fill{Type: "pattern", Color: []string{"#FFC7CE"}, Pattern: 1},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Reaproveita a coluna de erros de uma planilha já anotada
+	posicaoErros := len(linhas[0])
+	for i, titulo := range linhas[0] {
+		if strings.TrimSpace(titulo) == "Erros" {
+			posicaoErros = i
+		}
+	}
+	colunaErros, _ := excelize.ColumnNumberToName(posicaoErros + 1)
+	f.SetCellValue(aba, colunaErros+"1", "Erros")
+
+	resultado := &ResultadoPlanilha{Planilha: f}
+	var aceitas []linhaPlanilha
+
+	for i := 1; i < len(linhas); i++ {
+		numeroLinha := i + 1
+		if linhaVazia(linhas[i]) {
+			continue
+		}
+
+		linha := linhaPlanilha{}
+		var erros []string
+
+		for c, coluna := range colunas {
+			celula, _ := excelize.CoordinatesToCellName(indices[c]+1, numeroLinha)
+
+			valor := ""
+			if indices[c] < len(linhas[i]) {
+				valor = strings.TrimSpace(linhas[i][indices[c]])
+			}
+
+			convertido, err := converterCelula(f, aba, celula, valor, coluna)
+			if err == nil {
+				err = validarNoPeriodo(convertido, coluna, inicio, fim)
+			}
+			if err != nil {
+				erros = append(erros, fmt.Sprintf("%s: %v", coluna.Titulo, err))
+				f.SetCellStyle(aba, celula, celula, estiloErro)
+				f.AddComment(aba, excelize.Comment{Author: "e-Financeira", Cell: celula, Text: err.Error()})
+				continue
+			}
+			linha[coluna.Campo] = convertido
+		}
+
+		if len(erros) > 0 {
+			resultado.LinhasRejeitadas++
+			f.SetCellValue(aba, fmt.Sprintf("%s%d", colunaErros, numeroLinha), strings.Join(erros, "; "))
+			continue
+		}
+
+		f.SetCellValue(aba, fmt.Sprintf("%s%d", colunaErros, numeroLinha), "")
+		resultado.LinhasAceitas++
+		aceitas = append(aceitas, linha)
+	}
+
+	resultado.Eventos = montarEventos(tipo, declarante, periodo, aceitas)
+	return resultado, nil
+}
+
+// Localiza cada coluna do modelo no cabeçalho, permitindo colunas fora de ordem
+func indicesColunas(cabecalho []string, colunas []Coluna) ([]int, error) {
+	posicoes := make(map[string]int)
+	for i, titulo := range cabecalho {
+		titulo = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(titulo), "*"))
+		posicoes[strings.ToLower(titulo)] = i
+	}
+
+	indices := make([]int, len(colunas))
+	for i, coluna := range colunas {
+		posicao, ok := posicoes[strings.ToLower(coluna.Titulo)]
+		if !ok {
+			return nil, fmt.Errorf("coluna '%s' não encontrada no cabeçalho da planilha", coluna.Titulo)
+		}
+		indices[i] = posicao
+	}
+
+	return indices, nil
+}
+
+func linhaVazia(linha []string) bool {
+	for _, valor := range linha {
+		if strings.TrimSpace(valor) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func converterCelula(f *excelize.File, aba, celula, valor string, coluna Coluna) (interface{}, error) {
+	if valor == "" {
+		if coluna.Obrigatoria {
+			return nil, fmt.Errorf("campo obrigatório")
+		}
+		return nil, nil
+	}
+
+	// Células numéricas vêm do Excel sem formatação, com ponto decimal
+	// (o Excel grava números sem o atributo de tipo da célula)
+	numerica := false
+	if tipoCelula, err := f.GetCellType(aba, celula); err == nil {
+		numerica = tipoCelula == excelize.CellTypeNumber || tipoCelula == excelize.CellTypeUnset
+	}
+
+	switch coluna.Tipo {
+	case colunaDocumento:
+		if numerica {
+			valor = completarDocumento(valor)
+		}
+		if !validacao.DocumentoValido(valor) {
+			return nil, fmt.Errorf("CPF/CNPJ '%s' inválido", valor)
+		}
+		return validacao.SomenteDigitos(valor), nil
+
+	case colunaCPF:
+		if numerica {
+			valor = completarDocumento(valor)
+		}
+		if !validacao.CPFValido(valor) {
+			return nil, fmt.Errorf("CPF '%s' inválido", valor)
+		}
+		return validacao.SomenteDigitos(valor), nil
+
+	case colunaData:
+		if numerica {
+			serial, err := strconv.ParseFloat(valor, 64)
+			if err != nil {
+				return nil, err
+			}
+			return excelize.ExcelDateToTime(serial, false)
+		}
+		return validacao.ParseDataBR(valor)
+
+	case colunaMesAno:
+		if numerica {
+			serial, err := strconv.ParseFloat(valor, 64)
+			if err != nil {
+				return nil, err
+			}
+			data, err := excelize.ExcelDateToTime(serial, false)
+			if err != nil {
+				return nil, err
+			}
+			return time.Date(data.Year(), data.Month(), 1, 0, 0, 0, 0, time.UTC), nil
+		}
+		return validacao.ParseMesAnoBR(valor)
+
+	case colunaDecimal:
+		if numerica {
+			return strconv.ParseFloat(valor, 64)
+		}
+		return validacao.ParseDecimalBR(valor)
+
+	case colunaMoeda:
+		valor = strings.ToUpper(valor)
+		if !validacao.MoedaValida(valor) {
+			return nil, fmt.Errorf("moeda '%s' inválida, use o código ISO 4217", valor)
+		}
+		return valor, nil
+
+	case colunaPais:
+		valor = strings.ToUpper(valor)
+		if !validacao.PaisValido(valor) {
+			return nil, fmt.Errorf("país '%s' inválido, use o código ISO 3166", valor)
+		}
+		return valor, nil
+	}
+
+	return valor, nil
+}
+
+// Documentos digitados como número perdem os zeros à esquerda
+func completarDocumento(valor string) string {
+	if len(valor) <= 11 {
+		return fmt.Sprintf("%011s", valor)
+	}
+	return fmt.Sprintf("%014s", valor)
+}
+
+// Datas de competência precisam estar dentro do semestre importado
+func validarNoPeriodo(valor interface{}, coluna Coluna, inicio, fim time.Time) error {
+	data, ok := valor.(time.Time)
+	if !ok {
+		return nil
+	}
+
+	switch coluna.Campo {
+	case "dt_inicio", "dt_fim", "ano_mes":
+		if data.Before(inicio) || data.After(fim) {
+			return fmt.Errorf("data fora do período %s a %s", inicio.Format("02/01/2006"), fim.Format("02/01/2006"))
+		}
+	}
+	return nil
+}
+
+func montarEventos(tipo, declarante, periodo string, linhas []linhaPlanilha) []*models.Evento {
+	var resultado []*models.Evento
+
+	novoEvento := func() *models.Evento {
+		return &models.Evento{
+			Tipo:       tipo,
+			Declarante: declarante,
+			Periodo:    periodo,
+			Status:     models.EventoRascunho,
+			Origem:     eventos.OrigemPlanilha,
+		}
+	}
+
+	switch tipo {
+	case eventos.TipoAbertura:
+		for _, linha := range linhas {
+			evento := novoEvento()
+			evento.Abertura = &models.AberturaeFinanceira{
+				DtInicio: linha.data("dt_inicio"),
+				DtFim:    linha.data("dt_fim"),
+				ResponsavelRMF: models.Responsavel{
+					CPF:      linha.texto("rmf_cpf"),
+					Nome:     linha.texto("rmf_nome"),
+					Setor:    linha.texto("rmf_setor"),
+					Telefone: linha.texto("rmf_telefone"),
+				},
+				RespeFin: models.Responsavel{
+					CPF:   linha.texto("efin_cpf"),
+					Nome:  linha.texto("efin_nome"),
+					Email: linha.texto("efin_email"),
+				},
+				RepresLegal: models.Responsavel{
+					CPF:  linha.texto("legal_cpf"),
+					Nome: linha.texto("legal_nome"),
+				},
+			}
+			resultado = append(resultado, evento)
+		}
+
+	case eventos.TipoFechamento:
+		for _, linha := range linhas {
+			evento := novoEvento()
+			evento.Fechamento = &models.FechamentoeFinanceira{
+				DtInicio:    linha.data("dt_inicio"),
+				DtFim:       linha.data("dt_fim"),
+				SitEspecial: linha.texto("sit_especial"),
+			}
+			resultado = append(resultado, evento)
+		}
+
+	case eventos.TipoMovimento:
+		// Um evento por declarado, agrupando as contas e os meses das linhas
+		porDeclarado := make(map[string]*models.Evento)
+		for _, linha := range linhas {
+			ni := linha.texto("ni")
+
+			evento, ok := porDeclarado[ni]
+			if !ok {
+				evento = novoEvento()
+				evento.Movimento = &models.MovimentoOpFin{
+					Declarado: models.Declarado{
+						TpNI:         eventos.TipoNI(ni),
+						NI:           ni,
+						Nome:         linha.texto("nome"),
+						Endereco:     linha.texto("endereco"),
+						PaisEndereco: valorOuPadrao(linha.texto("pais_endereco"), "BR"),
+					},
+				}
+				porDeclarado[ni] = evento
+				resultado = append(resultado, evento)
+			}
+
+			conta := contaDoMovimento(evento.Movimento, linha)
+			conta.Meses = append(conta.Meses, models.MesCaixa{
+				AnoMes:      linha.data("ano_mes").Format("200601"),
+				TotCreditos: linha.decimal("tot_creditos"),
+				TotDebitos:  linha.decimal("tot_debitos"),
+				VlrUltDia:   linha.decimal("vlr_ult_dia"),
+			})
+		}
+
+		// Só as datas de abertura e encerramento do semestre são declaradas
+		inicio, fim, _ := eventos.LimitesPeriodo(periodo)
+		for _, evento := range resultado {
+			for i := range evento.Movimento.Contas {
+				conta := &evento.Movimento.Contas[i]
+				eventos.MarcarCicloDeVida(conta, conta.DtAbertura, conta.DtEncerramento, inicio, fim)
+			}
+		}
+	}
+
+	return resultado
+}
+
+func contaDoMovimento(movimento *models.MovimentoOpFin, linha linhaPlanilha) *models.ContaMovimento {
+	numConta := linha.texto("num_conta")
+	for i := range movimento.Contas {
+		if movimento.Contas[i].NumConta == numConta {
+			return &movimento.Contas[i]
+		}
+	}
+
+	conta := models.ContaMovimento{
+		NumConta:       numConta,
+		TpConta:        linha.texto("tp_conta"),
+		Moeda:          valorOuPadrao(linha.texto("moeda"), "BRL"),
+		DtAbertura:     linha.dataOpcional("dt_abertura"),
+		DtEncerramento: linha.dataOpcional("dt_encerramento"),
+	}
+	movimento.Contas = append(movimento.Contas, conta)
+	return &movimento.Contas[len(movimento.Contas)-1]
+}
+
+func valorOuPadrao(valor, padrao string) string {
+	if valor == "" {
+		return padrao
+	}
+	return valor
+}
+
+func (l linhaPlanilha) texto(campo string) string {
+	valor, _ := l[campo].(string)
+	return valor
+}
+
+func (l linhaPlanilha) decimal(campo string) float64 {
+	valor, _ := l[campo].(float64)
+	return valor
+}
+
+func (l linhaPlanilha) data(campo string) time.Time {
+	valor, _ := l[campo].(time.Time)
+	return valor
+}
+
+func (l linhaPlanilha) dataOpcional(campo string) *time.Time {
+	valor, ok := l[campo].(time.Time)
+	if !ok {
+		return nil
+	}
+	return &valor
+}
@@ -0,0 +1,367 @@
+package importacao
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"sped-efinanceira/agregacao"
+	"sped-efinanceira/eventos"
+	"sped-efinanceira/models"
+	"sped-efinanceira/repositories"
+	"sped-efinanceira/validacao"
+)
+
+const (
+	TipoTransacoes = "transacoes"
+
+	// Linhas lidas antes de gravar os acumulados e o checkpoint
+	linhasPorLote = 5000
+)
+
+// Colunas do arquivo de transações (separado por ponto e vírgula); as
+// colunas de moeda e estorno são opcionais
+var colunasTransacoes = []string{"documento", "conta", "data", "valor", "natureza", "moeda", "estorno", "data_original"}
+
+var colunasOpcionais = map[string]bool{
+	"moeda":         true,
+	"estorno":       true,
+	"data_original": true,
+}
+
+type ProcessadorTransacoes struct {
+	importacaoRepo *repositories.ImportacaoRepositorio
+	movimentoRepo  *repositories.MovimentoContaRepositorio
+	periodoRepo    *repositories.PeriodoRepositorio
+
+	mu          sync.Mutex
+	emAndamento map[primitive.ObjectID]bool
+}
+
+func NovoProcessadorTransacoes(importacaoRepo *repositories.ImportacaoRepositorio, movimentoRepo *repositories.MovimentoContaRepositorio, periodoRepo *repositories.PeriodoRepositorio) *ProcessadorTransacoes {
+	return &ProcessadorTransacoes{
+		importacaoRepo: importacaoRepo,
+		movimentoRepo:  movimentoRepo,
+		periodoRepo:    periodoRepo,
+		emAndamento:    make(map[primitive.ObjectID]bool),
+	}
+}
+
+// Iniciar processa a importação em segundo plano
+func (p *ProcessadorTransacoes) Iniciar(importacao *models.Importacao) {
+	p.mu.Lock()
+	if p.emAndamento[importacao.ID] {
+		p.mu.Unlock()
+		return
+	}
+	p.emAndamento[importacao.ID] = true
+	p.mu.Unlock()
+
+	go func() {
+		defer func() {
+			p.mu.Lock()
+			delete(p.emAndamento, importacao.ID)
+			p.mu.Unlock()
+		}()
+
+		if err := p.Processar(importacao); err != nil {
+			log.Printf("Importação %s falhou: %v", importacao.ID.Hex(), err)
+			return
+		}
+
+		// O arquivo recebido é apenas uma cópia temporária
+		if err := os.Remove(importacao.Caminho); err != nil {
+			log.Println("Erro ao remover arquivo importado:", err)
+		}
+	}()
+}
+
+// RetomarImportacoes continua, a partir do último checkpoint, as importações
+// que foram interrompidas (por exemplo, pela queda do servidor)
+func (p *ProcessadorTransacoes) RetomarImportacoes() {
+	importacoes, err := p.importacaoRepo.ListarImportacoesPorStatus(models.ImportacaoPendente, models.ImportacaoProcessando)
+	if err != nil {
+		log.Println("Erro ao listar importações pendentes:", err)
+		return
+	}
+
+	for _, importacao := range importacoes {
+		if importacao.Tipo != TipoTransacoes {
+			continue
+		}
+		log.Printf("Retomando importação %s a partir do byte %d", importacao.ID.Hex(), importacao.BytesProcessados)
+		p.Iniciar(importacao)
+	}
+}
+
+// Processar lê o arquivo linha a linha, sem carregá-lo inteiro em memória,
+// e acumula os totais por conta e mês em lotes
+func (p *ProcessadorTransacoes) Processar(importacao *models.Importacao) error {
+	err := p.importacaoRepo.AtualizarStatusImportacao(importacao.ID, models.ImportacaoProcessando)
+	if err != nil {
+		return err
+	}
+
+	err = p.processarArquivo(importacao)
+	if err != nil {
+		p.importacaoRepo.RegistrarErroImportacao(importacao.ID, err.Error())
+		p.importacaoRepo.AtualizarStatusImportacao(importacao.ID, models.ImportacaoFalhou)
+		return err
+	}
+
+	err = p.importacaoRepo.AtualizarStatusImportacao(importacao.ID, models.ImportacaoConcluida)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Importação %s concluída: %d linhas, %d rejeitadas", importacao.ID.Hex(), importacao.LinhasProcessadas, importacao.LinhasRejeitadas)
+	return nil
+}
+
+func (p *ProcessadorTransacoes) processarArquivo(importacao *models.Importacao) error {
+	inicio, fim, err := eventos.LimitesPeriodo(importacao.Periodo)
+	if err != nil {
+		return err
+	}
+
+	// O período pode ter sido fechado enquanto a importação esperava
+	if err := eventos.VerificarPeriodoAberto(p.periodoRepo, importacao.Declarante, importacao.Periodo); err != nil {
+		return err
+	}
+
+	arquivo, err := os.Open(importacao.Caminho)
+	if err != nil {
+		return err
+	}
+	defer arquivo.Close()
+
+	indices, fimCabecalho, err := lerCabecalhoTransacoes(arquivo)
+	if err != nil {
+		return err
+	}
+
+	// Retoma do checkpoint; na primeira execução começa após o cabeçalho
+	base := importacao.BytesProcessados
+	if base < fimCabecalho {
+		base = fimCabecalho
+	}
+	if _, err := arquivo.Seek(base, io.SeekStart); err != nil {
+		return err
+	}
+
+	leitor := novoLeitorCSV(arquivo)
+	agregador := agregacao.NovoAgregador(inicio, fim)
+	var erros []string
+	linhasNoLote := 0
+
+	gravarLote := func() error {
+		importacao.Lote++
+		movimentos := movimentosDoLote(importacao, agregador.Totais())
+
+		if err := p.verificarPeriodos(importacao.Declarante, movimentos); err != nil {
+			return err
+		}
+		if err := p.movimentoRepo.AplicarLote(importacao.Lote, movimentos); err != nil {
+			return err
+		}
+
+		importacao.BytesProcessados = base + leitor.InputOffset()
+		if err := p.importacaoRepo.SalvarCheckpoint(importacao, erros); err != nil {
+			return err
+		}
+
+		agregador = agregacao.NovoAgregador(inicio, fim)
+		erros = nil
+		linhasNoLote = 0
+		return nil
+	}
+
+	for {
+		registro, err := leitor.Read()
+		if err == io.EOF {
+			break
+		}
+
+		importacao.LinhasProcessadas++
+		linhasNoLote++
+
+		erroLinha := err
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return err
+			}
+		} else {
+			var t agregacao.Transacao
+			t, erroLinha = converterTransacao(registro, indices)
+			if erroLinha == nil {
+				erroLinha = agregador.Adicionar(t)
+			}
+		}
+
+		if erroLinha != nil {
+			importacao.LinhasRejeitadas++
+			// O cabeçalho ocupa a primeira linha do arquivo
+			erros = append(erros, fmt.Sprintf("linha %d: %v", importacao.LinhasProcessadas+1, erroLinha))
+		}
+
+		if linhasNoLote >= linhasPorLote {
+			if err := gravarLote(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if linhasNoLote > 0 {
+		return gravarLote()
+	}
+	return nil
+}
+
+func novoLeitorCSV(r io.Reader) *csv.Reader {
+	leitor := csv.NewReader(r)
+	leitor.Comma = ';'
+	leitor.FieldsPerRecord = -1
+	leitor.ReuseRecord = true
+	return leitor
+}
+
+// Lê o cabeçalho e devolve a posição de cada coluna e onde os dados começam
+func lerCabecalhoTransacoes(arquivo *os.File) ([]int, int64, error) {
+	leitor := novoLeitorCSV(arquivo)
+	cabecalho, err := leitor.Read()
+	if err != nil {
+		return nil, 0, fmt.Errorf("não foi possível ler o cabeçalho do arquivo: %v", err)
+	}
+
+	posicoes := make(map[string]int)
+	for i, titulo := range cabecalho {
+		posicoes[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(titulo, "\ufeff")))] = i
+	}
+
+	indices := make([]int, len(colunasTransacoes))
+	for i, coluna := range colunasTransacoes {
+		posicao, ok := posicoes[coluna]
+		if !ok && !colunasOpcionais[coluna] {
+			return nil, 0, fmt.Errorf("coluna '%s' não encontrada no cabeçalho", coluna)
+		}
+		if !ok {
+			posicao = -1
+		}
+		indices[i] = posicao
+	}
+
+	return indices, leitor.InputOffset(), nil
+}
+
+func converterTransacao(registro []string, indices []int) (agregacao.Transacao, error) {
+	campo := func(i int) string {
+		if indices[i] < 0 || indices[i] >= len(registro) {
+			return ""
+		}
+		return strings.TrimSpace(registro[indices[i]])
+	}
+
+	t := agregacao.Transacao{
+		Documento: validacao.SomenteDigitos(campo(0)),
+		NumConta:  campo(1),
+		Natureza:  strings.ToUpper(campo(4)),
+		Moeda:     strings.ToUpper(campo(5)),
+	}
+
+	if !validacao.DocumentoValido(t.Documento) {
+		return t, fmt.Errorf("CPF/CNPJ '%s' inválido", campo(0))
+	}
+	if t.NumConta == "" {
+		return t, fmt.Errorf("conta não informada")
+	}
+
+	var err error
+	t.Data, err = validacao.ParseDataBR(campo(2))
+	if err != nil {
+		return t, err
+	}
+
+	t.Valor, err = validacao.ParseDecimalBR(campo(3))
+	if err != nil {
+		return t, err
+	}
+
+	if t.Moeda == "" {
+		t.Moeda = "BRL"
+	}
+	if !validacao.MoedaValida(t.Moeda) {
+		return t, fmt.Errorf("moeda '%s' inválida", campo(5))
+	}
+
+	switch strings.ToUpper(campo(6)) {
+	case "", "N":
+	case "S":
+		t.Estorno = true
+	default:
+		return t, fmt.Errorf("indicador de estorno '%s' inválido, use S ou N", campo(6))
+	}
+
+	if original := campo(7); original != "" {
+		dataOriginal, err := validacao.ParseDataBR(original)
+		if err != nil {
+			return t, err
+		}
+		t.DataOriginal = &dataOriginal
+	}
+
+	return t, nil
+}
+
+// Os acumulados só mudam em períodos abertos: um período fechado no meio da
+// importação (ou um mês de estorno em período já fechado) interrompe o
+// processamento antes de gravar o lote
+func (p *ProcessadorTransacoes) verificarPeriodos(declarante string, movimentos []models.MovimentoConta) error {
+	verificados := make(map[string]bool)
+	for _, movimento := range movimentos {
+		mes, err := time.Parse("200601", movimento.AnoMes)
+		if err != nil {
+			return err
+		}
+
+		periodo := eventos.PeriodoDe(mes)
+		if verificados[periodo] {
+			continue
+		}
+		verificados[periodo] = true
+
+		if err := eventos.VerificarPeriodoAberto(p.periodoRepo, declarante, periodo); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Converte os baldes do lote nos acumulados gravados no Mongo
+func movimentosDoLote(importacao *models.Importacao, totais []agregacao.Totais) []models.MovimentoConta {
+	movimentos := make([]models.MovimentoConta, 0, len(totais))
+	for _, total := range totais {
+		movimentos = append(movimentos, models.MovimentoConta{
+			ID:           strings.Join([]string{importacao.ID.Hex(), total.Documento, total.NumConta, total.AnoMes, total.Moeda}, "|"),
+			ImportacaoID: importacao.ID,
+			Declarante:   importacao.Declarante,
+			Periodo:      importacao.Periodo,
+			Documento:    total.Documento,
+			NumConta:     total.NumConta,
+			AnoMes:       total.AnoMes,
+			Moeda:        total.Moeda,
+			TotCreditos:  float64(total.Creditos) / 100,
+			TotDebitos:   float64(total.Debitos) / 100,
+			Lancamentos:  total.Lancamentos,
+		})
+	}
+	return movimentos
+}
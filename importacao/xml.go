@@ -0,0 +1,313 @@
+package importacao
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"sped-efinanceira/cadastro"
+	"sped-efinanceira/eventos"
+	"sped-efinanceira/layout"
+	"sped-efinanceira/models"
+	"sped-efinanceira/repositories"
+	"sped-efinanceira/retorno"
+)
+
+// Tamanho máximo de cada XML dentro do ZIP
+const limiteArquivoXML = 50 << 20
+
+type ResultadoXML struct {
+	Arquivos    int
+	Eventos     []*models.Evento
+	Recibos     map[string]string
+	Ocorrencias map[string][]models.Ocorrencia
+	Erros       []string
+}
+
+// ResumoXML é o que foi efetivamente gravado a partir de um ResultadoXML
+type ResumoXML struct {
+	Arquivos          int      `json:"arquivos"`
+	EventosImportados int      `json:"eventos_importados"`
+	EventosIgnorados  int      `json:"eventos_ignorados"`
+	RecibosAssociados int      `json:"recibos_associados"`
+	OcorrenciasLidas  int      `json:"ocorrencias_lidas"`
+	Erros             []string `json:"erros"`
+}
+
+// ImportarArquivoXML lê um XML avulso ou um ZIP de XMLs históricos gerados
+// por outro sistema. Eventos com recibo (presente em algum retorno do mesmo
+// arquivo) entram como aceitos; os demais, como rascunho.
+func ImportarArquivoXML(caminho string) (*ResultadoXML, error) {
+	arquivo, err := os.Open(caminho)
+	if err != nil {
+		return nil, err
+	}
+	defer arquivo.Close()
+
+	assinatura := make([]byte, 4)
+	if _, err := io.ReadFull(arquivo, assinatura); err != nil {
+		return nil, fmt.Errorf("arquivo vazio ou inválido")
+	}
+
+	resultado := &ResultadoXML{
+		Recibos:     make(map[string]string),
+		Ocorrencias: make(map[string][]models.Ocorrencia),
+	}
+
+	if bytes.Equal(assinatura, []byte("PK\x03\x04")) {
+		leitor, err := zip.OpenReader(caminho)
+		if err != nil {
+			return nil, fmt.Errorf("ZIP inválido: %v", err)
+		}
+		defer leitor.Close()
+
+		for _, entrada := range leitor.File {
+			if entrada.FileInfo().IsDir() || !strings.EqualFold(filepath.Ext(entrada.Name), ".xml") {
+				continue
+			}
+
+			dados, err := lerEntradaZIP(entrada)
+			if err == nil {
+				err = resultado.adicionar(dados)
+			}
+			if err != nil {
+				resultado.Erros = append(resultado.Erros, fmt.Sprintf("%s: %v", entrada.Name, err))
+			}
+			resultado.Arquivos++
+		}
+	} else {
+		if _, err := arquivo.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		dados, err := io.ReadAll(io.LimitReader(arquivo, limiteArquivoXML))
+		if err != nil {
+			return nil, err
+		}
+		if err := resultado.adicionar(dados); err != nil {
+			resultado.Erros = append(resultado.Erros, fmt.Sprintf("%s: %v", filepath.Base(caminho), err))
+		}
+		resultado.Arquivos++
+	}
+
+	for _, evento := range resultado.Eventos {
+		evento.Status = models.EventoRascunho
+		if recibo, ok := resultado.Recibos[evento.IDEvento]; ok {
+			evento.Recibo = recibo
+			evento.Status = models.EventoAceito
+			delete(resultado.Recibos, evento.IDEvento)
+		}
+		if ocorrencias, ok := resultado.Ocorrencias[evento.IDEvento]; ok {
+			retorno.Enriquecer(ocorrencias)
+			evento.Ocorrencias = ocorrencias
+			delete(resultado.Ocorrencias, evento.IDEvento)
+		}
+	}
+
+	return resultado, nil
+}
+
+func lerEntradaZIP(entrada *zip.File) ([]byte, error) {
+	if entrada.UncompressedSize64 > limiteArquivoXML {
+		return nil, fmt.Errorf("arquivo maior que o limite de %d MB", limiteArquivoXML>>20)
+	}
+
+	conteudo, err := entrada.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer conteudo.Close()
+
+	return io.ReadAll(io.LimitReader(conteudo, limiteArquivoXML))
+}
+
+func (r *ResultadoXML) adicionar(dados []byte) error {
+	conteudo, err := layout.LerArquivo(dados)
+	if err != nil {
+		return err
+	}
+
+	for id, recibo := range conteudo.Recibos {
+		r.Recibos[id] = recibo
+	}
+	for id, ocorrencias := range conteudo.Ocorrencias {
+		r.Ocorrencias[id] = append(r.Ocorrencias[id], ocorrencias...)
+	}
+
+	for _, lido := range conteudo.Eventos {
+		evento, err := layout.ParaEvento(lido.Raiz)
+		if err != nil {
+			return err
+		}
+		if !eventos.TipoValido(evento.Tipo) {
+			return fmt.Errorf("tipo de evento '%s' não suportado", evento.Tipo)
+		}
+		evento.XML = lido.XML
+		r.Eventos = append(r.Eventos, evento)
+	}
+
+	return nil
+}
+
+// Gravar salva os eventos lidos, ignorando os que já existem pelo ID da
+// Receita e recusando, com erro no resumo, os não aceitos de períodos
+// fechados, e associa os recibos e as ocorrências de retornos aos eventos já
+// presentes na base, avançando o status de cada um e fechando o período
+// quando o fechamento é aceito. Os declarados alimentam o cadastro de
+// titulares.
+func (r *ResultadoXML) Gravar(eventoRepo *repositories.EventoRepositorio, titularRepo *repositories.TitularRepositorio, periodoRepo *repositories.PeriodoRepositorio, usuario string) (*ResumoXML, error) {
+	ids := make([]string, 0, len(r.Eventos))
+	for _, evento := range r.Eventos {
+		ids = append(ids, evento.IDEvento)
+	}
+
+	existentes, err := eventoRepo.IDsEventosExistentes(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	var novos []*models.Evento
+	var bloqueados []string
+	periodosFechados := make(map[string]error)
+	for _, evento := range r.Eventos {
+		if existentes[evento.IDEvento] {
+			continue
+		}
+		existentes[evento.IDEvento] = true
+
+		// A exclusão herda o período do evento excluído, quando conhecido
+		if evento.Exclusao != nil && evento.Periodo == "" {
+			excluido, err := eventoRepo.BuscarEventoPorRecibo(evento.Exclusao.NrReciboEvento)
+			if err == nil && excluido != nil {
+				evento.Periodo = excluido.Periodo
+			}
+		}
+
+		// Só eventos históricos já aceitos entram em período fechado
+		if evento.Status != models.EventoAceito && evento.Periodo != "" {
+			chave := evento.Declarante + "|" + evento.Periodo
+			errPeriodo, verificado := periodosFechados[chave]
+			if !verificado {
+				errPeriodo = eventos.VerificarPeriodoAberto(periodoRepo, evento.Declarante, evento.Periodo)
+				periodosFechados[chave] = errPeriodo
+			}
+			if errPeriodo != nil {
+				bloqueados = append(bloqueados, fmt.Sprintf("evento %s: %v", evento.IDEvento, errPeriodo))
+				continue
+			}
+		}
+
+		evento.CriadoPor = usuario
+		novos = append(novos, evento)
+	}
+
+	if err := cadastro.VincularTitulares(titularRepo, novos, eventos.OrigemXML); err != nil {
+		return nil, err
+	}
+
+	if err := eventoRepo.CriarEventos(novos); err != nil {
+		return nil, err
+	}
+
+	resumo := &ResumoXML{
+		Arquivos:          r.Arquivos,
+		EventosImportados: len(novos),
+		EventosIgnorados:  len(r.Eventos) - len(novos) - len(bloqueados),
+		Erros:             append(append([]string{}, r.Erros...), bloqueados...),
+	}
+	for _, evento := range novos {
+		resumo.OcorrenciasLidas += len(evento.Ocorrencias)
+	}
+
+	// Eventos históricos já aceitos retificam ou excluem os anteriores
+	for _, evento := range novos {
+		if evento.Status != models.EventoAceito {
+			continue
+		}
+		if err := aplicarAceite(eventoRepo, periodoRepo, evento, usuario); err != nil {
+			resumo.Erros = append(resumo.Erros, fmt.Sprintf("evento %s: %v", evento.IDEvento, err))
+		}
+	}
+
+	// Recibos de retornos cujos eventos já estavam na base
+	for idEvento, recibo := range r.Recibos {
+		evento, err := eventoRepo.BuscarEventoPorIDEvento(idEvento)
+		if err == nil && evento == nil {
+			err = fmt.Errorf("evento %s não encontrado", idEvento)
+		}
+		if err == nil && evento.Status != models.EventoAceito {
+			err = eventos.AvancarStatus(eventoRepo, evento, models.EventoAceito, usuario, "Recibo no retorno da Receita")
+			if err == nil {
+				err = eventoRepo.RegistrarRecibo(evento.ID, recibo)
+			}
+			if err == nil {
+				evento.Recibo = recibo
+				err = aplicarAceite(eventoRepo, periodoRepo, evento, usuario)
+			}
+		}
+		if err != nil {
+			resumo.Erros = append(resumo.Erros, fmt.Sprintf("recibo %s: %v", recibo, err))
+			continue
+		}
+		resumo.RecibosAssociados++
+	}
+
+	// Ocorrências de retornos cujos eventos já estavam na base. Erros sem
+	// recibo indicam que o evento foi rejeitado.
+	for idEvento, ocorrencias := range r.Ocorrencias {
+		retorno.Enriquecer(ocorrencias)
+		evento, err := eventoRepo.BuscarEventoPorIDEvento(idEvento)
+		if err == nil && evento == nil {
+			err = fmt.Errorf("evento %s não encontrado", idEvento)
+		}
+		if err == nil {
+			_, err = eventoRepo.RegistrarOcorrenciasRetorno(idEvento, ocorrencias)
+		}
+		if err == nil && comErro(ocorrencias) && evento.Recibo == "" && r.Recibos[idEvento] == "" && evento.Status != models.EventoRejeitado {
+			err = eventos.AvancarStatus(eventoRepo, evento, models.EventoRejeitado, usuario, "Rejeitado no retorno da Receita")
+		}
+		if err != nil {
+			resumo.Erros = append(resumo.Erros, fmt.Sprintf("ocorrências do evento %s: %v", idEvento, err))
+			continue
+		}
+		resumo.OcorrenciasLidas += len(ocorrencias)
+	}
+
+	return resumo, nil
+}
+
+// Ao ser aceita, a retificadora substitui o evento original e a exclusão
+// encerra o evento excluído. O fechamento aceito fecha o período.
+func aplicarAceite(eventoRepo *repositories.EventoRepositorio, periodoRepo *repositories.PeriodoRepositorio, evento *models.Evento, usuario string) error {
+	if err := eventos.FecharPeriodo(periodoRepo, evento, usuario); err != nil {
+		return err
+	}
+
+	recibo, status := evento.NrReciboAnterior, models.EventoRetificado
+	if evento.Exclusao != nil {
+		recibo, status = evento.Exclusao.NrReciboEvento, models.EventoExcluido
+	}
+	if recibo == "" {
+		return nil
+	}
+
+	anterior, err := eventoRepo.BuscarEventoPorRecibo(recibo)
+	if err != nil || anterior == nil || anterior.Status != models.EventoAceito {
+		return err
+	}
+
+	motivo := fmt.Sprintf("Evento %s aceito", evento.IDEvento)
+	return eventos.AlterarStatus(eventoRepo, anterior, status, usuario, motivo)
+}
+
+func comErro(ocorrencias []models.Ocorrencia) bool {
+	for _, ocorrencia := range ocorrencias {
+		if ocorrencia.Tipo == models.OcorrenciaErro {
+			return true
+		}
+	}
+	return false
+}
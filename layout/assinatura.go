@@ -0,0 +1,96 @@
+package layout
+
+import (
+	"crypto"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// Assinador assina os eventos com o certificado digital A1 do declarante
+// (arquivo PFX), no padrão XMLDSig exigido pela e-Financeira
+type Assinador struct {
+	chave       crypto.Signer
+	certificado *x509.Certificate
+	cadeia      [][]byte
+}
+
+// CarregarAssinador lê o certificado de CERTIFICADO_PFX, protegido pela
+// senha em CERTIFICADO_SENHA
+func CarregarAssinador() (*Assinador, error) {
+	caminho := os.Getenv("CERTIFICADO_PFX")
+	if caminho == "" {
+		return nil, fmt.Errorf("a variável CERTIFICADO_PFX não está definida")
+	}
+
+	dados, err := os.ReadFile(caminho)
+	if err != nil {
+		return nil, err
+	}
+
+	chave, certificado, intermediarios, err := pkcs12.DecodeChain(dados, os.Getenv("CERTIFICADO_SENHA"))
+	if err != nil {
+		return nil, fmt.Errorf("certificado inválido: %v", err)
+	}
+
+	assinante, ok := chave.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("a chave do certificado não permite assinatura")
+	}
+
+	agora := time.Now()
+	if agora.Before(certificado.NotBefore) || agora.After(certificado.NotAfter) {
+		return nil, fmt.Errorf("certificado fora da validade (%s a %s)",
+			certificado.NotBefore.Format("02/01/2006"), certificado.NotAfter.Format("02/01/2006"))
+	}
+
+	cadeia := [][]byte{certificado.Raw}
+	for _, intermediario := range intermediarios {
+		cadeia = append(cadeia, intermediario.Raw)
+	}
+
+	return &Assinador{chave: assinante, certificado: certificado, cadeia: cadeia}, nil
+}
+
+// Titular devolve o nome do titular do certificado
+func (a *Assinador) Titular() string {
+	return a.certificado.Subject.CommonName
+}
+
+// Assinar inclui a assinatura do evento como último filho de <eFinanceira>,
+// referenciando o atributo id do elemento do evento
+func (a *Assinador) Assinar(conteudo []byte) ([]byte, error) {
+	documento := etree.NewDocument()
+	if err := documento.ReadFromBytes(conteudo); err != nil {
+		return nil, err
+	}
+
+	raiz := documento.Root()
+	if raiz == nil || raiz.Tag != "eFinanceira" || len(raiz.ChildElements()) == 0 {
+		return nil, fmt.Errorf("XML do evento sem o elemento eFinanceira")
+	}
+	evento := raiz.ChildElements()[0]
+
+	contexto, err := dsig.NewSigningContext(a.chave, a.cadeia)
+	if err != nil {
+		return nil, err
+	}
+	contexto.IdAttribute = "id"
+	contexto.Canonicalizer = dsig.MakeC14N10RecCanonicalizer()
+	if err := contexto.SetSignatureMethod(dsig.RSASHA256SignatureMethod); err != nil {
+		return nil, err
+	}
+
+	assinatura, err := contexto.ConstructSignature(evento, true)
+	if err != nil {
+		return nil, err
+	}
+	raiz.AddChild(assinatura)
+
+	return documento.WriteToBytes()
+}
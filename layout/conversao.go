@@ -0,0 +1,471 @@
+package layout
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"sped-efinanceira/eventos"
+	"sped-efinanceira/models"
+)
+
+const (
+	formatoData = "2006-01-02"
+	verAplic    = "sped-efinanceira"
+
+	// aplicEmi 1 = aplicativo do contribuinte
+	aplicEmiContribuinte = 1
+)
+
+// AmbienteConfigurado retorna o tpAmb da variável EFINANCEIRA_AMBIENTE
+// (1 = produção, 2 = homologação); na ausência, usa homologação
+func AmbienteConfigurado() int {
+	if os.Getenv("EFINANCEIRA_AMBIENTE") == "1" {
+		return 1
+	}
+	return 2
+}
+
+// Monta a estrutura do leiaute 1.2 com os namespaces de cada tipo de evento
+func paraXML(evento *models.Evento, tpAmb int, namespaces map[string]string) (*EFinanceira, error) {
+	if evento.IDEvento == "" {
+		return nil, fmt.Errorf("evento %s sem identificador", evento.ID.Hex())
+	}
+
+	ideEvento := IdeEvento{
+		IndRetificacao: evento.IndRetificacao,
+		NrRecibo:       evento.NrReciboAnterior,
+		TpAmb:          tpAmb,
+		AplicEmi:       aplicEmiContribuinte,
+		VerAplic:       verAplic,
+	}
+	if ideEvento.IndRetificacao == 0 {
+		ideEvento.IndRetificacao = 1
+	}
+	ideDeclarante := IdeDeclarante{CnpjDeclarante: evento.Declarante}
+
+	switch evento.Tipo {
+	case eventos.TipoAbertura:
+		if evento.Abertura == nil {
+			return nil, fmt.Errorf("evento de abertura sem dados")
+		}
+		return &EFinanceira{
+			Xmlns: namespaces[eventos.TipoAbertura],
+			Abertura: &EvtAbertura{
+				ID:            evento.IDEvento,
+				IdeEvento:     ideEvento,
+				IdeDeclarante: ideDeclarante,
+				InfoAbertura: InfoPeriodo{
+					DtInicio: evento.Abertura.DtInicio.Format(formatoData),
+					DtFim:    evento.Abertura.DtFim.Format(formatoData),
+				},
+				AberturaMovOpFin: AberturaMovOpFin{
+					ResponsavelRMF: Responsavel(evento.Abertura.ResponsavelRMF),
+					RespeFin:       Responsavel(evento.Abertura.RespeFin),
+					RepresLegal:    Responsavel(evento.Abertura.RepresLegal),
+				},
+			},
+		}, nil
+
+	case eventos.TipoMovimento:
+		if evento.Movimento == nil {
+			return nil, fmt.Errorf("evento de movimento sem dados")
+		}
+		declarado := evento.Movimento.Declarado
+		return &EFinanceira{
+			Xmlns: namespaces[eventos.TipoMovimento],
+			MovOpFin: &EvtMovOpFin{
+				ID:            evento.IDEvento,
+				IdeEvento:     ideEvento,
+				IdeDeclarante: ideDeclarante,
+				IdeDeclarado: IdeDeclarado{
+					TpNI:              declarado.TpNI,
+					NIDeclarado:       declarado.NI,
+					NIF:               nifsParaXML(declarado.Residencias),
+					NomeDeclarado:     declarado.Nome,
+					EnderecoLivre:     declarado.Endereco,
+					PaisEndereco:      Pais{Pais: declarado.PaisEndereco},
+					PaisResid:         paisesParaXML(declarado.Residencias),
+					PaisNacionalidade: declarado.Nacionalidade,
+					Proprietarios:     proprietariosParaXML(declarado.Controladores),
+				},
+				MesCaixa: mesesParaXML(evento.Movimento.Contas),
+			},
+		}, nil
+
+	case eventos.TipoFechamento:
+		if evento.Fechamento == nil {
+			return nil, fmt.Errorf("evento de fechamento sem dados")
+		}
+		return &EFinanceira{
+			Xmlns: namespaces[eventos.TipoFechamento],
+			Fechamento: &EvtFechamento{
+				ID:            evento.IDEvento,
+				IdeEvento:     ideEvento,
+				IdeDeclarante: ideDeclarante,
+				InfoFechamento: InfoPeriodo{
+					DtInicio:    evento.Fechamento.DtInicio.Format(formatoData),
+					DtFim:       evento.Fechamento.DtFim.Format(formatoData),
+					SitEspecial: evento.Fechamento.SitEspecial,
+				},
+				FechamentoMovOpFin: fechamentoMovOpFinParaXML(evento.Fechamento.Meses),
+			},
+		}, nil
+
+	case eventos.TipoExclusao:
+		if evento.Exclusao == nil {
+			return nil, fmt.Errorf("evento de exclusão sem dados")
+		}
+		// A exclusão não possui indicador de retificação
+		ideEvento.IndRetificacao = 0
+		ideEvento.NrRecibo = ""
+		return &EFinanceira{
+			Xmlns: namespaces[eventos.TipoExclusao],
+			Exclusao: &EvtExclusao{
+				ID:            evento.IDEvento,
+				IdeEvento:     ideEvento,
+				IdeDeclarante: ideDeclarante,
+				InfoExclusao:  InfoExclusao{NrReciboEvento: evento.Exclusao.NrReciboEvento},
+			},
+		}, nil
+	}
+
+	return nil, fmt.Errorf("tipo de evento '%s' não suportado", evento.Tipo)
+}
+
+func fechamentoMovOpFinParaXML(meses []models.FechamentoMes) *FechamentoMovOpFin {
+	if len(meses) == 0 {
+		return nil
+	}
+
+	fechamento := &FechamentoMovOpFin{}
+	for _, mes := range meses {
+		fechamento.FechamentoMes = append(fechamento.FechamentoMes, FechamentoMes{
+			AnoMesCaixa:   mes.AnoMesCaixa,
+			QuantArqTrans: mes.QuantArqTrans,
+		})
+	}
+	return fechamento
+}
+
+// No XML as contas ficam agrupadas por mês; no modelo, os meses por conta
+func mesesParaXML(contas []models.ContaMovimento) []MesCaixa {
+	porMes := make(map[string]*MesCaixa)
+	var meses []string
+
+	for _, conta := range contas {
+		for _, mes := range conta.Meses {
+			mesCaixa, ok := porMes[mes.AnoMes]
+			if !ok {
+				mesCaixa = &MesCaixa{AnoMesCaixa: mes.AnoMes}
+				porMes[mes.AnoMes] = mesCaixa
+				meses = append(meses, mes.AnoMes)
+			}
+
+			infoConta := InfoConta{
+				TpConta:            conta.TpConta,
+				NumConta:           conta.NumConta,
+				TpRelacaoDeclarado: conta.TpRelacaoDeclarado,
+				NoTitulares:        conta.NoTitulares,
+				Moeda:              conta.Moeda,
+				BalancoConta: BalancoConta{
+					TotCreditos: FormatarValor(mes.TotCreditos),
+					TotDebitos:  FormatarValor(mes.TotDebitos),
+					VlrUltDia:   FormatarValor(mes.VlrUltDia),
+				},
+			}
+			if conta.DtAbertura != nil {
+				infoConta.DtAberturaConta = conta.DtAbertura.Format(formatoData)
+			}
+			if conta.DtEncerramento != nil {
+				infoConta.DtEncerramentoConta = conta.DtEncerramento.Format(formatoData)
+			}
+			mesCaixa.MovOpFin.Conta = append(mesCaixa.MovOpFin.Conta, Conta{InfoConta: infoConta})
+		}
+	}
+
+	sort.Strings(meses)
+	resultado := make([]MesCaixa, 0, len(meses))
+	for _, mes := range meses {
+		resultado = append(resultado, *porMes[mes])
+	}
+	return resultado
+}
+
+// ParaEvento converte um evento lido do XML para o modelo
+func ParaEvento(raiz *EFinanceira) (*models.Evento, error) {
+	evento := &models.Evento{Origem: eventos.OrigemXML}
+
+	var ideEvento IdeEvento
+	switch {
+	case raiz.Abertura != nil:
+		abertura := raiz.Abertura
+		ideEvento = abertura.IdeEvento
+		evento.Tipo = eventos.TipoAbertura
+		evento.IDEvento = abertura.ID
+		evento.Declarante = abertura.IdeDeclarante.CnpjDeclarante
+
+		dtInicio, dtFim, err := lerDatas(abertura.InfoAbertura)
+		if err != nil {
+			return nil, err
+		}
+		evento.Periodo = eventos.PeriodoDe(dtInicio)
+		evento.Abertura = &models.AberturaeFinanceira{
+			DtInicio:       dtInicio,
+			DtFim:          dtFim,
+			ResponsavelRMF: models.Responsavel(abertura.AberturaMovOpFin.ResponsavelRMF),
+			RespeFin:       models.Responsavel(abertura.AberturaMovOpFin.RespeFin),
+			RepresLegal:    models.Responsavel(abertura.AberturaMovOpFin.RepresLegal),
+		}
+
+	case raiz.MovOpFin != nil:
+		movimento := raiz.MovOpFin
+		ideEvento = movimento.IdeEvento
+		evento.Tipo = eventos.TipoMovimento
+		evento.IDEvento = movimento.ID
+		evento.Declarante = movimento.IdeDeclarante.CnpjDeclarante
+
+		contas, err := mesesParaModelo(movimento.MesCaixa)
+		if err != nil {
+			return nil, err
+		}
+		if len(movimento.MesCaixa) > 0 {
+			primeiroMes, err := time.Parse("200601", movimento.MesCaixa[0].AnoMesCaixa)
+			if err != nil {
+				return nil, fmt.Errorf("anoMesCaixa '%s' inválido", movimento.MesCaixa[0].AnoMesCaixa)
+			}
+			evento.Periodo = eventos.PeriodoDe(primeiroMes)
+		}
+
+		declarado := movimento.IdeDeclarado
+		evento.Movimento = &models.MovimentoOpFin{
+			Declarado: models.Declarado{
+				TpNI:          declarado.TpNI,
+				NI:            declarado.NIDeclarado,
+				Nome:          declarado.NomeDeclarado,
+				Endereco:      declarado.EnderecoLivre,
+				PaisEndereco:  declarado.PaisEndereco.Pais,
+				Nacionalidade: declarado.PaisNacionalidade,
+				Residencias:   residenciasParaModelo(declarado.PaisResid, declarado.NIF),
+			},
+			Contas: contas,
+		}
+
+		for _, proprietario := range declarado.Proprietarios {
+			controlador := models.ControladorDeclarado{
+				TpControle:    proprietario.TpProprietario,
+				NI:            proprietario.NIProprietario,
+				Nome:          proprietario.Nome,
+				Endereco:      proprietario.EnderecoLivre,
+				PaisEndereco:  proprietario.PaisEndereco.Pais,
+				Nacionalidade: proprietario.PaisNacionalidade,
+				Residencias:   residenciasParaModelo(proprietario.PaisResid, proprietario.NIF),
+			}
+			if proprietario.DataNasc != "" {
+				data, err := time.Parse(formatoData, proprietario.DataNasc)
+				if err != nil {
+					return nil, fmt.Errorf("DataNasc '%s' inválida", proprietario.DataNasc)
+				}
+				controlador.DtNascimento = &data
+			}
+			evento.Movimento.Declarado.Controladores = append(evento.Movimento.Declarado.Controladores, controlador)
+		}
+
+	case raiz.Fechamento != nil:
+		fechamento := raiz.Fechamento
+		ideEvento = fechamento.IdeEvento
+		evento.Tipo = eventos.TipoFechamento
+		evento.IDEvento = fechamento.ID
+		evento.Declarante = fechamento.IdeDeclarante.CnpjDeclarante
+
+		dtInicio, dtFim, err := lerDatas(fechamento.InfoFechamento)
+		if err != nil {
+			return nil, err
+		}
+		evento.Periodo = eventos.PeriodoDe(dtInicio)
+		evento.Fechamento = &models.FechamentoeFinanceira{
+			DtInicio:    dtInicio,
+			DtFim:       dtFim,
+			SitEspecial: fechamento.InfoFechamento.SitEspecial,
+		}
+		if fechamento.FechamentoMovOpFin != nil {
+			for _, mes := range fechamento.FechamentoMovOpFin.FechamentoMes {
+				evento.Fechamento.Meses = append(evento.Fechamento.Meses, models.FechamentoMes{
+					AnoMesCaixa:   mes.AnoMesCaixa,
+					QuantArqTrans: mes.QuantArqTrans,
+				})
+			}
+		}
+
+	case raiz.Exclusao != nil:
+		exclusao := raiz.Exclusao
+		ideEvento = exclusao.IdeEvento
+		evento.Tipo = eventos.TipoExclusao
+		evento.IDEvento = exclusao.ID
+		evento.Declarante = exclusao.IdeDeclarante.CnpjDeclarante
+		evento.Exclusao = &models.ExclusaoeFinanceira{NrReciboEvento: exclusao.InfoExclusao.NrReciboEvento}
+
+	default:
+		return nil, fmt.Errorf("o arquivo não contém um evento reconhecido")
+	}
+
+	evento.IndRetificacao = ideEvento.IndRetificacao
+	evento.NrReciboAnterior = ideEvento.NrRecibo
+	return evento, nil
+}
+
+func mesesParaModelo(meses []MesCaixa) ([]models.ContaMovimento, error) {
+	var contas []models.ContaMovimento
+	posicao := make(map[string]int)
+
+	for _, mes := range meses {
+		for _, conta := range mes.MovOpFin.Conta {
+			info := conta.InfoConta
+			chave := info.NumConta + "|" + info.Moeda
+
+			i, ok := posicao[chave]
+			if !ok {
+				nova := models.ContaMovimento{
+					NumConta:           info.NumConta,
+					TpConta:            info.TpConta,
+					Moeda:              info.Moeda,
+					TpRelacaoDeclarado: info.TpRelacaoDeclarado,
+					NoTitulares:        info.NoTitulares,
+				}
+				if info.DtAberturaConta != "" {
+					data, err := time.Parse(formatoData, info.DtAberturaConta)
+					if err != nil {
+						return nil, fmt.Errorf("dtAberturaConta '%s' inválida", info.DtAberturaConta)
+					}
+					nova.DtAbertura = &data
+					nova.AbertaNoPeriodo = true
+				}
+				if info.DtEncerramentoConta != "" {
+					data, err := time.Parse(formatoData, info.DtEncerramentoConta)
+					if err != nil {
+						return nil, fmt.Errorf("dtEncerramentoConta '%s' inválida", info.DtEncerramentoConta)
+					}
+					nova.DtEncerramento = &data
+					nova.EncerradaNoPeriodo = true
+				}
+				contas = append(contas, nova)
+				i = len(contas) - 1
+				posicao[chave] = i
+			}
+
+			creditos, err := LerValor(info.BalancoConta.TotCreditos)
+			if err != nil {
+				return nil, err
+			}
+			debitos, err := LerValor(info.BalancoConta.TotDebitos)
+			if err != nil {
+				return nil, err
+			}
+			saldo, err := LerValor(info.BalancoConta.VlrUltDia)
+			if err != nil {
+				return nil, err
+			}
+
+			contas[i].Meses = append(contas[i].Meses, models.MesCaixa{
+				AnoMes:      mes.AnoMesCaixa,
+				TotCreditos: creditos,
+				TotDebitos:  debitos,
+				VlrUltDia:   saldo,
+			})
+		}
+	}
+
+	return contas, nil
+}
+
+func lerDatas(info InfoPeriodo) (time.Time, time.Time, error) {
+	dtInicio, err := time.Parse(formatoData, info.DtInicio)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("dtInicio '%s' inválida", info.DtInicio)
+	}
+	dtFim, err := time.Parse(formatoData, info.DtFim)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("dtFim '%s' inválida", info.DtFim)
+	}
+	return dtInicio, dtFim, nil
+}
+
+// FormatarValor escreve valores monetários com vírgula decimal (ex.: 1234,56)
+func FormatarValor(valor float64) string {
+	return strings.Replace(strconv.FormatFloat(valor, 'f', 2, 64), ".", ",", 1)
+}
+
+// LerValor aceita valores com vírgula ou ponto decimal
+func LerValor(valor string) (float64, error) {
+	valor = strings.TrimSpace(valor)
+	if valor == "" {
+		return 0, nil
+	}
+
+	convertido, err := strconv.ParseFloat(strings.Replace(valor, ",", ".", 1), 64)
+	if err != nil {
+		return 0, fmt.Errorf("valor '%s' inválido", valor)
+	}
+	return convertido, nil
+}
+
+func nifsParaXML(residencias []models.ResidenciaFiscal) []NIF {
+	var nifs []NIF
+	for _, residencia := range residencias {
+		if residencia.NIF != "" {
+			nifs = append(nifs, NIF{NumeroNIF: residencia.NIF, PaisEmissaoNIF: residencia.Pais})
+		}
+	}
+	return nifs
+}
+
+func paisesParaXML(residencias []models.ResidenciaFiscal) []Pais {
+	var paises []Pais
+	for _, residencia := range residencias {
+		paises = append(paises, Pais{Pais: residencia.Pais})
+	}
+	return paises
+}
+
+func proprietariosParaXML(controladores []models.ControladorDeclarado) []Proprietarios {
+	var proprietarios []Proprietarios
+	for _, controlador := range controladores {
+		proprietario := Proprietarios{
+			NIProprietario:    controlador.NI,
+			TpProprietario:    controlador.TpControle,
+			NIF:               nifsParaXML(controlador.Residencias),
+			Nome:              controlador.Nome,
+			EnderecoLivre:     controlador.Endereco,
+			PaisEndereco:      Pais{Pais: controlador.PaisEndereco},
+			PaisResid:         paisesParaXML(controlador.Residencias),
+			PaisNacionalidade: controlador.Nacionalidade,
+		}
+		if controlador.NI != "" {
+			proprietario.TpNI = "1"
+		}
+		if controlador.DtNascimento != nil {
+			proprietario.DataNasc = controlador.DtNascimento.Format(formatoData)
+		}
+		proprietarios = append(proprietarios, proprietario)
+	}
+	return proprietarios
+}
+
+// Reconstrói as residências fiscais a partir dos países e dos NIFs do XML
+func residenciasParaModelo(paises []Pais, nifs []NIF) []models.ResidenciaFiscal {
+	var residencias []models.ResidenciaFiscal
+	for _, pais := range paises {
+		residencia := models.ResidenciaFiscal{Pais: pais.Pais}
+		for _, nif := range nifs {
+			if nif.PaisEmissaoNIF == pais.Pais {
+				residencia.NIF = nif.NumeroNIF
+				break
+			}
+		}
+		residencias = append(residencias, residencia)
+	}
+	return residencias
+}
@@ -0,0 +1,188 @@
+package layout
+
+import "encoding/xml"
+
+// Namespaces do leiaute 1.2 da e-Financeira (v1_2.go)
+const (
+	NamespaceLote       = "http://www.eFinanceira.gov.br/schemas/envioLoteEventos/v1_2_0"
+	NamespaceAbertura   = "http://www.eFinanceira.gov.br/schemas/evtAberturaeFinanceira/v1_2_1"
+	NamespaceMovimento  = "http://www.eFinanceira.gov.br/schemas/evtMovOpFin/v1_2_1"
+	NamespaceFechamento = "http://www.eFinanceira.gov.br/schemas/evtFechamentoeFinanceira/v1_2_2"
+	NamespaceExclusao   = "http://www.eFinanceira.gov.br/schemas/evtExclusaoeFinanceira/v1_2_0"
+)
+
+// EFinanceira é o elemento raiz de todos os arquivos: evento avulso, lote
+// de envio ou retorno da Receita
+type EFinanceira struct {
+	XMLName     xml.Name         `xml:"eFinanceira"`
+	Xmlns       string           `xml:"xmlns,attr,omitempty"`
+	LoteEventos *LoteEventos     `xml:"loteEventos,omitempty"`
+	Abertura    *EvtAbertura     `xml:"evtAberturaeFinanceira,omitempty"`
+	MovOpFin    *EvtMovOpFin     `xml:"evtMovOpFin,omitempty"`
+	Fechamento  *EvtFechamento   `xml:"evtFechamentoeFinanceira,omitempty"`
+	Exclusao    *EvtExclusao     `xml:"evtExclusaoeFinanceira,omitempty"`
+	RetornoLote *RetornoGenerico `xml:"retornoLoteEventos,omitempty"`
+	Retorno     *RetornoGenerico `xml:"retornoEvento,omitempty"`
+}
+
+type LoteEventos struct {
+	Eventos []EventoLote `xml:"evento"`
+}
+
+// EventoLote guarda o XML do evento sem reinterpretá-lo, preservando a
+// assinatura
+type EventoLote struct {
+	ID  string `xml:"id,attr"`
+	XML string `xml:",innerxml"`
+}
+
+type RetornoGenerico struct {
+	XML string `xml:",innerxml"`
+}
+
+type IdeEvento struct {
+	IndRetificacao int    `xml:"indRetificacao,omitempty"`
+	NrRecibo       string `xml:"nrRecibo,omitempty"`
+	TpAmb          int    `xml:"tpAmb"`
+	AplicEmi       int    `xml:"aplicEmi"`
+	VerAplic       string `xml:"verAplic"`
+}
+
+type IdeDeclarante struct {
+	CnpjDeclarante string `xml:"cnpjDeclarante"`
+}
+
+// evtAberturaeFinanceira
+type EvtAbertura struct {
+	ID               string           `xml:"id,attr"`
+	IdeEvento        IdeEvento        `xml:"ideEvento"`
+	IdeDeclarante    IdeDeclarante    `xml:"ideDeclarante"`
+	InfoAbertura     InfoPeriodo      `xml:"infoAbertura"`
+	AberturaMovOpFin AberturaMovOpFin `xml:"AberturaMovOpFin"`
+}
+
+type InfoPeriodo struct {
+	DtInicio    string `xml:"dtInicio"`
+	DtFim       string `xml:"dtFim"`
+	SitEspecial string `xml:"sitEspecial,omitempty"`
+}
+
+type AberturaMovOpFin struct {
+	ResponsavelRMF Responsavel `xml:"ResponsavelRMF"`
+	RespeFin       Responsavel `xml:"RespeFin"`
+	RepresLegal    Responsavel `xml:"RepresLegal"`
+}
+
+type Responsavel struct {
+	CPF      string `xml:"CPF"`
+	Nome     string `xml:"Nome,omitempty"`
+	Setor    string `xml:"Setor,omitempty"`
+	Telefone string `xml:"Telefone,omitempty"`
+	Email    string `xml:"Email,omitempty"`
+}
+
+// evtMovOpFin
+type EvtMovOpFin struct {
+	ID            string        `xml:"id,attr"`
+	IdeEvento     IdeEvento     `xml:"ideEvento"`
+	IdeDeclarante IdeDeclarante `xml:"ideDeclarante"`
+	IdeDeclarado  IdeDeclarado  `xml:"ideDeclarado"`
+	MesCaixa      []MesCaixa    `xml:"mesCaixa"`
+}
+
+type IdeDeclarado struct {
+	TpNI              string          `xml:"tpNI"`
+	NIDeclarado       string          `xml:"NIDeclarado"`
+	NIF               []NIF           `xml:"NIF,omitempty"`
+	NomeDeclarado     string          `xml:"NomeDeclarado"`
+	EnderecoLivre     string          `xml:"EnderecoLivre,omitempty"`
+	PaisEndereco      Pais            `xml:"PaisEndereco"`
+	PaisResid         []Pais          `xml:"paisResid,omitempty"`
+	PaisNacionalidade string          `xml:"PaisNacionalidade,omitempty"`
+	Proprietarios     []Proprietarios `xml:"Proprietarios,omitempty"`
+}
+
+// NIF emitido por país de residência fiscal (CRS)
+type NIF struct {
+	NumeroNIF      string `xml:"NumeroNIF"`
+	PaisEmissaoNIF string `xml:"PaisEmissaoNIF"`
+}
+
+// Proprietarios são as pessoas controladoras de NFE passiva (CRS)
+type Proprietarios struct {
+	TpNI              string `xml:"tpNI,omitempty"`
+	NIProprietario    string `xml:"NIProprietario,omitempty"`
+	TpProprietario    string `xml:"tpProprietario"`
+	NIF               []NIF  `xml:"NIF,omitempty"`
+	Nome              string `xml:"Nome"`
+	EnderecoLivre     string `xml:"EnderecoLivre,omitempty"`
+	PaisEndereco      Pais   `xml:"PaisEndereco"`
+	PaisResid         []Pais `xml:"paisResid,omitempty"`
+	PaisNacionalidade string `xml:"PaisNacionalidade,omitempty"`
+	DataNasc          string `xml:"DataNasc,omitempty"`
+}
+
+type Pais struct {
+	Pais string `xml:"Pais"`
+}
+
+type MesCaixa struct {
+	AnoMesCaixa string   `xml:"anoMesCaixa"`
+	MovOpFin    MovOpFin `xml:"movOpFin"`
+}
+
+type MovOpFin struct {
+	Conta []Conta `xml:"Conta"`
+}
+
+type Conta struct {
+	InfoConta InfoConta `xml:"infoConta"`
+}
+
+type InfoConta struct {
+	TpConta             string       `xml:"tpConta"`
+	NumConta            string       `xml:"numConta"`
+	TpRelacaoDeclarado  string       `xml:"tpRelacaoDeclarado,omitempty"`
+	NoTitulares         int          `xml:"NoTitulares,omitempty"`
+	Moeda               string       `xml:"Moeda,omitempty"`
+	DtAberturaConta     string       `xml:"dtAberturaConta,omitempty"`
+	DtEncerramentoConta string       `xml:"dtEncerramentoConta,omitempty"`
+	BalancoConta        BalancoConta `xml:"BalancoConta"`
+}
+
+type BalancoConta struct {
+	TotCreditos string `xml:"totCreditos"`
+	TotDebitos  string `xml:"totDebitos"`
+	VlrUltDia   string `xml:"vlrUltDia,omitempty"`
+}
+
+// evtFechamentoeFinanceira
+type EvtFechamento struct {
+	ID             string        `xml:"id,attr"`
+	IdeEvento      IdeEvento     `xml:"ideEvento"`
+	IdeDeclarante  IdeDeclarante `xml:"ideDeclarante"`
+	InfoFechamento InfoPeriodo   `xml:"infoFechamento"`
+	// Totais dos movimentos enviados no período
+	FechamentoMovOpFin *FechamentoMovOpFin `xml:"FechamentoMovOpFin,omitempty"`
+}
+
+type FechamentoMovOpFin struct {
+	FechamentoMes []FechamentoMes `xml:"FechamentoMes"`
+}
+
+type FechamentoMes struct {
+	AnoMesCaixa   string `xml:"anoMesCaixa"`
+	QuantArqTrans int    `xml:"quantArqTrans"`
+}
+
+// evtExclusaoeFinanceira
+type EvtExclusao struct {
+	ID            string        `xml:"id,attr"`
+	IdeEvento     IdeEvento     `xml:"ideEvento"`
+	IdeDeclarante IdeDeclarante `xml:"ideDeclarante"`
+	InfoExclusao  InfoExclusao  `xml:"infoExclusao"`
+}
+
+type InfoExclusao struct {
+	NrReciboEvento string `xml:"nrReciboEvento"`
+}
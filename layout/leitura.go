@@ -0,0 +1,132 @@
+package layout
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"sped-efinanceira/models"
+)
+
+// ConteudoArquivo reúne o que foi encontrado em um arquivo XML: eventos
+// (avulsos ou dentro de um lote) e recibos e ocorrências de retornos da
+// Receita, indexados pelo ID do evento
+type ConteudoArquivo struct {
+	Eventos     []EventoLido
+	Recibos     map[string]string
+	Ocorrencias map[string][]models.Ocorrencia
+}
+
+type EventoLido struct {
+	Raiz *EFinanceira
+	XML  string
+}
+
+// LerArquivo interpreta um arquivo de evento assinado ou não, um lote de
+// envio ou um retorno de processamento
+func LerArquivo(dados []byte) (*ConteudoArquivo, error) {
+	var raiz EFinanceira
+	if err := xml.Unmarshal(dados, &raiz); err != nil {
+		return nil, fmt.Errorf("XML inválido: %v", err)
+	}
+
+	conteudo := &ConteudoArquivo{
+		Recibos:     make(map[string]string),
+		Ocorrencias: make(map[string][]models.Ocorrencia),
+	}
+
+	switch {
+	case raiz.LoteEventos != nil:
+		for _, evento := range raiz.LoteEventos.Eventos {
+			var interno EFinanceira
+			if err := xml.Unmarshal([]byte(evento.XML), &interno); err != nil {
+				return nil, fmt.Errorf("evento %s do lote inválido: %v", evento.ID, err)
+			}
+			conteudo.Eventos = append(conteudo.Eventos, EventoLido{
+				Raiz: &interno,
+				XML:  strings.TrimSpace(evento.XML),
+			})
+		}
+
+	case raiz.RetornoLote != nil, raiz.Retorno != nil:
+		if err := lerRetorno(dados, conteudo); err != nil {
+			return nil, err
+		}
+
+	case raiz.Abertura != nil, raiz.MovOpFin != nil, raiz.Fechamento != nil, raiz.Exclusao != nil:
+		conteudo.Eventos = append(conteudo.Eventos, EventoLido{
+			Raiz: &raiz,
+			XML:  strings.TrimSpace(string(dados)),
+		})
+
+	default:
+		return nil, fmt.Errorf("estrutura do arquivo não reconhecida")
+	}
+
+	return conteudo, nil
+}
+
+type ocorrenciaRetorno struct {
+	Tipo        int    `xml:"tipo"`
+	Localizacao string `xml:"localizacaoErroAviso"`
+	Codigo      string `xml:"codigo"`
+	Descricao   string `xml:"descricao"`
+}
+
+// Percorre o retorno associando cada numeroRecibo e cada ocorrência ao ID do
+// evento em que aparece (atributo id de evento ou retornoEvento)
+func lerRetorno(dados []byte, conteudo *ConteudoArquivo) error {
+	decoder := xml.NewDecoder(bytes.NewReader(dados))
+
+	var idAtual string
+	var dentroRecibo bool
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("XML de retorno inválido: %v", err)
+		}
+
+		switch elemento := token.(type) {
+		case xml.StartElement:
+			if elemento.Name.Local == "evento" || elemento.Name.Local == "retornoEvento" {
+				for _, atributo := range elemento.Attr {
+					if atributo.Name.Local == "id" {
+						idAtual = atributo.Value
+					}
+				}
+			}
+			if elemento.Name.Local == "ocorrencia" && idAtual != "" {
+				var lida ocorrenciaRetorno
+				if err := decoder.DecodeElement(&lida, &elemento); err != nil {
+					return fmt.Errorf("ocorrência do evento %s inválida: %v", idAtual, err)
+				}
+				conteudo.Ocorrencias[idAtual] = append(conteudo.Ocorrencias[idAtual], models.Ocorrencia{
+					Tipo:        lida.Tipo,
+					Localizacao: strings.TrimSpace(lida.Localizacao),
+					Codigo:      strings.TrimSpace(lida.Codigo),
+					Descricao:   strings.TrimSpace(lida.Descricao),
+				})
+				continue
+			}
+			dentroRecibo = elemento.Name.Local == "numeroRecibo"
+
+		case xml.CharData:
+			if dentroRecibo && idAtual != "" {
+				recibo := strings.TrimSpace(string(elemento))
+				if recibo != "" {
+					conteudo.Recibos[idAtual] = recibo
+				}
+			}
+
+		case xml.EndElement:
+			dentroRecibo = false
+		}
+	}
+
+	return nil
+}
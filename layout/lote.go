@@ -0,0 +1,70 @@
+package layout
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+)
+
+// Quantidade máxima de eventos em um lote de envio
+const MaximoEventosLote = 100
+
+// EventoXML é um evento já convertido (e, quando for o caso, assinado)
+type EventoXML struct {
+	ID  string
+	XML []byte
+}
+
+// MontarLotes distribui os eventos em lotes de envio da versão, na ordem
+// recebida. O XML de cada evento entra sem alterações, preservando a
+// assinatura.
+func (v *Versao) MontarLotes(eventos []EventoXML) ([][]byte, error) {
+	var lotes [][]byte
+	for inicio := 0; inicio < len(eventos); inicio += MaximoEventosLote {
+		fim := inicio + MaximoEventosLote
+		if fim > len(eventos) {
+			fim = len(eventos)
+		}
+
+		lote, err := montarLote(v.NamespaceLote, eventos[inicio:fim])
+		if err != nil {
+			return nil, err
+		}
+		lotes = append(lotes, lote)
+	}
+	return lotes, nil
+}
+
+func montarLote(namespace string, eventos []EventoXML) ([]byte, error) {
+	raiz := EFinanceira{
+		Xmlns:       namespace,
+		LoteEventos: &LoteEventos{},
+	}
+	for _, evento := range eventos {
+		if evento.ID == "" {
+			return nil, fmt.Errorf("evento sem identificador no lote")
+		}
+		raiz.LoteEventos.Eventos = append(raiz.LoteEventos.Eventos, EventoLote{
+			ID:  evento.ID,
+			XML: string(bytes.TrimSpace(removerDeclaracao(evento.XML))),
+		})
+	}
+
+	conteudo, err := xml.Marshal(raiz)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), conteudo...), nil
+}
+
+// Remove a declaração <?xml ...?> do evento, que não pode aparecer dentro
+// do lote
+func removerDeclaracao(dados []byte) []byte {
+	dados = bytes.TrimSpace(dados)
+	if bytes.HasPrefix(dados, []byte("<?xml")) {
+		if fim := bytes.Index(dados, []byte("?>")); fim >= 0 {
+			return dados[fim+2:]
+		}
+	}
+	return dados
+}
@@ -0,0 +1,45 @@
+package layout
+
+import (
+	"encoding/xml"
+
+	"sped-efinanceira/eventos"
+	"sped-efinanceira/models"
+)
+
+// Leiaute 1.2: a estrutura de estrutura.go com os namespaces abaixo
+func init() {
+	namespaces := map[string]string{
+		eventos.TipoAbertura:   NamespaceAbertura,
+		eventos.TipoMovimento:  NamespaceMovimento,
+		eventos.TipoFechamento: NamespaceFechamento,
+		eventos.TipoExclusao:   NamespaceExclusao,
+	}
+
+	RegistrarVersao(&Versao{
+		Codigo:        "v1_2",
+		Descricao:     "Leiaute 1.2: abertura e movimento v1_2_1, fechamento v1_2_2, exclusão e lote v1_2_0",
+		NamespaceLote: NamespaceLote,
+		Namespaces:    namespaces,
+		Esquemas: map[string]string{
+			eventos.TipoAbertura:   "evtAberturaeFinanceira-v1_2_1.xsd",
+			eventos.TipoMovimento:  "evtMovOpFin-v1_2_1.xsd",
+			eventos.TipoFechamento: "evtFechamentoeFinanceira-v1_2_2.xsd",
+			eventos.TipoExclusao:   "evtExclusaoeFinanceira-v1_2_0.xsd",
+		},
+		Gerador: GeradorEstrutura1_2(namespaces),
+	})
+}
+
+// GeradorEstrutura1_2 gera os eventos na estrutura do leiaute 1.2 com os
+// namespaces informados. Versões que só trocam namespaces reaproveitam este
+// gerador; as que mudam campos trazem estrutura e gerador próprios.
+func GeradorEstrutura1_2(namespaces map[string]string) Gerador {
+	return func(evento *models.Evento, tpAmb int) ([]byte, error) {
+		raiz, err := paraXML(evento, tpAmb, namespaces)
+		if err != nil {
+			return nil, err
+		}
+		return xml.Marshal(raiz)
+	}
+}
@@ -0,0 +1,99 @@
+package layout
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"sped-efinanceira/models"
+)
+
+// Gerador converte o evento no XML de uma versão do leiaute, ainda sem
+// assinatura
+type Gerador func(evento *models.Evento, tpAmb int) ([]byte, error)
+
+// Versao é um pacote de leiautes publicado pela Receita: namespaces e
+// esquemas de cada evento e o gerador que monta o XML nessa estrutura. Cada
+// versão se registra no próprio arquivo (v1_2.go, ...); publicar uma nova não
+// altera as anteriores, que continuam disponíveis para retificar períodos
+// passados.
+type Versao struct {
+	Codigo    string `json:"codigo"`
+	Descricao string `json:"descricao"`
+	// Primeiro período (AAAA-S) em que a versão é a padrão; vazio para a
+	// versão inicial
+	VigenteDesde  string            `json:"vigente_desde,omitempty"`
+	NamespaceLote string            `json:"namespace_lote"`
+	Namespaces    map[string]string `json:"namespaces"`
+	Esquemas      map[string]string `json:"esquemas"`
+	Gerador       Gerador           `json:"-"`
+}
+
+var versoes = make(map[string]*Versao)
+
+// RegistrarVersao inclui a versão no registro; chamada no init do arquivo da
+// versão, por isso um registro inconsistente interrompe a inicialização
+func RegistrarVersao(versao *Versao) {
+	if versao.Codigo == "" || versao.Gerador == nil {
+		panic("layout: versão sem código ou sem gerador")
+	}
+	if _, existe := versoes[versao.Codigo]; existe {
+		panic(fmt.Sprintf("layout: versão %s registrada duas vezes", versao.Codigo))
+	}
+	versoes[versao.Codigo] = versao
+}
+
+// Versoes lista as versões registradas, da mais antiga à mais recente
+func Versoes() []*Versao {
+	lista := make([]*Versao, 0, len(versoes))
+	for _, versao := range versoes {
+		lista = append(lista, versao)
+	}
+	sort.Slice(lista, func(i, j int) bool {
+		if lista[i].VigenteDesde != lista[j].VigenteDesde {
+			return lista[i].VigenteDesde < lista[j].VigenteDesde
+		}
+		return lista[i].Codigo < lista[j].Codigo
+	})
+	return lista
+}
+
+// BuscarVersao devolve a versão registrada com o código informado
+func BuscarVersao(codigo string) (*Versao, error) {
+	versao, ok := versoes[codigo]
+	if !ok {
+		var codigos []string
+		for _, registrada := range Versoes() {
+			codigos = append(codigos, registrada.Codigo)
+		}
+		return nil, fmt.Errorf("versão de leiaute '%s' desconhecida; use %s", codigo, strings.Join(codigos, ", "))
+	}
+	return versao, nil
+}
+
+// VersaoPara escolhe a versão do período: a definida para o declarante,
+// quando houver, ou a mais recente vigente no período
+func VersaoPara(codigo, periodo string) (*Versao, error) {
+	if codigo != "" {
+		return BuscarVersao(codigo)
+	}
+
+	var escolhida *Versao
+	for _, versao := range Versoes() {
+		if escolhida == nil || versao.VigenteDesde <= periodo {
+			escolhida = versao
+		}
+	}
+	if escolhida == nil {
+		return nil, fmt.Errorf("nenhuma versão de leiaute registrada")
+	}
+	return escolhida, nil
+}
+
+// GerarXML monta o XML do evento nesta versão, ainda sem assinatura
+func (v *Versao) GerarXML(evento *models.Evento, tpAmb int) ([]byte, error) {
+	if _, ok := v.Namespaces[evento.Tipo]; !ok {
+		return nil, fmt.Errorf("tipo de evento '%s' não suportado na versão %s", evento.Tipo, v.Codigo)
+	}
+	return v.Gerador(evento, tpAmb)
+}
@@ -0,0 +1,58 @@
+package layout
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// ValidarXSD valida o XML do evento contra o esquema oficial da versão,
+// na pasta EFINANCEIRA_XSD_DIR, usando o xmllint. Devolve as violações
+// encontradas; o erro indica que a validação não pôde ser feita (xmllint ou
+// esquema ausentes).
+func (v *Versao) ValidarXSD(tipo string, conteudo []byte) ([]string, error) {
+	pasta := os.Getenv("EFINANCEIRA_XSD_DIR")
+	if pasta == "" {
+		return nil, fmt.Errorf("a variável EFINANCEIRA_XSD_DIR não está definida")
+	}
+
+	arquivo, ok := v.Esquemas[tipo]
+	if !ok {
+		return nil, fmt.Errorf("sem esquema XSD para o evento '%s' na versão %s", tipo, v.Codigo)
+	}
+	esquema := filepath.Join(pasta, arquivo)
+	if _, err := os.Stat(esquema); err != nil {
+		return nil, fmt.Errorf("esquema %s não encontrado", esquema)
+	}
+
+	var saida bytes.Buffer
+	comando := exec.Command("xmllint", "--noout", "--schema", esquema, "-")
+	comando.Stdin = bytes.NewReader(conteudo)
+	comando.Stderr = &saida
+
+	err := comando.Run()
+	if err == nil {
+		return nil, nil
+	}
+
+	// Código 3 é XML fora do esquema; os demais, falha do próprio xmllint
+	var falha *exec.ExitError
+	if !errors.As(err, &falha) || falha.ExitCode() != 3 {
+		return nil, fmt.Errorf("xmllint: %v %s", err, strings.TrimSpace(saida.String()))
+	}
+
+	var violacoes []string
+	for _, linha := range strings.Split(saida.String(), "\n") {
+		if i := strings.Index(linha, "Schemas validity error : "); i >= 0 {
+			violacoes = append(violacoes, strings.TrimSpace(linha[i+len("Schemas validity error : "):]))
+		}
+	}
+	if len(violacoes) == 0 {
+		violacoes = append(violacoes, strings.TrimSpace(saida.String()))
+	}
+	return violacoes, nil
+}
@@ -7,8 +7,11 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"sped-efinanceira/calendario"
 	"sped-efinanceira/database"
 	"sped-efinanceira/database/seeders"
+	"sped-efinanceira/importacao"
+	"sped-efinanceira/repositories"
 	"sped-efinanceira/routes"
 	"time"
 
@@ -80,13 +83,69 @@ func main() {
 	seeders.SeedUsuarios(&usuarioRepo, &perfilRepo)
 
 	// Cria um roteador principal com Mux
-	router := routes.ConfiguraRotas(client)
+	router, processadorTransacoes := routes.ConfiguraRotas(client)
+
+	// Monitora a pasta de entrada de arquivos, quando configurada. Usa o mesmo
+	// processador de transações das rotas, para que uma importação pendente
+	// nunca seja processada duas vezes ao mesmo tempo.
+	if os.Getenv("PASTA_ENTRADA") != "" {
+		eventoRepo, err := repositories.NovoEventoRepositorio(dbURL, dbName)
+		if err != nil {
+			log.Fatal("Erro ao conectar ao repositório de eventos:", err)
+		}
+
+		importacaoRepo, err := repositories.NovoImportacaoRepositorio(dbURL, dbName)
+		if err != nil {
+			log.Fatal("Erro ao conectar ao repositório de importações:", err)
+		}
+
+		titularRepo, err := repositories.NovoTitularRepositorio(dbURL, dbName)
+		if err != nil {
+			log.Fatal("Erro ao conectar ao repositório de titulares:", err)
+		}
+
+		periodoRepo, err := repositories.NovoPeriodoRepositorio(dbURL, dbName)
+		if err != nil {
+			log.Fatal("Erro ao conectar ao repositório de períodos:", err)
+		}
+
+		monitor, err := importacao.NovoMonitorPasta(eventoRepo, importacaoRepo, titularRepo, periodoRepo, processadorTransacoes)
+		if err != nil {
+			log.Fatalf("Erro ao configurar o monitor da pasta de entrada: %v", err)
+		}
+		go monitor.Iniciar()
+	}
+
+	// Lembretes de prazos por e-mail, quando configurados
+	if os.Getenv("CALENDARIO_EMAIL") != "" {
+		eventoRepo, err := repositories.NovoEventoRepositorio(dbURL, dbName)
+		if err != nil {
+			log.Fatal("Erro ao conectar ao repositório de eventos:", err)
+		}
+
+		periodoRepo, err := repositories.NovoPeriodoRepositorio(dbURL, dbName)
+		if err != nil {
+			log.Fatal("Erro ao conectar ao repositório de períodos:", err)
+		}
+
+		lembreteRepo, err := repositories.NovoLembreteRepositorio(dbURL, dbName)
+		if err != nil {
+			log.Fatal("Erro ao conectar ao repositório de lembretes:", err)
+		}
+
+		lembretes, err := calendario.NovoLembretes(eventoRepo, periodoRepo, lembreteRepo)
+		if err != nil {
+			log.Fatalf("Erro ao configurar os lembretes de prazos: %v", err)
+		}
+		go lembretes.Iniciar()
+	}
 
 	// Configuração personalizada do CORS
 	cors := handlers.CORS(
 		handlers.AllowedOrigins([]string{"*"}),
 		handlers.AllowedMethods([]string{"GET", "POST", "PUT", "DELETE"}),
-		handlers.AllowedHeaders([]string{"Content-Type", "Authorization"}),
+		handlers.AllowedHeaders([]string{"Content-Type", "Authorization", "Idempotency-Key"}),
+		handlers.ExposedHeaders([]string{"Idempotent-Replayed"}),
 	)
 
 	// Obtém o IP local
@@ -1,6 +1,7 @@
 package middlewares
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"strings"
@@ -39,6 +40,12 @@ func AutenticarMiddleware(next http.Handler) http.Handler {
 		}
 
 		if token.Valid {
+			// Disponibiliza o usuário logado para os controllers
+			if claims, ok := token.Claims.(jwt.MapClaims); ok {
+				if usuario, ok := claims["sub"].(string); ok {
+					r = r.WithContext(context.WithValue(r.Context(), chaveUsuario{}, usuario))
+				}
+			}
 			next.ServeHTTP(w, r)
 		} else {
 			http.Error(w, "Token de autenticação inválido", http.StatusUnauthorized)
@@ -46,3 +53,11 @@ func AutenticarMiddleware(next http.Handler) http.Handler {
 		}
 	})
 }
+
+type chaveUsuario struct{}
+
+// UsuarioLogado retorna o ID do usuário autenticado na requisição
+func UsuarioLogado(r *http.Request) string {
+	usuario, _ := r.Context().Value(chaveUsuario{}).(string)
+	return usuario
+}
@@ -0,0 +1,304 @@
+package middlewares
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"sped-efinanceira/common"
+	"sped-efinanceira/models"
+	"sped-efinanceira/repositories"
+)
+
+const (
+	cabecalhoIdempotencia = "Idempotency-Key"
+	tamanhoMaximoChave    = 255
+
+	// Respostas maiores (ZIP de lotes, por exemplo) não são guardadas: a
+	// repetição do pedido recebe só o status original
+	tamanhoMaximoResposta = 8 << 20
+
+	// Corpos que não são multipart ficam em memória até o handler lê-los
+	tamanhoMaximoPedido = 8 << 20
+)
+
+var errPedidoGrande = errors.New("pedido maior que o permitido")
+
+// Cabeçalhos da resposta guardados junto com o corpo
+var cabecalhosRepetidos = []string{"Content-Type", "Content-Disposition", "Location"}
+
+type IdempotenciaMiddleware struct {
+	repo *repositories.IdempotenciaRepositorio
+}
+
+func NovoIdempotenciaMiddleware(repo *repositories.IdempotenciaRepositorio) *IdempotenciaMiddleware {
+	return &IdempotenciaMiddleware{repo: repo}
+}
+
+// Middleware trata o cabeçalho Idempotency-Key dos POST: o primeiro pedido
+// com a chave é processado e a resposta guardada; repetições com o mesmo
+// corpo recebem a resposta original e, com outro corpo, 409. Deve rodar
+// depois da autenticação, porque as chaves são separadas por usuário.
+func (im *IdempotenciaMiddleware) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		chave := r.Header.Get(cabecalhoIdempotencia)
+		if r.Method != http.MethodPost || chave == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(chave) > tamanhoMaximoChave {
+			responderErroIdempotencia(w, http.StatusBadRequest, "Idempotency-Key inválida!", "A chave deve ter no máximo 255 caracteres.")
+			return
+		}
+
+		// O hash cobre rota, parâmetros e corpo do pedido
+		hash := sha256.New()
+		io.WriteString(hash, r.Method+" "+r.URL.RequestURI()+"\n")
+
+		corpo, err := copiarCorpo(r, hash)
+		if err == errPedidoGrande {
+			responderErroIdempotencia(w, http.StatusRequestEntityTooLarge, "Pedido grande demais!", "Pedidos com Idempotency-Key sem multipart devem ter no máximo 8 MB.")
+			return
+		}
+		if err != nil {
+			responderErroIdempotencia(w, http.StatusBadRequest, "Pedido inválido!", err.Error())
+			return
+		}
+		defer corpo.Close()
+		r.Body = corpo
+
+		usuario := UsuarioLogado(r)
+		registro := &models.RespostaIdempotente{
+			ID:         usuario + ":" + chave,
+			Usuario:    usuario,
+			Chave:      chave,
+			Rota:       r.URL.Path,
+			HashPedido: hex.EncodeToString(hash.Sum(nil)),
+		}
+
+		reservada, err := im.repo.Reservar(registro)
+		if err != nil {
+			responderErroIdempotencia(w, http.StatusInternalServerError, "Falha ao registrar Idempotency-Key!", err.Error())
+			return
+		}
+		if !reservada {
+			im.repetir(w, registro)
+			return
+		}
+
+		// Se o handler entrar em pânico, a chave é liberada para que o pedido
+		// possa ser repetido; enquanto ele roda, a reserva é renovada
+		defer func() {
+			if erro := recover(); erro != nil {
+				im.repo.Liberar(registro.ID)
+				panic(erro)
+			}
+		}()
+		terminou := make(chan struct{})
+		defer close(terminou)
+		go im.renovarReserva(registro.ID, terminou)
+
+		gravador := &gravadorResposta{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(gravador, r)
+
+		// Falhas do servidor não são guardadas: o pedido pode ser repetido
+		if gravador.status >= http.StatusInternalServerError {
+			im.repo.Liberar(registro.ID)
+			return
+		}
+
+		// Respostas grandes demais (ZIP de lotes, por exemplo) não são
+		// guardadas, mas o pedido fica registrado como concluído para não ser
+		// processado de novo
+		if gravador.excedeu {
+			if err := im.repo.RegistrarConclusao(registro.ID, gravador.status); err != nil {
+				log.Println("Erro ao registrar a conclusão da Idempotency-Key:", err)
+				im.repo.Liberar(registro.ID)
+			}
+			return
+		}
+
+		cabecalhos := make(map[string]string)
+		for _, nome := range cabecalhosRepetidos {
+			if valor := gravador.Header().Get(nome); valor != "" {
+				cabecalhos[nome] = valor
+			}
+		}
+		if err := im.repo.RegistrarResposta(registro.ID, gravador.status, cabecalhos, gravador.corpo.Bytes()); err != nil {
+			log.Println("Erro ao guardar a resposta da Idempotency-Key:", err)
+			im.repo.Liberar(registro.ID)
+		}
+	})
+}
+
+// Renova a reserva da chave até o pedido terminar
+func (im *IdempotenciaMiddleware) renovarReserva(id string, terminou <-chan struct{}) {
+	ticker := time.NewTicker(repositories.PrazoReservaIdempotencia / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-terminou:
+			return
+		case <-ticker.C:
+			if err := im.repo.RenovarReserva(id); err != nil {
+				log.Println("Erro ao renovar a reserva da Idempotency-Key:", err)
+			}
+		}
+	}
+}
+
+// Responde à repetição de um pedido com a chave já usada
+func (im *IdempotenciaMiddleware) repetir(w http.ResponseWriter, pedido *models.RespostaIdempotente) {
+	original, err := im.repo.BuscarChave(pedido.ID)
+	if err != nil {
+		responderErroIdempotencia(w, http.StatusInternalServerError, "Falha ao consultar Idempotency-Key!", err.Error())
+		return
+	}
+	if original == nil {
+		// Liberada entre a reserva e a consulta: o cliente pode tentar de novo
+		responderErroIdempotencia(w, http.StatusConflict, "Pedido em processamento!", "O pedido original com esta Idempotency-Key não terminou; tente novamente.")
+		return
+	}
+
+	if original.HashPedido != pedido.HashPedido {
+		responderErroIdempotencia(w, http.StatusConflict, "Idempotency-Key reutilizada!", "A chave já foi usada com um pedido diferente.")
+		return
+	}
+	if !original.Concluida {
+		responderErroIdempotencia(w, http.StatusConflict, "Pedido em processamento!", "O pedido original com esta Idempotency-Key ainda está em processamento.")
+		return
+	}
+
+	w.Header().Set("Idempotent-Replayed", "true")
+	if original.CorpoOmitido {
+		responderErroIdempotencia(w, original.Status, "Pedido já processado!", "O pedido original com esta Idempotency-Key já foi processado; a resposta era grande demais para ser guardada.")
+		return
+	}
+
+	for nome, valor := range original.Cabecalhos {
+		w.Header().Set(nome, valor)
+	}
+	w.WriteHeader(original.Status)
+	w.Write(original.Corpo)
+}
+
+// Lê o corpo do pedido calculando o hash e devolve uma cópia para o handler.
+// Uploads multipart são copiados para um arquivo temporário enquanto chegam,
+// sem ficar em memória, e o hash cobre o nome, o arquivo e o conteúdo de cada
+// parte em vez do texto cru: o boundary muda a cada envio do mesmo
+// formulário. Os demais corpos ficam em memória, até tamanhoMaximoPedido.
+func copiarCorpo(r *http.Request, hash io.Writer) (io.ReadCloser, error) {
+	tipo, parametros, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if !strings.HasPrefix(tipo, "multipart/") || parametros["boundary"] == "" {
+		var corpo bytes.Buffer
+		lidos, err := io.Copy(hash, io.TeeReader(io.LimitReader(r.Body, tamanhoMaximoPedido+1), &corpo))
+		if err != nil {
+			return nil, err
+		}
+		if lidos > tamanhoMaximoPedido {
+			return nil, errPedidoGrande
+		}
+		return io.NopCloser(&corpo), nil
+	}
+
+	arquivo, err := os.CreateTemp("", "idempotencia_*")
+	if err != nil {
+		return nil, err
+	}
+	temporario := &arquivoTemporario{arquivo}
+
+	leitor := io.TeeReader(r.Body, arquivo)
+	err = hashMultipart(multipart.NewReader(leitor, parametros["boundary"]), hash)
+	if err == nil {
+		// O que vier depois do último boundary também vai para a cópia
+		_, err = io.Copy(io.Discard, leitor)
+	}
+	if err == nil {
+		_, err = arquivo.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		temporario.Close()
+		return nil, err
+	}
+	return temporario, nil
+}
+
+func hashMultipart(leitor *multipart.Reader, hash io.Writer) error {
+	for {
+		parte, err := leitor.NextPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// Tamanho antes do conteúdo, para que partes vizinhas não se confundam
+		conteudo := sha256.New()
+		tamanho, err := io.Copy(conteudo, parte)
+		parte.Close()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(hash, "%q %q %d %x\n", parte.FormName(), parte.FileName(), tamanho, conteudo.Sum(nil))
+	}
+}
+
+// arquivoTemporario é removido ao ser fechado
+type arquivoTemporario struct {
+	*os.File
+}
+
+func (a *arquivoTemporario) Close() error {
+	err := a.File.Close()
+	os.Remove(a.File.Name())
+	return err
+}
+
+func responderErroIdempotencia(w http.ResponseWriter, status int, erro, mensagem string) {
+	RespostaComErro := common.RespostaComErro{
+		Error:   erro,
+		Message: mensagem,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(RespostaComErro)
+}
+
+// gravadorResposta repassa a resposta ao cliente e guarda uma cópia
+type gravadorResposta struct {
+	http.ResponseWriter
+	status  int
+	corpo   bytes.Buffer
+	excedeu bool
+}
+
+func (g *gravadorResposta) WriteHeader(status int) {
+	g.status = status
+	g.ResponseWriter.WriteHeader(status)
+}
+
+func (g *gravadorResposta) Write(dados []byte) (int, error) {
+	if !g.excedeu {
+		if g.corpo.Len()+len(dados) > tamanhoMaximoResposta {
+			g.excedeu = true
+			g.corpo.Reset()
+		} else {
+			g.corpo.Write(dados)
+		}
+	}
+	return g.ResponseWriter.Write(dados)
+}
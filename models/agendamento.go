@@ -0,0 +1,68 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Etapas do semestre que um agendamento pode executar, na ordem em que rodam
+const (
+	EtapaImportacao  = "importacao"
+	EtapaAbertura    = "abertura"
+	EtapaMovimentos  = "movimentos"
+	EtapaFechamento  = "fechamento"
+	EtapaValidacao   = "validacao"
+	EtapaTransmissao = "transmissao"
+)
+
+// Situação das execuções e de cada etapa
+const (
+	ExecucaoPendente    = "pendente"
+	ExecucaoEmAndamento = "em_andamento"
+	ExecucaoConcluida   = "concluida"
+	ExecucaoFalhou      = "falhou"
+	ExecucaoIgnorada    = "ignorada"
+)
+
+// Agendamento executa as etapas do semestre de um declarante nos horários
+// da expressão cron (minuto, hora, dia do mês, mês e dia da semana). Sem
+// período fixo, cada execução usa o último semestre encerrado.
+type Agendamento struct {
+	ID              primitive.ObjectID `json:"id" bson:"_id"`
+	Nome            string             `json:"nome" bson:"nome" validate:"required"`
+	Declarante      string             `json:"declarante" bson:"declarante" validate:"required"`
+	Expressao       string             `json:"expressao" bson:"expressao" validate:"required"`
+	Periodo         string             `json:"periodo,omitempty" bson:"periodo,omitempty"`
+	Etapas          []string           `json:"etapas" bson:"etapas"`
+	Emails          []string           `json:"emails" bson:"emails" validate:"dive,email"`
+	Ativo           bool               `json:"ativo" bson:"ativo"`
+	ProximaExecucao *time.Time         `json:"proxima_execucao,omitempty" bson:"proxima_execucao,omitempty"`
+	UltimaExecucao  *time.Time         `json:"ultima_execucao,omitempty" bson:"ultima_execucao,omitempty"`
+	UltimaSituacao  string             `json:"ultima_situacao,omitempty" bson:"ultima_situacao,omitempty"`
+	CriadoPor       string             `json:"criado_por" bson:"criado_por"`
+	CreatedAt       time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt       time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+// ExecucaoAgendamento registra uma execução, automática ou manual, e o
+// resultado de cada etapa. A primeira falha interrompe as seguintes.
+type ExecucaoAgendamento struct {
+	ID            primitive.ObjectID `json:"id" bson:"_id"`
+	AgendamentoID primitive.ObjectID `json:"agendamento_id" bson:"agendamento_id"`
+	Declarante    string             `json:"declarante" bson:"declarante"`
+	Periodo       string             `json:"periodo" bson:"periodo"`
+	Usuario       string             `json:"usuario" bson:"usuario"`
+	Situacao      string             `json:"situacao" bson:"situacao"`
+	Etapas        []EtapaExecucao    `json:"etapas" bson:"etapas"`
+	IniciadaEm    time.Time          `json:"iniciada_em" bson:"iniciada_em"`
+	ConcluidaEm   *time.Time         `json:"concluida_em,omitempty" bson:"concluida_em,omitempty"`
+}
+
+type EtapaExecucao struct {
+	Etapa       string     `json:"etapa" bson:"etapa"`
+	Situacao    string     `json:"situacao" bson:"situacao"`
+	Mensagem    string     `json:"mensagem,omitempty" bson:"mensagem,omitempty"`
+	IniciadaEm  *time.Time `json:"iniciada_em,omitempty" bson:"iniciada_em,omitempty"`
+	ConcluidaEm *time.Time `json:"concluida_em,omitempty" bson:"concluida_em,omitempty"`
+}
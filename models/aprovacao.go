@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Situação da solicitação de aprovação
+const (
+	AprovacaoPendente  = "pendente"
+	AprovacaoAprovada  = "aprovada"
+	AprovacaoRejeitada = "rejeitada"
+)
+
+// Aprovacao é o pedido de um usuário para que outro, com perfil aprovador,
+// libere a transmissão de eventos validados. Sem EventoIDs, o pedido cobre
+// todos os eventos validados do declarante no período (o lote inteiro).
+type Aprovacao struct {
+	ID             primitive.ObjectID    `json:"id" bson:"_id"`
+	Declarante     string                `json:"declarante" bson:"declarante" validate:"required"`
+	Periodo        string                `json:"periodo" bson:"periodo" validate:"required"`
+	EventoIDs      []primitive.ObjectID  `json:"evento_ids" bson:"evento_ids"`
+	Solicitante    string                `json:"solicitante" bson:"solicitante"`
+	Comentario     string                `json:"comentario,omitempty" bson:"comentario,omitempty"`
+	Situacao       string                `json:"situacao" bson:"situacao"`
+	Aprovador      string                `json:"aprovador,omitempty" bson:"aprovador,omitempty"`
+	MotivoRejeicao string                `json:"motivo_rejeicao,omitempty" bson:"motivo_rejeicao,omitempty"`
+	Comentarios    []ComentarioAprovacao `json:"comentarios,omitempty" bson:"comentarios,omitempty"`
+	DecididaEm     *time.Time            `json:"decidida_em,omitempty" bson:"decidida_em,omitempty"`
+	CreatedAt      time.Time             `json:"created_at" bson:"created_at"`
+	UpdatedAt      time.Time             `json:"updated_at" bson:"updated_at"`
+}
+
+type ComentarioAprovacao struct {
+	Usuario string    `json:"usuario" bson:"usuario"`
+	Texto   string    `json:"texto" bson:"texto" validate:"required"`
+	Data    time.Time `json:"data" bson:"data"`
+}
+
+// DecisaoAprovacao é a resposta do aprovador; rejeições exigem o motivo
+type DecisaoAprovacao struct {
+	Acao       string `json:"acao" validate:"required,oneof=aprovar rejeitar"`
+	Comentario string `json:"comentario"`
+	Motivo     string `json:"motivo"`
+}
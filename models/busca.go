@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// FiltroBusca reúne os critérios da busca de eventos. Termo é a busca
+// textual nos eventos; NIs, Contas e TitularIDs vêm dos titulares e contas do
+// cadastro que casaram com o termo e ampliam o resultado.
+type FiltroBusca struct {
+	Declarante string
+	Periodo    string
+	Status     string
+	Tipo       string
+	Recibo     string
+	NI         string
+	Conta      string
+	Termo      string
+	NIs        []string
+	Contas     []string
+	TitularIDs []primitive.ObjectID
+}
+
+// ResultadoBusca resume um evento encontrado, com o link para o XML
+type ResultadoBusca struct {
+	ID         string    `json:"id"`
+	Tipo       string    `json:"tipo"`
+	Declarante string    `json:"declarante"`
+	Periodo    string    `json:"periodo"`
+	Status     string    `json:"status"`
+	IDEvento   string    `json:"id_evento,omitempty"`
+	Recibo     string    `json:"recibo,omitempty"`
+	NI         string    `json:"ni,omitempty"`
+	Nome       string    `json:"nome,omitempty"`
+	Contas     []string  `json:"contas,omitempty"`
+	XML        string    `json:"xml"`
+	CreatedAt  time.Time `json:"created_at"`
+}
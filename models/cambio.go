@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// Cotacao é uma linha do boletim de fechamento PTAX do Banco Central
+type Cotacao struct {
+	ID             string    `json:"id" bson:"_id"`
+	Moeda          string    `json:"moeda" bson:"moeda"`
+	CodigoMoeda    string    `json:"codigo_moeda" bson:"codigo_moeda"`
+	Tipo           string    `json:"tipo" bson:"tipo"`
+	Data           time.Time `json:"data" bson:"data"`
+	TaxaCompra     float64   `json:"taxa_compra" bson:"taxa_compra"`
+	TaxaVenda      float64   `json:"taxa_venda" bson:"taxa_venda"`
+	ParidadeCompra float64   `json:"paridade_compra" bson:"paridade_compra"`
+	ParidadeVenda  float64   `json:"paridade_venda" bson:"paridade_venda"`
+	Arquivo        string    `json:"arquivo,omitempty" bson:"arquivo,omitempty"`
+	CreatedAt      time.Time `json:"created_at" bson:"created_at"`
+}
+
+// CotacaoUtilizada registra, no mês do evento, a taxa aplicada na
+// conversão para reais e os valores na moeda original da conta
+type CotacaoUtilizada struct {
+	Moeda               string    `json:"moeda" bson:"moeda"`
+	Data                time.Time `json:"data" bson:"data"`
+	Taxa                float64   `json:"taxa" bson:"taxa"`
+	TotCreditosOriginal float64   `json:"tot_creditos_original" bson:"tot_creditos_original"`
+	TotDebitosOriginal  float64   `json:"tot_debitos_original" bson:"tot_debitos_original"`
+	VlrUltDiaOriginal   float64   `json:"vlr_ult_dia_original" bson:"vlr_ult_dia_original"`
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Situação da classificação de uma conta
+const (
+	ClassificacaoPendente   = "pendente"
+	ClassificacaoConfirmada = "confirmada"
+	ClassificacaoAlterada   = "alterada"
+)
+
+// ClassificacaoConta guarda o resultado da busca de indícios FATCA/CRS de
+// uma conta. Jurisdições são os países (ISO alfa-2) para os quais a conta
+// é reportável; "US" indica FATCA. Quando o revisor altera a classificação,
+// prevalece o resultado da revisão.
+type ClassificacaoConta struct {
+	ID          primitive.ObjectID     `json:"id" bson:"_id"`
+	Declarante  string                 `json:"declarante" bson:"declarante"`
+	ContaID     primitive.ObjectID     `json:"conta_id" bson:"conta_id"`
+	NumConta    string                 `json:"num_conta" bson:"num_conta"`
+	Reportavel  bool                   `json:"reportavel" bson:"reportavel"`
+	Jurisdicoes []string               `json:"jurisdicoes" bson:"jurisdicoes"`
+	Evidencias  []Indicio              `json:"evidencias" bson:"evidencias"`
+	Situacao    string                 `json:"situacao" bson:"situacao"`
+	Revisao     *RevisaoClassificacao  `json:"revisao,omitempty" bson:"revisao,omitempty"`
+	Revisoes    []RevisaoClassificacao `json:"revisoes,omitempty" bson:"revisoes,omitempty"`
+	CalculadaEm time.Time              `json:"calculada_em" bson:"calculada_em"`
+	CreatedAt   time.Time              `json:"created_at" bson:"created_at"`
+	UpdatedAt   time.Time              `json:"updated_at" bson:"updated_at"`
+}
+
+// Indicio é uma evidência encontrada no cadastro de um participante da conta
+type Indicio struct {
+	Regra     string `json:"regra" bson:"regra"`
+	Regime    string `json:"regime" bson:"regime"`
+	NI        string `json:"ni" bson:"ni"`
+	Campo     string `json:"campo" bson:"campo"`
+	Valor     string `json:"valor" bson:"valor"`
+	Pais      string `json:"pais,omitempty" bson:"pais,omitempty"`
+	Descricao string `json:"descricao" bson:"descricao"`
+}
+
+// RevisaoClassificacao registra a confirmação ou alteração feita pelo revisor
+type RevisaoClassificacao struct {
+	Acao          string    `json:"acao" bson:"acao" validate:"required,oneof=confirmar alterar"`
+	Revisor       string    `json:"revisor" bson:"revisor" validate:"required"`
+	Reportavel    bool      `json:"reportavel" bson:"reportavel"`
+	Jurisdicoes   []string  `json:"jurisdicoes,omitempty" bson:"jurisdicoes,omitempty"`
+	Justificativa string    `json:"justificativa,omitempty" bson:"justificativa,omitempty"`
+	Data          time.Time `json:"data" bson:"data"`
+}
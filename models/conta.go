@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Papéis dos participantes de uma conta
+const (
+	PapelTitular    = "titular"
+	PapelCotitular  = "cotitular"
+	PapelProcurador = "procurador"
+)
+
+// Conta é o cadastro de uma conta do declarante, com seus participantes e
+// datas de abertura e encerramento
+type Conta struct {
+	ID             primitive.ObjectID `json:"id" bson:"_id"`
+	Declarante     string             `json:"declarante" bson:"declarante" validate:"required"`
+	NumConta       string             `json:"num_conta" bson:"num_conta" validate:"required"`
+	TpConta        string             `json:"tp_conta" bson:"tp_conta" validate:"required"`
+	Moeda          string             `json:"moeda" bson:"moeda" validate:"required,len=3"`
+	DtAbertura     time.Time          `json:"dt_abertura" bson:"dt_abertura" validate:"required"`
+	DtEncerramento *time.Time         `json:"dt_encerramento,omitempty" bson:"dt_encerramento,omitempty"`
+	Titulares      []TitularConta     `json:"titulares" bson:"titulares" validate:"required,min=1,dive"`
+	CreatedAt      time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt      time.Time          `json:"updated_at" bson:"updated_at"`
+	DeletedAt      time.Time          `json:"deleted_at" bson:"deleted_at"`
+}
+
+type TitularConta struct {
+	TitularID primitive.ObjectID `json:"titular_id" bson:"titular_id"`
+	NI        string             `json:"ni" bson:"ni" validate:"required"`
+	Papel     string             `json:"papel" bson:"papel" validate:"required,oneof=titular cotitular procurador"`
+}
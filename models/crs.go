@@ -0,0 +1,71 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Classificação da entidade declarada na autocertificação (CRS)
+const (
+	EntidadeInstituicaoFinanceira = "IF"
+	EntidadeNFEAtiva              = "NFE_ATIVA"
+	EntidadeNFEPassiva            = "NFE_PASSIVA"
+)
+
+// Situação da autocertificação
+const (
+	AutoCertificacaoVigente     = "vigente"
+	AutoCertificacaoVencida     = "vencida"
+	AutoCertificacaoSubstituida = "substituida"
+)
+
+// AutoCertificacao guarda os dados declarados pelo titular e o documento
+// assinado. A mais recente vigente substitui as anteriores.
+type AutoCertificacao struct {
+	ID           primitive.ObjectID `json:"id" bson:"_id"`
+	Declarante   string             `json:"declarante" bson:"declarante"`
+	TitularID    primitive.ObjectID `json:"titular_id" bson:"titular_id"`
+	NI           string             `json:"ni" bson:"ni"`
+	TipoEntidade string             `json:"tipo_entidade,omitempty" bson:"tipo_entidade,omitempty" validate:"omitempty,oneof=IF NFE_ATIVA NFE_PASSIVA"`
+	Residencias  []ResidenciaFiscal `json:"residencias" bson:"residencias" validate:"required,min=1,dive"`
+	DtAssinatura time.Time          `json:"dt_assinatura" bson:"dt_assinatura" validate:"required"`
+	DtValidade   *time.Time         `json:"dt_validade,omitempty" bson:"dt_validade,omitempty"`
+	Arquivo      *ArquivoDocumento  `json:"arquivo,omitempty" bson:"arquivo,omitempty"`
+	Situacao     string             `json:"situacao,omitempty" bson:"-"`
+	CreatedAt    time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt    time.Time          `json:"updated_at" bson:"updated_at"`
+	DeletedAt    time.Time          `json:"deleted_at" bson:"deleted_at"`
+}
+
+type ResidenciaFiscal struct {
+	Pais         string `json:"pais" bson:"pais" validate:"required,len=2"`
+	NIF          string `json:"nif,omitempty" bson:"nif,omitempty"`
+	MotivoSemNIF string `json:"motivo_sem_nif,omitempty" bson:"motivo_sem_nif,omitempty"`
+}
+
+type ArquivoDocumento struct {
+	Nome         string `json:"nome" bson:"nome"`
+	Caminho      string `json:"-" bson:"caminho"`
+	TipoConteudo string `json:"tipo_conteudo" bson:"tipo_conteudo"`
+	Tamanho      int64  `json:"tamanho" bson:"tamanho"`
+}
+
+// PessoaControladora de uma entidade titular (NFE passiva), com o tipo de
+// controle na codificação do CRS (CRS801 a CRS813)
+type PessoaControladora struct {
+	ID            primitive.ObjectID `json:"id" bson:"_id"`
+	Declarante    string             `json:"declarante" bson:"declarante"`
+	EntidadeID    primitive.ObjectID `json:"entidade_id" bson:"entidade_id"`
+	TpControle    string             `json:"tp_controle" bson:"tp_controle" validate:"required,oneof=CRS801 CRS802 CRS803 CRS804 CRS805 CRS806 CRS807 CRS808 CRS809 CRS810 CRS811 CRS812 CRS813"`
+	NI            string             `json:"ni,omitempty" bson:"ni,omitempty"`
+	Nome          string             `json:"nome" bson:"nome" validate:"required"`
+	Endereco      string             `json:"endereco,omitempty" bson:"endereco,omitempty"`
+	PaisEndereco  string             `json:"pais_endereco" bson:"pais_endereco" validate:"required,len=2"`
+	Nacionalidade string             `json:"nacionalidade,omitempty" bson:"nacionalidade,omitempty"`
+	DtNascimento  *time.Time         `json:"dt_nascimento,omitempty" bson:"dt_nascimento,omitempty"`
+	Residencias   []ResidenciaFiscal `json:"residencias" bson:"residencias" validate:"required,min=1,dive"`
+	CreatedAt     time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt     time.Time          `json:"updated_at" bson:"updated_at"`
+	DeletedAt     time.Time          `json:"deleted_at" bson:"deleted_at"`
+}
@@ -0,0 +1,160 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Status dos eventos; as transições permitidas ficam em eventos.Transicionar
+const (
+	EventoRascunho   = "rascunho"
+	EventoValidado   = "validado"
+	EventoAprovado   = "aprovado"
+	EventoAssinado   = "assinado"
+	EventoEmLote     = "em_lote"
+	EventoEnviado    = "enviado"
+	EventoAceito     = "aceito"
+	EventoRejeitado  = "rejeitado"
+	EventoRetificado = "retificado"
+	EventoExcluido   = "excluido"
+)
+
+type Evento struct {
+	ID               primitive.ObjectID     `json:"id" bson:"_id"`
+	Tipo             string                 `json:"tipo" bson:"tipo"`
+	Declarante       string                 `json:"declarante" bson:"declarante"`
+	Periodo          string                 `json:"periodo" bson:"periodo"`
+	Status           string                 `json:"status" bson:"status"`
+	Origem           string                 `json:"origem" bson:"origem"`
+	CriadoPor        string                 `json:"criado_por,omitempty" bson:"criado_por,omitempty"`
+	IDEvento         string                 `json:"id_evento,omitempty" bson:"id_evento,omitempty"`
+	Recibo           string                 `json:"recibo,omitempty" bson:"recibo,omitempty"`
+	IndRetificacao   int                    `json:"ind_retificacao,omitempty" bson:"ind_retificacao,omitempty"`
+	NrReciboAnterior string                 `json:"nr_recibo_anterior,omitempty" bson:"nr_recibo_anterior,omitempty"`
+	XML              string                 `json:"-" bson:"xml,omitempty"`
+	HashAprovado     string                 `json:"hash_aprovado,omitempty" bson:"hash_aprovado,omitempty"`
+	Abertura         *AberturaeFinanceira   `json:"abertura,omitempty" bson:"abertura,omitempty"`
+	Movimento        *MovimentoOpFin        `json:"movimento,omitempty" bson:"movimento,omitempty"`
+	Fechamento       *FechamentoeFinanceira `json:"fechamento,omitempty" bson:"fechamento,omitempty"`
+	Exclusao         *ExclusaoeFinanceira   `json:"exclusao,omitempty" bson:"exclusao,omitempty"`
+	Ocorrencias      []Ocorrencia           `json:"ocorrencias,omitempty" bson:"ocorrencias,omitempty"`
+	Historico        []TransicaoStatus      `json:"historico,omitempty" bson:"historico,omitempty"`
+	CreatedAt        time.Time              `json:"created_at" bson:"created_at"`
+	UpdatedAt        time.Time              `json:"updated_at" bson:"updated_at"`
+	DeletedAt        time.Time              `json:"deleted_at" bson:"deleted_at"`
+}
+
+// TransicaoStatus registra quem mudou o status do evento e quando
+type TransicaoStatus struct {
+	De      string    `json:"de" bson:"de"`
+	Para    string    `json:"para" bson:"para"`
+	Usuario string    `json:"usuario" bson:"usuario"`
+	Motivo  string    `json:"motivo,omitempty" bson:"motivo,omitempty"`
+	Data    time.Time `json:"data" bson:"data"`
+}
+
+// AceiteExclusoes escolhe os recibos das exclusões sugeridas a criar
+type AceiteExclusoes struct {
+	Recibos []string `json:"recibos"`
+}
+
+// AlteracaoStatus é o pedido de mudança manual de status
+type AlteracaoStatus struct {
+	Status string `json:"status" validate:"required"`
+	Motivo string `json:"motivo"`
+}
+
+// evtAberturaeFinanceira
+type AberturaeFinanceira struct {
+	DtInicio       time.Time   `json:"dt_inicio" bson:"dt_inicio"`
+	DtFim          time.Time   `json:"dt_fim" bson:"dt_fim"`
+	ResponsavelRMF Responsavel `json:"responsavel_rmf" bson:"responsavel_rmf"`
+	RespeFin       Responsavel `json:"resp_efin" bson:"resp_efin"`
+	RepresLegal    Responsavel `json:"repres_legal" bson:"repres_legal"`
+}
+
+type Responsavel struct {
+	CPF      string `json:"cpf" bson:"cpf"`
+	Nome     string `json:"nome" bson:"nome"`
+	Setor    string `json:"setor,omitempty" bson:"setor,omitempty"`
+	Telefone string `json:"telefone,omitempty" bson:"telefone,omitempty"`
+	Email    string `json:"email,omitempty" bson:"email,omitempty"`
+}
+
+// evtMovOpFin
+// Em rascunhos, Declarado guarda apenas o documento e os demais dados vêm do
+// cadastro de titulares; eventos aceitos mantêm os dados enviados
+type MovimentoOpFin struct {
+	TitularID *primitive.ObjectID `json:"titular_id,omitempty" bson:"titular_id,omitempty"`
+	Declarado Declarado           `json:"declarado" bson:"declarado"`
+	Contas    []ContaMovimento    `json:"contas" bson:"contas"`
+}
+
+// Residencias e Controladores formam os blocos do CRS; vêm da
+// autocertificação vigente do titular
+type Declarado struct {
+	TpNI          string                 `json:"tp_ni" bson:"tp_ni"`
+	NI            string                 `json:"ni" bson:"ni"`
+	Nome          string                 `json:"nome" bson:"nome"`
+	Endereco      string                 `json:"endereco,omitempty" bson:"endereco,omitempty"`
+	PaisEndereco  string                 `json:"pais_endereco" bson:"pais_endereco"`
+	Nacionalidade string                 `json:"nacionalidade,omitempty" bson:"nacionalidade,omitempty"`
+	Residencias   []ResidenciaFiscal     `json:"residencias,omitempty" bson:"residencias,omitempty"`
+	Controladores []ControladorDeclarado `json:"controladores,omitempty" bson:"controladores,omitempty"`
+}
+
+type ControladorDeclarado struct {
+	TpControle    string             `json:"tp_controle" bson:"tp_controle"`
+	NI            string             `json:"ni,omitempty" bson:"ni,omitempty"`
+	Nome          string             `json:"nome" bson:"nome"`
+	Endereco      string             `json:"endereco,omitempty" bson:"endereco,omitempty"`
+	PaisEndereco  string             `json:"pais_endereco" bson:"pais_endereco"`
+	Nacionalidade string             `json:"nacionalidade,omitempty" bson:"nacionalidade,omitempty"`
+	DtNascimento  *time.Time         `json:"dt_nascimento,omitempty" bson:"dt_nascimento,omitempty"`
+	Residencias   []ResidenciaFiscal `json:"residencias,omitempty" bson:"residencias,omitempty"`
+}
+
+// As datas de abertura e encerramento só são informadas quando ocorrem
+// dentro do semestre declarado
+type ContaMovimento struct {
+	NumConta           string     `json:"num_conta" bson:"num_conta"`
+	TpConta            string     `json:"tp_conta" bson:"tp_conta"`
+	Moeda              string     `json:"moeda" bson:"moeda"`
+	TpRelacaoDeclarado string     `json:"tp_relacao_declarado,omitempty" bson:"tp_relacao_declarado,omitempty"`
+	NoTitulares        int        `json:"no_titulares,omitempty" bson:"no_titulares,omitempty"`
+	DtAbertura         *time.Time `json:"dt_abertura,omitempty" bson:"dt_abertura,omitempty"`
+	DtEncerramento     *time.Time `json:"dt_encerramento,omitempty" bson:"dt_encerramento,omitempty"`
+	AbertaNoPeriodo    bool       `json:"aberta_no_periodo" bson:"aberta_no_periodo"`
+	EncerradaNoPeriodo bool       `json:"encerrada_no_periodo" bson:"encerrada_no_periodo"`
+	Meses              []MesCaixa `json:"meses" bson:"meses"`
+}
+
+// Valores sempre em reais; em contas em moeda estrangeira, Cotacao guarda a
+// taxa usada e os valores originais
+type MesCaixa struct {
+	AnoMes      string            `json:"ano_mes" bson:"ano_mes"`
+	TotCreditos float64           `json:"tot_creditos" bson:"tot_creditos"`
+	TotDebitos  float64           `json:"tot_debitos" bson:"tot_debitos"`
+	VlrUltDia   float64           `json:"vlr_ult_dia" bson:"vlr_ult_dia"`
+	Cotacao     *CotacaoUtilizada `json:"cotacao,omitempty" bson:"cotacao,omitempty"`
+}
+
+// evtFechamentoeFinanceira. Meses traz os totais do FechamentoMovOpFin:
+// quantos eventos de movimento foram enviados para cada mês de caixa.
+type FechamentoeFinanceira struct {
+	DtInicio    time.Time       `json:"dt_inicio" bson:"dt_inicio"`
+	DtFim       time.Time       `json:"dt_fim" bson:"dt_fim"`
+	SitEspecial string          `json:"sit_especial" bson:"sit_especial"`
+	Meses       []FechamentoMes `json:"meses,omitempty" bson:"meses,omitempty"`
+}
+
+type FechamentoMes struct {
+	AnoMesCaixa   string `json:"ano_mes_caixa" bson:"ano_mes_caixa"`
+	QuantArqTrans int    `json:"quant_arq_trans" bson:"quant_arq_trans"`
+}
+
+// evtExclusaoeFinanceira
+type ExclusaoeFinanceira struct {
+	NrReciboEvento string `json:"nr_recibo_evento" bson:"nr_recibo_evento"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// RespostaIdempotente guarda o pedido feito com um Idempotency-Key e a
+// resposta dada, devolvida de novo quando o cliente repete o pedido
+type RespostaIdempotente struct {
+	ID         string            `bson:"_id"`
+	Usuario    string            `bson:"usuario"`
+	Chave      string            `bson:"chave"`
+	Rota       string            `bson:"rota"`
+	HashPedido string            `bson:"hash_pedido"`
+	Concluida  bool              `bson:"concluida"`
+	Status     int               `bson:"status,omitempty"`
+	Cabecalhos map[string]string `bson:"cabecalhos,omitempty"`
+	Corpo      []byte            `bson:"corpo,omitempty"`
+	// A resposta passou do limite e só o status foi guardado
+	CorpoOmitido bool `bson:"corpo_omitido,omitempty"`
+	// Renovada enquanto o pedido é processado; vencida, a reserva foi
+	// abandonada e o mesmo pedido pode assumi-la
+	ReservadaEm time.Time `bson:"reservada_em"`
+	CreatedAt   time.Time `bson:"created_at"`
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Status das importações
+const (
+	ImportacaoPendente    = "pendente"
+	ImportacaoProcessando = "processando"
+	ImportacaoConcluida   = "concluida"
+	ImportacaoFalhou      = "falhou"
+)
+
+type Importacao struct {
+	ID                primitive.ObjectID `json:"id" bson:"_id"`
+	Tipo              string             `json:"tipo" bson:"tipo"`
+	Declarante        string             `json:"declarante" bson:"declarante"`
+	Periodo           string             `json:"periodo" bson:"periodo"`
+	NomeArquivo       string             `json:"nome_arquivo" bson:"nome_arquivo"`
+	Caminho           string             `json:"-" bson:"caminho"`
+	Status            string             `json:"status" bson:"status"`
+	TotalBytes        int64              `json:"total_bytes" bson:"total_bytes"`
+	BytesProcessados  int64              `json:"bytes_processados" bson:"bytes_processados"`
+	LinhasProcessadas int64              `json:"linhas_processadas" bson:"linhas_processadas"`
+	LinhasRejeitadas  int64              `json:"linhas_rejeitadas" bson:"linhas_rejeitadas"`
+	Lote              int64              `json:"lote" bson:"lote"`
+	Erros             []string           `json:"erros" bson:"erros"`
+	Progresso         float64            `json:"progresso" bson:"-"`
+	IniciadaEm        *time.Time         `json:"iniciada_em,omitempty" bson:"iniciada_em,omitempty"`
+	ConcluidaEm       *time.Time         `json:"concluida_em,omitempty" bson:"concluida_em,omitempty"`
+	CreatedAt         time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt         time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+// Totais de uma conta em um mês, acumulados a partir dos lançamentos importados
+type MovimentoConta struct {
+	ID           string             `json:"id" bson:"_id"`
+	ImportacaoID primitive.ObjectID `json:"importacao_id" bson:"importacao_id"`
+	Declarante   string             `json:"declarante" bson:"declarante"`
+	Periodo      string             `json:"periodo" bson:"periodo"`
+	Documento    string             `json:"documento" bson:"documento"`
+	NumConta     string             `json:"num_conta" bson:"num_conta"`
+	AnoMes       string             `json:"ano_mes" bson:"ano_mes"`
+	Moeda        string             `json:"moeda" bson:"moeda"`
+	TotCreditos  float64            `json:"tot_creditos" bson:"tot_creditos"`
+	TotDebitos   float64            `json:"tot_debitos" bson:"tot_debitos"`
+	Lancamentos  int64              `json:"lancamentos" bson:"lancamentos"`
+	UltimoLote   int64              `json:"ultimo_lote" bson:"ultimo_lote"`
+}
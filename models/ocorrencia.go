@@ -0,0 +1,21 @@
+package models
+
+// Tipos de ocorrência, na codificação do retorno da Receita
+const (
+	OcorrenciaErro        = 1
+	OcorrenciaAdvertencia = 2
+)
+
+// Ocorrencia segue o formato das ocorrências do retorno de processamento
+// da e-Financeira, tanto para as regras validadas localmente quanto para as
+// devolvidas pela Receita. Explicacao, CausasProvaveis e Campos vêm do
+// catálogo de códigos de retorno.
+type Ocorrencia struct {
+	Tipo            int      `json:"tipo" bson:"tipo"`
+	Localizacao     string   `json:"localizacao_erro_aviso" bson:"localizacao_erro_aviso"`
+	Codigo          string   `json:"codigo" bson:"codigo"`
+	Descricao       string   `json:"descricao" bson:"descricao"`
+	Explicacao      string   `json:"explicacao,omitempty" bson:"explicacao,omitempty"`
+	CausasProvaveis []string `json:"causas_provaveis,omitempty" bson:"causas_provaveis,omitempty"`
+	Campos          []string `json:"campos,omitempty" bson:"campos,omitempty"`
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Situação do período de um declarante. Períodos sem registro estão abertos.
+const (
+	PeriodoAberto   = "aberto"
+	PeriodoFechado  = "fechado"
+	PeriodoReaberto = "reaberto"
+)
+
+// PeriodoDeclarante controla se os eventos do semestre ainda podem ser
+// alterados. O período fecha quando o evtFechamentoeFinanceira é aceito e só
+// volta a aceitar alterações por uma reabertura registrada. Também guarda a
+// versão do leiaute escolhida para o período; sem ela, vale a vigente.
+type PeriodoDeclarante struct {
+	ID               primitive.ObjectID `json:"id" bson:"_id"`
+	Declarante       string             `json:"declarante" bson:"declarante"`
+	Periodo          string             `json:"periodo" bson:"periodo"`
+	Situacao         string             `json:"situacao" bson:"situacao"`
+	ReciboFechamento string             `json:"recibo_fechamento,omitempty" bson:"recibo_fechamento,omitempty"`
+	VersaoLayout     string             `json:"versao_layout,omitempty" bson:"versao_layout,omitempty"`
+	Historico        []SituacaoPeriodo  `json:"historico" bson:"historico"`
+	CreatedAt        time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt        time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+type SituacaoPeriodo struct {
+	Situacao string    `json:"situacao" bson:"situacao"`
+	Usuario  string    `json:"usuario" bson:"usuario"`
+	Motivo   string    `json:"motivo" bson:"motivo"`
+	Data     time.Time `json:"data" bson:"data"`
+}
+
+// ReaberturaPeriodo é o pedido de reabertura de um período fechado
+type ReaberturaPeriodo struct {
+	Motivo string `json:"motivo" validate:"required"`
+}
+
+// EscolhaVersaoLayout define a versão do leiaute usada nos eventos do período
+type EscolhaVersaoLayout struct {
+	Versao string `json:"versao" validate:"required"`
+}
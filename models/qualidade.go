@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RelatorioQualidade é a fotografia da qualidade dos dados de um declarante
+// em um momento: os relatórios guardados formam a série histórica
+type RelatorioQualidade struct {
+	ID             primitive.ObjectID   `json:"id" bson:"_id"`
+	Declarante     string               `json:"declarante" bson:"declarante"`
+	Periodo        string               `json:"periodo" bson:"periodo"`
+	Pontuacao      float64              `json:"pontuacao" bson:"pontuacao"`
+	TotalTitulares int                  `json:"total_titulares" bson:"total_titulares"`
+	TotalContas    int                  `json:"total_contas" bson:"total_contas"`
+	TotalEventos   int                  `json:"total_eventos" bson:"total_eventos"`
+	Indicadores    []IndicadorQualidade `json:"indicadores" bson:"indicadores"`
+	GeradoPor      string               `json:"gerado_por" bson:"gerado_por"`
+	CreatedAt      time.Time            `json:"created_at" bson:"created_at"`
+}
+
+// IndicadorQualidade conta os registros avaliados e os com problema em uma
+// verificação; a pontuação vai de 0 a 100
+type IndicadorQualidade struct {
+	Codigo    string              `json:"codigo" bson:"codigo"`
+	Descricao string              `json:"descricao" bson:"descricao"`
+	Peso      int                 `json:"peso" bson:"peso"`
+	Avaliados int                 `json:"avaliados" bson:"avaliados"`
+	Problemas int                 `json:"problemas" bson:"problemas"`
+	Pontuacao float64             `json:"pontuacao" bson:"pontuacao"`
+	Exemplos  []ProblemaQualidade `json:"exemplos,omitempty" bson:"exemplos,omitempty"`
+}
+
+// ProblemaQualidade identifica o registro com problema: titular (NI), conta
+// (número) ou evento (ID)
+type ProblemaQualidade struct {
+	Registro   string `json:"registro" bson:"registro"`
+	Referencia string `json:"referencia" bson:"referencia"`
+	Descricao  string `json:"descricao" bson:"descricao"`
+}
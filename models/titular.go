@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Titular é o cadastro único de um cliente (CPF/CNPJ) por declarante. Os
+// eventos de movimento em rascunho apontam para ele em vez de copiar os dados.
+type Titular struct {
+	ID            primitive.ObjectID `json:"id" bson:"_id"`
+	Declarante    string             `json:"declarante" bson:"declarante"`
+	TpNI          string             `json:"tp_ni" bson:"tp_ni"`
+	NI            string             `json:"ni" bson:"ni"`
+	Nome          string             `json:"nome" bson:"nome" validate:"required"`
+	Endereco      string             `json:"endereco,omitempty" bson:"endereco,omitempty"`
+	PaisEndereco  string             `json:"pais_endereco" bson:"pais_endereco"`
+	Nacionalidade string             `json:"nacionalidade,omitempty" bson:"nacionalidade,omitempty"`
+
+	// Dados usados na busca de indícios FATCA/CRS, mantidos apenas pela
+	// edição manual. Instruções permanentes guardam o país de destino das
+	// transferências programadas.
+	Telefones             []string `json:"telefones,omitempty" bson:"telefones,omitempty"`
+	PaisNascimento        string   `json:"pais_nascimento,omitempty" bson:"pais_nascimento,omitempty"`
+	InstrucoesPermanentes []string `json:"instrucoes_permanentes,omitempty" bson:"instrucoes_permanentes,omitempty"`
+
+	// Campos editados manualmente não são sobrescritos por importações
+	CamposManuais []string           `json:"campos_manuais,omitempty" bson:"campos_manuais,omitempty"`
+	Historico     []AlteracaoTitular `json:"historico,omitempty" bson:"historico,omitempty"`
+
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+	DeletedAt time.Time `json:"deleted_at" bson:"deleted_at"`
+}
+
+// AlteracaoTitular registra cada mudança de campo. Divergências recebidas de
+// importações que não foram aplicadas também ficam registradas, com Aplicada
+// falso, para conferência.
+type AlteracaoTitular struct {
+	Campo         string    `json:"campo" bson:"campo"`
+	ValorAnterior string    `json:"valor_anterior" bson:"valor_anterior"`
+	ValorNovo     string    `json:"valor_novo" bson:"valor_novo"`
+	Origem        string    `json:"origem" bson:"origem"`
+	Aplicada      bool      `json:"aplicada" bson:"aplicada"`
+	Data          time.Time `json:"data" bson:"data"`
+}
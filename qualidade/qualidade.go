@@ -0,0 +1,298 @@
+package qualidade
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"sped-efinanceira/eventos"
+	"sped-efinanceira/models"
+	"sped-efinanceira/validacao"
+)
+
+// Códigos dos indicadores
+const (
+	IndicadorDocumentoInvalido  = "documento_invalido"
+	IndicadorDocumentoDuplicado = "documento_duplicado"
+	IndicadorNIFAusente         = "nif_ausente"
+	IndicadorEnderecoInvalido   = "endereco_invalido"
+	IndicadorNomeSuspeito       = "nome_suspeito"
+	IndicadorContaSaldoZero     = "conta_saldo_zero"
+)
+
+// Quantidade de exemplos guardados por indicador
+const maximoExemplos = 50
+
+// Endereços mais curtos que isso não identificam um local
+const tamanhoMinimoEndereco = 10
+
+// Nomes usados como preenchimento quando o dado real não foi informado
+var nomesGenericos = regexp.MustCompile(`(?i)\b(TESTE|CLIENTE|NAO INFORMADO|NÃO INFORMADO|SEM NOME|DESCONHECIDO|XXX+|ASDF|NULL)\b`)
+
+// Mesmo caractere repetido quatro vezes ou mais (AAAA, 1111)
+func repeticaoSuspeita(texto string) bool {
+	anterior, seguidos := rune(0), 0
+	for _, r := range texto {
+		if r == anterior && !unicode.IsSpace(r) {
+			seguidos++
+			if seguidos >= 4 {
+				return true
+			}
+		} else {
+			anterior, seguidos = r, 1
+		}
+	}
+	return false
+}
+
+func novoIndicador(codigo, descricao string, peso int) *models.IndicadorQualidade {
+	return &models.IndicadorQualidade{Codigo: codigo, Descricao: descricao, Peso: peso}
+}
+
+// Conta um registro avaliado e, com problema, guarda o exemplo
+func avaliar(i *models.IndicadorQualidade, problema *models.ProblemaQualidade) {
+	i.Avaliados++
+	if problema == nil {
+		return
+	}
+	i.Problemas++
+	if len(i.Exemplos) < maximoExemplos {
+		i.Exemplos = append(i.Exemplos, *problema)
+	}
+}
+
+// Avaliar calcula os indicadores sobre o cadastro de titulares e contas e os
+// movimentos em rascunho do período (com os declarados já resolvidos pelo
+// cadastro). A pontuação geral é a média dos indicadores ponderada pelo
+// peso, ignorando os que não tiveram registros avaliados.
+func Avaliar(titulares []*models.Titular, contas []*models.Conta, rascunhos []*models.Evento) *models.RelatorioQualidade {
+	documentos := novoIndicador(IndicadorDocumentoInvalido, "CPF ou CNPJ com dígito verificador inválido em titulares e participantes de contas", 3)
+	duplicados := novoIndicador(IndicadorDocumentoDuplicado, "Documento repetido em mais de um titular ou em mais de um movimento do período", 3)
+	nifs := novoIndicador(IndicadorNIFAusente, "Residência fiscal no exterior sem NIF e sem motivo de dispensa", 3)
+	enderecos := novoIndicador(IndicadorEnderecoInvalido, "Endereço ausente, curto demais ou com país inválido", 2)
+	nomes := novoIndicador(IndicadorNomeSuspeito, "Nome ausente, genérico, com dígitos ou caracteres repetidos", 2)
+	saldosZero := novoIndicador(IndicadorContaSaldoZero, "Conta declarada sem créditos, débitos ou saldo no semestre", 1)
+
+	porDocumento := make(map[string]int)
+	for _, titular := range titulares {
+		porDocumento[validacao.SomenteDigitos(titular.NI)]++
+	}
+
+	for _, titular := range titulares {
+		ni := validacao.SomenteDigitos(titular.NI)
+
+		var problema *models.ProblemaQualidade
+		if !validacao.DocumentoValido(ni) {
+			problema = problemaTitular(titular, fmt.Sprintf("Documento '%s' inválido.", titular.NI))
+		}
+		avaliar(documentos, problema)
+
+		problema = nil
+		if porDocumento[ni] > 1 {
+			problema = problemaTitular(titular, fmt.Sprintf("Documento presente em %d titulares.", porDocumento[ni]))
+		}
+		avaliar(duplicados, problema)
+
+		problema = nil
+		if descricao := verificarEndereco(titular.Endereco, titular.PaisEndereco); descricao != "" {
+			problema = problemaTitular(titular, descricao)
+		}
+		avaliar(enderecos, problema)
+
+		problema = nil
+		if descricao := verificarNome(titular.Nome, titular.TpNI); descricao != "" {
+			problema = problemaTitular(titular, descricao)
+		}
+		avaliar(nomes, problema)
+	}
+
+	for _, conta := range contas {
+		for _, participante := range conta.Titulares {
+			var problema *models.ProblemaQualidade
+			if !validacao.DocumentoValido(participante.NI) {
+				problema = &models.ProblemaQualidade{
+					Registro:   "conta",
+					Referencia: conta.NumConta,
+					Descricao:  fmt.Sprintf("Participante (%s) com documento '%s' inválido.", participante.Papel, participante.NI),
+				}
+			}
+			avaliar(documentos, problema)
+		}
+	}
+
+	movimentosPorDocumento := make(map[string]int)
+	totalEventos := 0
+	for _, evento := range rascunhos {
+		if evento.Movimento != nil && eventos.Editavel(evento.Status) {
+			movimentosPorDocumento[evento.Movimento.Declarado.NI]++
+		}
+	}
+
+	for _, evento := range rascunhos {
+		if evento.Movimento == nil || !eventos.Editavel(evento.Status) {
+			continue
+		}
+		totalEventos++
+		declarado := evento.Movimento.Declarado
+
+		var problema *models.ProblemaQualidade
+		if movimentosPorDocumento[declarado.NI] > 1 {
+			problema = problemaEvento(evento, fmt.Sprintf("Declarado %s em %d movimentos do período.", declarado.NI, movimentosPorDocumento[declarado.NI]))
+		}
+		avaliar(duplicados, problema)
+
+		for _, residencia := range declarado.Residencias {
+			if residencia.Pais == "BR" {
+				continue
+			}
+			problema = nil
+			if strings.TrimSpace(residencia.NIF) == "" && strings.TrimSpace(residencia.MotivoSemNIF) == "" {
+				problema = problemaEvento(evento, fmt.Sprintf("Declarado %s residente em %s sem NIF.", declarado.NI, residencia.Pais))
+			}
+			avaliar(nifs, problema)
+		}
+		for _, controlador := range declarado.Controladores {
+			for _, residencia := range controlador.Residencias {
+				if residencia.Pais == "BR" {
+					continue
+				}
+				problema = nil
+				if strings.TrimSpace(residencia.NIF) == "" {
+					problema = problemaEvento(evento, fmt.Sprintf("Pessoa controladora %s residente em %s sem NIF.", controlador.Nome, residencia.Pais))
+				}
+				avaliar(nifs, problema)
+			}
+		}
+
+		for _, conta := range evento.Movimento.Contas {
+			problema = nil
+			if semMovimento(conta) {
+				problema = &models.ProblemaQualidade{
+					Registro:   "conta",
+					Referencia: conta.NumConta,
+					Descricao:  fmt.Sprintf("Conta declarada para %s sem créditos, débitos ou saldo.", declarado.NI),
+				}
+			}
+			avaliar(saldosZero, problema)
+		}
+	}
+
+	relatorio := &models.RelatorioQualidade{
+		TotalTitulares: len(titulares),
+		TotalContas:    len(contas),
+		TotalEventos:   totalEventos,
+	}
+
+	somaPesos, soma := 0, 0.0
+	for _, item := range []*models.IndicadorQualidade{documentos, duplicados, nifs, enderecos, nomes, saldosZero} {
+		item.Pontuacao = 100
+		if item.Avaliados > 0 {
+			item.Pontuacao = arredondar(100 * float64(item.Avaliados-item.Problemas) / float64(item.Avaliados))
+			somaPesos += item.Peso
+			soma += item.Pontuacao * float64(item.Peso)
+		}
+		relatorio.Indicadores = append(relatorio.Indicadores, *item)
+	}
+
+	relatorio.Pontuacao = 100
+	if somaPesos > 0 {
+		relatorio.Pontuacao = arredondar(soma / float64(somaPesos))
+	}
+
+	return relatorio
+}
+
+func verificarEndereco(endereco, pais string) string {
+	endereco = strings.TrimSpace(endereco)
+	switch {
+	case endereco == "":
+		return "Endereço não informado."
+	case len([]rune(endereco)) < tamanhoMinimoEndereco:
+		return fmt.Sprintf("Endereço '%s' curto demais.", endereco)
+	case repeticaoSuspeita(strings.ToUpper(endereco)):
+		return fmt.Sprintf("Endereço '%s' com caracteres repetidos.", endereco)
+	case !validacao.PaisValido(pais):
+		return fmt.Sprintf("País do endereço '%s' inválido.", pais)
+	}
+	return ""
+}
+
+// Pessoas físicas (tpNI 1) precisam de nome e sobrenome
+func verificarNome(nome, tpNI string) string {
+	nome = strings.TrimSpace(nome)
+	switch {
+	case nome == "":
+		return "Nome não informado."
+	case nomesGenericos.MatchString(nome):
+		return fmt.Sprintf("Nome '%s' genérico.", nome)
+	case strings.IndexFunc(nome, unicode.IsDigit) >= 0 && tpNI == "1":
+		return fmt.Sprintf("Nome '%s' com dígitos.", nome)
+	case repeticaoSuspeita(strings.ToUpper(nome)):
+		return fmt.Sprintf("Nome '%s' com caracteres repetidos.", nome)
+	case tpNI == "1" && len(strings.Fields(nome)) < 2:
+		return fmt.Sprintf("Nome '%s' sem sobrenome.", nome)
+	}
+	return ""
+}
+
+// Contas abertas ou encerradas no semestre são declaradas mesmo zeradas
+func semMovimento(conta models.ContaMovimento) bool {
+	if conta.AbertaNoPeriodo || conta.EncerradaNoPeriodo {
+		return false
+	}
+	for _, mes := range conta.Meses {
+		if mes.TotCreditos != 0 || mes.TotDebitos != 0 || mes.VlrUltDia != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func problemaTitular(titular *models.Titular, descricao string) *models.ProblemaQualidade {
+	return &models.ProblemaQualidade{Registro: "titular", Referencia: titular.NI, Descricao: descricao}
+}
+
+func problemaEvento(evento *models.Evento, descricao string) *models.ProblemaQualidade {
+	return &models.ProblemaQualidade{Registro: "evento", Referencia: evento.ID.Hex(), Descricao: descricao}
+}
+
+func arredondar(valor float64) float64 {
+	return math.Round(valor*100) / 100
+}
+
+// PontoTendencia resume um relatório na série histórica, com a variação da
+// pontuação em relação ao relatório anterior
+type PontoTendencia struct {
+	ID          string             `json:"id"`
+	Periodo     string             `json:"periodo"`
+	Pontuacao   float64            `json:"pontuacao"`
+	Variacao    *float64           `json:"variacao,omitempty"`
+	Indicadores map[string]float64 `json:"indicadores"`
+	CreatedAt   time.Time          `json:"created_at"`
+}
+
+// Tendencia monta a série a partir dos relatórios do mais recente ao mais
+// antigo (a ordem do repositório), mantendo essa ordem
+func Tendencia(relatorios []*models.RelatorioQualidade) []PontoTendencia {
+	pontos := make([]PontoTendencia, len(relatorios))
+	for i, relatorio := range relatorios {
+		pontos[i] = PontoTendencia{
+			ID:          relatorio.ID.Hex(),
+			Periodo:     relatorio.Periodo,
+			Pontuacao:   relatorio.Pontuacao,
+			Indicadores: make(map[string]float64, len(relatorio.Indicadores)),
+			CreatedAt:   relatorio.CreatedAt,
+		}
+		for _, indicador := range relatorio.Indicadores {
+			pontos[i].Indicadores[indicador.Codigo] = indicador.Pontuacao
+		}
+		if i+1 < len(relatorios) {
+			variacao := arredondar(relatorio.Pontuacao - relatorios[i+1].Pontuacao)
+			pontos[i].Variacao = &variacao
+		}
+	}
+	return pontos
+}
@@ -0,0 +1,108 @@
+package regras
+
+import (
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"sped-efinanceira/eventos"
+	"sped-efinanceira/models"
+)
+
+// Contexto dá às regras acesso aos demais eventos do declarante no período:
+// os já gravados e os que vão compor o lote
+type Contexto struct {
+	Declarante string
+	Periodo    string
+	Inicio     time.Time
+	Fim        time.Time
+
+	eventos   []*models.Evento
+	lote      map[primitive.ObjectID]bool
+	excluidos map[string]bool
+}
+
+// NovoContexto monta o contexto a partir dos eventos gravados do período e
+// dos eventos do lote
+func NovoContexto(declarante, periodo string, existentes, lote []*models.Evento) *Contexto {
+	ctx := &Contexto{
+		Declarante: declarante,
+		Periodo:    periodo,
+		lote:       make(map[primitive.ObjectID]bool),
+		excluidos:  make(map[string]bool),
+	}
+	ctx.Inicio, ctx.Fim, _ = eventos.LimitesPeriodo(periodo)
+
+	for _, evento := range lote {
+		ctx.lote[evento.ID] = true
+		ctx.eventos = append(ctx.eventos, evento)
+	}
+	for _, evento := range existentes {
+		if !ctx.lote[evento.ID] {
+			ctx.eventos = append(ctx.eventos, evento)
+		}
+	}
+
+	for _, evento := range ctx.eventos {
+		if evento.Exclusao != nil && (eventos.Enviado(evento.Status) || ctx.lote[evento.ID]) {
+			ctx.excluidos[evento.Exclusao.NrReciboEvento] = true
+		}
+	}
+
+	return ctx
+}
+
+// NoLote informa se o evento será enviado neste lote
+func (ctx *Contexto) NoLote(evento *models.Evento) bool {
+	return ctx.lote[evento.ID]
+}
+
+// Vigentes devolve os eventos do tipo que valem perante a Receita depois do
+// lote: os aceitos ou em envio não excluídos e os que estão no lote
+func (ctx *Contexto) Vigentes(tipo string) []*models.Evento {
+	var vigentes []*models.Evento
+	for _, evento := range ctx.eventos {
+		if evento.Tipo != tipo {
+			continue
+		}
+		if ctx.lote[evento.ID] || (eventos.Enviado(evento.Status) && !ctx.excluidos[evento.Recibo]) {
+			vigentes = append(vigentes, evento)
+		}
+	}
+	return vigentes
+}
+
+// Pendentes devolve os rascunhos e validados do tipo que ficaram fora do lote
+func (ctx *Contexto) Pendentes(tipo string) []*models.Evento {
+	var pendentes []*models.Evento
+	for _, evento := range ctx.eventos {
+		if evento.Tipo == tipo && eventos.Editavel(evento.Status) && !ctx.lote[evento.ID] {
+			pendentes = append(pendentes, evento)
+		}
+	}
+	return pendentes
+}
+
+// Aceito devolve o evento aceito com o recibo informado
+func (ctx *Contexto) Aceito(recibo string) *models.Evento {
+	if recibo == "" {
+		return nil
+	}
+	for _, evento := range ctx.eventos {
+		if evento.Status == models.EventoAceito && evento.Recibo == recibo {
+			return evento
+		}
+	}
+	return nil
+}
+
+// Eventos devolve todos os eventos conhecidos do período
+func (ctx *Contexto) Eventos() []*models.Evento {
+	return ctx.eventos
+}
+
+// Caminho monta a localização da ocorrência no XML do evento
+func Caminho(evento *models.Evento, partes ...string) string {
+	return "/eFinanceira/" + strings.Join(append([]string{evento.Tipo}, partes...), "/")
+}
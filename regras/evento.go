@@ -0,0 +1,106 @@
+package regras
+
+import (
+	"fmt"
+
+	"sped-efinanceira/eventos"
+	"sped-efinanceira/models"
+	"sped-efinanceira/validacao"
+)
+
+// Regras comuns a todos os eventos
+func init() {
+	Registrar(Regra{
+		Codigo:    "REGRA_CNPJ_DECLARANTE",
+		Descricao: "O CNPJ do declarante deve ser válido",
+		Tipo:      models.OcorrenciaErro,
+		Verificar: RegraCNPJDeclarante,
+	})
+	Registrar(Regra{
+		Codigo:    "REGRA_IDENTIFICADOR_EVENTO",
+		Descricao: "O evento deve ter identificador único no período",
+		Tipo:      models.OcorrenciaErro,
+		Verificar: RegraIdentificadorEvento,
+	})
+	Registrar(Regra{
+		Codigo:    "REGRA_RETIFICACAO",
+		Descricao: "A retificação deve indicar o recibo de um evento aceito do mesmo tipo",
+		Tipo:      models.OcorrenciaErro,
+		Eventos:   []string{eventos.TipoAbertura, eventos.TipoMovimento, eventos.TipoFechamento},
+		Verificar: RegraRetificacao,
+	})
+	Registrar(Regra{
+		Codigo:    "REGRA_EXCLUSAO_RECIBO",
+		Descricao: "A exclusão deve indicar o recibo de um evento aceito e ainda não excluído",
+		Tipo:      models.OcorrenciaErro,
+		Eventos:   []string{eventos.TipoExclusao},
+		Verificar: RegraExclusaoRecibo,
+	})
+}
+
+func RegraCNPJDeclarante(ctx *Contexto, evento *models.Evento) []Violacao {
+	if validacao.CNPJValido(evento.Declarante) {
+		return nil
+	}
+	return []Violacao{{
+		Localizacao: Caminho(evento, "ideDeclarante", "cnpjDeclarante"),
+		Descricao:   fmt.Sprintf("CNPJ do declarante '%s' inválido.", evento.Declarante),
+	}}
+}
+
+func RegraIdentificadorEvento(ctx *Contexto, evento *models.Evento) []Violacao {
+	localizacao := Caminho(evento, "@id")
+	if evento.IDEvento == "" {
+		return []Violacao{{Localizacao: localizacao, Descricao: "Evento sem identificador."}}
+	}
+
+	for _, outro := range ctx.Eventos() {
+		if outro.ID != evento.ID && outro.IDEvento == evento.IDEvento {
+			return []Violacao{{
+				Localizacao: localizacao,
+				Descricao:   fmt.Sprintf("Identificador %s já usado em outro evento.", evento.IDEvento),
+			}}
+		}
+	}
+	return nil
+}
+
+func RegraRetificacao(ctx *Contexto, evento *models.Evento) []Violacao {
+	localizacao := Caminho(evento, "ideEvento", "nrRecibo")
+
+	if evento.IndRetificacao != 2 {
+		if evento.NrReciboAnterior != "" {
+			return []Violacao{{Localizacao: localizacao, Descricao: "O recibo só deve ser informado na retificação (indRetificacao = 2)."}}
+		}
+		return nil
+	}
+
+	anterior := ctx.Aceito(evento.NrReciboAnterior)
+	switch {
+	case evento.NrReciboAnterior == "":
+		return []Violacao{{Localizacao: localizacao, Descricao: "Retificação sem o recibo do evento retificado."}}
+	case anterior == nil:
+		return []Violacao{{Localizacao: localizacao, Descricao: fmt.Sprintf("Recibo %s não corresponde a um evento aceito no período.", evento.NrReciboAnterior)}}
+	case anterior.Tipo != evento.Tipo:
+		return []Violacao{{Localizacao: localizacao, Descricao: fmt.Sprintf("Recibo %s pertence a um evento de outro tipo (%s).", evento.NrReciboAnterior, anterior.Tipo)}}
+	}
+	return nil
+}
+
+func RegraExclusaoRecibo(ctx *Contexto, evento *models.Evento) []Violacao {
+	localizacao := Caminho(evento, "infoExclusao", "nrReciboEvento")
+	if evento.Exclusao == nil || evento.Exclusao.NrReciboEvento == "" {
+		return []Violacao{{Localizacao: localizacao, Descricao: "Exclusão sem o recibo do evento a excluir."}}
+	}
+
+	recibo := evento.Exclusao.NrReciboEvento
+	if ctx.Aceito(recibo) == nil {
+		return []Violacao{{Localizacao: localizacao, Descricao: fmt.Sprintf("Recibo %s não corresponde a um evento aceito no período.", recibo)}}
+	}
+	for _, outro := range ctx.Vigentes(eventos.TipoExclusao) {
+		if outro.ID != evento.ID && outro.Exclusao != nil && outro.Exclusao.NrReciboEvento == recibo {
+			return []Violacao{{Localizacao: localizacao, Descricao: fmt.Sprintf("O evento do recibo %s já foi excluído.", recibo)}}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package regras
+
+import (
+	"testing"
+
+	"sped-efinanceira/eventos"
+	"sped-efinanceira/models"
+)
+
+func TestRegraCNPJDeclarante(t *testing.T) {
+	invalido := abertura(models.EventoRascunho, inicioTeste, fimTeste)
+	invalido.Declarante = "11222333000180"
+
+	executarCasos(t, RegraCNPJDeclarante, []casoRegra{
+		{nome: "CNPJ válido", evento: abertura(models.EventoRascunho, inicioTeste, fimTeste)},
+		{nome: "CNPJ inválido", evento: invalido, esperadas: []string{"'11222333000180' inválido"}},
+	})
+}
+
+func TestRegraIdentificadorEvento(t *testing.T) {
+	comID := func(id string) *models.Evento {
+		evento := abertura(models.EventoRascunho, inicioTeste, fimTeste)
+		evento.IDEvento = id
+		return evento
+	}
+
+	executarCasos(t, RegraIdentificadorEvento, []casoRegra{
+		{nome: "identificador único", existentes: []*models.Evento{comID("ID2")}, evento: comID("ID1")},
+		{nome: "sem identificador", evento: comID(""), esperadas: []string{"Evento sem identificador"}},
+		{
+			nome:       "identificador repetido",
+			existentes: []*models.Evento{comID("ID1")},
+			evento:     comID("ID1"),
+			esperadas:  []string{"ID1 já usado"},
+		},
+	})
+}
+
+func TestRegraRetificacao(t *testing.T) {
+	aceito := movimento(models.EventoAceito, "52998224725")
+	aceito.Recibo = "1-01-2024"
+	retificadora := func(recibo string) *models.Evento {
+		evento := movimento(models.EventoRascunho, "52998224725")
+		evento.IndRetificacao = 2
+		evento.NrReciboAnterior = recibo
+		return evento
+	}
+	reciboSemRetificacao := movimento(models.EventoRascunho, "52998224725")
+	reciboSemRetificacao.NrReciboAnterior = aceito.Recibo
+	outroTipo := abertura(models.EventoAceito, inicioTeste, fimTeste)
+	outroTipo.Recibo = "1-02-2024"
+
+	executarCasos(t, RegraRetificacao, []casoRegra{
+		{nome: "original", evento: movimento(models.EventoRascunho, "52998224725")},
+		{nome: "retifica aceito", existentes: []*models.Evento{aceito}, evento: retificadora(aceito.Recibo)},
+		{nome: "recibo sem retificação", evento: reciboSemRetificacao, esperadas: []string{"só deve ser informado na retificação"}},
+		{nome: "retificação sem recibo", evento: retificadora(""), esperadas: []string{"sem o recibo"}},
+		{nome: "recibo desconhecido", existentes: []*models.Evento{aceito}, evento: retificadora("9-99"), esperadas: []string{"9-99 não corresponde"}},
+		{nome: "recibo de outro tipo", existentes: []*models.Evento{outroTipo}, evento: retificadora(outroTipo.Recibo), esperadas: []string{"outro tipo"}},
+	})
+}
+
+func TestRegraExclusaoRecibo(t *testing.T) {
+	aceito := movimento(models.EventoAceito, "52998224725")
+	aceito.Recibo = "1-01-2024"
+	exclusao := func(status, recibo string) *models.Evento {
+		evento := novoEvento(eventos.TipoExclusao, status)
+		evento.Exclusao = &models.ExclusaoeFinanceira{NrReciboEvento: recibo}
+		return evento
+	}
+
+	executarCasos(t, RegraExclusaoRecibo, []casoRegra{
+		{nome: "exclui aceito", existentes: []*models.Evento{aceito}, evento: exclusao(models.EventoRascunho, aceito.Recibo)},
+		{nome: "sem recibo", evento: exclusao(models.EventoRascunho, ""), esperadas: []string{"sem o recibo"}},
+		{nome: "recibo desconhecido", evento: exclusao(models.EventoRascunho, "9-99"), esperadas: []string{"9-99 não corresponde"}},
+		{
+			nome:       "já excluído",
+			existentes: []*models.Evento{aceito, exclusao(models.EventoAceito, aceito.Recibo)},
+			evento:     exclusao(models.EventoRascunho, aceito.Recibo),
+			esperadas:  []string{"já foi excluído"},
+		},
+	})
+}
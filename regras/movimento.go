@@ -0,0 +1,188 @@
+package regras
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"sped-efinanceira/eventos"
+	"sped-efinanceira/models"
+	"sped-efinanceira/validacao"
+)
+
+// Regras do evento de movimento de operações financeiras
+func init() {
+	Registrar(Regra{
+		Codigo:    "REGRA_NI_DECLARADO",
+		Descricao: "O documento do declarado deve ser um CPF ou CNPJ válido, conforme o tpNI",
+		Tipo:      models.OcorrenciaErro,
+		Eventos:   []string{eventos.TipoMovimento},
+		Verificar: RegraNIDeclarado,
+	})
+	Registrar(Regra{
+		Codigo:    "REGRA_DECLARADO_DUPLICADO",
+		Descricao: "Só pode haver um movimento vigente por declarado no período; alterações devem ser retificações",
+		Tipo:      models.OcorrenciaErro,
+		Eventos:   []string{eventos.TipoMovimento},
+		Verificar: RegraDeclaradoDuplicado,
+	})
+	Registrar(Regra{
+		Codigo:    "REGRA_PERIODO_MOVIMENTO",
+		Descricao: "Os meses informados devem pertencer ao semestre do evento",
+		Tipo:      models.OcorrenciaErro,
+		Eventos:   []string{eventos.TipoMovimento},
+		Verificar: RegraPeriodoMovimento,
+	})
+	Registrar(Regra{
+		Codigo:    "REGRA_CONTA_DUPLICADA",
+		Descricao: "A mesma conta não pode aparecer duas vezes no mesmo mês do evento",
+		Tipo:      models.OcorrenciaErro,
+		Eventos:   []string{eventos.TipoMovimento},
+		Verificar: RegraContaDuplicada,
+	})
+	Registrar(Regra{
+		Codigo:    "REGRA_SALDO_CONTA",
+		Descricao: "O saldo do último dia deve acompanhar créditos e débitos entre meses consecutivos",
+		Tipo:      models.OcorrenciaAdvertencia,
+		Eventos:   []string{eventos.TipoMovimento},
+		Verificar: RegraSaldoConta,
+	})
+}
+
+func RegraNIDeclarado(ctx *Contexto, evento *models.Evento) []Violacao {
+	if evento.Movimento == nil {
+		return []Violacao{{Localizacao: Caminho(evento, "ideDeclarado"), Descricao: "Movimento sem dados."}}
+	}
+
+	declarado := evento.Movimento.Declarado
+	valido := false
+	switch declarado.TpNI {
+	case "1":
+		valido = validacao.CPFValido(declarado.NI)
+	case "2":
+		valido = validacao.CNPJValido(declarado.NI)
+	}
+	if valido {
+		return nil
+	}
+	return []Violacao{{
+		Localizacao: Caminho(evento, "ideDeclarado", "NIDeclarado"),
+		Descricao:   fmt.Sprintf("Documento '%s' inválido para o tpNI %s.", declarado.NI, declarado.TpNI),
+	}}
+}
+
+func RegraDeclaradoDuplicado(ctx *Contexto, evento *models.Evento) []Violacao {
+	if evento.Movimento == nil || evento.IndRetificacao == 2 {
+		return nil
+	}
+
+	for _, outro := range ctx.Vigentes(eventos.TipoMovimento) {
+		if outro.ID == evento.ID || outro.Movimento == nil || outro.IndRetificacao == 2 {
+			continue
+		}
+		if outro.Movimento.Declarado.NI == evento.Movimento.Declarado.NI {
+			return []Violacao{{
+				Localizacao: Caminho(evento, "ideDeclarado", "NIDeclarado"),
+				Descricao:   fmt.Sprintf("Já existe movimento do declarado %s no período %s.", evento.Movimento.Declarado.NI, ctx.Periodo),
+			}}
+		}
+	}
+	return nil
+}
+
+func RegraPeriodoMovimento(ctx *Contexto, evento *models.Evento) []Violacao {
+	if evento.Movimento == nil || ctx.Inicio.IsZero() {
+		return nil
+	}
+
+	primeiro, ultimo := ctx.Inicio.Format("200601"), ctx.Fim.Format("200601")
+	var violacoes []Violacao
+	for _, conta := range evento.Movimento.Contas {
+		for _, mes := range conta.Meses {
+			if mes.AnoMes < primeiro || mes.AnoMes > ultimo {
+				violacoes = append(violacoes, Violacao{
+					Localizacao: Caminho(evento, "mesCaixa", "anoMesCaixa"),
+					Descricao:   fmt.Sprintf("Mês %s da conta %s fora do semestre %s.", mes.AnoMes, conta.NumConta, ctx.Periodo),
+				})
+			}
+		}
+	}
+	return violacoes
+}
+
+func RegraContaDuplicada(ctx *Contexto, evento *models.Evento) []Violacao {
+	if evento.Movimento == nil {
+		return nil
+	}
+
+	vistos := make(map[string]bool)
+	var violacoes []Violacao
+	for _, conta := range evento.Movimento.Contas {
+		for _, mes := range conta.Meses {
+			chave := mes.AnoMes + "|" + conta.NumConta
+			if vistos[chave] {
+				violacoes = append(violacoes, Violacao{
+					Localizacao: Caminho(evento, "mesCaixa", "movOpFin", "Conta", "infoConta", "numConta"),
+					Descricao:   fmt.Sprintf("Conta %s informada mais de uma vez no mês %s.", conta.NumConta, mes.AnoMes),
+				})
+			}
+			vistos[chave] = true
+		}
+	}
+	return violacoes
+}
+
+// Em contas em moeda estrangeira a conferência usa os valores originais,
+// pois cada mês é convertido por uma taxa diferente
+func RegraSaldoConta(ctx *Contexto, evento *models.Evento) []Violacao {
+	if evento.Movimento == nil {
+		return nil
+	}
+
+	var violacoes []Violacao
+	for _, conta := range evento.Movimento.Contas {
+		meses := append([]models.MesCaixa(nil), conta.Meses...)
+		sort.Slice(meses, func(i, j int) bool { return meses[i].AnoMes < meses[j].AnoMes })
+
+		for i := 1; i < len(meses); i++ {
+			if !consecutivos(meses[i-1].AnoMes, meses[i].AnoMes) {
+				continue
+			}
+
+			anterior, atual := valoresOriginais(meses[i-1]), valoresOriginais(meses[i])
+			esperado := anterior.VlrUltDia + atual.TotCreditos - atual.TotDebitos
+			if math.Abs(esperado-atual.VlrUltDia) >= 0.01 {
+				violacoes = append(violacoes, Violacao{
+					Localizacao: Caminho(evento, "mesCaixa", "movOpFin", "Conta", "infoConta", "BalancoConta", "vlrUltDia"),
+					Descricao: fmt.Sprintf("Saldo da conta %s em %s (%.2f) difere do saldo anterior mais créditos menos débitos (%.2f).",
+						conta.NumConta, atual.AnoMes, atual.VlrUltDia, esperado),
+				})
+			}
+		}
+	}
+	return violacoes
+}
+
+func valoresOriginais(mes models.MesCaixa) models.MesCaixa {
+	if mes.Cotacao == nil {
+		return mes
+	}
+	return models.MesCaixa{
+		AnoMes:      mes.AnoMes,
+		TotCreditos: mes.Cotacao.TotCreditosOriginal,
+		TotDebitos:  mes.Cotacao.TotDebitosOriginal,
+		VlrUltDia:   mes.Cotacao.VlrUltDiaOriginal,
+	}
+}
+
+func consecutivos(anterior, atual string) bool {
+	var ano, mes int
+	if _, err := fmt.Sscanf(anterior, "%4d%2d", &ano, &mes); err != nil {
+		return false
+	}
+	mes++
+	if mes > 12 {
+		ano, mes = ano+1, 1
+	}
+	return atual == fmt.Sprintf("%04d%02d", ano, mes)
+}
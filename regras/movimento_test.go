@@ -0,0 +1,86 @@
+package regras
+
+import (
+	"testing"
+
+	"sped-efinanceira/models"
+)
+
+func TestRegraNIDeclarado(t *testing.T) {
+	cnpjComTpNICPF := movimento(models.EventoRascunho, "11222333000181")
+	cnpjComTpNICPF.Movimento.Declarado.TpNI = "1"
+
+	executarCasos(t, RegraNIDeclarado, []casoRegra{
+		{nome: "CPF válido", evento: movimento(models.EventoRascunho, "52998224725")},
+		{nome: "CNPJ válido", evento: movimento(models.EventoRascunho, "11222333000181")},
+		{nome: "CPF inválido", evento: movimento(models.EventoRascunho, "52998224724"), esperadas: []string{"'52998224724' inválido"}},
+		{nome: "tpNI não corresponde", evento: cnpjComTpNICPF, esperadas: []string{"inválido para o tpNI 1"}},
+	})
+}
+
+func TestRegraDeclaradoDuplicado(t *testing.T) {
+	aceito := movimento(models.EventoAceito, "52998224725")
+	retificadora := movimento(models.EventoRascunho, "52998224725")
+	retificadora.IndRetificacao = 2
+
+	executarCasos(t, RegraDeclaradoDuplicado, []casoRegra{
+		{nome: "primeiro movimento", evento: movimento(models.EventoRascunho, "52998224725")},
+		{
+			nome:       "declarado já aceito",
+			existentes: []*models.Evento{aceito},
+			evento:     movimento(models.EventoRascunho, "52998224725"),
+			esperadas:  []string{"Já existe movimento do declarado 52998224725"},
+		},
+		{
+			nome:      "dois no mesmo lote",
+			lote:      []*models.Evento{movimento(models.EventoAprovado, "52998224725")},
+			evento:    movimento(models.EventoRascunho, "52998224725"),
+			esperadas: []string{"Já existe movimento"},
+		},
+		{nome: "retificação do aceito", existentes: []*models.Evento{aceito}, evento: retificadora},
+		{
+			nome:       "outro declarado",
+			existentes: []*models.Evento{aceito},
+			evento:     movimento(models.EventoRascunho, "11144477735"),
+		},
+	})
+}
+
+func TestRegraPeriodoMovimento(t *testing.T) {
+	executarCasos(t, RegraPeriodoMovimento, []casoRegra{
+		{nome: "meses do semestre", evento: movimento(models.EventoRascunho, "52998224725", conta("1", mes("202401", 0, 0, 0), mes("202406", 0, 0, 0)))},
+		{
+			nome:      "mês do semestre seguinte",
+			evento:    movimento(models.EventoRascunho, "52998224725", conta("1", mes("202407", 0, 0, 0))),
+			esperadas: []string{"Mês 202407 da conta 1 fora do semestre"},
+		},
+	})
+}
+
+func TestRegraContaDuplicada(t *testing.T) {
+	executarCasos(t, RegraContaDuplicada, []casoRegra{
+		{nome: "contas distintas", evento: movimento(models.EventoRascunho, "52998224725", conta("1", mes("202401", 0, 0, 0)), conta("2", mes("202401", 0, 0, 0)))},
+		{
+			nome:      "conta repetida no mês",
+			evento:    movimento(models.EventoRascunho, "52998224725", conta("1", mes("202401", 0, 0, 0)), conta("1", mes("202401", 0, 0, 0))),
+			esperadas: []string{"Conta 1 informada mais de uma vez no mês 202401"},
+		},
+	})
+}
+
+func TestRegraSaldoConta(t *testing.T) {
+	estrangeira := conta("1", mes("202401", 0, 0, 500), mes("202402", 0, 0, 600))
+	estrangeira.Meses[0].Cotacao = &models.CotacaoUtilizada{VlrUltDiaOriginal: 100}
+	estrangeira.Meses[1].Cotacao = &models.CotacaoUtilizada{TotCreditosOriginal: 20, VlrUltDiaOriginal: 120}
+
+	executarCasos(t, RegraSaldoConta, []casoRegra{
+		{nome: "saldos conferem", evento: movimento(models.EventoRascunho, "52998224725", conta("1", mes("202401", 100, 0, 100), mes("202402", 50, 30, 120)))},
+		{
+			nome:      "saldo não confere",
+			evento:    movimento(models.EventoRascunho, "52998224725", conta("1", mes("202401", 100, 0, 100), mes("202402", 50, 30, 200))),
+			esperadas: []string{"Saldo da conta 1 em 202402 (200.00)"},
+		},
+		{nome: "meses não consecutivos", evento: movimento(models.EventoRascunho, "52998224725", conta("1", mes("202401", 100, 0, 100), mes("202403", 0, 0, 999)))},
+		{nome: "moeda estrangeira pelos valores originais", evento: movimento(models.EventoRascunho, "52998224725", estrangeira)},
+	})
+}
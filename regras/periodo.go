@@ -0,0 +1,191 @@
+package regras
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"sped-efinanceira/eventos"
+	"sped-efinanceira/models"
+)
+
+const formatoData = "02/01/2006"
+
+// Regras de abertura e fechamento do período
+func init() {
+	Registrar(Regra{
+		Codigo:    "REGRA_PERIODO_ABERTURA",
+		Descricao: "As datas da abertura devem estar dentro do semestre do evento",
+		Tipo:      models.OcorrenciaErro,
+		Eventos:   []string{eventos.TipoAbertura},
+		Verificar: RegraPeriodoAbertura,
+	})
+	Registrar(Regra{
+		Codigo:    "REGRA_ABERTURA_UNICA",
+		Descricao: "Só pode haver uma abertura vigente por período; alterações devem ser retificações",
+		Tipo:      models.OcorrenciaErro,
+		Eventos:   []string{eventos.TipoAbertura},
+		Verificar: RegraAberturaUnica,
+	})
+	Registrar(Regra{
+		Codigo:    "REGRA_ABERTURA_EXISTENTE",
+		Descricao: "Movimentos e fechamento exigem a abertura do período, aceita ou no mesmo lote",
+		Tipo:      models.OcorrenciaErro,
+		Eventos:   []string{eventos.TipoMovimento, eventos.TipoFechamento},
+		Verificar: RegraAberturaExistente,
+	})
+	Registrar(Regra{
+		Codigo:    "REGRA_PERIODO_FECHAMENTO",
+		Descricao: "As datas do fechamento devem coincidir com as da abertura do período",
+		Tipo:      models.OcorrenciaErro,
+		Eventos:   []string{eventos.TipoFechamento},
+		Verificar: RegraPeriodoFechamento,
+	})
+	Registrar(Regra{
+		Codigo:    "REGRA_FECHAMENTO_TOTAIS",
+		Descricao: "Os totais do fechamento devem conferir com os movimentos vigentes do período",
+		Tipo:      models.OcorrenciaErro,
+		Eventos:   []string{eventos.TipoFechamento},
+		Verificar: RegraFechamentoTotais,
+	})
+	Registrar(Regra{
+		Codigo:    "REGRA_FECHAMENTO_MOVIMENTOS",
+		Descricao: "O fechamento só pode ser enviado sem movimentos do período pendentes de envio",
+		Tipo:      models.OcorrenciaErro,
+		Eventos:   []string{eventos.TipoFechamento},
+		Verificar: RegraFechamentoMovimentos,
+	})
+}
+
+func RegraPeriodoAbertura(ctx *Contexto, evento *models.Evento) []Violacao {
+	if evento.Abertura == nil {
+		return []Violacao{{Localizacao: Caminho(evento, "infoAbertura"), Descricao: "Abertura sem dados."}}
+	}
+	return verificarDatas(ctx, evento, "infoAbertura", evento.Abertura.DtInicio, evento.Abertura.DtFim)
+}
+
+func RegraAberturaUnica(ctx *Contexto, evento *models.Evento) []Violacao {
+	if evento.IndRetificacao == 2 {
+		return nil
+	}
+
+	for _, outra := range ctx.Vigentes(eventos.TipoAbertura) {
+		if outra.ID != evento.ID && outra.IndRetificacao != 2 {
+			return []Violacao{{
+				Localizacao: Caminho(evento, "ideEvento", "indRetificacao"),
+				Descricao:   fmt.Sprintf("Já existe abertura para o período %s; envie uma retificação.", ctx.Periodo),
+			}}
+		}
+	}
+	return nil
+}
+
+func RegraAberturaExistente(ctx *Contexto, evento *models.Evento) []Violacao {
+	if len(ctx.Vigentes(eventos.TipoAbertura)) > 0 {
+		return nil
+	}
+	return []Violacao{{
+		Localizacao: Caminho(evento, "ideDeclarante", "cnpjDeclarante"),
+		Descricao:   fmt.Sprintf("Não há abertura aceita ou no lote para o período %s.", ctx.Periodo),
+	}}
+}
+
+func RegraPeriodoFechamento(ctx *Contexto, evento *models.Evento) []Violacao {
+	if evento.Fechamento == nil {
+		return []Violacao{{Localizacao: Caminho(evento, "infoFechamento"), Descricao: "Fechamento sem dados."}}
+	}
+
+	violacoes := verificarDatas(ctx, evento, "infoFechamento", evento.Fechamento.DtInicio, evento.Fechamento.DtFim)
+	for _, abertura := range ctx.Vigentes(eventos.TipoAbertura) {
+		if abertura.Abertura == nil {
+			continue
+		}
+		if !abertura.Abertura.DtInicio.Equal(evento.Fechamento.DtInicio) || !abertura.Abertura.DtFim.Equal(evento.Fechamento.DtFim) {
+			violacoes = append(violacoes, Violacao{
+				Localizacao: Caminho(evento, "infoFechamento"),
+				Descricao: fmt.Sprintf("Datas do fechamento diferem das da abertura (%s a %s).",
+					abertura.Abertura.DtInicio.Format(formatoData), abertura.Abertura.DtFim.Format(formatoData)),
+			})
+		}
+	}
+	return violacoes
+}
+
+func RegraFechamentoMovimentos(ctx *Contexto, evento *models.Evento) []Violacao {
+	pendentes := len(ctx.Pendentes(eventos.TipoMovimento))
+	if pendentes == 0 {
+		return nil
+	}
+	return []Violacao{{
+		Localizacao: Caminho(evento, "infoFechamento"),
+		Descricao:   fmt.Sprintf("%d evento(s) de movimento do período ainda não enviados.", pendentes),
+	}}
+}
+
+func RegraFechamentoTotais(ctx *Contexto, evento *models.Evento) []Violacao {
+	if evento.Fechamento == nil {
+		return nil
+	}
+
+	informados := make(map[string]int)
+	for _, mes := range evento.Fechamento.Meses {
+		informados[mes.AnoMesCaixa] += mes.QuantArqTrans
+	}
+
+	var violacoes []Violacao
+	for _, mes := range eventos.TotaisFechamento(ctx.Vigentes(eventos.TipoMovimento)) {
+		if informados[mes.AnoMesCaixa] != mes.QuantArqTrans {
+			violacoes = append(violacoes, Violacao{
+				Localizacao: Caminho(evento, "FechamentoMovOpFin", "FechamentoMes", "quantArqTrans"),
+				Descricao: fmt.Sprintf("O fechamento informa %d movimento(s) em %s, mas há %d vigente(s).",
+					informados[mes.AnoMesCaixa], mes.AnoMesCaixa, mes.QuantArqTrans),
+			})
+		}
+		delete(informados, mes.AnoMesCaixa)
+	}
+
+	var sobrando []string
+	for anoMes, quantidade := range informados {
+		if quantidade > 0 {
+			sobrando = append(sobrando, anoMes)
+		}
+	}
+	sort.Strings(sobrando)
+	for _, anoMes := range sobrando {
+		violacoes = append(violacoes, Violacao{
+			Localizacao: Caminho(evento, "FechamentoMovOpFin", "FechamentoMes", "anoMesCaixa"),
+			Descricao:   fmt.Sprintf("O fechamento informa %d movimento(s) em %s, mas não há nenhum vigente.", informados[anoMes], anoMes),
+		})
+	}
+	return violacoes
+}
+
+func verificarDatas(ctx *Contexto, evento *models.Evento, grupo string, inicio, fim time.Time) []Violacao {
+	if ctx.Inicio.IsZero() {
+		return []Violacao{{Localizacao: Caminho(evento, grupo), Descricao: fmt.Sprintf("Período '%s' inválido.", ctx.Periodo)}}
+	}
+
+	// O último dia do semestre vale por inteiro
+	limite := ctx.Fim.AddDate(0, 0, 1)
+
+	var violacoes []Violacao
+	if inicio.Before(ctx.Inicio) || !inicio.Before(limite) {
+		violacoes = append(violacoes, Violacao{
+			Localizacao: Caminho(evento, grupo, "dtInicio"),
+			Descricao:   fmt.Sprintf("Data de início %s fora do semestre %s.", inicio.Format(formatoData), ctx.Periodo),
+		})
+	}
+	if fim.Before(ctx.Inicio) || !fim.Before(limite) {
+		violacoes = append(violacoes, Violacao{
+			Localizacao: Caminho(evento, grupo, "dtFim"),
+			Descricao:   fmt.Sprintf("Data de fim %s fora do semestre %s.", fim.Format(formatoData), ctx.Periodo),
+		})
+	}
+	if fim.Before(inicio) {
+		violacoes = append(violacoes, Violacao{
+			Localizacao: Caminho(evento, grupo, "dtFim"),
+			Descricao:   "Data de fim anterior à data de início.",
+		})
+	}
+	return violacoes
+}
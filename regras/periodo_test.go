@@ -0,0 +1,158 @@
+package regras
+
+import (
+	"testing"
+	"time"
+
+	"sped-efinanceira/eventos"
+	"sped-efinanceira/models"
+)
+
+func TestRegraPeriodoAbertura(t *testing.T) {
+	executarCasos(t, RegraPeriodoAbertura, []casoRegra{
+		{nome: "dentro do semestre", evento: abertura(models.EventoRascunho, inicioTeste, fimTeste)},
+		{nome: "último dia inteiro", evento: abertura(models.EventoRascunho, inicioTeste, fimTeste.Add(23*time.Hour))},
+		{
+			nome:      "início antes do semestre",
+			evento:    abertura(models.EventoRascunho, inicioTeste.AddDate(0, 0, -1), fimTeste),
+			esperadas: []string{"Data de início"},
+		},
+		{
+			nome:      "fim antes do início",
+			evento:    abertura(models.EventoRascunho, fimTeste, inicioTeste),
+			esperadas: []string{"Data de fim anterior"},
+		},
+		{
+			nome:      "sem dados",
+			evento:    novoEvento(eventos.TipoAbertura, models.EventoRascunho),
+			esperadas: []string{"Abertura sem dados"},
+		},
+	})
+}
+
+func TestRegraAberturaUnica(t *testing.T) {
+	aceita := abertura(models.EventoAceito, inicioTeste, fimTeste)
+	retificadora := abertura(models.EventoRascunho, inicioTeste, fimTeste)
+	retificadora.IndRetificacao = 2
+
+	executarCasos(t, RegraAberturaUnica, []casoRegra{
+		{nome: "primeira abertura", evento: abertura(models.EventoRascunho, inicioTeste, fimTeste)},
+		{
+			nome:       "já aceita",
+			existentes: []*models.Evento{aceita},
+			evento:     abertura(models.EventoRascunho, inicioTeste, fimTeste),
+			esperadas:  []string{"Já existe abertura"},
+		},
+		{nome: "retificação da aceita", existentes: []*models.Evento{aceita}, evento: retificadora},
+		{
+			nome:       "rejeitada não conta",
+			existentes: []*models.Evento{abertura(models.EventoRejeitado, inicioTeste, fimTeste)},
+			evento:     abertura(models.EventoRascunho, inicioTeste, fimTeste),
+		},
+	})
+}
+
+func TestRegraAberturaExistente(t *testing.T) {
+	executarCasos(t, RegraAberturaExistente, []casoRegra{
+		{
+			nome:      "sem abertura",
+			evento:    fechamento(models.EventoRascunho),
+			esperadas: []string{"Não há abertura"},
+		},
+		{
+			nome:       "abertura aceita",
+			existentes: []*models.Evento{abertura(models.EventoAceito, inicioTeste, fimTeste)},
+			evento:     fechamento(models.EventoRascunho),
+		},
+		{
+			nome:   "abertura no lote",
+			lote:   []*models.Evento{abertura(models.EventoAprovado, inicioTeste, fimTeste)},
+			evento: fechamento(models.EventoRascunho),
+		},
+		{
+			nome:       "abertura só em rascunho fora do lote",
+			existentes: []*models.Evento{abertura(models.EventoRascunho, inicioTeste, fimTeste)},
+			evento:     fechamento(models.EventoRascunho),
+			esperadas:  []string{"Não há abertura"},
+		},
+	})
+}
+
+func TestRegraPeriodoFechamento(t *testing.T) {
+	executarCasos(t, RegraPeriodoFechamento, []casoRegra{
+		{
+			nome:       "datas da abertura",
+			existentes: []*models.Evento{abertura(models.EventoAceito, inicioTeste, fimTeste)},
+			evento:     fechamento(models.EventoRascunho),
+		},
+		{
+			nome:       "datas diferentes da abertura",
+			existentes: []*models.Evento{abertura(models.EventoAceito, inicioTeste.AddDate(0, 1, 0), fimTeste)},
+			evento:     fechamento(models.EventoRascunho),
+			esperadas:  []string{"diferem das da abertura"},
+		},
+	})
+}
+
+func TestRegraFechamentoMovimentos(t *testing.T) {
+	executarCasos(t, RegraFechamentoMovimentos, []casoRegra{
+		{
+			nome:       "movimentos enviados",
+			existentes: []*models.Evento{movimento(models.EventoAceito, "52998224725")},
+			evento:     fechamento(models.EventoRascunho),
+		},
+		{
+			nome:   "movimento no mesmo lote",
+			lote:   []*models.Evento{movimento(models.EventoAprovado, "52998224725")},
+			evento: fechamento(models.EventoRascunho),
+		},
+		{
+			nome:       "movimento pendente fora do lote",
+			existentes: []*models.Evento{movimento(models.EventoValidado, "52998224725")},
+			evento:     fechamento(models.EventoRascunho),
+			esperadas:  []string{"1 evento(s) de movimento"},
+		},
+	})
+}
+
+func TestRegraFechamentoTotais(t *testing.T) {
+	janeiro := conta("1", mes("202401", 10, 0, 10))
+	janeiroFevereiro := conta("2", mes("202401", 10, 0, 10), mes("202402", 0, 5, 5))
+
+	aceito := movimento(models.EventoAceito, "52998224725", janeiro)
+	aceito.Recibo = "1-01-2024"
+	retificadora := movimento(models.EventoAprovado, "52998224725", janeiroFevereiro)
+	retificadora.IndRetificacao = 2
+	retificadora.NrReciboAnterior = aceito.Recibo
+
+	executarCasos(t, RegraFechamentoTotais, []casoRegra{
+		{
+			nome:       "totais conferem",
+			existentes: []*models.Evento{aceito, movimento(models.EventoAceito, "11144477735", janeiroFevereiro)},
+			evento:     fechamento(models.EventoRascunho, models.FechamentoMes{AnoMesCaixa: "202401", QuantArqTrans: 2}, models.FechamentoMes{AnoMesCaixa: "202402", QuantArqTrans: 1}),
+		},
+		{
+			nome:       "total menor que os movimentos",
+			existentes: []*models.Evento{aceito, movimento(models.EventoAceito, "11144477735", janeiro)},
+			evento:     fechamento(models.EventoRascunho, models.FechamentoMes{AnoMesCaixa: "202401", QuantArqTrans: 1}),
+			esperadas:  []string{"informa 1 movimento(s) em 202401, mas há 2"},
+		},
+		{
+			nome:       "mês sem movimento",
+			existentes: []*models.Evento{aceito},
+			evento:     fechamento(models.EventoRascunho, models.FechamentoMes{AnoMesCaixa: "202401", QuantArqTrans: 1}, models.FechamentoMes{AnoMesCaixa: "202403", QuantArqTrans: 4}),
+			esperadas:  []string{"202403, mas não há nenhum"},
+		},
+		{
+			nome:       "retificadora no lote conta o declarado uma vez",
+			existentes: []*models.Evento{aceito},
+			lote:       []*models.Evento{retificadora},
+			evento:     fechamento(models.EventoRascunho, models.FechamentoMes{AnoMesCaixa: "202401", QuantArqTrans: 1}, models.FechamentoMes{AnoMesCaixa: "202402", QuantArqTrans: 1}),
+		},
+		{
+			nome:       "movimento rejeitado não conta",
+			existentes: []*models.Evento{movimento(models.EventoRejeitado, "52998224725", janeiro)},
+			evento:     fechamento(models.EventoRascunho),
+		},
+	})
+}
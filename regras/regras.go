@@ -0,0 +1,133 @@
+// Package regras implementa as regras de validação de negócio da
+// e-Financeira, aplicadas aos eventos antes da montagem dos lotes. As
+// violações são devolvidas no mesmo formato das ocorrências da Receita.
+package regras
+
+import (
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"sped-efinanceira/models"
+)
+
+// Violacao é o resultado de uma regra, antes de receber código e tipo
+type Violacao struct {
+	Localizacao string
+	Descricao   string
+}
+
+// Regra de validação. O código é o usado nas ocorrências e deve ser mantido
+// igual ao do manual de orientação da versão de leiaute em uso.
+type Regra struct {
+	Codigo    string
+	Descricao string
+	Tipo      int
+	// Tipos de evento aos quais a regra se aplica; vazio aplica a todos
+	Eventos   []string
+	Verificar func(ctx *Contexto, evento *models.Evento) []Violacao
+}
+
+// ResultadoEvento reúne as ocorrências de um evento
+type ResultadoEvento struct {
+	EventoID    primitive.ObjectID  `json:"evento_id"`
+	IDEvento    string              `json:"id_evento,omitempty"`
+	Tipo        string              `json:"tipo"`
+	Valido      bool                `json:"valido"`
+	Ocorrencias []models.Ocorrencia `json:"ocorrencias"`
+}
+
+var registro = make(map[string]Regra)
+
+// Registrar inclui a regra no registro; códigos repetidos são erro de
+// programação
+func Registrar(regra Regra) {
+	if _, ok := registro[regra.Codigo]; ok {
+		panic("regra registrada duas vezes: " + regra.Codigo)
+	}
+	registro[regra.Codigo] = regra
+}
+
+// Regras devolve as regras registradas, ordenadas pelo código
+func Regras() []Regra {
+	lista := make([]Regra, 0, len(registro))
+	for _, regra := range registro {
+		lista = append(lista, regra)
+	}
+	sort.Slice(lista, func(i, j int) bool {
+		return lista[i].Codigo < lista[j].Codigo
+	})
+	return lista
+}
+
+// BuscarRegra devolve a regra pelo código
+func BuscarRegra(codigo string) (Regra, bool) {
+	regra, ok := registro[codigo]
+	return regra, ok
+}
+
+// Aplicar executa uma regra sobre o evento, se ela valer para o seu tipo
+func (r Regra) Aplicar(ctx *Contexto, evento *models.Evento) []models.Ocorrencia {
+	if len(r.Eventos) > 0 && !contem(r.Eventos, evento.Tipo) {
+		return nil
+	}
+
+	var ocorrencias []models.Ocorrencia
+	for _, violacao := range r.Verificar(ctx, evento) {
+		ocorrencias = append(ocorrencias, models.Ocorrencia{
+			Tipo:        r.Tipo,
+			Localizacao: violacao.Localizacao,
+			Codigo:      r.Codigo,
+			Descricao:   violacao.Descricao,
+		})
+	}
+	return ocorrencias
+}
+
+// Validar aplica todas as regras aos eventos do lote. Um evento é válido
+// quando não tem ocorrências do tipo erro.
+func Validar(ctx *Contexto, lote []*models.Evento) []ResultadoEvento {
+	regras := Regras()
+
+	resultados := make([]ResultadoEvento, 0, len(lote))
+	for _, evento := range lote {
+		resultado := ResultadoEvento{
+			EventoID:    evento.ID,
+			IDEvento:    evento.IDEvento,
+			Tipo:        evento.Tipo,
+			Valido:      true,
+			Ocorrencias: []models.Ocorrencia{},
+		}
+
+		for _, regra := range regras {
+			for _, ocorrencia := range regra.Aplicar(ctx, evento) {
+				resultado.Ocorrencias = append(resultado.Ocorrencias, ocorrencia)
+				if ocorrencia.Tipo == models.OcorrenciaErro {
+					resultado.Valido = false
+				}
+			}
+		}
+		resultados = append(resultados, resultado)
+	}
+
+	return resultados
+}
+
+// Validos informa se todos os eventos passaram nas regras
+func Validos(resultados []ResultadoEvento) bool {
+	for _, resultado := range resultados {
+		if !resultado.Valido {
+			return false
+		}
+	}
+	return true
+}
+
+func contem(lista []string, valor string) bool {
+	for _, item := range lista {
+		if item == valor {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package regras
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"sped-efinanceira/eventos"
+	"sped-efinanceira/models"
+)
+
+const (
+	declaranteTeste = "11222333000181"
+	periodoTeste    = "2024-1"
+)
+
+var (
+	inicioTeste = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	fimTeste    = time.Date(2024, 6, 30, 0, 0, 0, 0, time.UTC)
+)
+
+// Caso de tabela: os eventos gravados, os do lote e o evento verificado, que
+// entra no lote. Espera as violações cujas descrições contêm os trechos.
+type casoRegra struct {
+	nome       string
+	existentes []*models.Evento
+	lote       []*models.Evento
+	evento     *models.Evento
+	esperadas  []string
+}
+
+func executarCasos(t *testing.T, regra func(*Contexto, *models.Evento) []Violacao, casos []casoRegra) {
+	t.Helper()
+
+	for _, caso := range casos {
+		t.Run(caso.nome, func(t *testing.T) {
+			ctx := NovoContexto(declaranteTeste, periodoTeste, caso.existentes, append(caso.lote, caso.evento))
+			violacoes := regra(ctx, caso.evento)
+
+			if len(violacoes) != len(caso.esperadas) {
+				t.Fatalf("esperava %d violação(ões), vieram %d: %+v", len(caso.esperadas), len(violacoes), violacoes)
+			}
+			for i, trecho := range caso.esperadas {
+				if !strings.Contains(violacoes[i].Descricao, trecho) {
+					t.Errorf("violação %d: esperava %q em %q", i, trecho, violacoes[i].Descricao)
+				}
+			}
+		})
+	}
+}
+
+func novoEvento(tipo, status string) *models.Evento {
+	return &models.Evento{
+		ID:         primitive.NewObjectID(),
+		Tipo:       tipo,
+		Declarante: declaranteTeste,
+		Periodo:    periodoTeste,
+		Status:     status,
+	}
+}
+
+func abertura(status string, inicio, fim time.Time) *models.Evento {
+	evento := novoEvento(eventos.TipoAbertura, status)
+	evento.Abertura = &models.AberturaeFinanceira{DtInicio: inicio, DtFim: fim}
+	return evento
+}
+
+func fechamento(status string, meses ...models.FechamentoMes) *models.Evento {
+	evento := novoEvento(eventos.TipoFechamento, status)
+	evento.Fechamento = &models.FechamentoeFinanceira{DtInicio: inicioTeste, DtFim: fimTeste, SitEspecial: "0", Meses: meses}
+	return evento
+}
+
+func movimento(status, ni string, contas ...models.ContaMovimento) *models.Evento {
+	evento := novoEvento(eventos.TipoMovimento, status)
+	evento.Movimento = &models.MovimentoOpFin{
+		Declarado: models.Declarado{TpNI: eventos.TipoNI(ni), NI: ni},
+		Contas:    contas,
+	}
+	return evento
+}
+
+func conta(numero string, meses ...models.MesCaixa) models.ContaMovimento {
+	return models.ContaMovimento{NumConta: numero, Moeda: "BRL", Meses: meses}
+}
+
+func mes(anoMes string, creditos, debitos, saldo float64) models.MesCaixa {
+	return models.MesCaixa{AnoMes: anoMes, TotCreditos: creditos, TotDebitos: debitos, VlrUltDia: saldo}
+}
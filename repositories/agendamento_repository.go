@@ -0,0 +1,258 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+
+	"sped-efinanceira/models"
+)
+
+type AgendamentoRepositorio struct {
+	db *mongo.Database
+}
+
+func NovoAgendamentoRepositorio(dbURL, dbName string) (*AgendamentoRepositorio, error) {
+	client, err := mongo.NewClient(options.Client().ApplyURI(dbURL))
+	if err != nil {
+		return nil, err
+	}
+
+	err = client.Connect(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	err = client.Ping(context.Background(), readpref.Primary())
+	if err != nil {
+		return nil, err
+	}
+
+	db := client.Database(dbName)
+	return &AgendamentoRepositorio{db: db}, nil
+}
+
+// Criar Agendamento
+func (ar *AgendamentoRepositorio) CriarAgendamento(agendamento *models.Agendamento) error {
+	agendamento.ID = primitive.NewObjectID()
+	agendamento.CreatedAt = time.Now()
+	agendamento.UpdatedAt = agendamento.CreatedAt
+
+	_, err := ar.db.Collection("agendamentos").InsertOne(context.Background(), agendamento)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// Listar Agendamentos com filtro opcional de declarante
+func (ar *AgendamentoRepositorio) ListarAgendamentos(declarante string) ([]*models.Agendamento, error) {
+	filter := bson.M{}
+	if declarante != "" {
+		filter["declarante"] = declarante
+	}
+
+	opcoes := options.Find().SetSort(bson.D{{Key: "declarante", Value: 1}, {Key: "nome", Value: 1}})
+	cursor, err := ar.db.Collection("agendamentos").Find(context.Background(), filter, opcoes)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var agendamentos []*models.Agendamento
+	if err := cursor.All(context.Background(), &agendamentos); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return agendamentos, nil
+}
+
+// Listar Agendamento por ID
+func (ar *AgendamentoRepositorio) ListarAgendamentoPorID(id string) (*models.Agendamento, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	var agendamento models.Agendamento
+	err = ar.db.Collection("agendamentos").FindOne(context.Background(), bson.M{"_id": objectID}).Decode(&agendamento)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return &agendamento, nil
+}
+
+// Editar Agendamento
+func (ar *AgendamentoRepositorio) EditarAgendamento(agendamento *models.Agendamento) error {
+	agendamento.UpdatedAt = time.Now()
+
+	update := bson.M{
+		"$set": bson.M{
+			"nome":             agendamento.Nome,
+			"declarante":       agendamento.Declarante,
+			"expressao":        agendamento.Expressao,
+			"periodo":          agendamento.Periodo,
+			"etapas":           agendamento.Etapas,
+			"emails":           agendamento.Emails,
+			"ativo":            agendamento.Ativo,
+			"proxima_execucao": agendamento.ProximaExecucao,
+			"updated_at":       agendamento.UpdatedAt,
+		},
+	}
+
+	_, err := ar.db.Collection("agendamentos").UpdateOne(context.Background(), bson.M{"_id": agendamento.ID}, update)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// Deletar Agendamento; o histórico de execuções é mantido
+func (ar *AgendamentoRepositorio) DeletarAgendamento(id string) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	resultado, err := ar.db.Collection("agendamentos").DeleteOne(context.Background(), bson.M{"_id": objectID})
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	if resultado.DeletedCount == 0 {
+		return errors.New("Agendamento não encontrado")
+	}
+
+	return nil
+}
+
+// Listar Agendamentos ativos cuja próxima execução já passou
+func (ar *AgendamentoRepositorio) ListarAgendamentosVencidos(agora time.Time) ([]*models.Agendamento, error) {
+	filter := bson.M{
+		"ativo":            true,
+		"proxima_execucao": bson.M{"$lte": agora},
+	}
+
+	cursor, err := ar.db.Collection("agendamentos").Find(context.Background(), filter)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var agendamentos []*models.Agendamento
+	if err := cursor.All(context.Background(), &agendamentos); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return agendamentos, nil
+}
+
+// Reservar a execução prevista, avançando a próxima execução. Só uma
+// instância do servidor consegue reservar cada horário; devolve false se
+// outra já o fez.
+func (ar *AgendamentoRepositorio) ReservarExecucao(id primitive.ObjectID, prevista, proxima time.Time) (bool, error) {
+	filter := bson.M{"_id": id, "proxima_execucao": prevista}
+	update := bson.M{
+		"$set": bson.M{
+			"proxima_execucao": proxima,
+			"updated_at":       time.Now(),
+		},
+	}
+
+	resultado, err := ar.db.Collection("agendamentos").UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		log.Println(err)
+		return false, err
+	}
+
+	return resultado.MatchedCount > 0, nil
+}
+
+// Registrar a situação da última execução do Agendamento
+func (ar *AgendamentoRepositorio) RegistrarUltimaExecucao(id primitive.ObjectID, data time.Time, situacao string) error {
+	update := bson.M{
+		"$set": bson.M{
+			"ultima_execucao": data,
+			"ultima_situacao": situacao,
+		},
+	}
+
+	_, err := ar.db.Collection("agendamentos").UpdateOne(context.Background(), bson.M{"_id": id}, update)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// Criar Execução de um Agendamento
+func (ar *AgendamentoRepositorio) CriarExecucao(execucao *models.ExecucaoAgendamento) error {
+	execucao.ID = primitive.NewObjectID()
+
+	_, err := ar.db.Collection("execucoes_agendamento").InsertOne(context.Background(), execucao)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// Gravar o andamento da Execução
+func (ar *AgendamentoRepositorio) AtualizarExecucao(execucao *models.ExecucaoAgendamento) error {
+	update := bson.M{
+		"$set": bson.M{
+			"situacao":     execucao.Situacao,
+			"etapas":       execucao.Etapas,
+			"concluida_em": execucao.ConcluidaEm,
+		},
+	}
+
+	_, err := ar.db.Collection("execucoes_agendamento").UpdateOne(context.Background(), bson.M{"_id": execucao.ID}, update)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// Listar Execuções de um Agendamento, das mais recentes às mais antigas
+func (ar *AgendamentoRepositorio) ListarExecucoes(agendamentoID primitive.ObjectID) ([]*models.ExecucaoAgendamento, error) {
+	opcoes := options.Find().SetSort(bson.D{{Key: "iniciada_em", Value: -1}})
+	cursor, err := ar.db.Collection("execucoes_agendamento").Find(context.Background(), bson.M{"agendamento_id": agendamentoID}, opcoes)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var execucoes []*models.ExecucaoAgendamento
+	if err := cursor.All(context.Background(), &execucoes); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return execucoes, nil
+}
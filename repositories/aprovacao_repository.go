@@ -0,0 +1,186 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+
+	"sped-efinanceira/models"
+)
+
+type AprovacaoRepositorio struct {
+	db *mongo.Database
+}
+
+func NovoAprovacaoRepositorio(dbURL, dbName string) (*AprovacaoRepositorio, error) {
+	client, err := mongo.NewClient(options.Client().ApplyURI(dbURL))
+	if err != nil {
+		return nil, err
+	}
+
+	err = client.Connect(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	err = client.Ping(context.Background(), readpref.Primary())
+	if err != nil {
+		return nil, err
+	}
+
+	db := client.Database(dbName)
+	return &AprovacaoRepositorio{db: db}, nil
+}
+
+// Criar Aprovação
+func (ar *AprovacaoRepositorio) CriarAprovacao(aprovacao *models.Aprovacao) error {
+	aprovacao.ID = primitive.NewObjectID()
+	aprovacao.CreatedAt = time.Now()
+	aprovacao.UpdatedAt = aprovacao.CreatedAt
+
+	_, err := ar.db.Collection("aprovacoes").InsertOne(context.Background(), aprovacao)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// Listar Aprovações com filtros opcionais de declarante e situação, das mais recentes às mais antigas
+func (ar *AprovacaoRepositorio) ListarAprovacoes(declarante, situacao string) ([]*models.Aprovacao, error) {
+	filter := bson.M{}
+	if declarante != "" {
+		filter["declarante"] = declarante
+	}
+	if situacao != "" {
+		filter["situacao"] = situacao
+	}
+
+	opcoes := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := ar.db.Collection("aprovacoes").Find(context.Background(), filter, opcoes)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var aprovacoes []*models.Aprovacao
+	for cursor.Next(context.Background()) {
+		var aprovacao models.Aprovacao
+		if err := cursor.Decode(&aprovacao); err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		aprovacoes = append(aprovacoes, &aprovacao)
+	}
+
+	if err := cursor.Err(); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return aprovacoes, nil
+}
+
+// Listar Aprovação por ID
+func (ar *AprovacaoRepositorio) ListarAprovacaoPorID(id string) (*models.Aprovacao, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	var aprovacao models.Aprovacao
+	err = ar.db.Collection("aprovacoes").FindOne(context.Background(), bson.M{"_id": objectID}).Decode(&aprovacao)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return &aprovacao, nil
+}
+
+// Listar quais dos eventos já estão em uma Aprovação pendente
+func (ar *AprovacaoRepositorio) EventosEmAprovacao(ids []primitive.ObjectID) (map[primitive.ObjectID]bool, error) {
+	filter := bson.M{
+		"situacao":   models.AprovacaoPendente,
+		"evento_ids": bson.M{"$in": ids},
+	}
+
+	cursor, err := ar.db.Collection("aprovacoes").Find(context.Background(), filter)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	pedidos := make(map[primitive.ObjectID]bool)
+	for cursor.Next(context.Background()) {
+		var aprovacao models.Aprovacao
+		if err := cursor.Decode(&aprovacao); err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		for _, id := range aprovacao.EventoIDs {
+			pedidos[id] = true
+		}
+	}
+
+	if err := cursor.Err(); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return pedidos, nil
+}
+
+// Adicionar comentário à Aprovação
+func (ar *AprovacaoRepositorio) AdicionarComentario(id primitive.ObjectID, comentario models.ComentarioAprovacao) error {
+	update := bson.M{
+		"$push": bson.M{"comentarios": comentario},
+		"$set":  bson.M{"updated_at": time.Now()},
+	}
+
+	_, err := ar.db.Collection("aprovacoes").UpdateOne(context.Background(), bson.M{"_id": id}, update)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// Registrar a decisão do aprovador, desde que a Aprovação ainda esteja pendente
+func (ar *AprovacaoRepositorio) RegistrarDecisao(aprovacao *models.Aprovacao) error {
+	filter := bson.M{"_id": aprovacao.ID, "situacao": models.AprovacaoPendente}
+	update := bson.M{
+		"$set": bson.M{
+			"situacao":        aprovacao.Situacao,
+			"aprovador":       aprovacao.Aprovador,
+			"motivo_rejeicao": aprovacao.MotivoRejeicao,
+			"comentarios":     aprovacao.Comentarios,
+			"decidida_em":     aprovacao.DecididaEm,
+			"updated_at":      time.Now(),
+		},
+	}
+
+	resultado, err := ar.db.Collection("aprovacoes").UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	if resultado.MatchedCount == 0 {
+		return fmt.Errorf("A aprovação já foi decidida.")
+	}
+
+	return nil
+}
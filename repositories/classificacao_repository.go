@@ -0,0 +1,166 @@
+package repositories
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+
+	"sped-efinanceira/models"
+)
+
+type ClassificacaoRepositorio struct {
+	db *mongo.Database
+}
+
+func NovoClassificacaoRepositorio(dbURL, dbName string) (*ClassificacaoRepositorio, error) {
+	client, err := mongo.NewClient(options.Client().ApplyURI(dbURL))
+	if err != nil {
+		return nil, err
+	}
+
+	err = client.Connect(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	err = client.Ping(context.Background(), readpref.Primary())
+	if err != nil {
+		return nil, err
+	}
+
+	db := client.Database(dbName)
+
+	// Uma classificação por conta
+	_, err = db.Collection("classificacoes").Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "conta_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &ClassificacaoRepositorio{db: db}, nil
+}
+
+// Salvar Classificação, criando-a na primeira vez
+func (cr *ClassificacaoRepositorio) SalvarClassificacao(classificacao *models.ClassificacaoConta) error {
+	if classificacao.ID.IsZero() {
+		classificacao.ID = primitive.NewObjectID()
+		classificacao.CreatedAt = time.Now()
+	}
+	classificacao.UpdatedAt = time.Now()
+
+	opcoes := options.Replace().SetUpsert(true)
+	_, err := cr.db.Collection("classificacoes").ReplaceOne(context.Background(), bson.M{"conta_id": classificacao.ContaID}, classificacao, opcoes)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// Listar Classificações do declarante, opcionalmente pela situação
+func (cr *ClassificacaoRepositorio) ListarClassificacoes(declarante, situacao string) ([]*models.ClassificacaoConta, error) {
+	filter := bson.M{}
+	if declarante != "" {
+		filter["declarante"] = declarante
+	}
+	if situacao != "" {
+		filter["situacao"] = situacao
+	}
+
+	cursor, err := cr.db.Collection("classificacoes").Find(context.Background(), filter, options.Find().SetSort(bson.M{"num_conta": 1}))
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var classificacoes []*models.ClassificacaoConta
+	if err := cursor.All(context.Background(), &classificacoes); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return classificacoes, nil
+}
+
+// Listar Classificações das contas, indexadas pelo ID da conta
+func (cr *ClassificacaoRepositorio) ListarClassificacoesPorContas(contaIDs []primitive.ObjectID) (map[primitive.ObjectID]*models.ClassificacaoConta, error) {
+	classificacoes := make(map[primitive.ObjectID]*models.ClassificacaoConta)
+	if len(contaIDs) == 0 {
+		return classificacoes, nil
+	}
+
+	cursor, err := cr.db.Collection("classificacoes").Find(context.Background(), bson.M{"conta_id": bson.M{"$in": contaIDs}})
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	for cursor.Next(context.Background()) {
+		var classificacao models.ClassificacaoConta
+		if err := cursor.Decode(&classificacao); err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		classificacoes[classificacao.ContaID] = &classificacao
+	}
+
+	if err := cursor.Err(); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return classificacoes, nil
+}
+
+// Listar Classificação por ID
+func (cr *ClassificacaoRepositorio) ListarClassificacaoPorID(id string) (*models.ClassificacaoConta, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	var classificacao models.ClassificacaoConta
+	err = cr.db.Collection("classificacoes").FindOne(context.Background(), bson.M{"_id": objectID}).Decode(&classificacao)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return &classificacao, nil
+}
+
+// Registrar a revisão da Classificação, mantendo as anteriores
+func (cr *ClassificacaoRepositorio) RevisarClassificacao(classificacao *models.ClassificacaoConta, revisao models.RevisaoClassificacao) error {
+	classificacao.UpdatedAt = time.Now()
+
+	update := bson.M{
+		"$set": bson.M{
+			"situacao":   classificacao.Situacao,
+			"revisao":    revisao,
+			"updated_at": classificacao.UpdatedAt,
+		},
+		"$push": bson.M{"revisoes": revisao},
+	}
+
+	_, err := cr.db.Collection("classificacoes").UpdateOne(context.Background(), bson.M{"_id": classificacao.ID}, update)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	classificacao.Revisao = &revisao
+	classificacao.Revisoes = append(classificacao.Revisoes, revisao)
+	return nil
+}
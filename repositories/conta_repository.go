@@ -0,0 +1,199 @@
+package repositories
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+
+	"sped-efinanceira/models"
+)
+
+type ContaRepositorio struct {
+	db *mongo.Database
+}
+
+func NovoContaRepositorio(dbURL, dbName string) (*ContaRepositorio, error) {
+	client, err := mongo.NewClient(options.Client().ApplyURI(dbURL))
+	if err != nil {
+		return nil, err
+	}
+
+	err = client.Connect(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	err = client.Ping(context.Background(), readpref.Primary())
+	if err != nil {
+		return nil, err
+	}
+
+	db := client.Database(dbName)
+
+	// O número da conta é único em cada declarante
+	_, err = db.Collection("contas").Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "declarante", Value: 1}, {Key: "num_conta", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "titulares.ni", Value: 1}},
+		},
+		{
+			Keys:    bson.D{{Key: "num_conta", Value: "text"}, {Key: "titulares.ni", Value: "text"}},
+			Options: options.Index().SetName("busca_texto").SetDefaultLanguage("none"),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &ContaRepositorio{db: db}, nil
+}
+
+// Criar Conta
+func (cr *ContaRepositorio) CriarConta(conta *models.Conta) error {
+	conta.ID = primitive.NewObjectID()
+	conta.CreatedAt = time.Now()
+	conta.UpdatedAt = conta.CreatedAt
+
+	_, err := cr.db.Collection("contas").InsertOne(context.Background(), conta)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// Listar Contas do declarante, opcionalmente apenas as de um participante
+func (cr *ContaRepositorio) ListarContas(declarante, ni string) ([]*models.Conta, error) {
+	filter := bson.M{}
+	if declarante != "" {
+		filter["declarante"] = declarante
+	}
+	if ni != "" {
+		filter["titulares.ni"] = ni
+	}
+
+	cursor, err := cr.db.Collection("contas").Find(context.Background(), filter, options.Find().SetSort(bson.M{"num_conta": 1}))
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var contas []*models.Conta
+	if err := cursor.All(context.Background(), &contas); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return contas, nil
+}
+
+// Buscar Contas pelo texto do número ou do documento de um participante, das
+// mais relevantes às menos, até o limite
+func (cr *ContaRepositorio) BuscarContasPorTexto(declarante, termo string, limite int) ([]*models.Conta, error) {
+	filter := bson.M{"$text": bson.M{"$search": termo}}
+	if declarante != "" {
+		filter["declarante"] = declarante
+	}
+
+	relevancia := bson.M{"relevancia": bson.M{"$meta": "textScore"}}
+	opcoes := options.Find().SetProjection(relevancia).SetSort(relevancia).SetLimit(int64(limite))
+	cursor, err := cr.db.Collection("contas").Find(context.Background(), filter, opcoes)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var contas []*models.Conta
+	if err := cursor.All(context.Background(), &contas); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return contas, nil
+}
+
+// Listar Conta por ID
+func (cr *ContaRepositorio) ListarContaPorID(id string) (*models.Conta, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	var conta models.Conta
+	err = cr.db.Collection("contas").FindOne(context.Background(), bson.M{"_id": objectID}).Decode(&conta)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return &conta, nil
+}
+
+// Listar Contas do declarante pelos números, indexadas pelo número
+func (cr *ContaRepositorio) ListarContasPorNumeros(declarante string, numeros []string) (map[string]*models.Conta, error) {
+	contas := make(map[string]*models.Conta)
+	if len(numeros) == 0 {
+		return contas, nil
+	}
+
+	filter := bson.M{"declarante": declarante, "num_conta": bson.M{"$in": numeros}}
+	cursor, err := cr.db.Collection("contas").Find(context.Background(), filter)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	for cursor.Next(context.Background()) {
+		var conta models.Conta
+		if err := cursor.Decode(&conta); err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		contas[conta.NumConta] = &conta
+	}
+
+	if err := cursor.Err(); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return contas, nil
+}
+
+// Editar Conta
+func (cr *ContaRepositorio) EditarConta(conta *models.Conta) error {
+	conta.UpdatedAt = time.Now()
+
+	update := bson.M{
+		"$set": bson.M{
+			"tp_conta":        conta.TpConta,
+			"moeda":           conta.Moeda,
+			"dt_abertura":     conta.DtAbertura,
+			"dt_encerramento": conta.DtEncerramento,
+			"titulares":       conta.Titulares,
+			"updated_at":      conta.UpdatedAt,
+		},
+	}
+
+	_, err := cr.db.Collection("contas").UpdateOne(context.Background(), bson.M{"_id": conta.ID}, update)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,112 @@
+package repositories
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+
+	"sped-efinanceira/models"
+)
+
+type CotacaoRepositorio struct {
+	db *mongo.Database
+}
+
+func NovoCotacaoRepositorio(dbURL, dbName string) (*CotacaoRepositorio, error) {
+	client, err := mongo.NewClient(options.Client().ApplyURI(dbURL))
+	if err != nil {
+		return nil, err
+	}
+
+	err = client.Connect(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	err = client.Ping(context.Background(), readpref.Primary())
+	if err != nil {
+		return nil, err
+	}
+
+	db := client.Database(dbName)
+
+	_, err = db.Collection("cotacoes").Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys: bson.D{{Key: "moeda", Value: 1}, {Key: "data", Value: -1}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &CotacaoRepositorio{db: db}, nil
+}
+
+// Salvar Cotações; um novo arquivo do mesmo dia substitui a cotação anterior
+func (cr *CotacaoRepositorio) SalvarCotacoes(cotacoes []models.Cotacao) error {
+	if len(cotacoes) == 0 {
+		return nil
+	}
+
+	operacoes := make([]mongo.WriteModel, 0, len(cotacoes))
+	for _, cotacao := range cotacoes {
+		operacoes = append(operacoes, mongo.NewReplaceOneModel().
+			SetFilter(bson.M{"_id": cotacao.ID}).
+			SetReplacement(cotacao).
+			SetUpsert(true))
+	}
+
+	_, err := cr.db.Collection("cotacoes").BulkWrite(context.Background(), operacoes, options.BulkWrite().SetOrdered(false))
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// Buscar a Cotação mais recente da moeda no intervalo; retorna nil quando
+// não houver boletim
+func (cr *CotacaoRepositorio) BuscarCotacao(moeda string, inicio, fim time.Time) (*models.Cotacao, error) {
+	filter := bson.M{"moeda": moeda, "data": bson.M{"$gte": inicio, "$lte": fim}}
+	opcoes := options.FindOne().SetSort(bson.M{"data": -1})
+
+	var cotacao models.Cotacao
+	err := cr.db.Collection("cotacoes").FindOne(context.Background(), filter, opcoes).Decode(&cotacao)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		log.Println(err)
+		return nil, err
+	}
+
+	return &cotacao, nil
+}
+
+// Listar Cotações da moeda no intervalo
+func (cr *CotacaoRepositorio) ListarCotacoes(moeda string, inicio, fim time.Time) ([]*models.Cotacao, error) {
+	filter := bson.M{"data": bson.M{"$gte": inicio, "$lte": fim}}
+	if moeda != "" {
+		filter["moeda"] = moeda
+	}
+
+	opcoes := options.Find().SetSort(bson.D{{Key: "data", Value: 1}, {Key: "moeda", Value: 1}})
+	cursor, err := cr.db.Collection("cotacoes").Find(context.Background(), filter, opcoes)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var cotacoes []*models.Cotacao
+	if err := cursor.All(context.Background(), &cotacoes); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return cotacoes, nil
+}
@@ -0,0 +1,207 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+
+	"sped-efinanceira/models"
+)
+
+// CRSRepositorio guarda as autocertificações e as pessoas controladoras
+type CRSRepositorio struct {
+	db *mongo.Database
+}
+
+func NovoCRSRepositorio(dbURL, dbName string) (*CRSRepositorio, error) {
+	client, err := mongo.NewClient(options.Client().ApplyURI(dbURL))
+	if err != nil {
+		return nil, err
+	}
+
+	err = client.Connect(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	err = client.Ping(context.Background(), readpref.Primary())
+	if err != nil {
+		return nil, err
+	}
+
+	db := client.Database(dbName)
+	return &CRSRepositorio{db: db}, nil
+}
+
+// Criar Autocertificação
+func (cr *CRSRepositorio) CriarAutoCertificacao(autoCertificacao *models.AutoCertificacao) error {
+	autoCertificacao.ID = primitive.NewObjectID()
+	autoCertificacao.CreatedAt = time.Now()
+	autoCertificacao.UpdatedAt = autoCertificacao.CreatedAt
+
+	_, err := cr.db.Collection("autocertificacoes").InsertOne(context.Background(), autoCertificacao)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// Listar Autocertificação por ID
+func (cr *CRSRepositorio) ListarAutoCertificacaoPorID(id string) (*models.AutoCertificacao, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	var autoCertificacao models.AutoCertificacao
+	err = cr.db.Collection("autocertificacoes").FindOne(context.Background(), bson.M{"_id": objectID}).Decode(&autoCertificacao)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return &autoCertificacao, nil
+}
+
+// Listar Autocertificações dos titulares, da mais recente para a mais antiga
+func (cr *CRSRepositorio) ListarAutoCertificacoes(titularIDs ...primitive.ObjectID) ([]*models.AutoCertificacao, error) {
+	filter := bson.M{"titular_id": bson.M{"$in": titularIDs}}
+	return cr.buscarAutoCertificacoes(filter)
+}
+
+// Listar Autocertificações do declarante com validade até a data informada
+func (cr *CRSRepositorio) ListarAutoCertificacoesVencendo(declarante string, ate time.Time) ([]*models.AutoCertificacao, error) {
+	filter := bson.M{"dt_validade": bson.M{"$lte": ate}}
+	if declarante != "" {
+		filter["declarante"] = declarante
+	}
+	return cr.buscarAutoCertificacoes(filter)
+}
+
+func (cr *CRSRepositorio) buscarAutoCertificacoes(filter bson.M) ([]*models.AutoCertificacao, error) {
+	opcoes := options.Find().SetSort(bson.D{{Key: "dt_assinatura", Value: -1}, {Key: "created_at", Value: -1}})
+	cursor, err := cr.db.Collection("autocertificacoes").Find(context.Background(), filter, opcoes)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var autoCertificacoes []*models.AutoCertificacao
+	if err := cursor.All(context.Background(), &autoCertificacoes); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return autoCertificacoes, nil
+}
+
+// Criar Pessoa Controladora
+func (cr *CRSRepositorio) CriarPessoaControladora(pessoa *models.PessoaControladora) error {
+	pessoa.ID = primitive.NewObjectID()
+	pessoa.CreatedAt = time.Now()
+	pessoa.UpdatedAt = pessoa.CreatedAt
+
+	_, err := cr.db.Collection("pessoas_controladoras").InsertOne(context.Background(), pessoa)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// Listar Pessoa Controladora por ID
+func (cr *CRSRepositorio) ListarPessoaControladoraPorID(id string) (*models.PessoaControladora, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	var pessoa models.PessoaControladora
+	err = cr.db.Collection("pessoas_controladoras").FindOne(context.Background(), bson.M{"_id": objectID}).Decode(&pessoa)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return &pessoa, nil
+}
+
+// Listar Pessoas Controladoras das entidades
+func (cr *CRSRepositorio) ListarPessoasControladoras(entidadeIDs ...primitive.ObjectID) ([]*models.PessoaControladora, error) {
+	filter := bson.M{"entidade_id": bson.M{"$in": entidadeIDs}}
+
+	cursor, err := cr.db.Collection("pessoas_controladoras").Find(context.Background(), filter, options.Find().SetSort(bson.M{"nome": 1}))
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var pessoas []*models.PessoaControladora
+	if err := cursor.All(context.Background(), &pessoas); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return pessoas, nil
+}
+
+// Editar Pessoa Controladora
+func (cr *CRSRepositorio) EditarPessoaControladora(pessoa *models.PessoaControladora) error {
+	pessoa.UpdatedAt = time.Now()
+
+	update := bson.M{
+		"$set": bson.M{
+			"tp_controle":   pessoa.TpControle,
+			"ni":            pessoa.NI,
+			"nome":          pessoa.Nome,
+			"endereco":      pessoa.Endereco,
+			"pais_endereco": pessoa.PaisEndereco,
+			"nacionalidade": pessoa.Nacionalidade,
+			"dt_nascimento": pessoa.DtNascimento,
+			"residencias":   pessoa.Residencias,
+			"updated_at":    pessoa.UpdatedAt,
+		},
+	}
+
+	_, err := cr.db.Collection("pessoas_controladoras").UpdateOne(context.Background(), bson.M{"_id": pessoa.ID}, update)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// Deletar Pessoa Controladora
+func (cr *CRSRepositorio) DeletarPessoaControladora(id string) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	resultado, err := cr.db.Collection("pessoas_controladoras").DeleteOne(context.Background(), bson.M{"_id": objectID})
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	if resultado.DeletedCount == 0 {
+		return errors.New("Pessoa controladora não encontrada")
+	}
+
+	return nil
+}
@@ -0,0 +1,570 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+
+	"sped-efinanceira/models"
+)
+
+type EventoRepositorio struct {
+	db *mongo.Database
+}
+
+func NovoEventoRepositorio(dbURL, dbName string) (*EventoRepositorio, error) {
+	client, err := mongo.NewClient(options.Client().ApplyURI(dbURL))
+	if err != nil {
+		return nil, err
+	}
+
+	err = client.Connect(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	err = client.Ping(context.Background(), readpref.Primary())
+	if err != nil {
+		return nil, err
+	}
+
+	db := client.Database(dbName)
+
+	// Índice textual da busca de eventos e os campos que ela também consulta
+	// diretamente: num $or com $text, todas as condições precisam de índice
+	_, err = db.Collection("eventos").Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "movimento.declarado.nome", Value: "text"},
+				{Key: "movimento.declarado.ni", Value: "text"},
+				{Key: "movimento.contas.num_conta", Value: "text"},
+				{Key: "recibo", Value: "text"},
+				{Key: "nr_recibo_anterior", Value: "text"},
+				{Key: "id_evento", Value: "text"},
+			},
+			Options: options.Index().SetName("busca_texto").SetDefaultLanguage("none"),
+		},
+		{Keys: bson.D{{Key: "recibo", Value: 1}}},
+		{Keys: bson.D{{Key: "movimento.declarado.ni", Value: 1}}},
+		{Keys: bson.D{{Key: "movimento.contas.num_conta", Value: 1}}},
+		{Keys: bson.D{{Key: "movimento.titular_id", Value: 1}}},
+		// Garantia final contra identificadores repetidos; eventos ainda sem
+		// identificador ficam de fora
+		{
+			Keys: bson.D{{Key: "id_evento", Value: 1}},
+			Options: options.Index().SetUnique(true).
+				SetPartialFilterExpression(bson.M{"id_evento": bson.M{"$exists": true}}),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &EventoRepositorio{db: db}, nil
+}
+
+// Criar Evento
+func (er *EventoRepositorio) CriarEvento(evento *models.Evento) error {
+	evento.ID = primitive.NewObjectID()
+	evento.CreatedAt = time.Now()
+	evento.UpdatedAt = evento.CreatedAt
+
+	_, err := er.db.Collection("eventos").InsertOne(context.Background(), evento)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// Criar vários Eventos de uma vez
+func (er *EventoRepositorio) CriarEventos(eventos []*models.Evento) error {
+	if len(eventos) == 0 {
+		return nil
+	}
+
+	documentos := make([]interface{}, 0, len(eventos))
+	for _, evento := range eventos {
+		evento.ID = primitive.NewObjectID()
+		evento.CreatedAt = time.Now()
+		evento.UpdatedAt = evento.CreatedAt
+		documentos = append(documentos, evento)
+	}
+
+	_, err := er.db.Collection("eventos").InsertMany(context.Background(), documentos)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	log.Printf("%d eventos criados com sucesso!", len(eventos))
+	return nil
+}
+
+// Listar Eventos com filtros opcionais de declarante, período, tipo e status
+func (er *EventoRepositorio) ListarEventos(declarante, periodo, tipo, status string) ([]*models.Evento, error) {
+	filter := bson.M{}
+	if declarante != "" {
+		filter["declarante"] = declarante
+	}
+	if periodo != "" {
+		filter["periodo"] = periodo
+	}
+	if tipo != "" {
+		filter["tipo"] = tipo
+	}
+	if status != "" {
+		filter["status"] = status
+	}
+
+	cursor, err := er.db.Collection("eventos").Find(context.Background(), filter)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var eventos []*models.Evento
+	for cursor.Next(context.Background()) {
+		var evento models.Evento
+		err := cursor.Decode(&evento)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+
+		eventos = append(eventos, &evento)
+	}
+
+	if err := cursor.Err(); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return eventos, nil
+}
+
+// Buscar Eventos pelos critérios do filtro, dos mais recentes aos mais
+// antigos, sem o XML. Devolve a página pedida e o total de eventos encontrados.
+func (er *EventoRepositorio) BuscarEventos(filtro models.FiltroBusca, pagina, porPagina int) ([]*models.Evento, int64, error) {
+	filter := bson.M{}
+	if filtro.Declarante != "" {
+		filter["declarante"] = filtro.Declarante
+	}
+	if filtro.Periodo != "" {
+		filter["periodo"] = filtro.Periodo
+	}
+	if filtro.Status != "" {
+		filter["status"] = filtro.Status
+	}
+	if filtro.Tipo != "" {
+		filter["tipo"] = filtro.Tipo
+	}
+	if filtro.Recibo != "" {
+		filter["recibo"] = filtro.Recibo
+	}
+	if filtro.NI != "" {
+		filter["movimento.declarado.ni"] = filtro.NI
+	}
+	if filtro.Conta != "" {
+		filter["movimento.contas.num_conta"] = filtro.Conta
+	}
+
+	if filtro.Termo != "" {
+		alternativas := []bson.M{{"$text": bson.M{"$search": filtro.Termo}}}
+		if len(filtro.NIs) > 0 {
+			alternativas = append(alternativas, bson.M{"movimento.declarado.ni": bson.M{"$in": filtro.NIs}})
+		}
+		if len(filtro.Contas) > 0 {
+			alternativas = append(alternativas, bson.M{"movimento.contas.num_conta": bson.M{"$in": filtro.Contas}})
+		}
+		if len(filtro.TitularIDs) > 0 {
+			alternativas = append(alternativas, bson.M{"movimento.titular_id": bson.M{"$in": filtro.TitularIDs}})
+		}
+
+		if len(alternativas) == 1 {
+			filter["$text"] = alternativas[0]["$text"]
+		} else {
+			filter["$or"] = alternativas
+		}
+	}
+
+	total, err := er.db.Collection("eventos").CountDocuments(context.Background(), filter)
+	if err != nil {
+		log.Println(err)
+		return nil, 0, err
+	}
+
+	opcoes := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(int64((pagina - 1) * porPagina)).
+		SetLimit(int64(porPagina)).
+		SetProjection(bson.M{"xml": 0})
+	cursor, err := er.db.Collection("eventos").Find(context.Background(), filter, opcoes)
+	if err != nil {
+		log.Println(err)
+		return nil, 0, err
+	}
+	defer cursor.Close(context.Background())
+
+	var eventos []*models.Evento
+	if err := cursor.All(context.Background(), &eventos); err != nil {
+		log.Println(err)
+		return nil, 0, err
+	}
+
+	return eventos, total, nil
+}
+
+// Listar Evento por ID
+func (er *EventoRepositorio) ListarEventoPorID(id string) (*models.Evento, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	filter := bson.M{"_id": objectID}
+
+	var evento models.Evento
+	err = er.db.Collection("eventos").FindOne(context.Background(), filter).Decode(&evento)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return &evento, nil
+}
+
+// Deletar Eventos ainda não assinados gerados por uma origem, antes de gerá-los novamente
+func (er *EventoRepositorio) DeletarRascunhos(declarante, periodo, tipo, origem string) (int64, error) {
+	filter := bson.M{
+		"declarante": declarante,
+		"periodo":    periodo,
+		"tipo":       tipo,
+		"origem":     origem,
+		"status":     bson.M{"$in": []string{models.EventoRascunho, models.EventoValidado, models.EventoAprovado}},
+	}
+
+	resultado, err := er.db.Collection("eventos").DeleteMany(context.Background(), filter)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+
+	return resultado.DeletedCount, nil
+}
+
+// Listar quais IDs de evento (padrão da Receita) já existem na base
+func (er *EventoRepositorio) IDsEventosExistentes(ids []string) (map[string]bool, error) {
+	existentes := make(map[string]bool)
+	if len(ids) == 0 {
+		return existentes, nil
+	}
+
+	filter := bson.M{"id_evento": bson.M{"$in": ids}}
+	cursor, err := er.db.Collection("eventos").Find(context.Background(), filter, options.Find().SetProjection(bson.M{"id_evento": 1}))
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	for cursor.Next(context.Background()) {
+		var evento models.Evento
+		if err := cursor.Decode(&evento); err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		existentes[evento.IDEvento] = true
+	}
+
+	if err := cursor.Err(); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return existentes, nil
+}
+
+// Buscar Evento pelo número do recibo
+func (er *EventoRepositorio) BuscarEventoPorRecibo(recibo string) (*models.Evento, error) {
+	var evento models.Evento
+	err := er.db.Collection("eventos").FindOne(context.Background(), bson.M{"recibo": recibo}).Decode(&evento)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		log.Println(err)
+		return nil, err
+	}
+
+	return &evento, nil
+}
+
+// Buscar Evento pelo ID no padrão da Receita
+func (er *EventoRepositorio) BuscarEventoPorIDEvento(idEvento string) (*models.Evento, error) {
+	var evento models.Evento
+	err := er.db.Collection("eventos").FindOne(context.Background(), bson.M{"id_evento": idEvento}).Decode(&evento)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		log.Println(err)
+		return nil, err
+	}
+
+	return &evento, nil
+}
+
+// Registrar o recibo de entrega de um Evento já gravado
+func (er *EventoRepositorio) RegistrarRecibo(id primitive.ObjectID, recibo string) error {
+	update := bson.M{
+		"$set": bson.M{
+			"recibo":     recibo,
+			"updated_at": time.Now(),
+		},
+	}
+
+	_, err := er.db.Collection("eventos").UpdateOne(context.Background(), bson.M{"_id": id}, update)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// Gravar as transições de status do Evento. Só atualiza se o status gravado
+// ainda for o de origem da primeira transição, para não sobrepor outra
+// operação feita em paralelo.
+func (er *EventoRepositorio) AtualizarStatus(id primitive.ObjectID, transicoes []models.TransicaoStatus) error {
+	if len(transicoes) == 0 {
+		return nil
+	}
+
+	filter := bson.M{"_id": id, "status": transicoes[0].De}
+	update := bson.M{
+		"$set": bson.M{
+			"status":     transicoes[len(transicoes)-1].Para,
+			"updated_at": time.Now(),
+		},
+		"$push": bson.M{
+			"historico": bson.M{"$each": transicoes},
+		},
+	}
+
+	resultado, err := er.db.Collection("eventos").UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	if resultado.MatchedCount == 0 {
+		return fmt.Errorf("O status do evento foi alterado por outra operação.")
+	}
+
+	return nil
+}
+
+// Gravar o movimento do Evento como será enviado, com os dados do declarado
+// e os blocos do CRS já resolvidos. Só altera eventos ainda não assinados.
+func (er *EventoRepositorio) GravarMovimento(id primitive.ObjectID, movimento *models.MovimentoOpFin) error {
+	filter := bson.M{
+		"_id":    id,
+		"status": bson.M{"$in": []string{models.EventoRascunho, models.EventoValidado, models.EventoAprovado}},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"movimento":  movimento,
+			"updated_at": time.Now(),
+		},
+	}
+
+	resultado, err := er.db.Collection("eventos").UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	if resultado.MatchedCount == 0 {
+		return fmt.Errorf("O evento não pode mais ser alterado.")
+	}
+
+	return nil
+}
+
+// Gravar o hash do conteúdo aprovado de um Evento validado
+func (er *EventoRepositorio) RegistrarHashAprovado(id primitive.ObjectID, hash string) error {
+	filter := bson.M{"_id": id, "status": models.EventoValidado}
+	update := bson.M{
+		"$set": bson.M{
+			"hash_aprovado": hash,
+			"updated_at":    time.Now(),
+		},
+	}
+
+	resultado, err := er.db.Collection("eventos").UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	if resultado.MatchedCount == 0 {
+		return fmt.Errorf("O status do evento foi alterado por outra operação.")
+	}
+
+	return nil
+}
+
+// Gravar o identificador de um Evento que ainda não tem um
+func (er *EventoRepositorio) RegistrarIDEvento(id primitive.ObjectID, idEvento string) error {
+	filter := bson.M{"_id": id, "id_evento": bson.M{"$exists": false}}
+	update := bson.M{
+		"$set": bson.M{
+			"id_evento":  idEvento,
+			"updated_at": time.Now(),
+		},
+	}
+
+	resultado, err := er.db.Collection("eventos").UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	if resultado.MatchedCount == 0 {
+		return fmt.Errorf("O evento já tem identificador.")
+	}
+
+	return nil
+}
+
+// Gravar a mesma sequência de transições em vários Eventos. Só altera os que
+// ainda estão no status de origem e devolve quantos mudaram.
+func (er *EventoRepositorio) AtualizarStatusEventos(ids []primitive.ObjectID, transicoes []models.TransicaoStatus) (int64, error) {
+	if len(ids) == 0 || len(transicoes) == 0 {
+		return 0, nil
+	}
+
+	filter := bson.M{"_id": bson.M{"$in": ids}, "status": transicoes[0].De}
+	update := bson.M{
+		"$set": bson.M{
+			"status":     transicoes[len(transicoes)-1].Para,
+			"updated_at": time.Now(),
+		},
+		"$push": bson.M{
+			"historico": bson.M{"$each": transicoes},
+		},
+	}
+
+	resultado, err := er.db.Collection("eventos").UpdateMany(context.Background(), filter, update)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+
+	return resultado.ModifiedCount, nil
+}
+
+// Desfazer as transições gravadas por AtualizarStatusEventos: os Eventos que
+// chegaram ao status final por elas voltam ao de origem, sem as entradas no
+// histórico
+func (er *EventoRepositorio) DesfazerStatusEventos(ids []primitive.ObjectID, transicoes []models.TransicaoStatus) error {
+	if len(ids) == 0 || len(transicoes) == 0 {
+		return nil
+	}
+
+	ultima := transicoes[len(transicoes)-1]
+	filter := bson.M{
+		"_id":    bson.M{"$in": ids},
+		"status": ultima.Para,
+		"historico": bson.M{"$elemMatch": bson.M{
+			"para":    ultima.Para,
+			"usuario": ultima.Usuario,
+			"data":    ultima.Data,
+		}},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"status":     transicoes[0].De,
+			"updated_at": time.Now(),
+		},
+		"$pull": bson.M{
+			"historico": bson.M{"usuario": ultima.Usuario, "data": ultima.Data},
+		},
+	}
+
+	_, err := er.db.Collection("eventos").UpdateMany(context.Background(), filter, update)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// Registrar as ocorrências da última validação do Evento
+func (er *EventoRepositorio) RegistrarOcorrencias(id primitive.ObjectID, ocorrencias []models.Ocorrencia) error {
+	update := bson.M{
+		"$set": bson.M{
+			"ocorrencias": ocorrencias,
+			"updated_at":  time.Now(),
+		},
+	}
+
+	_, err := er.db.Collection("eventos").UpdateOne(context.Background(), bson.M{"_id": id}, update)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// Registrar as ocorrências devolvidas pela Receita para um Evento já gravado
+func (er *EventoRepositorio) RegistrarOcorrenciasRetorno(idEvento string, ocorrencias []models.Ocorrencia) (bool, error) {
+	filter := bson.M{"id_evento": idEvento}
+	update := bson.M{
+		"$set": bson.M{
+			"ocorrencias": ocorrencias,
+			"updated_at":  time.Now(),
+		},
+	}
+
+	resultado, err := er.db.Collection("eventos").UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		log.Println(err)
+		return false, err
+	}
+
+	return resultado.MatchedCount > 0, nil
+}
+
+// Listar os CNPJs dos declarantes com Eventos
+func (er *EventoRepositorio) ListarDeclarantes() ([]string, error) {
+	valores, err := er.db.Collection("eventos").Distinct(context.Background(), "declarante", bson.M{})
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	var declarantes []string
+	for _, valor := range valores {
+		if declarante, ok := valor.(string); ok && declarante != "" {
+			declarantes = append(declarantes, declarante)
+		}
+	}
+	sort.Strings(declarantes)
+
+	return declarantes, nil
+}
@@ -0,0 +1,172 @@
+package repositories
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+
+	"sped-efinanceira/models"
+)
+
+// Tempo em que uma chave de idempotência fica guardada
+const ValidadeIdempotencia = 24 * time.Hour
+
+// Prazo da reserva de uma chave em processamento. O middleware a renova
+// enquanto o pedido roda; sem renovação (processo encerrado no meio do
+// pedido), a repetição do mesmo pedido assume a chave.
+const PrazoReservaIdempotencia = 2 * time.Minute
+
+type IdempotenciaRepositorio struct {
+	db *mongo.Database
+}
+
+func NovoIdempotenciaRepositorio(dbURL, dbName string) (*IdempotenciaRepositorio, error) {
+	client, err := mongo.NewClient(options.Client().ApplyURI(dbURL))
+	if err != nil {
+		return nil, err
+	}
+
+	err = client.Connect(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	err = client.Ping(context.Background(), readpref.Primary())
+	if err != nil {
+		return nil, err
+	}
+
+	db := client.Database(dbName)
+
+	_, err = db.Collection("idempotencia").Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "created_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(int32(ValidadeIdempotencia.Seconds())),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &IdempotenciaRepositorio{db: db}, nil
+}
+
+// Reservar a chave para o pedido; devolve false se ela já foi usada. Uma
+// reserva abandonada do mesmo pedido, com o prazo vencido, é assumida.
+func (ir *IdempotenciaRepositorio) Reservar(registro *models.RespostaIdempotente) (bool, error) {
+	agora := time.Now()
+	registro.Concluida = false
+	registro.ReservadaEm = agora
+	registro.CreatedAt = agora
+
+	_, err := ir.db.Collection("idempotencia").InsertOne(context.Background(), registro)
+	if err == nil {
+		return true, nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		log.Println(err)
+		return false, err
+	}
+
+	filter := bson.M{
+		"_id":         registro.ID,
+		"hash_pedido": registro.HashPedido,
+		"concluida":   false,
+		"$or": []bson.M{
+			{"reservada_em": bson.M{"$lt": agora.Add(-PrazoReservaIdempotencia)}},
+			{"reservada_em": bson.M{"$exists": false}},
+		},
+	}
+	update := bson.M{"$set": bson.M{"reservada_em": agora}}
+
+	resultado, err := ir.db.Collection("idempotencia").UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		log.Println(err)
+		return false, err
+	}
+
+	return resultado.ModifiedCount == 1, nil
+}
+
+// Renovar a reserva de uma chave ainda em processamento
+func (ir *IdempotenciaRepositorio) RenovarReserva(id string) error {
+	filter := bson.M{"_id": id, "concluida": false}
+	update := bson.M{"$set": bson.M{"reservada_em": time.Now()}}
+
+	_, err := ir.db.Collection("idempotencia").UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// Buscar o registro da chave; nil se não existe ou já expirou
+func (ir *IdempotenciaRepositorio) BuscarChave(id string) (*models.RespostaIdempotente, error) {
+	var registro models.RespostaIdempotente
+	err := ir.db.Collection("idempotencia").FindOne(context.Background(), bson.M{"_id": id}).Decode(&registro)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		log.Println(err)
+		return nil, err
+	}
+
+	return &registro, nil
+}
+
+// Registrar a resposta dada ao pedido da chave
+func (ir *IdempotenciaRepositorio) RegistrarResposta(id string, status int, cabecalhos map[string]string, corpo []byte) error {
+	update := bson.M{
+		"$set": bson.M{
+			"concluida":  true,
+			"status":     status,
+			"cabecalhos": cabecalhos,
+			"corpo":      corpo,
+		},
+	}
+
+	_, err := ir.db.Collection("idempotencia").UpdateOne(context.Background(), bson.M{"_id": id}, update)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// Registrar que o pedido da chave terminou, sem guardar o corpo da resposta,
+// grande demais; a repetição recebe só o status
+func (ir *IdempotenciaRepositorio) RegistrarConclusao(id string, status int) error {
+	update := bson.M{
+		"$set": bson.M{
+			"concluida":     true,
+			"status":        status,
+			"corpo_omitido": true,
+		},
+	}
+
+	_, err := ir.db.Collection("idempotencia").UpdateOne(context.Background(), bson.M{"_id": id}, update)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// Liberar a chave para que o pedido possa ser repetido
+func (ir *IdempotenciaRepositorio) Liberar(id string) error {
+	_, err := ir.db.Collection("idempotencia").DeleteOne(context.Background(), bson.M{"_id": id})
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,228 @@
+package repositories
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+
+	"sped-efinanceira/models"
+)
+
+// Quantidade máxima de erros guardados por importação
+const limiteErrosImportacao = 100
+
+type ImportacaoRepositorio struct {
+	db *mongo.Database
+}
+
+func NovoImportacaoRepositorio(dbURL, dbName string) (*ImportacaoRepositorio, error) {
+	client, err := mongo.NewClient(options.Client().ApplyURI(dbURL))
+	if err != nil {
+		return nil, err
+	}
+
+	err = client.Connect(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	err = client.Ping(context.Background(), readpref.Primary())
+	if err != nil {
+		return nil, err
+	}
+
+	db := client.Database(dbName)
+	return &ImportacaoRepositorio{db: db}, nil
+}
+
+// Criar Importação
+func (ir *ImportacaoRepositorio) CriarImportacao(importacao *models.Importacao) error {
+	importacao.ID = primitive.NewObjectID()
+	importacao.CreatedAt = time.Now()
+	importacao.UpdatedAt = importacao.CreatedAt
+
+	_, err := ir.db.Collection("importacoes").InsertOne(context.Background(), importacao)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// Listar Importação por ID
+func (ir *ImportacaoRepositorio) ListarImportacaoPorID(id string) (*models.Importacao, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	var importacao models.Importacao
+	err = ir.db.Collection("importacoes").FindOne(context.Background(), bson.M{"_id": objectID}).Decode(&importacao)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return &importacao, nil
+}
+
+// Listar Importações com os status informados
+func (ir *ImportacaoRepositorio) ListarImportacoesPorStatus(status ...string) ([]*models.Importacao, error) {
+	filter := bson.M{"status": bson.M{"$in": status}}
+
+	cursor, err := ir.db.Collection("importacoes").Find(context.Background(), filter)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var importacoes []*models.Importacao
+	for cursor.Next(context.Background()) {
+		var importacao models.Importacao
+		err := cursor.Decode(&importacao)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+
+		importacoes = append(importacoes, &importacao)
+	}
+
+	if err := cursor.Err(); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return importacoes, nil
+}
+
+// Listar Importações de um declarante no período
+func (ir *ImportacaoRepositorio) ListarImportacoes(declarante, periodo string) ([]*models.Importacao, error) {
+	filter := bson.M{"declarante": declarante, "periodo": periodo}
+
+	cursor, err := ir.db.Collection("importacoes").Find(context.Background(), filter)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var importacoes []*models.Importacao
+	if err := cursor.All(context.Background(), &importacoes); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return importacoes, nil
+}
+
+// Listar IDs das Importações concluídas de um declarante no período
+func (ir *ImportacaoRepositorio) ListarIDsImportacoesConcluidas(declarante, periodo string) ([]primitive.ObjectID, error) {
+	filter := bson.M{
+		"declarante": declarante,
+		"periodo":    periodo,
+		"status":     models.ImportacaoConcluida,
+	}
+
+	cursor, err := ir.db.Collection("importacoes").Find(context.Background(), filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var ids []primitive.ObjectID
+	for cursor.Next(context.Background()) {
+		var importacao models.Importacao
+		if err := cursor.Decode(&importacao); err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		ids = append(ids, importacao.ID)
+	}
+
+	if err := cursor.Err(); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// Atualizar status da Importação
+func (ir *ImportacaoRepositorio) AtualizarStatusImportacao(id primitive.ObjectID, status string) error {
+	agora := time.Now()
+	set := bson.M{
+		"status":     status,
+		"updated_at": agora,
+	}
+
+	switch status {
+	case models.ImportacaoProcessando:
+		set["iniciada_em"] = agora
+	case models.ImportacaoConcluida, models.ImportacaoFalhou:
+		set["concluida_em"] = agora
+	}
+
+	_, err := ir.db.Collection("importacoes").UpdateOne(context.Background(), bson.M{"_id": id}, bson.M{"$set": set})
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// Salvar checkpoint da Importação depois que um lote foi aplicado
+func (ir *ImportacaoRepositorio) SalvarCheckpoint(importacao *models.Importacao, novosErros []string) error {
+	update := bson.M{
+		"$set": bson.M{
+			"bytes_processados":  importacao.BytesProcessados,
+			"linhas_processadas": importacao.LinhasProcessadas,
+			"linhas_rejeitadas":  importacao.LinhasRejeitadas,
+			"lote":               importacao.Lote,
+			"updated_at":         time.Now(),
+		},
+	}
+
+	if len(novosErros) > 0 {
+		update["$push"] = bson.M{
+			"erros": bson.M{"$each": novosErros, "$slice": limiteErrosImportacao},
+		}
+	}
+
+	_, err := ir.db.Collection("importacoes").UpdateOne(context.Background(), bson.M{"_id": importacao.ID}, update)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// Registrar erro que interrompeu a Importação
+func (ir *ImportacaoRepositorio) RegistrarErroImportacao(id primitive.ObjectID, mensagem string) error {
+	update := bson.M{
+		"$push": bson.M{
+			"erros": bson.M{"$each": []string{mensagem}, "$slice": limiteErrosImportacao},
+		},
+		"$set": bson.M{"updated_at": time.Now()},
+	}
+
+	_, err := ir.db.Collection("importacoes").UpdateOne(context.Background(), bson.M{"_id": id}, update)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package repositories
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+type LembreteRepositorio struct {
+	db *mongo.Database
+}
+
+func NovoLembreteRepositorio(dbURL, dbName string) (*LembreteRepositorio, error) {
+	client, err := mongo.NewClient(options.Client().ApplyURI(dbURL))
+	if err != nil {
+		return nil, err
+	}
+
+	err = client.Connect(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	err = client.Ping(context.Background(), readpref.Primary())
+	if err != nil {
+		return nil, err
+	}
+
+	db := client.Database(dbName)
+
+	// Cada lembrete é enviado uma única vez
+	_, err = db.Collection("lembretes").Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "declarante", Value: 1}, {Key: "periodo", Value: 1}, {Key: "antecedencia", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &LembreteRepositorio{db: db}, nil
+}
+
+// Registrar o envio de um lembrete; devolve false se ele já tinha sido enviado
+func (lr *LembreteRepositorio) RegistrarLembrete(declarante, periodo string, antecedencia int) (bool, error) {
+	documento := bson.M{
+		"_id":          primitive.NewObjectID(),
+		"declarante":   declarante,
+		"periodo":      periodo,
+		"antecedencia": antecedencia,
+		"created_at":   time.Now(),
+	}
+
+	_, err := lr.db.Collection("lembretes").InsertOne(context.Background(), documento)
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		log.Println(err)
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,136 @@
+package repositories
+
+import (
+	"context"
+	"log"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+
+	"sped-efinanceira/models"
+)
+
+type MovimentoContaRepositorio struct {
+	db *mongo.Database
+}
+
+func NovoMovimentoContaRepositorio(dbURL, dbName string) (*MovimentoContaRepositorio, error) {
+	client, err := mongo.NewClient(options.Client().ApplyURI(dbURL))
+	if err != nil {
+		return nil, err
+	}
+
+	err = client.Connect(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	err = client.Ping(context.Background(), readpref.Primary())
+	if err != nil {
+		return nil, err
+	}
+
+	db := client.Database(dbName)
+	return &MovimentoContaRepositorio{db: db}, nil
+}
+
+// AplicarLote soma os totais de um lote aos acumulados de cada conta.
+// O filtro por ultimo_lote torna a operação idempotente: ao retomar uma
+// importação, contas que já receberam o lote geram erro de chave duplicada
+// no upsert, que é ignorado.
+func (mr *MovimentoContaRepositorio) AplicarLote(lote int64, movimentos []models.MovimentoConta) error {
+	if len(movimentos) == 0 {
+		return nil
+	}
+
+	operacoes := make([]mongo.WriteModel, 0, len(movimentos))
+	for _, movimento := range movimentos {
+		filter := bson.M{
+			"_id":         movimento.ID,
+			"ultimo_lote": bson.M{"$lt": lote},
+		}
+
+		update := bson.M{
+			"$inc": bson.M{
+				"tot_creditos": movimento.TotCreditos,
+				"tot_debitos":  movimento.TotDebitos,
+				"lancamentos":  movimento.Lancamentos,
+			},
+			"$set": bson.M{
+				"ultimo_lote": lote,
+			},
+			"$setOnInsert": bson.M{
+				"importacao_id": movimento.ImportacaoID,
+				"declarante":    movimento.Declarante,
+				"periodo":       movimento.Periodo,
+				"documento":     movimento.Documento,
+				"num_conta":     movimento.NumConta,
+				"ano_mes":       movimento.AnoMes,
+				"moeda":         movimento.Moeda,
+			},
+		}
+
+		operacoes = append(operacoes, mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(update).SetUpsert(true))
+	}
+
+	_, err := mr.db.Collection("movimentos_contas").BulkWrite(context.Background(), operacoes, options.BulkWrite().SetOrdered(false))
+	if err != nil && !somenteChaveDuplicada(err) {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// Listar Movimentos de Contas de um declarante no período, considerando
+// apenas as importações informadas
+func (mr *MovimentoContaRepositorio) ListarMovimentos(declarante, periodo string, importacoes []primitive.ObjectID) ([]*models.MovimentoConta, error) {
+	filter := bson.M{
+		"declarante":    declarante,
+		"periodo":       periodo,
+		"importacao_id": bson.M{"$in": importacoes},
+	}
+
+	cursor, err := mr.db.Collection("movimentos_contas").Find(context.Background(), filter)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var movimentos []*models.MovimentoConta
+	for cursor.Next(context.Background()) {
+		var movimento models.MovimentoConta
+		err := cursor.Decode(&movimento)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+
+		movimentos = append(movimentos, &movimento)
+	}
+
+	if err := cursor.Err(); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return movimentos, nil
+}
+
+func somenteChaveDuplicada(err error) bool {
+	bulkErr, ok := err.(mongo.BulkWriteException)
+	if !ok || bulkErr.WriteConcernError != nil || len(bulkErr.WriteErrors) == 0 {
+		return false
+	}
+
+	for _, writeErr := range bulkErr.WriteErrors {
+		if writeErr.Code != 11000 {
+			return false
+		}
+	}
+	return true
+}
@@ -137,6 +137,7 @@ func (ur *PerfilRepositorio) EditarPerfil(perfil *models.Perfil) error {
 	update := bson.M{
 		"$set": bson.M{
 			"descricao":  perfil.Descricao,
+			"aprovador":  perfil.Aprovador,
 			"updated_at": time.Now(),
 		},
 	}
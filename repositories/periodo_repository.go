@@ -0,0 +1,189 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+
+	"sped-efinanceira/models"
+)
+
+type PeriodoRepositorio struct {
+	db *mongo.Database
+}
+
+func NovoPeriodoRepositorio(dbURL, dbName string) (*PeriodoRepositorio, error) {
+	client, err := mongo.NewClient(options.Client().ApplyURI(dbURL))
+	if err != nil {
+		return nil, err
+	}
+
+	err = client.Connect(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	err = client.Ping(context.Background(), readpref.Primary())
+	if err != nil {
+		return nil, err
+	}
+
+	db := client.Database(dbName)
+
+	// Um registro por declarante e período
+	_, err = db.Collection("periodos").Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "declarante", Value: 1}, {Key: "periodo", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &PeriodoRepositorio{db: db}, nil
+}
+
+// Buscar Período do declarante; nil se nunca foi fechado
+func (pr *PeriodoRepositorio) BuscarPeriodo(declarante, periodo string) (*models.PeriodoDeclarante, error) {
+	var registro models.PeriodoDeclarante
+	err := pr.db.Collection("periodos").FindOne(context.Background(), bson.M{"declarante": declarante, "periodo": periodo}).Decode(&registro)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		log.Println(err)
+		return nil, err
+	}
+
+	return &registro, nil
+}
+
+// Listar Períodos com filtro opcional de declarante
+func (pr *PeriodoRepositorio) ListarPeriodos(declarante string) ([]*models.PeriodoDeclarante, error) {
+	filter := bson.M{}
+	if declarante != "" {
+		filter["declarante"] = declarante
+	}
+
+	opcoes := options.Find().SetSort(bson.D{{Key: "declarante", Value: 1}, {Key: "periodo", Value: -1}})
+	cursor, err := pr.db.Collection("periodos").Find(context.Background(), filter, opcoes)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var periodos []*models.PeriodoDeclarante
+	for cursor.Next(context.Background()) {
+		var registro models.PeriodoDeclarante
+		if err := cursor.Decode(&registro); err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		periodos = append(periodos, &registro)
+	}
+
+	if err := cursor.Err(); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return periodos, nil
+}
+
+// Fechar o Período, criando o registro se preciso. Períodos já fechados não
+// são alterados.
+func (pr *PeriodoRepositorio) FecharPeriodo(declarante, periodo, recibo string, situacao models.SituacaoPeriodo) (bool, error) {
+	filter := bson.M{
+		"declarante": declarante,
+		"periodo":    periodo,
+		"situacao":   bson.M{"$ne": models.PeriodoFechado},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"situacao":          models.PeriodoFechado,
+			"recibo_fechamento": recibo,
+			"updated_at":        time.Now(),
+		},
+		"$push": bson.M{"historico": situacao},
+		"$setOnInsert": bson.M{
+			"_id":        primitive.NewObjectID(),
+			"created_at": time.Now(),
+		},
+	}
+
+	resultado, err := pr.db.Collection("periodos").UpdateOne(context.Background(), filter, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		// Já estava fechado
+		return false, nil
+	}
+	if err != nil {
+		log.Println(err)
+		return false, err
+	}
+
+	return resultado.ModifiedCount > 0 || resultado.UpsertedCount > 0, nil
+}
+
+// Reabrir um Período fechado
+func (pr *PeriodoRepositorio) ReabrirPeriodo(declarante, periodo string, situacao models.SituacaoPeriodo) error {
+	filter := bson.M{
+		"declarante": declarante,
+		"periodo":    periodo,
+		"situacao":   models.PeriodoFechado,
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"situacao":   models.PeriodoReaberto,
+			"updated_at": time.Now(),
+		},
+		"$push": bson.M{"historico": situacao},
+	}
+
+	resultado, err := pr.db.Collection("periodos").UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	if resultado.MatchedCount == 0 {
+		return fmt.Errorf("O período %s do declarante %s não está fechado.", periodo, declarante)
+	}
+
+	return nil
+}
+
+// Definir a versão do leiaute do Período, criando o registro (aberto) se
+// preciso. Vazio volta a usar a versão vigente.
+func (pr *PeriodoRepositorio) DefinirVersaoLayout(declarante, periodo, versao string) error {
+	filter := bson.M{
+		"declarante": declarante,
+		"periodo":    periodo,
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"versao_layout": versao,
+			"updated_at":    time.Now(),
+		},
+		"$setOnInsert": bson.M{
+			"_id":        primitive.NewObjectID(),
+			"situacao":   models.PeriodoAberto,
+			"historico":  []models.SituacaoPeriodo{},
+			"created_at": time.Now(),
+		},
+	}
+
+	_, err := pr.db.Collection("periodos").UpdateOne(context.Background(), filter, update, options.Update().SetUpsert(true))
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,116 @@
+package repositories
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+
+	"sped-efinanceira/models"
+)
+
+type QualidadeRepositorio struct {
+	db *mongo.Database
+}
+
+func NovoQualidadeRepositorio(dbURL, dbName string) (*QualidadeRepositorio, error) {
+	client, err := mongo.NewClient(options.Client().ApplyURI(dbURL))
+	if err != nil {
+		return nil, err
+	}
+
+	err = client.Connect(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	err = client.Ping(context.Background(), readpref.Primary())
+	if err != nil {
+		return nil, err
+	}
+
+	db := client.Database(dbName)
+
+	_, err = db.Collection("relatorios_qualidade").Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys: bson.D{{Key: "declarante", Value: 1}, {Key: "created_at", Value: -1}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &QualidadeRepositorio{db: db}, nil
+}
+
+// Criar Relatório de qualidade
+func (qr *QualidadeRepositorio) CriarRelatorio(relatorio *models.RelatorioQualidade) error {
+	relatorio.ID = primitive.NewObjectID()
+	relatorio.CreatedAt = time.Now()
+
+	_, err := qr.db.Collection("relatorios_qualidade").InsertOne(context.Background(), relatorio)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// Listar Relatórios do declarante, com filtro opcional de período, dos mais
+// recentes aos mais antigos. Os exemplos ficam de fora: a série só precisa
+// das pontuações.
+func (qr *QualidadeRepositorio) ListarRelatorios(declarante, periodo string) ([]*models.RelatorioQualidade, error) {
+	filter := bson.M{"declarante": declarante}
+	if periodo != "" {
+		filter["periodo"] = periodo
+	}
+
+	opcoes := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetProjection(bson.M{"indicadores.exemplos": 0})
+	cursor, err := qr.db.Collection("relatorios_qualidade").Find(context.Background(), filter, opcoes)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var relatorios []*models.RelatorioQualidade
+	for cursor.Next(context.Background()) {
+		var relatorio models.RelatorioQualidade
+		if err := cursor.Decode(&relatorio); err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		relatorios = append(relatorios, &relatorio)
+	}
+
+	if err := cursor.Err(); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return relatorios, nil
+}
+
+// Listar Relatório por ID
+func (qr *QualidadeRepositorio) ListarRelatorioPorID(id string) (*models.RelatorioQualidade, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	var relatorio models.RelatorioQualidade
+	err = qr.db.Collection("relatorios_qualidade").FindOne(context.Background(), bson.M{"_id": objectID}).Decode(&relatorio)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return &relatorio, nil
+}
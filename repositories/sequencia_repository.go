@@ -0,0 +1,76 @@
+package repositories
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// Os contadores só valem no segundo a que se referem; o Mongo remove os
+// antigos depois deste prazo
+const validadeSequencia = 24 * time.Hour
+
+type SequenciaRepositorio struct {
+	db *mongo.Database
+}
+
+func NovoSequenciaRepositorio(dbURL, dbName string) (*SequenciaRepositorio, error) {
+	client, err := mongo.NewClient(options.Client().ApplyURI(dbURL))
+	if err != nil {
+		return nil, err
+	}
+
+	err = client.Connect(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	err = client.Ping(context.Background(), readpref.Primary())
+	if err != nil {
+		return nil, err
+	}
+
+	db := client.Database(dbName)
+
+	_, err = db.Collection("sequencias_evento").Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "created_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(int32(validadeSequencia.Seconds())),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &SequenciaRepositorio{db: db}, nil
+}
+
+// Reservar um bloco de sequenciais do contador, criando-o se preciso, e
+// devolver o primeiro. O incremento é atômico: chamadas simultâneas, mesmo de
+// outras instâncias do servidor, recebem blocos distintos.
+func (sr *SequenciaRepositorio) Reservar(chave string, quantidade int) (int, error) {
+	filter := bson.M{"_id": chave}
+	update := bson.M{
+		"$inc":         bson.M{"sequencial": quantidade},
+		"$setOnInsert": bson.M{"created_at": time.Now()},
+	}
+	opcoes := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var contador struct {
+		Sequencial int `bson:"sequencial"`
+	}
+	err := sr.db.Collection("sequencias_evento").FindOneAndUpdate(context.Background(), filter, update, opcoes).Decode(&contador)
+	if mongo.IsDuplicateKeyError(err) {
+		// Outra chamada criou o contador ao mesmo tempo; agora ele existe
+		err = sr.db.Collection("sequencias_evento").FindOneAndUpdate(context.Background(), filter, update, opcoes).Decode(&contador)
+	}
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+
+	return contador.Sequencial - quantidade + 1, nil
+}
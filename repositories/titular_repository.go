@@ -0,0 +1,222 @@
+package repositories
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+
+	"sped-efinanceira/models"
+)
+
+type TitularRepositorio struct {
+	db *mongo.Database
+}
+
+func NovoTitularRepositorio(dbURL, dbName string) (*TitularRepositorio, error) {
+	client, err := mongo.NewClient(options.Client().ApplyURI(dbURL))
+	if err != nil {
+		return nil, err
+	}
+
+	err = client.Connect(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	err = client.Ping(context.Background(), readpref.Primary())
+	if err != nil {
+		return nil, err
+	}
+
+	db := client.Database(dbName)
+
+	// Um único cadastro por documento em cada declarante
+	_, err = db.Collection("titulares").Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "declarante", Value: 1}, {Key: "ni", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "nome", Value: "text"}, {Key: "ni", Value: "text"}},
+			Options: options.Index().SetName("busca_texto").SetDefaultLanguage("none"),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &TitularRepositorio{db: db}, nil
+}
+
+// Criar Titular
+func (tr *TitularRepositorio) CriarTitular(titular *models.Titular) error {
+	titular.ID = primitive.NewObjectID()
+	titular.CreatedAt = time.Now()
+	titular.UpdatedAt = titular.CreatedAt
+
+	_, err := tr.db.Collection("titulares").InsertOne(context.Background(), titular)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// Buscar Titular pelo documento; retorna nil quando não cadastrado
+func (tr *TitularRepositorio) BuscarTitular(declarante, ni string) (*models.Titular, error) {
+	filter := bson.M{"declarante": declarante, "ni": ni}
+
+	var titular models.Titular
+	err := tr.db.Collection("titulares").FindOne(context.Background(), filter).Decode(&titular)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		log.Println(err)
+		return nil, err
+	}
+
+	return &titular, nil
+}
+
+// Listar Titulares do declarante, opcionalmente filtrando pelo documento
+func (tr *TitularRepositorio) ListarTitulares(declarante, ni string) ([]*models.Titular, error) {
+	filter := bson.M{}
+	if declarante != "" {
+		filter["declarante"] = declarante
+	}
+	if ni != "" {
+		filter["ni"] = ni
+	}
+
+	opcoes := options.Find().SetSort(bson.M{"nome": 1}).SetProjection(bson.M{"historico": 0})
+	cursor, err := tr.db.Collection("titulares").Find(context.Background(), filter, opcoes)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var titulares []*models.Titular
+	if err := cursor.All(context.Background(), &titulares); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return titulares, nil
+}
+
+// Buscar Titulares pelo texto do nome ou documento, dos mais relevantes aos
+// menos, até o limite
+func (tr *TitularRepositorio) BuscarTitularesPorTexto(declarante, termo string, limite int) ([]*models.Titular, error) {
+	filter := bson.M{"$text": bson.M{"$search": termo}}
+	if declarante != "" {
+		filter["declarante"] = declarante
+	}
+
+	relevancia := bson.M{"relevancia": bson.M{"$meta": "textScore"}}
+	opcoes := options.Find().SetProjection(relevancia).SetSort(relevancia).SetLimit(int64(limite))
+	cursor, err := tr.db.Collection("titulares").Find(context.Background(), filter, opcoes)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var titulares []*models.Titular
+	if err := cursor.All(context.Background(), &titulares); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return titulares, nil
+}
+
+// Listar Titular por ID
+func (tr *TitularRepositorio) ListarTitularPorID(id string) (*models.Titular, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	var titular models.Titular
+	err = tr.db.Collection("titulares").FindOne(context.Background(), bson.M{"_id": objectID}).Decode(&titular)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return &titular, nil
+}
+
+// Listar Titulares pelos IDs, indexados pelo ID
+func (tr *TitularRepositorio) ListarTitularesPorIDs(ids []primitive.ObjectID) (map[primitive.ObjectID]*models.Titular, error) {
+	titulares := make(map[primitive.ObjectID]*models.Titular)
+	if len(ids) == 0 {
+		return titulares, nil
+	}
+
+	opcoes := options.Find().SetProjection(bson.M{"historico": 0})
+	cursor, err := tr.db.Collection("titulares").Find(context.Background(), bson.M{"_id": bson.M{"$in": ids}}, opcoes)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	for cursor.Next(context.Background()) {
+		var titular models.Titular
+		if err := cursor.Decode(&titular); err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		titulares[titular.ID] = &titular
+	}
+
+	if err := cursor.Err(); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return titulares, nil
+}
+
+// Editar Titular, acrescentando as alterações ao histórico
+func (tr *TitularRepositorio) EditarTitular(titular *models.Titular, alteracoes []models.AlteracaoTitular) error {
+	titular.UpdatedAt = time.Now()
+
+	update := bson.M{
+		"$set": bson.M{
+			"tp_ni":          titular.TpNI,
+			"nome":           titular.Nome,
+			"endereco":       titular.Endereco,
+			"pais_endereco":  titular.PaisEndereco,
+			"nacionalidade":  titular.Nacionalidade,
+			"campos_manuais": titular.CamposManuais,
+			"updated_at":     titular.UpdatedAt,
+
+			"telefones":              titular.Telefones,
+			"pais_nascimento":        titular.PaisNascimento,
+			"instrucoes_permanentes": titular.InstrucoesPermanentes,
+		},
+	}
+	if len(alteracoes) > 0 {
+		update["$push"] = bson.M{"historico": bson.M{"$each": alteracoes}}
+	}
+
+	_, err := tr.db.Collection("titulares").UpdateOne(context.Background(), bson.M{"_id": titular.ID}, update)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
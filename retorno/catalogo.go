@@ -0,0 +1,72 @@
+package retorno
+
+import (
+	_ "embed"
+	"encoding/json"
+	"strings"
+
+	"sped-efinanceira/models"
+)
+
+// CodigoRetorno explica uma ocorrência devolvida pela Receita e aponta os
+// campos do modelo que costumam precisar de correção
+type CodigoRetorno struct {
+	Codigo          string   `json:"codigo"`
+	Descricao       string   `json:"descricao"`
+	Explicacao      string   `json:"explicacao"`
+	CausasProvaveis []string `json:"causas_provaveis"`
+	Campos          []string `json:"campos"`
+}
+
+//go:embed catalogo.json
+var catalogoJSON []byte
+
+var catalogo = carregarCatalogo()
+
+func carregarCatalogo() map[string]*CodigoRetorno {
+	var lista []*CodigoRetorno
+	if err := json.Unmarshal(catalogoJSON, &lista); err != nil {
+		panic("catálogo de códigos de retorno inválido: " + err.Error())
+	}
+
+	codigos := make(map[string]*CodigoRetorno, len(lista))
+	for _, codigo := range lista {
+		codigos[normalizar(codigo.Codigo)] = codigo
+	}
+	return codigos
+}
+
+// Os retornos trazem o código ora com o prefixo MS, ora só com o número
+func normalizar(codigo string) string {
+	codigo = strings.ToUpper(strings.TrimSpace(codigo))
+	if codigo != "" && codigo[0] >= '0' && codigo[0] <= '9' {
+		for len(codigo) < 4 {
+			codigo = "0" + codigo
+		}
+		codigo = "MS" + codigo
+	}
+	return codigo
+}
+
+// BuscarCodigo retorna a explicação do código, se conhecido
+func BuscarCodigo(codigo string) (*CodigoRetorno, bool) {
+	encontrado, ok := catalogo[normalizar(codigo)]
+	return encontrado, ok
+}
+
+// Enriquecer completa as ocorrências com a explicação do catálogo; códigos
+// desconhecidos ficam como vieram
+func Enriquecer(ocorrencias []models.Ocorrencia) {
+	for i := range ocorrencias {
+		codigo, ok := BuscarCodigo(ocorrencias[i].Codigo)
+		if !ok {
+			continue
+		}
+		ocorrencias[i].Explicacao = codigo.Explicacao
+		ocorrencias[i].CausasProvaveis = codigo.CausasProvaveis
+		ocorrencias[i].Campos = codigo.Campos
+		if ocorrencias[i].Descricao == "" {
+			ocorrencias[i].Descricao = codigo.Descricao
+		}
+	}
+}
@@ -6,10 +6,13 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"sped-efinanceira/agenda"
 	"sped-efinanceira/controllers"
 	"sped-efinanceira/database"
+	"sped-efinanceira/importacao"
 	"sped-efinanceira/middlewares"
 	"sped-efinanceira/repositories"
+	"sped-efinanceira/semestre"
 
 	"github.com/gorilla/mux"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -70,8 +73,10 @@ func EnviarEmailHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write(jsonResponse)
 }
 
-// ConfiguraRotas configura as rotas e recebe o client do MongoDB
-func ConfiguraRotas(client *mongo.Client) *mux.Router {
+// ConfiguraRotas configura as rotas e recebe o client do MongoDB. Devolve
+// também o processador de transações das rotas, que o monitor da pasta de
+// entrada deve compartilhar.
+func ConfiguraRotas(client *mongo.Client) (*mux.Router, *importacao.ProcessadorTransacoes) {
 
 	dbURL := os.Getenv("DB_URL")
 	dbName := os.Getenv("DB_NAME")
@@ -92,9 +97,116 @@ func ConfiguraRotas(client *mongo.Client) *mux.Router {
 		log.Fatal("Erro ao conectar ao repositório de autenticação:", err)
 	}
 
+	eventoRepo, err := repositories.NovoEventoRepositorio(dbURL, dbName)
+	if err != nil {
+		log.Fatal("Erro ao conectar ao repositório de eventos:", err)
+	}
+
+	importacaoRepo, err := repositories.NovoImportacaoRepositorio(dbURL, dbName)
+	if err != nil {
+		log.Fatal("Erro ao conectar ao repositório de importações:", err)
+	}
+
+	movimentoContaRepo, err := repositories.NovoMovimentoContaRepositorio(dbURL, dbName)
+	if err != nil {
+		log.Fatal("Erro ao conectar ao repositório de movimentos de contas:", err)
+	}
+
+	titularRepo, err := repositories.NovoTitularRepositorio(dbURL, dbName)
+	if err != nil {
+		log.Fatal("Erro ao conectar ao repositório de titulares:", err)
+	}
+
+	contaRepo, err := repositories.NovoContaRepositorio(dbURL, dbName)
+	if err != nil {
+		log.Fatal("Erro ao conectar ao repositório de contas:", err)
+	}
+
+	crsRepo, err := repositories.NovoCRSRepositorio(dbURL, dbName)
+	if err != nil {
+		log.Fatal("Erro ao conectar ao repositório do CRS:", err)
+	}
+
+	classificacaoRepo, err := repositories.NovoClassificacaoRepositorio(dbURL, dbName)
+	if err != nil {
+		log.Fatal("Erro ao conectar ao repositório de classificações:", err)
+	}
+
+	cotacaoRepo, err := repositories.NovoCotacaoRepositorio(dbURL, dbName)
+	if err != nil {
+		log.Fatal("Erro ao conectar ao repositório de cotações:", err)
+	}
+
+	aprovacaoRepo, err := repositories.NovoAprovacaoRepositorio(dbURL, dbName)
+	if err != nil {
+		log.Fatal("Erro ao conectar ao repositório de aprovações:", err)
+	}
+
+	periodoRepo, err := repositories.NovoPeriodoRepositorio(dbURL, dbName)
+	if err != nil {
+		log.Fatal("Erro ao conectar ao repositório de períodos:", err)
+	}
+
+	sequenciaRepo, err := repositories.NovoSequenciaRepositorio(dbURL, dbName)
+	if err != nil {
+		log.Fatal("Erro ao conectar ao repositório de sequenciais de eventos:", err)
+	}
+
+	idempotenciaRepo, err := repositories.NovoIdempotenciaRepositorio(dbURL, dbName)
+	if err != nil {
+		log.Fatal("Erro ao conectar ao repositório de idempotência:", err)
+	}
+
+	agendamentoRepo, err := repositories.NovoAgendamentoRepositorio(dbURL, dbName)
+	if err != nil {
+		log.Fatal("Erro ao conectar ao repositório de agendamentos:", err)
+	}
+
+	qualidadeRepo, err := repositories.NovoQualidadeRepositorio(dbURL, dbName)
+	if err != nil {
+		log.Fatal("Erro ao conectar ao repositório de qualidade dos dados:", err)
+	}
+
+	// Retoma importações interrompidas a partir do último checkpoint
+	processadorTransacoes := importacao.NovoProcessadorTransacoes(importacaoRepo, movimentoContaRepo, periodoRepo)
+	go processadorTransacoes.RetomarImportacoes()
+
+	// Executa as etapas do semestre nos horários dos agendamentos ativos
+	agendador := agenda.NovoAgendador(agendamentoRepo, &semestre.Repositorios{
+		Eventos:         eventoRepo,
+		Importacoes:     importacaoRepo,
+		MovimentosConta: movimentoContaRepo,
+		Titulares:       titularRepo,
+		Contas:          contaRepo,
+		CRS:             crsRepo,
+		Cotacoes:        cotacaoRepo,
+		Periodos:        periodoRepo,
+		Aprovacoes:      aprovacaoRepo,
+		Usuarios:        usuarioRepo,
+		Perfis:          perfilRepo,
+		Sequencias:      sequenciaRepo,
+	})
+	go agendador.Iniciar()
+
 	// Inicializar o controlador de perfil
 	perfilController := controllers.NovoPerfilController(perfilRepo)
 	usuarioController := controllers.NovoUsuarioController(usuarioRepo, perfilRepo, authRepo)
+	eventoController := controllers.NovoEventoController(eventoRepo, importacaoRepo, movimentoContaRepo, titularRepo, contaRepo, crsRepo, cotacaoRepo, periodoRepo, sequenciaRepo)
+	importacaoController := controllers.NovoImportacaoController(eventoRepo, importacaoRepo, titularRepo, cotacaoRepo, periodoRepo, sequenciaRepo, processadorTransacoes)
+	titularController := controllers.NovoTitularController(titularRepo)
+	contaController := controllers.NovoContaController(contaRepo, titularRepo)
+	crsController := controllers.NovoCRSController(crsRepo, titularRepo)
+	classificacaoController := controllers.NovoClassificacaoController(classificacaoRepo, contaRepo, titularRepo, crsRepo)
+	cotacaoController := controllers.NovoCotacaoController(cotacaoRepo)
+	loteController := controllers.NovoLoteController(eventoRepo, titularRepo, crsRepo, periodoRepo, sequenciaRepo, importacaoRepo, movimentoContaRepo, contaRepo, cotacaoRepo)
+	codigoRetornoController := controllers.NovoCodigoRetornoController()
+	periodoController := controllers.NovoPeriodoController(periodoRepo, eventoRepo, sequenciaRepo)
+	calendarioController := controllers.NovoCalendarioController(eventoRepo, periodoRepo)
+	aprovacaoController := controllers.NovoAprovacaoController(aprovacaoRepo, eventoRepo, usuarioRepo, perfilRepo, periodoRepo, titularRepo, crsRepo)
+	agendamentoController := controllers.NovoAgendamentoController(agendamentoRepo, agendador)
+	analiseController := controllers.NovoAnaliseController(eventoRepo)
+	qualidadeController := controllers.NovoQualidadeController(qualidadeRepo, titularRepo, contaRepo, crsRepo, eventoRepo)
+	buscaController := controllers.NovoBuscaController(eventoRepo, titularRepo, contaRepo, crsRepo)
 
 	router := mux.NewRouter()
 
@@ -122,6 +234,9 @@ func ConfiguraRotas(client *mongo.Client) *mux.Router {
 	privateRoutes := router.PathPrefix("/").Subrouter()
 	privateRoutes.Use(middlewares.AutenticarMiddleware)
 
+	// POST com Idempotency-Key repetido devolve a resposta original
+	privateRoutes.Use(middlewares.NovoIdempotenciaMiddleware(idempotenciaRepo).Middleware)
+
 	// Rotas para perfis
 	privateRoutes.HandleFunc("/perfis", perfilController.CriarPerfil).Methods("POST").Name("CriarPerfil")
 	privateRoutes.HandleFunc("/perfis", perfilController.ListarTodosPerfis).Methods("GET").Name("ListarPerfil")
@@ -137,5 +252,99 @@ func ConfiguraRotas(client *mongo.Client) *mux.Router {
 	privateRoutes.HandleFunc("/usuarios/{id}", usuarioController.AtualizarUsuario).Methods("PUT").Name("AtualizarUsuario")
 	privateRoutes.HandleFunc("/usuarios/{id}", usuarioController.DeletarUsuario).Methods("DELETE").Name("DeletarUsuario")
 
-	return router
+	// Rotas para eventos
+	privateRoutes.HandleFunc("/eventos", eventoController.ListarEventos).Methods("GET").Name("ListarEventos")
+	privateRoutes.HandleFunc("/eventos/{id}", eventoController.ListarEventoPorID).Methods("GET").Name("ListarEventoPorID")
+	privateRoutes.HandleFunc("/eventos/{id}/xml", eventoController.BaixarXMLEvento).Methods("GET").Name("BaixarXMLEvento")
+	privateRoutes.HandleFunc("/eventos/{id}/status", eventoController.AlterarStatusEvento).Methods("POST").Name("AlterarStatusEvento")
+	privateRoutes.HandleFunc("/eventos/movimentos", eventoController.GerarMovimentos).Methods("POST").Name("GerarMovimentos")
+	privateRoutes.HandleFunc("/eventos/validacao", loteController.ValidarPeriodo).Methods("POST").Name("ValidarPeriodo")
+	privateRoutes.HandleFunc("/eventos/exclusoes/sugestoes", eventoController.SugerirExclusoes).Methods("GET").Name("SugerirExclusoes")
+	privateRoutes.HandleFunc("/eventos/exclusoes", eventoController.AceitarExclusoes).Methods("POST").Name("AceitarExclusoes")
+
+	// Rotas para lotes de envio
+	privateRoutes.HandleFunc("/lotes", loteController.GerarLotes).Methods("POST").Name("GerarLotes")
+	privateRoutes.HandleFunc("/lotes/simulacao", loteController.SimularEnvio).Methods("POST").Name("SimularEnvio")
+	privateRoutes.HandleFunc("/lotes/simulacao/{id}", loteController.BaixarSimulacao).Methods("GET").Name("BaixarSimulacao")
+
+	// Rotas para abertura, fechamento, reabertura e leiaute dos períodos
+	privateRoutes.HandleFunc("/periodos", periodoController.ListarPeriodos).Methods("GET").Name("ListarPeriodos")
+	privateRoutes.HandleFunc("/periodos/{declarante}/{periodo}", periodoController.BuscarPeriodo).Methods("GET").Name("BuscarPeriodo")
+	privateRoutes.HandleFunc("/periodos/{declarante}/{periodo}/reabertura", periodoController.ReabrirPeriodo).Methods("POST").Name("ReabrirPeriodo")
+	privateRoutes.HandleFunc("/periodos/{declarante}/{periodo}/layout", periodoController.DefinirVersaoLayout).Methods("PUT").Name("DefinirVersaoLayout")
+	privateRoutes.HandleFunc("/layouts", periodoController.ListarVersoesLayout).Methods("GET").Name("ListarVersoesLayout")
+
+	// Rotas para análises antes do envio
+	privateRoutes.HandleFunc("/analises/variacao", analiseController.AnalisarVariacao).Methods("GET").Name("AnalisarVariacao")
+
+	// Rotas para busca de eventos
+	privateRoutes.HandleFunc("/busca", buscaController.BuscarEventos).Methods("GET").Name("BuscarEventos")
+
+	// Rotas para qualidade dos dados
+	privateRoutes.HandleFunc("/qualidade", qualidadeController.GerarRelatorio).Methods("POST").Name("GerarRelatorioQualidade")
+	privateRoutes.HandleFunc("/qualidade", qualidadeController.ListarTendencia).Methods("GET").Name("ListarTendenciaQualidade")
+	privateRoutes.HandleFunc("/qualidade/{id}", qualidadeController.ListarRelatorioPorID).Methods("GET").Name("ListarRelatorioQualidadePorID")
+
+	// Rotas para o calendário de prazos
+	privateRoutes.HandleFunc("/calendario", calendarioController.ListarPrazos).Methods("GET").Name("ListarPrazos")
+	privateRoutes.HandleFunc("/calendario/feriados", calendarioController.ListarFeriados).Methods("GET").Name("ListarFeriados")
+
+	// Rotas para aprovação dos eventos antes da transmissão
+	privateRoutes.HandleFunc("/aprovacoes", aprovacaoController.SolicitarAprovacao).Methods("POST").Name("SolicitarAprovacao")
+	privateRoutes.HandleFunc("/aprovacoes", aprovacaoController.ListarAprovacoes).Methods("GET").Name("ListarAprovacoes")
+	privateRoutes.HandleFunc("/aprovacoes/{id}", aprovacaoController.ListarAprovacaoPorID).Methods("GET").Name("ListarAprovacaoPorID")
+	privateRoutes.HandleFunc("/aprovacoes/{id}/comentarios", aprovacaoController.ComentarAprovacao).Methods("POST").Name("ComentarAprovacao")
+	privateRoutes.HandleFunc("/aprovacoes/{id}/decisao", aprovacaoController.DecidirAprovacao).Methods("POST").Name("DecidirAprovacao")
+
+	// Rotas para agendamentos das etapas do semestre
+	privateRoutes.HandleFunc("/agendamentos", agendamentoController.CriarAgendamento).Methods("POST").Name("CriarAgendamento")
+	privateRoutes.HandleFunc("/agendamentos", agendamentoController.ListarAgendamentos).Methods("GET").Name("ListarAgendamentos")
+	privateRoutes.HandleFunc("/agendamentos/{id}", agendamentoController.ListarAgendamentoPorID).Methods("GET").Name("ListarAgendamentoPorID")
+	privateRoutes.HandleFunc("/agendamentos/{id}", agendamentoController.EditarAgendamento).Methods("PUT").Name("EditarAgendamento")
+	privateRoutes.HandleFunc("/agendamentos/{id}", agendamentoController.DeletarAgendamento).Methods("DELETE").Name("DeletarAgendamento")
+	privateRoutes.HandleFunc("/agendamentos/{id}/execucoes", agendamentoController.ExecutarAgendamento).Methods("POST").Name("ExecutarAgendamento")
+	privateRoutes.HandleFunc("/agendamentos/{id}/execucoes", agendamentoController.ListarExecucoes).Methods("GET").Name("ListarExecucoes")
+
+	// Rotas para importações
+	privateRoutes.HandleFunc("/importacoes/modelos/{tipo}", importacaoController.BaixarModeloPlanilha).Methods("GET").Name("BaixarModeloPlanilha")
+	privateRoutes.HandleFunc("/importacoes/planilha", importacaoController.ImportarPlanilha).Methods("POST").Name("ImportarPlanilha")
+	privateRoutes.HandleFunc("/importacoes/transacoes", importacaoController.ImportarTransacoes).Methods("POST").Name("ImportarTransacoes")
+	privateRoutes.HandleFunc("/importacoes/xml", importacaoController.ImportarXML).Methods("POST").Name("ImportarXML")
+	privateRoutes.HandleFunc("/importacoes/{id}", importacaoController.ListarImportacaoPorID).Methods("GET").Name("ListarImportacaoPorID")
+
+	// Rotas para titulares
+	privateRoutes.HandleFunc("/titulares", titularController.ListarTitulares).Methods("GET").Name("ListarTitulares")
+	privateRoutes.HandleFunc("/titulares/{id}", titularController.ListarTitularPorID).Methods("GET").Name("ListarTitularPorID")
+	privateRoutes.HandleFunc("/titulares/{id}", titularController.EditarTitular).Methods("PUT").Name("EditarTitular")
+
+	// Rotas para contas
+	privateRoutes.HandleFunc("/contas", contaController.CriarConta).Methods("POST").Name("CriarConta")
+	privateRoutes.HandleFunc("/contas", contaController.ListarContas).Methods("GET").Name("ListarContas")
+	privateRoutes.HandleFunc("/contas/{id}", contaController.ListarContaPorID).Methods("GET").Name("ListarContaPorID")
+	privateRoutes.HandleFunc("/contas/{id}", contaController.EditarConta).Methods("PUT").Name("EditarConta")
+
+	// Rotas para autocertificações e pessoas controladoras (CRS)
+	privateRoutes.HandleFunc("/titulares/{id}/autocertificacoes", crsController.CriarAutoCertificacao).Methods("POST").Name("CriarAutoCertificacao")
+	privateRoutes.HandleFunc("/titulares/{id}/autocertificacoes", crsController.ListarAutoCertificacoesTitular).Methods("GET").Name("ListarAutoCertificacoesTitular")
+	privateRoutes.HandleFunc("/autocertificacoes", crsController.ListarAutoCertificacoesVencendo).Methods("GET").Name("ListarAutoCertificacoesVencendo")
+	privateRoutes.HandleFunc("/autocertificacoes/{id}/arquivo", crsController.BaixarArquivoAutoCertificacao).Methods("GET").Name("BaixarArquivoAutoCertificacao")
+	privateRoutes.HandleFunc("/titulares/{id}/controladores", crsController.CriarPessoaControladora).Methods("POST").Name("CriarPessoaControladora")
+	privateRoutes.HandleFunc("/titulares/{id}/controladores", crsController.ListarPessoasControladoras).Methods("GET").Name("ListarPessoasControladoras")
+	privateRoutes.HandleFunc("/controladores/{id}", crsController.EditarPessoaControladora).Methods("PUT").Name("EditarPessoaControladora")
+	privateRoutes.HandleFunc("/controladores/{id}", crsController.DeletarPessoaControladora).Methods("DELETE").Name("DeletarPessoaControladora")
+
+	// Rotas para classificação FATCA/CRS das contas
+	privateRoutes.HandleFunc("/classificacoes", classificacaoController.ClassificarContas).Methods("POST").Name("ClassificarContas")
+	privateRoutes.HandleFunc("/classificacoes", classificacaoController.ListarClassificacoes).Methods("GET").Name("ListarClassificacoes")
+	privateRoutes.HandleFunc("/classificacoes/{id}", classificacaoController.ListarClassificacaoPorID).Methods("GET").Name("ListarClassificacaoPorID")
+	privateRoutes.HandleFunc("/classificacoes/{id}/revisao", classificacaoController.RevisarClassificacao).Methods("POST").Name("RevisarClassificacao")
+
+	// Rotas para cotações PTAX
+	privateRoutes.HandleFunc("/cotacoes/ptax", cotacaoController.ImportarPTAX).Methods("POST").Name("ImportarPTAX")
+	privateRoutes.HandleFunc("/cotacoes", cotacaoController.ListarCotacoes).Methods("GET").Name("ListarCotacoes")
+
+	// Rotas para o catálogo de códigos de retorno da Receita
+	privateRoutes.HandleFunc("/codigos-retorno/{codigo}", codigoRetornoController.BuscarCodigoRetorno).Methods("GET").Name("BuscarCodigoRetorno")
+
+	return router, processadorTransacoes
 }
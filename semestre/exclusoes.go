@@ -0,0 +1,92 @@
+package semestre
+
+import (
+	"fmt"
+	"strings"
+
+	"sped-efinanceira/eventos"
+	"sped-efinanceira/models"
+	"sped-efinanceira/validacao"
+)
+
+// SugerirExclusoes lista os movimentos aceitos do período que deixariam de
+// ser declarados com os movimentos gerados na retificação
+func SugerirExclusoes(repos *Repositorios, declarante, periodo string) ([]eventos.SugestaoExclusao, error) {
+	existentes, err := eventosParaExclusao(repos, declarante, periodo)
+	if err != nil {
+		return nil, err
+	}
+	return eventos.SugerirExclusoes(existentes), nil
+}
+
+// AceitarExclusoes cria, em rascunho, as exclusões sugeridas para os recibos
+// informados; sem recibos, aceita todas as sugestões
+func AceitarExclusoes(repos *Repositorios, declarante, periodo string, recibos []string, usuario string) ([]*models.Evento, error) {
+	existentes, err := eventosParaExclusao(repos, declarante, periodo)
+	if err != nil {
+		return nil, err
+	}
+
+	sugeridos := make(map[string]bool)
+	var escolhidos []string
+	for _, sugestao := range eventos.SugerirExclusoes(existentes) {
+		sugeridos[sugestao.Recibo] = true
+		if len(recibos) == 0 {
+			escolhidos = append(escolhidos, sugestao.Recibo)
+		}
+	}
+
+	var invalidos []string
+	for _, recibo := range recibos {
+		if sugeridos[recibo] {
+			escolhidos = append(escolhidos, recibo)
+			delete(sugeridos, recibo)
+		} else {
+			invalidos = append(invalidos, recibo)
+		}
+	}
+	if len(invalidos) > 0 {
+		return nil, fmt.Errorf("recibo(s) sem exclusão sugerida no período: %s", strings.Join(invalidos, ", "))
+	}
+	if len(escolhidos) == 0 {
+		return nil, fmt.Errorf("nenhuma exclusão sugerida no período %s", periodo)
+	}
+
+	var exclusoes []*models.Evento
+	for _, recibo := range escolhidos {
+		exclusao := eventos.NovaExclusao(declarante, periodo, recibo)
+		exclusao.CriadoPor = usuario
+		exclusoes = append(exclusoes, exclusao)
+	}
+
+	if err := eventos.AtribuirIDs(repos.Sequencias, exclusoes...); err != nil {
+		return nil, err
+	}
+	if err := repos.Eventos.CriarEventos(exclusoes); err != nil {
+		return nil, err
+	}
+	return exclusoes, nil
+}
+
+// Eventos do período, exigindo movimentos gerados para comparar: sem eles,
+// todos os aceitos pareceriam ausentes
+func eventosParaExclusao(repos *Repositorios, declarante, periodo string) ([]*models.Evento, error) {
+	if !validacao.CNPJValido(declarante) {
+		return nil, fmt.Errorf("O CNPJ do declarante é inválido.")
+	}
+	if _, _, err := eventos.LimitesPeriodo(periodo); err != nil {
+		return nil, err
+	}
+
+	existentes, err := repos.Eventos.ListarEventos(declarante, periodo, "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, evento := range existentes {
+		if evento.Movimento != nil && eventos.Editavel(evento.Status) {
+			return existentes, nil
+		}
+	}
+	return nil, fmt.Errorf("o período %s não tem movimentos gerados para comparar com os aceitos", periodo)
+}
@@ -0,0 +1,129 @@
+package semestre
+
+import (
+	"log"
+
+	"sped-efinanceira/agregacao"
+	"sped-efinanceira/cadastro"
+	"sped-efinanceira/cambio"
+	"sped-efinanceira/eventos"
+	"sped-efinanceira/models"
+)
+
+// ErroConversao indica que a conversão cambial dos movimentos falhou, em
+// geral por falta de cotação PTAX para a moeda ou o mês
+type ErroConversao struct {
+	Err error
+}
+
+func (e *ErroConversao) Error() string {
+	return e.Err.Error()
+}
+
+// GerarMovimentos gera os eventos de movimento (evtMovOpFin) a partir dos
+// totais das importações de transações concluídas. Rascunhos gerados
+// anteriormente para o mesmo período são substituídos.
+func GerarMovimentos(repos *Repositorios, declarante, periodo, usuario string) ([]*models.Evento, error) {
+	gerados, err := montarMovimentos(repos, declarante, periodo, usuario)
+	if err != nil {
+		return nil, err
+	}
+
+	err = cadastro.VincularTitulares(repos.Titulares, gerados, eventos.OrigemAgregacao)
+	if err == nil {
+		_, err = repos.Eventos.DeletarRascunhos(declarante, periodo, eventos.TipoMovimento, eventos.OrigemAgregacao)
+	}
+	if err == nil {
+		// As retificadoras criadas na reabertura dão lugar às geradas
+		_, err = repos.Eventos.DeletarRascunhos(declarante, periodo, eventos.TipoMovimento, eventos.OrigemReabertura)
+	}
+	if err == nil {
+		err = eventos.AtribuirIDs(repos.Sequencias, gerados...)
+	}
+	if err == nil {
+		err = repos.Eventos.CriarEventos(gerados)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cadastro.ResolverDeclarados(repos.Titulares, repos.CRS, gerados...); err != nil {
+		log.Println("Erro ao consultar o cadastro de titulares:", err)
+	}
+
+	return gerados, nil
+}
+
+// Monta os eventos de movimento do período sem gravar nada: nem os eventos
+// nem o cadastro de titulares
+func montarMovimentos(repos *Repositorios, declarante, periodo, usuario string) ([]*models.Evento, error) {
+	inicio, fim, err := eventos.LimitesPeriodo(periodo)
+	if err != nil {
+		return nil, err
+	}
+
+	importacoes, err := repos.Importacoes.ListarIDsImportacoesConcluidas(declarante, periodo)
+	if err != nil {
+		return nil, err
+	}
+
+	movimentos, err := repos.MovimentosConta.ListarMovimentos(declarante, periodo, importacoes)
+	if err != nil {
+		return nil, err
+	}
+
+	// O semestre anterior fornece o saldo inicial das contas
+	periodoAnterior, _ := eventos.PeriodoAnterior(periodo)
+	anteriores, err := repos.Eventos.ListarEventos(declarante, periodoAnterior, eventos.TipoMovimento, "")
+	if err != nil {
+		return nil, err
+	}
+	anteriores = eventos.MovimentosVigentes(anteriores)
+
+	// Cadastro das contas movimentadas no período ou declaradas no anterior
+	var numeros []string
+	for _, movimento := range movimentos {
+		numeros = append(numeros, movimento.NumConta)
+	}
+	for _, anterior := range anteriores {
+		if anterior.Movimento != nil {
+			for _, conta := range anterior.Movimento.Contas {
+				numeros = append(numeros, conta.NumConta)
+			}
+		}
+	}
+
+	cadastradas, err := repos.Contas.ListarContasPorNumeros(declarante, numeros)
+	if err != nil {
+		return nil, err
+	}
+
+	// Movimentos de contas conjuntas ficam no documento do titular principal
+	agregador := agregacao.NovoAgregador(inicio, fim)
+	for _, movimento := range movimentos {
+		if cadastrada, ok := cadastradas[movimento.NumConta]; ok {
+			movimento.Documento = eventos.TitularPrincipal(cadastrada, movimento.Documento)
+		}
+		agregador.Mesclar(*movimento)
+	}
+	eventos.AplicarSaldosAnteriores(agregador, anteriores, cadastradas)
+
+	gerados := eventos.GerarMovimentos(declarante, periodo, agregador.Contas(), cadastradas)
+	for _, evento := range gerados {
+		evento.CriadoPor = usuario
+	}
+
+	// Contas em moeda estrangeira são declaradas em reais pela PTAX
+	if err := cambio.NovoConversor(repos.Cotacoes).ConverterEventos(gerados); err != nil {
+		return nil, &ErroConversao{Err: err}
+	}
+
+	// Declarados com movimento já aceito recebem uma retificadora
+	aceitos, err := repos.Eventos.ListarEventos(declarante, periodo, eventos.TipoMovimento, models.EventoAceito)
+	if err != nil {
+		return nil, err
+	}
+	eventos.MarcarRetificacoes(gerados, aceitos)
+
+	return gerados, nil
+}
@@ -0,0 +1,46 @@
+package semestre
+
+import (
+	"sped-efinanceira/eventos"
+	"sped-efinanceira/models"
+)
+
+// IniciarRetificacao cria, na reabertura do período, as retificadoras em
+// rascunho dos movimentos e do fechamento aceitos. Eventos aceitos que já têm
+// retificadora pendente ficam de fora. Os aceitos passam a retificados quando
+// a Receita aceitar as retificadoras.
+func IniciarRetificacao(repos *Repositorios, declarante, periodo, usuario string) ([]*models.Evento, error) {
+	existentes, err := repos.Eventos.ListarEventos(declarante, periodo, "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	pendentes := make(map[string]bool)
+	for _, evento := range existentes {
+		if evento.NrReciboAnterior != "" && (eventos.Editavel(evento.Status) || eventos.Enviado(evento.Status)) {
+			pendentes[evento.NrReciboAnterior] = true
+		}
+	}
+
+	var retificadoras []*models.Evento
+	for _, evento := range existentes {
+		if evento.Status != models.EventoAceito || evento.Recibo == "" || pendentes[evento.Recibo] {
+			continue
+		}
+		if evento.Tipo != eventos.TipoMovimento && evento.Tipo != eventos.TipoFechamento {
+			continue
+		}
+		retificadoras = append(retificadoras, eventos.NovaRetificacao(evento, usuario))
+	}
+	if len(retificadoras) == 0 {
+		return nil, nil
+	}
+
+	if err := eventos.AtribuirIDs(repos.Sequencias, retificadoras...); err != nil {
+		return nil, err
+	}
+	if err := repos.Eventos.CriarEventos(retificadoras); err != nil {
+		return nil, err
+	}
+	return retificadoras, nil
+}
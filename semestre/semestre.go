@@ -0,0 +1,216 @@
+package semestre
+
+import (
+	"fmt"
+
+	"sped-efinanceira/aprovacao"
+	"sped-efinanceira/eventos"
+	"sped-efinanceira/models"
+	"sped-efinanceira/repositories"
+)
+
+// Repositorios reúne o que as etapas do semestre consultam e gravam
+type Repositorios struct {
+	Eventos         *repositories.EventoRepositorio
+	Importacoes     *repositories.ImportacaoRepositorio
+	MovimentosConta *repositories.MovimentoContaRepositorio
+	Titulares       *repositories.TitularRepositorio
+	Contas          *repositories.ContaRepositorio
+	CRS             *repositories.CRSRepositorio
+	Cotacoes        *repositories.CotacaoRepositorio
+	Periodos        *repositories.PeriodoRepositorio
+	Aprovacoes      *repositories.AprovacaoRepositorio
+	Usuarios        *repositories.UsuarioRepositorio
+	Perfis          *repositories.PerfilRepositorio
+	Sequencias      *repositories.SequenciaRepositorio
+}
+
+// VerificarImportacoes confere se as importações de transações do período
+// terminaram e devolve quantas foram concluídas
+func VerificarImportacoes(repos *Repositorios, declarante, periodo string) (int, error) {
+	importacoes, err := repos.Importacoes.ListarImportacoes(declarante, periodo)
+	if err != nil {
+		return 0, err
+	}
+
+	concluidas := 0
+	for _, importacao := range importacoes {
+		switch importacao.Status {
+		case models.ImportacaoPendente, models.ImportacaoProcessando:
+			return 0, fmt.Errorf("a importação %s (%s) ainda está em processamento", importacao.ID.Hex(), importacao.NomeArquivo)
+		case models.ImportacaoConcluida:
+			concluidas++
+		}
+	}
+
+	if concluidas == 0 {
+		return 0, fmt.Errorf("nenhuma importação concluída para o declarante %s no período %s", declarante, periodo)
+	}
+	return concluidas, nil
+}
+
+// GerarAbertura cria a abertura do período com os responsáveis da última
+// abertura aceita do declarante. Se o período já tem abertura, devolve a
+// existente e false.
+func GerarAbertura(repos *Repositorios, declarante, periodo, usuario string) (*models.Evento, bool, error) {
+	abertura, novo, err := montarAbertura(repos, declarante, periodo, usuario)
+	if err != nil || !novo {
+		return abertura, false, err
+	}
+
+	if err := eventos.AtribuirIDs(repos.Sequencias, abertura); err != nil {
+		return nil, false, err
+	}
+	if err := repos.Eventos.CriarEvento(abertura); err != nil {
+		return nil, false, err
+	}
+	return abertura, true, nil
+}
+
+// Monta a abertura sem gravar; devolve a existente e false quando o período
+// já tem uma
+func montarAbertura(repos *Repositorios, declarante, periodo, usuario string) (*models.Evento, bool, error) {
+	inicio, fim, err := eventos.LimitesPeriodo(periodo)
+	if err != nil {
+		return nil, false, err
+	}
+
+	existente, err := eventoDoPeriodo(repos, declarante, periodo, eventos.TipoAbertura)
+	if err != nil || existente != nil {
+		return existente, false, err
+	}
+
+	aceitas, err := repos.Eventos.ListarEventos(declarante, "", eventos.TipoAbertura, models.EventoAceito)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var anterior *models.Evento
+	for _, aceita := range aceitas {
+		if aceita.Abertura != nil && (anterior == nil || aceita.Periodo > anterior.Periodo) {
+			anterior = aceita
+		}
+	}
+	if anterior == nil {
+		return nil, false, fmt.Errorf("o declarante %s não tem abertura aceita de onde copiar os responsáveis", declarante)
+	}
+
+	abertura := &models.Evento{
+		Tipo:       eventos.TipoAbertura,
+		Declarante: declarante,
+		Periodo:    periodo,
+		Status:     models.EventoRascunho,
+		Origem:     eventos.OrigemAgenda,
+		CriadoPor:  usuario,
+		Abertura: &models.AberturaeFinanceira{
+			DtInicio:       inicio,
+			DtFim:          fim,
+			ResponsavelRMF: anterior.Abertura.ResponsavelRMF,
+			RespeFin:       anterior.Abertura.RespeFin,
+			RepresLegal:    anterior.Abertura.RepresLegal,
+		},
+	}
+	return abertura, true, nil
+}
+
+// GerarFechamento cria o fechamento do período, sem situação especial e com
+// os totais dos movimentos por mês. Se o período já tem fechamento, devolve o
+// existente e false.
+func GerarFechamento(repos *Repositorios, declarante, periodo, usuario string) (*models.Evento, bool, error) {
+	fechamento, novo, err := montarFechamento(repos, declarante, periodo, usuario)
+	if err != nil || !novo {
+		return fechamento, false, err
+	}
+
+	if err := eventos.AtribuirIDs(repos.Sequencias, fechamento); err != nil {
+		return nil, false, err
+	}
+	if err := repos.Eventos.CriarEvento(fechamento); err != nil {
+		return nil, false, err
+	}
+	return fechamento, true, nil
+}
+
+// Monta o fechamento sem gravar; devolve o existente e false quando o
+// período já tem um
+func montarFechamento(repos *Repositorios, declarante, periodo, usuario string) (*models.Evento, bool, error) {
+	inicio, fim, err := eventos.LimitesPeriodo(periodo)
+	if err != nil {
+		return nil, false, err
+	}
+
+	existente, err := eventoDoPeriodo(repos, declarante, periodo, eventos.TipoFechamento)
+	if err != nil || existente != nil {
+		return existente, false, err
+	}
+
+	// Os totais contam os movimentos que serão enviados ou já valem no período
+	lista, err := repos.Eventos.ListarEventos(declarante, periodo, eventos.TipoMovimento, "")
+	if err != nil {
+		return nil, false, err
+	}
+	var movimentos []*models.Evento
+	for _, evento := range lista {
+		switch evento.Status {
+		case models.EventoRejeitado, models.EventoRetificado, models.EventoExcluido:
+			continue
+		}
+		movimentos = append(movimentos, evento)
+	}
+
+	fechamento := &models.Evento{
+		Tipo:       eventos.TipoFechamento,
+		Declarante: declarante,
+		Periodo:    periodo,
+		Status:     models.EventoRascunho,
+		Origem:     eventos.OrigemAgenda,
+		CriadoPor:  usuario,
+		Fechamento: &models.FechamentoeFinanceira{
+			DtInicio:    inicio,
+			DtFim:       fim,
+			SitEspecial: "0",
+			Meses:       eventos.TotaisFechamento(movimentos),
+		},
+	}
+	return fechamento, true, nil
+}
+
+// SolicitarTransmissao pede a aprovação de todos os eventos validados do
+// período, último passo antes da geração dos lotes
+func SolicitarTransmissao(repos *Repositorios, declarante, periodo, usuario, comentario string) (*models.Aprovacao, error) {
+	pedido := &models.Aprovacao{
+		Declarante:  declarante,
+		Periodo:     periodo,
+		Solicitante: usuario,
+		Comentario:  comentario,
+		Situacao:    models.AprovacaoPendente,
+	}
+
+	if _, err := aprovacao.EventosDaAprovacao(repos.Eventos, repos.Aprovacoes, pedido); err != nil {
+		return nil, err
+	}
+	if err := repos.Aprovacoes.CriarAprovacao(pedido); err != nil {
+		return nil, err
+	}
+
+	go aprovacao.NotificarPedido(repos.Usuarios, repos.Perfis, pedido)
+	return pedido, nil
+}
+
+// Evento do tipo que ainda vale para o período: não rejeitado nem
+// substituído por retificação ou exclusão
+func eventoDoPeriodo(repos *Repositorios, declarante, periodo, tipo string) (*models.Evento, error) {
+	lista, err := repos.Eventos.ListarEventos(declarante, periodo, tipo, "")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, evento := range lista {
+		switch evento.Status {
+		case models.EventoRejeitado, models.EventoRetificado, models.EventoExcluido:
+			continue
+		}
+		return evento, nil
+	}
+	return nil, nil
+}
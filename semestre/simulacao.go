@@ -0,0 +1,261 @@
+package semestre
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"sped-efinanceira/cadastro"
+	"sped-efinanceira/eventos"
+	"sped-efinanceira/layout"
+	"sped-efinanceira/models"
+	"sped-efinanceira/regras"
+	"sped-efinanceira/retorno"
+	"sped-efinanceira/validacao"
+)
+
+// Código do retorno da Receita para XML fora do esquema
+const codigoErroXSD = "MS0030"
+
+// Simulacao resume o que seria transmitido para o período
+type Simulacao struct {
+	ID                 string                   `json:"id"`
+	Declarante         string                   `json:"declarante"`
+	Periodo            string                   `json:"periodo"`
+	VersaoLayout       string                   `json:"versao_layout"`
+	Valida             bool                     `json:"valida"`
+	TotalEventos       int                      `json:"total_eventos"`
+	EventosPorTipo     map[string]int           `json:"eventos_por_tipo"`
+	PendentesAprovacao int                      `json:"pendentes_aprovacao"`
+	Assinada           bool                     `json:"assinada"`
+	Certificado        string                   `json:"certificado,omitempty"`
+	ValidadaXSD        bool                     `json:"validada_xsd"`
+	TotalLotes         int                      `json:"total_lotes"`
+	Lotes              []LoteSimulado           `json:"lotes"`
+	TotalBytes         int                      `json:"total_bytes"`
+	BytesZIP           int64                    `json:"bytes_zip"`
+	Avisos             []string                 `json:"avisos,omitempty"`
+	Eventos            []regras.ResultadoEvento `json:"eventos"`
+	CriadaEm           time.Time                `json:"criada_em"`
+}
+
+type LoteSimulado struct {
+	Arquivo string `json:"arquivo"`
+	Eventos int    `json:"eventos"`
+	Bytes   int    `json:"bytes"`
+}
+
+// SimularEnvio monta o envio do período como se fosse transmiti-lo: gera em
+// memória a abertura, os movimentos e o fechamento como as etapas do
+// semestre fariam, junta os demais eventos pendentes, aplica as regras de
+// negócio, gera o XML de cada evento, assina com o certificado (quando
+// informado), valida contra os XSD e distribui em lotes, na versão do
+// leiaute do período. Nada é gravado: eventos sem identificador recebem um
+// provisório apenas para a simulação.
+func SimularEnvio(repos *Repositorios, declarante, periodo string, assinador *layout.Assinador) (*Simulacao, [][]byte, error) {
+	if !validacao.CNPJValido(declarante) {
+		return nil, nil, fmt.Errorf("O CNPJ do declarante é inválido.")
+	}
+	if _, _, err := eventos.LimitesPeriodo(periodo); err != nil {
+		return nil, nil, err
+	}
+	versao, err := VersaoLayout(repos.Periodos, declarante, periodo)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	existentes, lote, avisos, err := montarEnvio(repos, declarante, periodo)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(lote) == 0 {
+		return nil, nil, fmt.Errorf("nenhum evento pendente de envio no período %s", periodo)
+	}
+	sort.SliceStable(lote, func(i, j int) bool {
+		return eventos.OrdemEnvio(lote[i].Tipo) < eventos.OrdemEnvio(lote[j].Tipo)
+	})
+
+	if err := cadastro.ResolverDeclarados(repos.Titulares, repos.CRS, lote...); err != nil {
+		return nil, nil, err
+	}
+
+	agora := time.Now()
+	simulacao := &Simulacao{
+		ID:             fmt.Sprintf("%s_%s_%s_%s", declarante, periodo, agora.Format("20060102150405"), primitive.NewObjectID().Hex()),
+		Declarante:     declarante,
+		Periodo:        periodo,
+		VersaoLayout:   versao.Codigo,
+		TotalEventos:   len(lote),
+		EventosPorTipo: make(map[string]int),
+		Assinada:       assinador != nil,
+		ValidadaXSD:    true,
+		Avisos:         avisos,
+		CriadaEm:       agora,
+	}
+	if assinador != nil {
+		simulacao.Certificado = assinador.Titular()
+	}
+
+	provisorios := 0
+	for i, evento := range lote {
+		simulacao.EventosPorTipo[evento.Tipo]++
+		if evento.Status != models.EventoAprovado {
+			simulacao.PendentesAprovacao++
+		}
+		if evento.IDEvento == "" {
+			evento.IDEvento = eventos.IDEvento(declarante, agora, i+1)
+			provisorios++
+		}
+	}
+	if provisorios > 0 {
+		simulacao.Avisos = append(simulacao.Avisos, fmt.Sprintf("%d evento(s) sem identificador receberam um provisório só para a simulação", provisorios))
+	}
+	if simulacao.PendentesAprovacao > 0 {
+		simulacao.Avisos = append(simulacao.Avisos, fmt.Sprintf("%d evento(s) ainda sem aprovação não seriam aceitos na geração dos lotes", simulacao.PendentesAprovacao))
+	}
+
+	ctx := regras.NovoContexto(declarante, periodo, existentes, lote)
+	simulacao.Eventos = regras.Validar(ctx, lote)
+
+	tpAmb := layout.AmbienteConfigurado()
+	eventosXML := make([]layout.EventoXML, 0, len(lote))
+	for i, evento := range lote {
+		// Eventos importados já trazem o XML original, com a assinatura
+		conteudo := []byte(evento.XML)
+		if evento.XML == "" {
+			conteudo, err = versao.GerarXML(evento, tpAmb)
+			if err == nil && assinador != nil {
+				conteudo, err = assinador.Assinar(conteudo)
+			}
+			if err != nil {
+				return nil, nil, fmt.Errorf("evento %s: %v", evento.ID.Hex(), err)
+			}
+		}
+		eventosXML = append(eventosXML, layout.EventoXML{ID: evento.IDEvento, XML: conteudo})
+
+		if !simulacao.ValidadaXSD {
+			continue
+		}
+		violacoes, err := versao.ValidarXSD(evento.Tipo, conteudo)
+		if err != nil {
+			simulacao.ValidadaXSD = false
+			simulacao.Avisos = append(simulacao.Avisos, "Validação XSD não executada: "+err.Error())
+			continue
+		}
+		adicionarViolacoesXSD(&simulacao.Eventos[i], evento, violacoes)
+	}
+
+	lotes, err := versao.MontarLotes(eventosXML)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for i, conteudo := range lotes {
+		quantidade := len(lote) - i*layout.MaximoEventosLote
+		if quantidade > layout.MaximoEventosLote {
+			quantidade = layout.MaximoEventosLote
+		}
+		simulacao.Lotes = append(simulacao.Lotes, LoteSimulado{
+			Arquivo: NomeArquivoLote(i),
+			Eventos: quantidade,
+			Bytes:   len(conteudo),
+		})
+		simulacao.TotalBytes += len(conteudo)
+	}
+	simulacao.TotalLotes = len(lotes)
+	simulacao.Valida = regras.Validos(simulacao.Eventos)
+
+	return simulacao, lotes, nil
+}
+
+// Monta em memória os eventos que a transmissão do período levaria. Devolve
+// os eventos gravados que continuam valendo e o lote: os pendentes gravados
+// mais a abertura, os movimentos e o fechamento gerados. Os movimentos
+// gerados tomam o lugar dos rascunhos de agregação e de reabertura, como em
+// GerarMovimentos.
+func montarEnvio(repos *Repositorios, declarante, periodo string) ([]*models.Evento, []*models.Evento, []string, error) {
+	gravados, err := repos.Eventos.ListarEventos(declarante, periodo, "", "")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var avisos []string
+	var gerados []*models.Evento
+
+	abertura, novo, err := montarAbertura(repos, declarante, periodo, eventos.UsuarioSistema)
+	if err != nil {
+		avisos = append(avisos, "Abertura não gerada: "+err.Error())
+	} else if novo {
+		gerados = append(gerados, abertura)
+	}
+
+	substituir := false
+	if _, err := VerificarImportacoes(repos, declarante, periodo); err != nil {
+		avisos = append(avisos, "Movimentos não gerados: "+err.Error())
+	} else {
+		movimentos, err := montarMovimentos(repos, declarante, periodo, eventos.UsuarioSistema)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if err := cadastro.LocalizarTitulares(repos.Titulares, movimentos); err != nil {
+			return nil, nil, nil, err
+		}
+		gerados = append(gerados, movimentos...)
+		substituir = true
+	}
+
+	fechamento, novo, err := montarFechamento(repos, declarante, periodo, eventos.UsuarioSistema)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if novo {
+		gerados = append(gerados, fechamento)
+	}
+
+	var existentes, lote []*models.Evento
+	for _, evento := range gravados {
+		if substituir && evento.Tipo == eventos.TipoMovimento && eventos.Editavel(evento.Status) &&
+			(evento.Origem == eventos.OrigemAgregacao || evento.Origem == eventos.OrigemReabertura) {
+			continue
+		}
+		existentes = append(existentes, evento)
+		if eventos.Editavel(evento.Status) {
+			lote = append(lote, evento)
+		}
+	}
+
+	// As regras distinguem os eventos do lote pelo ID
+	for _, evento := range gerados {
+		evento.ID = primitive.NewObjectID()
+	}
+	lote = append(lote, gerados...)
+
+	return existentes, lote, avisos, nil
+}
+
+// NomeArquivoLote é o nome do lote dentro do ZIP: lote_001.xml, lote_002.xml...
+func NomeArquivoLote(indice int) string {
+	return fmt.Sprintf("lote_%03d.xml", indice+1)
+}
+
+func adicionarViolacoesXSD(resultado *regras.ResultadoEvento, evento *models.Evento, violacoes []string) {
+	if len(violacoes) == 0 {
+		return
+	}
+
+	var ocorrencias []models.Ocorrencia
+	for _, violacao := range violacoes {
+		ocorrencias = append(ocorrencias, models.Ocorrencia{
+			Tipo:        models.OcorrenciaErro,
+			Localizacao: regras.Caminho(evento),
+			Codigo:      codigoErroXSD,
+			Descricao:   violacao,
+		})
+	}
+	retorno.Enriquecer(ocorrencias)
+
+	resultado.Ocorrencias = append(resultado.Ocorrencias, ocorrencias...)
+	resultado.Valido = false
+}
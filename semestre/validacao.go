@@ -0,0 +1,94 @@
+package semestre
+
+import (
+	"fmt"
+	"sort"
+
+	"sped-efinanceira/cadastro"
+	"sped-efinanceira/eventos"
+	"sped-efinanceira/models"
+	"sped-efinanceira/regras"
+	"sped-efinanceira/validacao"
+)
+
+// Validar aplica as regras aos eventos ainda não assinados do período,
+// considerando os demais eventos gravados, registra as ocorrências e
+// atualiza o status: rascunhos sem erros passam a validados e eventos com
+// erros voltam a rascunho, perdendo a aprovação
+func Validar(repos *Repositorios, declarante, periodo, usuario string) ([]*models.Evento, []regras.ResultadoEvento, error) {
+	if !validacao.CNPJValido(declarante) {
+		return nil, nil, fmt.Errorf("O CNPJ do declarante é inválido.")
+	}
+	if _, _, err := eventos.LimitesPeriodo(periodo); err != nil {
+		return nil, nil, err
+	}
+
+	existentes, err := repos.Eventos.ListarEventos(declarante, periodo, "", "")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var lote []*models.Evento
+	for _, evento := range existentes {
+		if eventos.Editavel(evento.Status) {
+			lote = append(lote, evento)
+		}
+	}
+	sort.SliceStable(lote, func(i, j int) bool {
+		return eventos.OrdemEnvio(lote[i].Tipo) < eventos.OrdemEnvio(lote[j].Tipo)
+	})
+
+	if err := atribuirIDsPendentes(repos, lote); err != nil {
+		return nil, nil, err
+	}
+
+	if err := cadastro.ResolverDeclarados(repos.Titulares, repos.CRS, lote...); err != nil {
+		return nil, nil, err
+	}
+
+	ctx := regras.NovoContexto(declarante, periodo, existentes, lote)
+	resultados := regras.Validar(ctx, lote)
+	for i, resultado := range resultados {
+		if err := repos.Eventos.RegistrarOcorrencias(lote[i].ID, resultado.Ocorrencias); err != nil {
+			return nil, nil, err
+		}
+
+		status := lote[i].Status
+		if !resultado.Valido {
+			status = models.EventoRascunho
+		} else if status == models.EventoRascunho {
+			status = models.EventoValidado
+		}
+		if lote[i].Status != status {
+			if err := eventos.AlterarStatus(repos.Eventos, lote[i], status, usuario, "Validação das regras de negócio"); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	return lote, resultados, nil
+}
+
+// Eventos gravados antes do serviço de identificadores (ou por rotinas que não
+// o usam) recebem o ID aqui, antes das regras e da montagem dos lotes
+func atribuirIDsPendentes(repos *Repositorios, lote []*models.Evento) error {
+	var pendentes []*models.Evento
+	for _, evento := range lote {
+		if evento.IDEvento == "" {
+			pendentes = append(pendentes, evento)
+		}
+	}
+	if len(pendentes) == 0 {
+		return nil
+	}
+
+	if err := eventos.AtribuirIDs(repos.Sequencias, pendentes...); err != nil {
+		return err
+	}
+	for _, evento := range pendentes {
+		if err := repos.Eventos.RegistrarIDEvento(evento.ID, evento.IDEvento); err != nil {
+			return fmt.Errorf("evento %s: %v", evento.ID.Hex(), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+package semestre
+
+import (
+	"sped-efinanceira/layout"
+	"sped-efinanceira/repositories"
+)
+
+// VersaoLayout é a versão do leiaute dos eventos do período: a escolhida
+// para o declarante ou, sem escolha, a vigente no período
+func VersaoLayout(periodos *repositories.PeriodoRepositorio, declarante, periodo string) (*layout.Versao, error) {
+	registro, err := periodos.BuscarPeriodo(declarante, periodo)
+	if err != nil {
+		return nil, err
+	}
+
+	codigo := ""
+	if registro != nil {
+		codigo = registro.VersaoLayout
+	}
+	return layout.VersaoPara(codigo, periodo)
+}
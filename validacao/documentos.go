@@ -0,0 +1,78 @@
+package validacao
+
+import (
+	"strings"
+	"unicode"
+)
+
+// SomenteDigitos remove pontuação de CPF/CNPJ
+func SomenteDigitos(valor string) string {
+	var b strings.Builder
+	for _, r := range valor {
+		if unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// CPFValido verifica os dígitos verificadores de um CPF
+func CPFValido(cpf string) bool {
+	cpf = SomenteDigitos(cpf)
+	if len(cpf) != 11 || repetido(cpf) {
+		return false
+	}
+
+	return digitoVerificador(cpf[:9], 10) == cpf[9] && digitoVerificador(cpf[:10], 11) == cpf[10]
+}
+
+// CNPJValido verifica os dígitos verificadores de um CNPJ
+func CNPJValido(cnpj string) bool {
+	cnpj = SomenteDigitos(cnpj)
+	if len(cnpj) != 14 || repetido(cnpj) {
+		return false
+	}
+
+	pesos := []int{6, 5, 4, 3, 2, 9, 8, 7, 6, 5, 4, 3, 2}
+	return digitoCNPJ(cnpj[:12], pesos[1:]) == cnpj[12] && digitoCNPJ(cnpj[:13], pesos) == cnpj[13]
+}
+
+// DocumentoValido aceita tanto CPF quanto CNPJ
+func DocumentoValido(documento string) bool {
+	documento = SomenteDigitos(documento)
+	switch len(documento) {
+	case 11:
+		return CPFValido(documento)
+	case 14:
+		return CNPJValido(documento)
+	}
+	return false
+}
+
+func digitoVerificador(base string, pesoInicial int) byte {
+	soma := 0
+	for i, r := range base {
+		soma += int(r-'0') * (pesoInicial - i)
+	}
+	resto := (soma * 10) % 11
+	if resto == 10 {
+		resto = 0
+	}
+	return byte('0' + resto)
+}
+
+func digitoCNPJ(base string, pesos []int) byte {
+	soma := 0
+	for i, r := range base {
+		soma += int(r-'0') * pesos[i]
+	}
+	resto := soma % 11
+	if resto < 2 {
+		return '0'
+	}
+	return byte('0' + 11 - resto)
+}
+
+func repetido(valor string) bool {
+	return strings.Count(valor, valor[:1]) == len(valor)
+}
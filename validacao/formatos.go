@@ -0,0 +1,54 @@
+package validacao
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	decimalBR = regexp.MustCompile(`^-?\d{1,3}(\.\d{3})*(,\d+)?$|^-?\d+(,\d+)?$`)
+	codigoISO = regexp.MustCompile(`^[A-Z]+$`)
+)
+
+// ParseDataBR interpreta datas no formato dd/mm/aaaa
+func ParseDataBR(valor string) (time.Time, error) {
+	data, err := time.Parse("02/01/2006", strings.TrimSpace(valor))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("data '%s' inválida, use dd/mm/aaaa", valor)
+	}
+	return data, nil
+}
+
+// ParseMesAnoBR interpreta competências no formato mm/aaaa
+func ParseMesAnoBR(valor string) (time.Time, error) {
+	data, err := time.Parse("01/2006", strings.TrimSpace(valor))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("mês '%s' inválido, use mm/aaaa", valor)
+	}
+	return data, nil
+}
+
+// ParseDecimalBR interpreta valores com vírgula decimal e ponto de milhar (ex.: 1.234,56)
+func ParseDecimalBR(valor string) (float64, error) {
+	valor = strings.TrimSpace(valor)
+	if !decimalBR.MatchString(valor) {
+		return 0, fmt.Errorf("valor '%s' inválido, use o formato 1.234,56", valor)
+	}
+
+	valor = strings.ReplaceAll(valor, ".", "")
+	valor = strings.Replace(valor, ",", ".", 1)
+	return strconv.ParseFloat(valor, 64)
+}
+
+// MoedaValida verifica um código de moeda ISO 4217
+func MoedaValida(moeda string) bool {
+	return len(moeda) == 3 && codigoISO.MatchString(moeda)
+}
+
+// PaisValido verifica um código de país ISO 3166 alfa-2
+func PaisValido(pais string) bool {
+	return len(pais) == 2 && codigoISO.MatchString(pais)
+}